@@ -2,12 +2,17 @@ package binary_plugin
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os/exec"
 	"strings"
+	"time"
 
 	"github.com/konveyor/crane-lib/transform"
+	"github.com/konveyor/crane-lib/transform/internal/pluginlimit"
+	"github.com/konveyor/crane-lib/transform/internal/pluginlog"
 	"github.com/sirupsen/logrus"
 )
 
@@ -19,19 +24,53 @@ type BinaryPlugin struct {
 	commandRunner
 	pluginMetadata transform.PluginMetadata
 	log            logrus.FieldLogger
+	// requestVersion and responseVersion are the highest versions supported
+	// by both the plugin and this library.
+	requestVersion  transform.Version
+	responseVersion transform.Version
+}
+
+// Options configures how a binary plugin is run.
+type Options struct {
+	// Streaming starts plugins advertising transform.CapabilityStreaming once
+	// and sends them every object over the streaming protocol. Other plugins
+	// still run one process per object. The plugin must be closed with Close
+	// once done.
+	Streaming bool
+	// Timeout bounds every run of the plugin, including the metadata
+	// request. In streaming mode it bounds every request and a plugin that
+	// times out is restarted. Zero means no timeout.
+	Timeout time.Duration
+	// MaxOutputBytes bounds what the plugin may write on stdout and on
+	// stderr for a single object. In streaming mode it bounds every frame
+	// and every log line instead. Zero means no limit.
+	MaxOutputBytes int64
+	// CleanEnv runs the plugin with only PATH from the environment of the
+	// caller, instead of the whole environment.
+	CleanEnv bool
+	// Env is added to the environment of the plugin, as "KEY=value".
+	Env []string
+	// IsolateWorkDir runs every plugin process in a new empty working
+	// directory, removed once the process exited.
+	IsolateWorkDir bool
 }
 
 // NewBinaryPlugin -
 func NewBinaryPlugin(path string, logger *logrus.Logger) (transform.Plugin, error) {
+	return NewBinaryPluginWithOptions(path, logger, Options{})
+}
 
-	commandRunner := &binaryRunner{pluginPath: path}
-	log := logger.WithField("pluginPath", path)
+// NewBinaryPluginWithOptions is like NewBinaryPlugin but runs the plugin as
+// configured by opts. The returned plugin is a *BinaryPlugin.
+func NewBinaryPluginWithOptions(path string, logger *logrus.Logger, opts Options) (transform.Plugin, error) {
+	commandRunner := &binaryRunner{pluginPath: path, opts: opts}
+	log := logger.WithField(pluginlog.FieldPluginPath, path)
 
 	out, errBytes, err := commandRunner.Metadata(log)
 	// TODO: Create specific error for command not being run.
 	if err != nil {
 		log.Errorf("error running the plugin metadata command")
-		return nil, fmt.Errorf("error running the plugin metadata command: %v", err)
+		return nil, fmt.Errorf("error running the plugin metadata command: %w", err)
 	}
 
 	if len(errBytes) != 0 {
@@ -46,54 +85,63 @@ func NewBinaryPlugin(path string, logger *logrus.Logger) (transform.Plugin, erro
 		return nil, fmt.Errorf("unable to decode metadata sent by the plugin: %s, err: %v", string(out), err)
 	}
 
-	// Validate version return error
-	if !contain(transform.RequestVersion, metadata.RequestVersion) || !contain(transform.ResponseVersion, metadata.ResponseVersion) {
+	requestVersion, requestOk := transform.NegotiateVersion(metadata.RequestVersion)
+	responseVersion, responseOk := transform.NegotiateVersion(metadata.ResponseVersion)
+	if !requestOk || !responseOk {
 		return nil, fmt.Errorf("invalid versions supported by plugin defined by caller responseVersions: %v, requestVersions: %v", metadata.ResponseVersion, metadata.RequestVersion)
 	}
-
-	// TODO: Validate Versions contain the versions that this wrapper can use.
-	return &BinaryPlugin{commandRunner: commandRunner, pluginMetadata: metadata, log: log}, nil
-}
-
-func contain(validVersion transform.Version, versions []transform.Version) bool {
-	for _, v := range versions {
-		if validVersion == v {
-			return true
+	log.Debugf("using request version %v and response version %v", requestVersion, responseVersion)
+
+	b := &BinaryPlugin{
+		commandRunner:   commandRunner,
+		pluginMetadata:  metadata,
+		log:             log,
+		requestVersion:  requestVersion,
+		responseVersion: responseVersion,
+	}
+	if opts.Streaming && metadata.HasCapability(transform.CapabilityStreaming) {
+		b.commandRunner = &streamRunner{
+			binaryRunner: commandRunner,
+			pluginName:   metadata.Name,
+			log:          log.WithField(pluginlog.FieldPlugin, metadata.Name),
 		}
 	}
-	return false
+	return b, nil
 }
 
 func (b *BinaryPlugin) Run(request transform.PluginRequest) (transform.PluginResponse, error) {
+	return b.RunWithContext(context.Background(), request)
+}
+
+// RunWithContext runs the plugin, killing it when ctx is done.
+func (b *BinaryPlugin) RunWithContext(ctx context.Context, request transform.PluginRequest) (transform.PluginResponse, error) {
 	p := transform.PluginResponse{}
 
-	out, logBytes, err := b.commandRunner.Run(request, b.log)
-	if err != nil {
-		b.log.Errorf("error running the plugin command")
-		return p, fmt.Errorf("error running the plugin command: %v", err)
-	}
+	log := b.log.WithFields(pluginlog.ObjectFields(b.pluginMetadata.Name, request))
+	out, logBytes, err := b.commandRunner.Run(ctx, request.ForPlugin(b.requestVersion, b.pluginMetadata), log)
+	// The logs tell why the plugin failed, so they are kept in any case.
 	if len(logBytes) != 0 {
 		logs := strings.Split(string(logBytes), "\n")
-		//TODO: we should be able to find what type of log, warning, debug, error, info and based on debug level filter them out
 		for _, line := range logs {
-			switch {
-			case strings.Contains(line, "level=info"):
-				b.log.Infof("Plugin: %v -- %v ", b.pluginMetadata.Name, line)
-			case strings.Contains(line, "level=warning"):
-				b.log.Warnf("Plugin: %v -- %v ", b.pluginMetadata.Name, line)
-			case strings.Contains(line, "level=error"):
-				b.log.Errorf("Plugin: %v -- %v ", b.pluginMetadata.Name, line)
-			case strings.Contains(line, "level=debug"):
-				b.log.Debugf("Plugin: %v -- %v ", b.pluginMetadata.Name, line)
-			}
+			pluginlog.Output(log, line)
 		}
 	}
+	if err != nil {
+		log.Errorf("error running the plugin command")
+		return p, fmt.Errorf("error running the plugin command: %w", err)
+	}
 
 	err = json.Unmarshal(out, &p)
 	if err != nil {
-		b.log.Errorf("unable to decode json sent by the plugin")
+		log.Errorf("unable to decode json sent by the plugin")
 		return p, fmt.Errorf("unable to decode object sent by the plugin: %s, err: %v", string(out), err)
 	}
+	if b.responseVersion == transform.V1 {
+		// V1 responses have no warnings, annotations or renames.
+		p.Warnings = nil
+		p.Annotations = nil
+		p.Renames = nil
+	}
 
 	return p, nil
 }
@@ -102,13 +150,22 @@ func (b *BinaryPlugin) Metadata() transform.PluginMetadata {
 	return b.pluginMetadata
 }
 
+// Close stops the plugin process when it runs in streaming mode.
+func (b *BinaryPlugin) Close() error {
+	if c, ok := b.commandRunner.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
 type commandRunner interface {
-	Run(request transform.PluginRequest, log logrus.FieldLogger) ([]byte, []byte, error)
+	Run(ctx context.Context, request transform.PluginRequest, log logrus.FieldLogger) ([]byte, []byte, error)
 	Metadata(log logrus.FieldLogger) ([]byte, []byte, error)
 }
 
 type binaryRunner struct {
 	pluginPath string
+	opts       Options
 }
 
 // Type to use for
@@ -124,50 +181,72 @@ func (e execContext) getCommand(name string, arg ...string) *exec.Cmd {
 var cliContext execContext
 
 func (b *binaryRunner) Metadata(log logrus.FieldLogger) ([]byte, []byte, error) {
-	command := cliContext.getCommand(b.pluginPath)
-
-	// set var to get the output
-	var out bytes.Buffer
-	var errorBytes bytes.Buffer
-
-	// set the output to our variable
-	command.Stdout = &out
-	command.Stdin = bytes.NewBufferString(MetadataRequest)
-	command.Stderr = &errorBytes
-	err := command.Run()
+	out, errorBytes, err := b.exec(context.Background(), []byte(MetadataRequest), log)
 	if err != nil {
-		log.Errorf("unable to run the plugin binary")
-		return nil, nil, fmt.Errorf("unable to run the plugin binary, err: %v", err)
+		return nil, nil, err
 	}
-
-	return out.Bytes(), errorBytes.Bytes(), nil
-
+	return out, errorBytes, nil
 }
 
-func (b *binaryRunner) Run(request transform.PluginRequest, log logrus.FieldLogger) ([]byte, []byte, error) {
-	unstructuredJson, err := request.MarshalJSON()
-	objMap := map[string]interface{}{}
-	json.Unmarshal(unstructuredJson, &objMap)
-	objMap["extras"] = request.Extras
-	objJson, err := json.Marshal(objMap)
+func (b *binaryRunner) Run(ctx context.Context, request transform.PluginRequest, log logrus.FieldLogger) ([]byte, []byte, error) {
+	objJson, err := json.Marshal(request)
 	if err != nil {
 		log.Errorf("unable to marshal unstructured Object")
-		return nil, nil, fmt.Errorf("unable to marshal unstructured Object: %s, err: %v", request, err)
+		return nil, nil, fmt.Errorf("unable to marshal unstructured Object: %s, err: %v", request.GetName(), err)
 	}
+	return b.exec(ctx, objJson, log)
+}
+
+// exec runs the plugin binary with input on stdin, within the limits of the
+// options, and returns its stdout and stderr.
+func (b *binaryRunner) exec(ctx context.Context, input []byte, log logrus.FieldLogger) ([]byte, []byte, error) {
 	command := cliContext.getCommand(b.pluginPath)
+	cleanup, err := b.opts.configure(command)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cleanup()
+	runCtx, cancel := pluginlimit.WithTimeout(ctx, b.opts.Timeout)
+	defer cancel()
 
 	// set var to get the output
-	var out bytes.Buffer
-	var errorBytes bytes.Buffer
+	kill := func() { command.Process.Kill() }
+	out := pluginlimit.NewBuffer(b.opts.MaxOutputBytes, kill)
+	errorBytes := pluginlimit.NewBuffer(b.opts.MaxOutputBytes, kill)
 
 	// set the output to our variable
-	command.Stdout = &out
-	command.Stdin = bytes.NewBuffer(objJson)
-	command.Stderr = &errorBytes
-	err = command.Run()
+	command.Stdout = out
+	command.Stdin = bytes.NewBuffer(input)
+	command.Stderr = errorBytes
+	if err := command.Start(); err != nil {
+		log.Errorf("unable to run the plugin binary")
+		return nil, nil, fmt.Errorf("unable to run the plugin binary, err: %v", err)
+	}
+	exited := make(chan struct{})
+	go func() {
+		select {
+		case <-runCtx.Done():
+			kill()
+		case <-exited:
+		}
+	}()
+	err = command.Wait()
+	close(exited)
 	if err != nil {
+		switch {
+		case out.Exceeded():
+			err = pluginlimit.OutputError(b.opts.MaxOutputBytes, "stdout")
+		case errorBytes.Exceeded():
+			err = pluginlimit.OutputError(b.opts.MaxOutputBytes, "stderr")
+		default:
+			if limitErr := pluginlimit.Error(ctx, runCtx, b.opts.Timeout); limitErr != nil {
+				err = limitErr
+			} else {
+				err = fmt.Errorf("unable to run the plugin binary, err: %v", err)
+			}
+		}
 		log.Errorf("unable to run the plugin binary")
-		return nil, errorBytes.Bytes(), fmt.Errorf("unable to run the plugin binary, err: %v", err)
+		return nil, errorBytes.Bytes(), err
 	}
 	return out.Bytes(), errorBytes.Bytes(), nil
 }
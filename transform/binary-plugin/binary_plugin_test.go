@@ -1,6 +1,7 @@
 package binary_plugin
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -17,9 +18,11 @@ type fakeCommandRunner struct {
 	stdout, stderr                            []byte
 	errorRunningMetadata, errorRunningCommand error
 	metadataStdout, metadataStderr            []byte
+	request                                   transform.PluginRequest
 }
 
-func (f *fakeCommandRunner) Run(_ transform.PluginRequest, _ logrus.FieldLogger) ([]byte, []byte, error) {
+func (f *fakeCommandRunner) Run(_ context.Context, request transform.PluginRequest, _ logrus.FieldLogger) ([]byte, []byte, error) {
+	f.request = request
 	return f.stdout, f.stderr, f.errorRunningCommand
 }
 
@@ -99,6 +102,37 @@ func TestShellMetadataSuccessOptionalField(t *testing.T) {
 	os.Exit(0)
 }
 
+func TestShellMetadataSuccessV2(t *testing.T) {
+	if os.Getenv("GO_TEST_PROCESS") != "1" {
+		return
+	}
+
+	var s string
+	_, err := fmt.Scanln(&s)
+	if err != nil {
+		os.Exit(1)
+	}
+
+	if s != `{}` {
+		os.Exit(1)
+	}
+
+	res, err := json.Marshal(transform.PluginMetadata{
+		Name:            "fakeShellMetadata",
+		Version:         "v1",
+		RequestVersion:  []transform.Version{transform.V1, transform.V2, transform.Version("v3")},
+		ResponseVersion: []transform.Version{transform.V1},
+	})
+
+	if err != nil {
+		fmt.Fprint(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+
+	fmt.Fprint(os.Stdout, string(res))
+	os.Exit(0)
+}
+
 func TestShellMetadataFailure(t *testing.T) {
 	if os.Getenv("GO_TEST_PROCESS") != "1" {
 		return
@@ -168,10 +202,12 @@ func TestShellMetadataInvalid(t *testing.T) {
 
 func TestNewBinaryPlugin(t *testing.T) {
 	tests := []struct {
-		name       string
-		want       transform.PluginMetadata
-		wantErr    bool
-		cliContext execContext
+		name                string
+		want                transform.PluginMetadata
+		wantRequestVersion  transform.Version
+		wantResponseVersion transform.Version
+		wantErr             bool
+		cliContext          execContext
 	}{
 		{
 			name: "ValidStdoutNoStderr",
@@ -210,6 +246,25 @@ func TestNewBinaryPlugin(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "ValidStdoutV2",
+			want: transform.PluginMetadata{
+				Name:            "fakeShellMetadata",
+				Version:         "v1",
+				RequestVersion:  []transform.Version{transform.V1, transform.V2, transform.Version("v3")},
+				ResponseVersion: []transform.Version{transform.V1},
+			},
+			cliContext: func(name string, args ...string) *exec.Cmd {
+				cs := []string{"-test.run=TestShellMetadataSuccessV2", "--", name}
+				cs = append(cs, args...)
+				cmd := exec.Command(os.Args[0], cs...)
+				cmd.Env = []string{"GO_TEST_PROCESS=1"}
+				return cmd
+			},
+			wantRequestVersion:  transform.V2,
+			wantResponseVersion: transform.V1,
+			wantErr:             false,
+		},
 		{
 			name: "InValidStdoutNoStderr",
 			cliContext: func(name string, args ...string) *exec.Cmd {
@@ -283,6 +338,14 @@ func TestNewBinaryPlugin(t *testing.T) {
 			if !reflect.DeepEqual(b.Metadata(), tt.want) {
 				t.Errorf("Metadata() got = %v, want %v", b.Metadata(), tt.want)
 			}
+			wantRequestVersion, wantResponseVersion := tt.wantRequestVersion, tt.wantResponseVersion
+			if wantRequestVersion == "" {
+				wantRequestVersion, wantResponseVersion = transform.V1, transform.V1
+			}
+			bp := b.(*BinaryPlugin)
+			if bp.requestVersion != wantRequestVersion || bp.responseVersion != wantResponseVersion {
+				t.Errorf("negotiated versions got = %v/%v, want %v/%v", bp.requestVersion, bp.responseVersion, wantRequestVersion, wantResponseVersion)
+			}
 		})
 	}
 }
@@ -342,7 +405,7 @@ func TestBinaryPlugin_Run(t *testing.T) {
 				},
 				log: logrus.New().WithField("test", tt.name),
 			}
-			got, err := b.Run(transform.PluginRequest{Unstructured:unstructured.Unstructured{}})
+			got, err := b.Run(transform.PluginRequest{Unstructured: unstructured.Unstructured{}})
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Run() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -353,3 +416,69 @@ func TestBinaryPlugin_Run(t *testing.T) {
 		})
 	}
 }
+
+func TestBinaryPlugin_RunVersions(t *testing.T) {
+	requestContext := &transform.RequestContext{
+		SourceClusterVersion: "v1.21.0",
+		TargetClusterVersion: "v1.27.0",
+		Resources: []transform.ResourceReference{
+			{APIVersion: "v1", Kind: "Pod", Namespace: "test", Name: "pod"},
+		},
+	}
+	stdout := []byte(`{"version": "v2", "warnings": ["check me"], "annotations": {"note": "value"}}`)
+	tests := []struct {
+		name            string
+		requestVersion  transform.Version
+		responseVersion transform.Version
+		wantRequest     transform.PluginRequest
+		want            transform.PluginResponse
+	}{
+		{
+			name:            "V1DropsV2Fields",
+			requestVersion:  transform.V1,
+			responseVersion: transform.V1,
+			wantRequest:     transform.PluginRequest{Extras: map[string]string{"flag": "value"}},
+			want:            transform.PluginResponse{Version: "v2"},
+		},
+		{
+			name:            "V2",
+			requestVersion:  transform.V2,
+			responseVersion: transform.V2,
+			wantRequest: transform.PluginRequest{
+				Extras:  map[string]string{"flag": "value"},
+				Version: transform.V2,
+				Context: requestContext,
+			},
+			want: transform.PluginResponse{
+				Version:     "v2",
+				Warnings:    []string{"check me"},
+				Annotations: map[string]string{"note": "value"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := &fakeCommandRunner{stdout: stdout}
+			b := &BinaryPlugin{
+				commandRunner:   runner,
+				log:             logrus.New().WithField("test", tt.name),
+				requestVersion:  tt.requestVersion,
+				responseVersion: tt.responseVersion,
+				pluginMetadata:  transform.PluginMetadata{Capabilities: []transform.Capability{transform.CapabilityResourceIndex}},
+			}
+			got, err := b.Run(transform.PluginRequest{
+				Extras:  map[string]string{"flag": "value"},
+				Context: requestContext,
+			})
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if !reflect.DeepEqual(runner.request, tt.wantRequest) {
+				t.Errorf("Run() sent request = %v, want %v", runner.request, tt.wantRequest)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Run() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
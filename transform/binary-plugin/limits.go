@@ -0,0 +1,39 @@
+package binary_plugin
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// waitDelay is how long a killed plugin gets to release its output, for
+// example when a child process still holds it.
+var waitDelay = 2 * time.Second
+
+// configure applies the environment and working directory options to cmd.
+// An environment set by the exec hook is kept and extended. The returned
+// function removes the isolated working directory once the process exited.
+func (o Options) configure(cmd *exec.Cmd) (func(), error) {
+	if o.CleanEnv || len(o.Env) > 0 {
+		env := cmd.Env
+		if env == nil && o.CleanEnv {
+			env = []string{"PATH=" + os.Getenv("PATH")}
+		} else if env == nil {
+			env = os.Environ()
+		}
+		cmd.Env = append(env, o.Env...)
+	}
+	if o.Timeout > 0 || o.MaxOutputBytes > 0 {
+		cmd.WaitDelay = waitDelay
+	}
+	if !o.IsolateWorkDir {
+		return func() {}, nil
+	}
+	dir, err := os.MkdirTemp("", "crane-plugin-")
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the plugin working directory: %v", err)
+	}
+	cmd.Dir = dir
+	return func() { os.RemoveAll(dir) }, nil
+}
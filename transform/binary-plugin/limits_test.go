@@ -0,0 +1,281 @@
+package binary_plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/konveyor/crane-lib/transform"
+	transformerrors "github.com/konveyor/crane-lib/transform/errors"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// TestShellLimitsPlugin misbehaves as told by MODE, otherwise it reports its
+// working directory and the EXTRA variable as warnings.
+func TestShellLimitsPlugin(t *testing.T) {
+	if os.Getenv("GO_TEST_PROCESS") != "1" {
+		return
+	}
+	m := map[string]interface{}{}
+	if err := json.NewDecoder(os.Stdin).Decode(&m); err != nil {
+		os.Exit(1)
+	}
+	if len(m) == 0 {
+		json.NewEncoder(os.Stdout).Encode(transform.PluginMetadata{
+			Name:            "limits",
+			Version:         "v1",
+			RequestVersion:  []transform.Version{transform.V2},
+			ResponseVersion: []transform.Version{transform.V2},
+		})
+		os.Exit(0)
+	}
+	switch os.Getenv("MODE") {
+	case "sleep":
+		time.Sleep(time.Minute)
+	case "stdout":
+		os.Stdout.Write(bytes.Repeat([]byte(" "), 1<<20))
+	case "stderr":
+		os.Stderr.Write(bytes.Repeat([]byte("a"), 1<<20))
+	}
+	wd, _ := os.Getwd()
+	json.NewEncoder(os.Stdout).Encode(transform.PluginResponse{
+		Version:  "v2",
+		Warnings: []string{wd, os.Getenv("EXTRA")},
+	})
+	os.Exit(0)
+}
+
+func limitsContext(test, mode string) execContext {
+	return func(name string, args ...string) *exec.Cmd {
+		cs := []string{"-test.run=" + test, "--", name}
+		cmd := exec.Command(os.Args[0], append(cs, args...)...)
+		cmd.Env = []string{"GO_TEST_PROCESS=1", "MODE=" + mode}
+		return cmd
+	}
+}
+
+func limitsRequest(name string) transform.PluginRequest {
+	u := unstructured.Unstructured{}
+	u.SetAPIVersion("v1")
+	u.SetKind("Pod")
+	u.SetName(name)
+	return transform.PluginRequest{Unstructured: u}
+}
+
+func TestBinaryPluginLimits(t *testing.T) {
+	defer func() { cliContext = nil }()
+	cases := []struct {
+		name    string
+		mode    string
+		opts    Options
+		ctx     func() (context.Context, context.CancelFunc)
+		wantErr func(error) bool
+	}{
+		{
+			name:    "Timeout",
+			mode:    "sleep",
+			opts:    Options{Timeout: 2 * time.Second},
+			wantErr: transformerrors.IsTimeoutError,
+		},
+		{
+			name: "Cancelled",
+			mode: "sleep",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 2*time.Second)
+			},
+			wantErr: func(err error) bool { return errors.Is(err, context.DeadlineExceeded) },
+		},
+		{
+			name:    "StdoutLimit",
+			mode:    "stdout",
+			opts:    Options{MaxOutputBytes: 1024},
+			wantErr: transformerrors.IsOutputLimitError,
+		},
+		{
+			name:    "StderrLimit",
+			mode:    "stderr",
+			opts:    Options{MaxOutputBytes: 1024},
+			wantErr: transformerrors.IsOutputLimitError,
+		},
+		{
+			name: "WithinLimits",
+			opts: Options{Timeout: time.Minute, MaxOutputBytes: 1024},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cliContext = limitsContext("TestShellLimitsPlugin", c.mode)
+			plugin, err := NewBinaryPluginWithOptions("limits", logrus.New(), c.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := context.Background(), func() {}
+			if c.ctx != nil {
+				ctx, cancel = c.ctx()
+			}
+			defer cancel()
+			start := time.Now()
+			_, err = plugin.(*BinaryPlugin).RunWithContext(ctx, limitsRequest("pod"))
+			if time.Since(start) > 10*time.Second {
+				t.Errorf("plugin was not stopped, ran for %v", time.Since(start))
+			}
+			if c.wantErr == nil {
+				if err != nil {
+					t.Errorf("RunWithContext() error = %v", err)
+				}
+				return
+			}
+			if !c.wantErr(err) {
+				t.Errorf("RunWithContext() got unexpected error %v", err)
+			}
+		})
+	}
+}
+
+func TestBinaryPluginLimitsReportedByRunner(t *testing.T) {
+	defer func() { cliContext = nil }()
+	cliContext = limitsContext("TestShellLimitsPlugin", "sleep")
+	plugin, err := NewBinaryPluginWithOptions("limits", logrus.New(), Options{Timeout: 2 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = transform.NewRunner(logrus.New(), nil, nil).Run(limitsRequest("stuck").Unstructured, []transform.Plugin{plugin})
+	objErr := &transformerrors.ObjectError{}
+	if !errors.As(err, &objErr) || objErr.Plugin != "limits" || objErr.Name != "stuck" {
+		t.Fatalf("expected an error for plugin limits on object stuck, got %v", err)
+	}
+	if !transformerrors.IsTimeoutError(err) {
+		t.Errorf("expected a timeout error, got %v", err)
+	}
+}
+
+func TestBinaryPluginIsolation(t *testing.T) {
+	defer func() { cliContext = nil }()
+	cliContext = limitsContext("TestShellLimitsPlugin", "")
+	plugin, err := NewBinaryPluginWithOptions("limits", logrus.New(), Options{
+		IsolateWorkDir: true,
+		Env:            []string{"EXTRA=value"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := plugin.Run(limitsRequest("pod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, _ := os.Getwd()
+	if resp.Warnings[0] == wd {
+		t.Errorf("plugin ran in the working directory of the caller")
+	}
+	if _, err := os.Stat(resp.Warnings[0]); !os.IsNotExist(err) {
+		t.Errorf("expected the plugin working directory %v to be removed, got %v", resp.Warnings[0], err)
+	}
+	if resp.Warnings[1] != "value" {
+		t.Errorf("expected EXTRA to be passed to the plugin, got %q", resp.Warnings[1])
+	}
+}
+
+func TestOptionsConfigureEnv(t *testing.T) {
+	t.Setenv("CRANE_TEST_SECRET", "secret")
+	cases := []struct {
+		name string
+		opts Options
+		env  []string
+	}{
+		{
+			name: "Inherited",
+			opts: Options{},
+		},
+		{
+			name: "Clean",
+			opts: Options{CleanEnv: true, Env: []string{"A=b"}},
+			env:  []string{"PATH=" + os.Getenv("PATH"), "A=b"},
+		},
+		{
+			name: "Extended",
+			opts: Options{Env: []string{"A=b"}},
+			env:  append(os.Environ(), "A=b"),
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cmd := exec.Command("plugin")
+			cleanup, err := c.opts.configure(cmd)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cleanup()
+			if !reflect.DeepEqual(cmd.Env, c.env) {
+				t.Errorf("got environment %v, want %v", cmd.Env, c.env)
+			}
+		})
+	}
+}
+
+func TestBinaryPluginStreamingTimeout(t *testing.T) {
+	defer func() { cliContext = nil }()
+	context, started := countingContext("TestShellStreamPlugin")
+	cliContext = context
+	plugin, err := NewBinaryPluginWithOptions("stream", logrus.New(), Options{Streaming: true, Timeout: 2 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plugin.(*BinaryPlugin).Close()
+	if _, err := plugin.Run(limitsRequest("sleep")); !transformerrors.IsTimeoutError(err) {
+		t.Errorf("expected a timeout error, got %v", err)
+	}
+	// The stuck plugin is replaced.
+	if _, err := plugin.Run(limitsRequest("a")); err != nil {
+		t.Errorf("Run() error = %v", err)
+	}
+	if *started != 3 {
+		t.Errorf("expected 3 processes, got %d", *started)
+	}
+}
+
+// TestBinaryPluginStreamingBlockedWrite sends a request the plugin does not
+// read, as it is busy with another one.
+func TestBinaryPluginStreamingBlockedWrite(t *testing.T) {
+	defer func() { cliContext = nil }()
+	defer func(timeout time.Duration) { streamShutdownTimeout = timeout }(streamShutdownTimeout)
+	streamShutdownTimeout = 100 * time.Millisecond
+	pluginContext, _ := countingContext("TestShellStreamPlugin")
+	cliContext = pluginContext
+	plugin, err := NewBinaryPluginWithOptions("stream", logrus.New(), Options{Streaming: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plugin.(*BinaryPlugin).Close()
+
+	sleepCtx, cancelSleep := context.WithCancel(context.Background())
+	defer cancelSleep()
+	go plugin.(*BinaryPlugin).RunWithContext(sleepCtx, limitsRequest("sleep"))
+	time.Sleep(time.Second)
+
+	// The request does not fit in the pipe to the plugin.
+	large := limitsRequest("large")
+	large.SetAnnotations(map[string]string{"data": strings.Repeat("a", 1<<20)})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := plugin.(*BinaryPlugin).RunWithContext(ctx, large)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected the deadline to be exceeded, got %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Run() is blocked writing to the plugin")
+	}
+}
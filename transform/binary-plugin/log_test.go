@@ -0,0 +1,51 @@
+package binary_plugin
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/konveyor/crane-lib/transform"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestBinaryPluginRunLogs(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	b := &BinaryPlugin{
+		commandRunner: &fakeCommandRunner{
+			stderr:              []byte("{\"level\": \"error\", \"message\": \"no route\"}\n\n"),
+			errorRunningCommand: errors.New("exit status 1"),
+		},
+		pluginMetadata:  transform.PluginMetadata{Name: "test"},
+		log:             logger.WithField("pluginPath", "/test"),
+		requestVersion:  transform.V1,
+		responseVersion: transform.V1,
+	}
+	request := transform.PluginRequest{Unstructured: unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "route.openshift.io/v1",
+		"kind":       "Route",
+		"metadata": map[string]interface{}{
+			"name":      "foo",
+			"namespace": "bar",
+		},
+	}}}
+	if _, err := b.Run(request); err == nil {
+		t.Fatalf("Run() expected an error")
+	}
+	entries := hook.AllEntries()
+	if len(entries) == 0 || entries[0].Message != "no route" {
+		t.Fatalf("Run() did not log the plugin output before failing: %v", entries)
+	}
+	want := logrus.Fields{
+		"pluginPath": "/test",
+		"plugin":     "test",
+		"kind":       "Route.route.openshift.io",
+		"namespace":  "bar",
+		"name":       "foo",
+	}
+	if !reflect.DeepEqual(entries[0].Data, want) {
+		t.Errorf("Run() logged fields %v, want %v", entries[0].Data, want)
+	}
+}
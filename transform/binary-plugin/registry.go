@@ -0,0 +1,166 @@
+package binary_plugin
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/konveyor/crane-lib/transform"
+	"github.com/sirupsen/logrus"
+)
+
+// LoadError is a file in a plugin directory that could not be loaded as a
+// plugin.
+type LoadError struct {
+	Path string
+	Err  error
+}
+
+func (e *LoadError) Error() string {
+	return fmt.Sprintf("unable to load plugin %s: %v", e.Path, e.Err)
+}
+
+func (e *LoadError) Unwrap() error {
+	return e.Err
+}
+
+// DiscoveryError lists every plugin that could not be loaded.
+type DiscoveryError struct {
+	Errors []*LoadError
+}
+
+func (e *DiscoveryError) Error() string {
+	msgs := []string{}
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("%d plugin(s) failed to load: %s", len(e.Errors), strings.Join(msgs, "; "))
+}
+
+func (e *DiscoveryError) Unwrap() []error {
+	errs := []error{}
+	for _, err := range e.Errors {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// Registry holds the binary plugins found in plugin directories.
+type Registry struct {
+	plugins []transform.Plugin
+	paths   map[string]string
+}
+
+// Discover loads every executable file in dirs as a binary plugin, skipping
+// hidden files and directories that do not exist. Plugins are identified by
+// their metadata name: when two files share a name the first one found, in
+// the order of dirs then of file names, is kept. The returned registry holds
+// every plugin that loaded; the others are reported in a *DiscoveryError.
+func Discover(dirs []string, logger *logrus.Logger, opts Options) (*Registry, error) {
+	r := &Registry{paths: map[string]string{}}
+	loadErrs := []*LoadError{}
+	for _, dir := range dirs {
+		paths, err := pluginPaths(dir)
+		if err != nil {
+			loadErrs = append(loadErrs, &LoadError{Path: dir, Err: err})
+			continue
+		}
+		for _, path := range paths {
+			plugin, err := NewBinaryPluginWithOptions(path, logger, opts)
+			if err != nil {
+				loadErrs = append(loadErrs, &LoadError{Path: path, Err: err})
+				continue
+			}
+			name := plugin.Metadata().Name
+			if previous, ok := r.paths[name]; ok {
+				plugin.(*BinaryPlugin).Close()
+				loadErrs = append(loadErrs, &LoadError{
+					Path: path,
+					Err:  fmt.Errorf("duplicate plugin name %q, already loaded from %s", name, previous),
+				})
+				continue
+			}
+			logger.Debugf("loaded plugin %v from %v", name, path)
+			r.paths[name] = path
+			r.plugins = append(r.plugins, plugin)
+		}
+	}
+	sort.SliceStable(r.plugins, func(i, j int) bool {
+		return r.plugins[i].Metadata().Name < r.plugins[j].Metadata().Name
+	})
+
+	if len(loadErrs) > 0 {
+		return r, &DiscoveryError{Errors: loadErrs}
+	}
+	return r, nil
+}
+
+// pluginPaths returns the executable files of dir sorted by name.
+func pluginPaths(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	paths := []string{}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		// Stat follows symlinks, which are commonly used to install plugins.
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() || info.Mode().Perm()&0111 == 0 {
+			continue
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// Plugins returns the loaded plugins sorted by name.
+func (r *Registry) Plugins() []transform.Plugin {
+	return r.plugins
+}
+
+// Path returns the file the named plugin was loaded from.
+func (r *Registry) Path(name string) (string, bool) {
+	path, ok := r.paths[name]
+	return path, ok
+}
+
+// OptionalFields returns the optional fields of every plugin, in plugin
+// order. A flag declared by several plugins is listed once; see
+// transform.ScopedFlagName to set it for a single plugin.
+func (r *Registry) OptionalFields() []transform.OptionalFields {
+	fields := []transform.OptionalFields{}
+	seen := map[string]bool{}
+	for _, plugin := range r.plugins {
+		for _, field := range plugin.Metadata().OptionalFields {
+			if seen[field.FlagName] {
+				continue
+			}
+			seen[field.FlagName] = true
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// Close stops the plugins running in streaming mode.
+func (r *Registry) Close() error {
+	var firstErr error
+	for _, plugin := range r.plugins {
+		if c, ok := plugin.(io.Closer); ok {
+			if err := c.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
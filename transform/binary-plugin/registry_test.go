@@ -0,0 +1,120 @@
+package binary_plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/konveyor/crane-lib/transform"
+	"github.com/sirupsen/logrus"
+)
+
+// TestShellRegistryPlugin answers the metadata request with the name and
+// flags given in its environment.
+func TestShellRegistryPlugin(t *testing.T) {
+	if os.Getenv("GO_TEST_PROCESS") != "1" {
+		return
+	}
+	name := os.Getenv("PLUGIN_NAME")
+	if name == "" {
+		fmt.Fprint(os.Stderr, "broken plugin")
+		os.Exit(1)
+	}
+	fields := []transform.OptionalFields{}
+	for _, flag := range strings.Fields(os.Getenv("PLUGIN_FLAGS")) {
+		fields = append(fields, transform.OptionalFields{FlagName: flag, Help: name + " " + flag})
+	}
+	json.NewEncoder(os.Stdout).Encode(transform.PluginMetadata{
+		Name:            name,
+		Version:         "v1",
+		RequestVersion:  []transform.Version{transform.V1},
+		ResponseVersion: []transform.Version{transform.V1},
+		OptionalFields:  fields,
+	})
+	os.Exit(0)
+}
+
+func TestDiscover(t *testing.T) {
+	defer func() { cliContext = nil }()
+	// The environment of every plugin file, by file name.
+	pluginEnv := map[string][]string{
+		"z-first":   {"PLUGIN_NAME=zeta", "PLUGIN_FLAGS=shared z-flag"},
+		"a-second":  {"PLUGIN_NAME=alpha", "PLUGIN_FLAGS=a-flag shared"},
+		"duplicate": {"PLUGIN_NAME=alpha"},
+		"broken":    {},
+	}
+	cliContext = func(name string, args ...string) *exec.Cmd {
+		cs := []string{"-test.run=TestShellRegistryPlugin", "--", name}
+		cmd := exec.Command(os.Args[0], append(cs, args...)...)
+		cmd.Env = append([]string{"GO_TEST_PROCESS=1"}, pluginEnv[filepath.Base(name)]...)
+		return cmd
+	}
+
+	first, second := t.TempDir(), t.TempDir()
+	files := []struct {
+		dir, name string
+		mode      os.FileMode
+	}{
+		{first, "z-first", 0755},
+		{first, "a-second", 0755},
+		{first, "README.md", 0644},
+		{first, ".hidden", 0755},
+		{second, "duplicate", 0755},
+		{second, "broken", 0755},
+	}
+	for _, f := range files {
+		if err := os.WriteFile(filepath.Join(f.dir, f.name), []byte("#!/bin/sh\n"), f.mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(first, "subdir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	registry, err := Discover([]string{first, second, filepath.Join(first, "missing")}, logrus.New(), Options{})
+
+	discoveryErr := &DiscoveryError{}
+	if !errors.As(err, &discoveryErr) {
+		t.Fatalf("expected a *DiscoveryError, got %v", err)
+	}
+	failed := []string{}
+	for _, loadErr := range discoveryErr.Errors {
+		failed = append(failed, filepath.Base(loadErr.Path))
+	}
+	// Files are loaded in name order.
+	if !reflect.DeepEqual(failed, []string{"broken", "duplicate"}) {
+		t.Errorf("expected broken and duplicate to fail, got %v", err)
+	}
+	if !strings.Contains(discoveryErr.Errors[1].Error(), `duplicate plugin name "alpha"`) {
+		t.Errorf("unexpected duplicate error: %v", discoveryErr.Errors[1])
+	}
+
+	names := []string{}
+	for _, plugin := range registry.Plugins() {
+		names = append(names, plugin.Metadata().Name)
+	}
+	if !reflect.DeepEqual(names, []string{"alpha", "zeta"}) {
+		t.Errorf("expected plugins alpha and zeta, got %v", names)
+	}
+	if path, _ := registry.Path("alpha"); path != filepath.Join(first, "a-second") {
+		t.Errorf("expected alpha to be loaded from the first directory, got %v", path)
+	}
+
+	wantFields := []transform.OptionalFields{
+		{FlagName: "a-flag", Help: "alpha a-flag"},
+		{FlagName: "shared", Help: "alpha shared"},
+		{FlagName: "z-flag", Help: "zeta z-flag"},
+	}
+	if !reflect.DeepEqual(registry.OptionalFields(), wantFields) {
+		t.Errorf("OptionalFields() got = %v, want %v", registry.OptionalFields(), wantFields)
+	}
+	if err := registry.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+}
@@ -0,0 +1,396 @@
+package binary_plugin
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/konveyor/crane-lib/transform"
+	"github.com/konveyor/crane-lib/transform/internal/pluginlimit"
+	"github.com/konveyor/crane-lib/transform/internal/pluginlog"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// streamStartTimeout bounds the health check of a newly started plugin.
+	streamStartTimeout = 10 * time.Second
+	// streamShutdownTimeout is how long a plugin gets to exit after a
+	// shutdown frame before it is killed.
+	streamShutdownTimeout = 5 * time.Second
+)
+
+// streamLogFrames is how many of the last requests keep their log. The
+// plugin's logs of a request may be read after its reply.
+const streamLogFrames = 1024
+
+// streamRunner runs a plugin as a single long-running process speaking the
+// streaming protocol, see transform.StreamFrame. The process is started on
+// the first request and restarted if it exits. If it cannot be started in
+// streaming mode, the runner falls back to one process per object.
+type streamRunner struct {
+	*binaryRunner
+	pluginName string
+	// log is used for the logs of the plugin, which are not tied to an
+	// object.
+	log logrus.FieldLogger
+
+	mu       sync.Mutex
+	stream   *pluginStream
+	fallback bool
+	closed   bool
+}
+
+func (s *streamRunner) Run(ctx context.Context, request transform.PluginRequest, log logrus.FieldLogger) ([]byte, []byte, error) {
+	stream, err := s.getStream(log)
+	if err != nil {
+		return nil, nil, err
+	}
+	if stream == nil {
+		return s.binaryRunner.Run(ctx, request, log)
+	}
+
+	callCtx, cancel := pluginlimit.WithTimeout(ctx, s.opts.Timeout)
+	defer cancel()
+	reply, err := stream.call(callCtx, transform.StreamFrame{Type: transform.StreamFrameRequest, Request: &request}, log)
+	if err != nil {
+		if limitErr := pluginlimit.Error(ctx, callCtx, s.opts.Timeout); limitErr != nil {
+			if ctx.Err() == nil {
+				// The plugin may be stuck, the next request restarts it.
+				log.Warnf("plugin %v timed out, stopping it", s.pluginName)
+				stream.kill()
+			}
+			return nil, nil, limitErr
+		}
+		log.Errorf("unable to run the plugin stream")
+		return nil, nil, fmt.Errorf("unable to run the plugin stream, err: %w", err)
+	}
+	switch {
+	case reply.Type == transform.StreamFrameResponse && reply.Response != nil:
+		out, err := json.Marshal(reply.Response)
+		return out, nil, err
+	case reply.Type == transform.StreamFrameError && reply.Error != nil:
+		return nil, nil, reply.Error
+	default:
+		return nil, nil, fmt.Errorf("unexpected %v frame sent by the plugin for request %v", reply.Type, reply.ID)
+	}
+}
+
+// getStream returns the running plugin process, starting it if needed. It
+// returns nil if the plugin must be run one process per object.
+func (s *streamRunner) getStream(log logrus.FieldLogger) (*pluginStream, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, fmt.Errorf("plugin %v is closed", s.pluginName)
+	}
+	if s.fallback {
+		return nil, nil
+	}
+	if s.stream != nil {
+		select {
+		case <-s.stream.done:
+			log.Warnf("plugin %v exited: %v, restarting it", s.pluginName, s.stream.err)
+		default:
+			return s.stream, nil
+		}
+	}
+
+	stream, err := startStream(s.pluginPath, s.pluginName, s.opts, s.log)
+	if err != nil {
+		log.Warnf("unable to run plugin %v in streaming mode, running one process per object: %v", s.pluginName, err)
+		s.fallback = true
+		return nil, nil
+	}
+	s.stream = stream
+	return stream, nil
+}
+
+// Close shuts the plugin process down.
+func (s *streamRunner) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	if s.stream == nil {
+		return nil
+	}
+	return s.stream.close()
+}
+
+// pluginStream is a running plugin process. Requests can be sent
+// concurrently, replies are matched to them by ID.
+type pluginStream struct {
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	cleanup func()
+
+	writeMu sync.Mutex
+	// objects are the objects of the export sent last, guarded by writeMu.
+	objects transform.StreamObjects
+	mu      sync.Mutex
+	nextID  uint64
+	pending map[uint64]chan transform.StreamFrame
+	// logs are the logs of the last requests, by frame ID.
+	logs map[uint64]logrus.FieldLogger
+
+	// done is closed once the process exited, err tells why and waitErr is
+	// the exit status.
+	done    chan struct{}
+	err     error
+	waitErr error
+}
+
+func startStream(path, pluginName string, opts Options, log logrus.FieldLogger) (*pluginStream, error) {
+	cmd := cliContext.getCommand(path)
+	cleanup, err := opts.configure(cmd)
+	if err != nil {
+		return nil, err
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		cleanup()
+		return nil, fmt.Errorf("unable to start the plugin binary, err: %v", err)
+	}
+
+	p := &pluginStream{
+		cmd:     cmd,
+		stdin:   stdin,
+		cleanup: cleanup,
+		pending: map[uint64]chan transform.StreamFrame{},
+		logs:    map[uint64]logrus.FieldLogger{},
+		done:    make(chan struct{}),
+	}
+	stderrDone := make(chan struct{})
+	go func() {
+		defer close(stderrDone)
+		scanner := bufio.NewScanner(stderr)
+		if opts.MaxOutputBytes > 0 {
+			scanner.Buffer(nil, int(opts.MaxOutputBytes))
+		}
+		for scanner.Scan() {
+			pluginlog.Output(p.frameLog(scanner.Text(), log), scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			log.Warnf("plugin %v: dropping the rest of its logs: %v", pluginName, err)
+			io.Copy(io.Discard, stderr)
+		}
+	}()
+	go p.readFrames(stdout, opts.MaxOutputBytes, stderrDone)
+
+	if _, err := io.WriteString(stdin, transform.StreamRequest+"\n"); err != nil {
+		p.kill()
+		return nil, fmt.Errorf("unable to write the stream request, err: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), streamStartTimeout)
+	defer cancel()
+	reply, err := p.call(ctx, transform.StreamFrame{Type: transform.StreamFrameHealth}, nil)
+	if err == nil && reply.Type != transform.StreamFrameHealth {
+		err = fmt.Errorf("unexpected %v frame in reply to health check", reply.Type)
+	}
+	if err != nil {
+		p.kill()
+		return nil, fmt.Errorf("plugin failed the health check: %v", err)
+	}
+	return p, nil
+}
+
+// readFrames hands every frame sent by the plugin to the request waiting for
+// it until the plugin closes its stdout, then waits for the process to exit.
+// A frame larger than maxFrameBytes stops the plugin.
+func (p *pluginStream) readFrames(stdout io.Reader, maxFrameBytes int64, stderrDone <-chan struct{}) {
+	reader := bufio.NewReader(stdout)
+	var err error
+	for {
+		var line []byte
+		if line, err = readLine(reader, maxFrameBytes); err != nil {
+			break
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		frame := transform.StreamFrame{}
+		if err = json.Unmarshal(line, &frame); err != nil {
+			err = fmt.Errorf("unable to decode frame sent by the plugin: %v", err)
+			break
+		}
+		p.mu.Lock()
+		reply, ok := p.pending[frame.ID]
+		delete(p.pending, frame.ID)
+		p.mu.Unlock()
+		if ok {
+			reply <- frame
+		}
+	}
+	if err == io.EOF {
+		err = fmt.Errorf("plugin closed its output")
+	} else {
+		// Stop the plugin rather than leave it blocked on a full pipe.
+		p.cmd.Process.Kill()
+	}
+	// The pipes must be drained before waiting for the process.
+	io.Copy(io.Discard, reader)
+	<-stderrDone
+	p.waitErr = p.cmd.Wait()
+	p.cleanup()
+	if p.waitErr != nil {
+		err = fmt.Errorf("%w: %v", err, p.waitErr)
+	}
+	p.err = err
+	close(p.done)
+}
+
+// readLine reads a line of at most max bytes, zero means no limit.
+func readLine(reader *bufio.Reader, max int64) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		line = append(line, chunk...)
+		if max > 0 && int64(len(line)) > max {
+			return nil, pluginlimit.OutputError(max, "stream frame")
+		}
+		if err != bufio.ErrBufferFull {
+			return line, err
+		}
+	}
+}
+
+// call sends frame with a new ID and waits for the reply. The logs of the
+// plugin for the frame go to log, if not nil.
+func (p *pluginStream) call(ctx context.Context, frame transform.StreamFrame, log logrus.FieldLogger) (transform.StreamFrame, error) {
+	reply := make(chan transform.StreamFrame, 1)
+	p.mu.Lock()
+	p.nextID++
+	frame.ID = p.nextID
+	p.pending[frame.ID] = reply
+	if log != nil {
+		p.logs[frame.ID] = log
+	}
+	delete(p.logs, frame.ID-streamLogFrames)
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.pending, frame.ID)
+		p.mu.Unlock()
+	}()
+
+	if err := p.send(ctx, frame); err != nil {
+		return transform.StreamFrame{}, err
+	}
+	select {
+	case r := <-reply:
+		return r, nil
+	case <-p.done:
+		select {
+		case r := <-reply:
+			return r, nil
+		default:
+			return transform.StreamFrame{}, p.err
+		}
+	case <-ctx.Done():
+		return transform.StreamFrame{}, ctx.Err()
+	}
+}
+
+// send writes frame, giving up when ctx is done. A frame given up on while
+// being written leaves the plugin with a partial frame, so its stdin is
+// closed and the plugin restarted by the next request.
+func (p *pluginStream) send(ctx context.Context, frame transform.StreamFrame) error {
+	// state is 0 until the frame is written or given up on, 1 while it is
+	// written and 2 once given up on.
+	var state int32
+	written := make(chan error, 1)
+	go func() {
+		p.writeMu.Lock()
+		defer p.writeMu.Unlock()
+		if !atomic.CompareAndSwapInt32(&state, 0, 1) {
+			return
+		}
+		written <- p.write(frame)
+	}()
+	select {
+	case err := <-written:
+		return err
+	case <-ctx.Done():
+	}
+	if !atomic.CompareAndSwapInt32(&state, 0, 2) {
+		select {
+		case err := <-written:
+			return err
+		default:
+			p.stdin.Close()
+		}
+	}
+	return ctx.Err()
+}
+
+// write writes frame, preceded by the objects of the export of its request if
+// the plugin does not have them yet. writeMu must be held.
+func (p *pluginStream) write(frame transform.StreamFrame) error {
+	for _, f := range p.objects.Frames(frame) {
+		b, err := json.Marshal(f)
+		if err != nil {
+			return fmt.Errorf("unable to marshal stream frame: %v", err)
+		}
+		if _, err := p.stdin.Write(append(b, '\n')); err != nil {
+			return fmt.Errorf("unable to write to the plugin: %v", err)
+		}
+	}
+	return nil
+}
+
+// close asks the plugin to shut down, and kills it if it does not exit in
+// time.
+func (p *pluginStream) close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), streamShutdownTimeout)
+	defer cancel()
+	p.send(ctx, transform.StreamFrame{Type: transform.StreamFrameShutdown})
+	p.stdin.Close()
+	select {
+	case <-p.done:
+		return p.waitErr
+	case <-ctx.Done():
+		p.kill()
+		return fmt.Errorf("plugin did not exit within %v and was killed", streamShutdownTimeout)
+	}
+}
+
+// frameLog returns the log of the request the plugin logged line for, or log
+// if the line is not tied to a request.
+func (p *pluginStream) frameLog(line string, log logrus.FieldLogger) logrus.FieldLogger {
+	id, ok := pluginlog.StreamFrame(line)
+	if !ok {
+		return log
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if frameLog, ok := p.logs[id]; ok {
+		return frameLog
+	}
+	return log
+}
+
+func (p *pluginStream) kill() {
+	p.stdin.Close()
+	p.cmd.Process.Kill()
+	<-p.done
+}
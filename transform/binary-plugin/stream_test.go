@@ -0,0 +1,334 @@
+package binary_plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/konveyor/crane-lib/transform"
+	"github.com/konveyor/crane-lib/transform/cli"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+type noStreamingPlugin struct {
+	transform.Plugin
+}
+
+func (n noStreamingPlugin) Metadata() transform.PluginMetadata {
+	m := n.Plugin.Metadata()
+	m.Capabilities = nil
+	return m
+}
+
+// TestShellStreamPlugin is a plugin built with the cli package, it reports
+// its process ID as a warning.
+func TestShellStreamPlugin(t *testing.T) {
+	if os.Getenv("GO_TEST_PROCESS") != "1" {
+		return
+	}
+	var plugin transform.Plugin = cli.NewCustomPlugin("fakeStreamPlugin", "v1", nil, func(request transform.PluginRequest) (transform.PluginResponse, error) {
+		switch request.GetName() {
+		case "exit":
+			os.Exit(3)
+		case "sleep":
+			time.Sleep(time.Minute)
+		case "log":
+			cli.Logger().Infof("running %s", request.GetName())
+		}
+		return transform.PluginResponse{
+			Version:  "v1",
+			Warnings: []string{fmt.Sprintf("%s %d", request.GetName(), os.Getpid())},
+		}, nil
+	})
+	if os.Getenv("NO_STREAMING") == "1" {
+		plugin = noStreamingPlugin{plugin}
+	}
+	cli.RunAndExit(plugin)
+	os.Exit(0)
+}
+
+// TestShellIndexStreamPlugin is a plugin built with the cli package that
+// looks at the objects of the export. It reports how many there are and
+// where they are in its memory, which tells whether they were received once.
+func TestShellIndexStreamPlugin(t *testing.T) {
+	if os.Getenv("GO_TEST_PROCESS") != "1" {
+		return
+	}
+	cli.RunAndExit(cli.NewCustomPlugin("fakeIndexStreamPlugin", "v1", nil, func(request transform.PluginRequest) (transform.PluginResponse, error) {
+		objects := request.Context.Objects
+		warning := fmt.Sprintf("%d", request.Context.Index().Len())
+		if len(objects) > 0 {
+			warning += fmt.Sprintf(" %p", &objects[0])
+		}
+		return transform.PluginResponse{Version: "v2", Warnings: []string{warning}}, nil
+	}, transform.CapabilityResourceIndex))
+	os.Exit(0)
+}
+
+// TestShellBrokenStreamPlugin advertises streaming but exits when asked to
+// stream.
+func TestShellBrokenStreamPlugin(t *testing.T) {
+	if os.Getenv("GO_TEST_PROCESS") != "1" {
+		return
+	}
+	m := map[string]interface{}{}
+	if err := json.NewDecoder(os.Stdin).Decode(&m); err != nil {
+		os.Exit(1)
+	}
+	switch {
+	case len(m) == 0:
+		json.NewEncoder(os.Stdout).Encode(transform.PluginMetadata{
+			Name:            "fakeBrokenStreamPlugin",
+			Version:         "v1",
+			RequestVersion:  []transform.Version{transform.V1, transform.V2},
+			ResponseVersion: []transform.Version{transform.V1, transform.V2},
+			Capabilities:    []transform.Capability{transform.CapabilityStreaming},
+		})
+	case m[transform.StreamVersionKey] != nil:
+		os.Exit(1)
+	default:
+		fmt.Fprintf(os.Stdout, `{"version": "v2", "warnings": ["%d"]}`, os.Getpid())
+	}
+	os.Exit(0)
+}
+
+func countingContext(test string, env ...string) (execContext, *int32) {
+	started := int32(0)
+	return func(name string, args ...string) *exec.Cmd {
+		atomic.AddInt32(&started, 1)
+		cs := []string{"-test.run=" + test, "--", name}
+		cs = append(cs, args...)
+		cmd := exec.Command(os.Args[0], cs...)
+		cmd.Env = append([]string{"GO_TEST_PROCESS=1"}, env...)
+		return cmd
+	}, &started
+}
+
+func runObjects(t *testing.T, plugin transform.Plugin, names ...string) []transform.PluginResponse {
+	responses := make([]transform.PluginResponse, len(names))
+	errs := make([]error, len(names))
+	wg := sync.WaitGroup{}
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			u := unstructured.Unstructured{}
+			u.SetAPIVersion("v1")
+			u.SetKind("Pod")
+			u.SetName(name)
+			responses[i], errs[i] = plugin.Run(transform.PluginRequest{Unstructured: u})
+		}(i, name)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("%s: Run() error = %v", names[i], err)
+		}
+	}
+	return responses
+}
+
+func TestBinaryPluginStreaming(t *testing.T) {
+	defer func() { cliContext = nil }()
+	names := []string{"a", "b", "c", "d", "e"}
+	pids := func(t *testing.T, responses []transform.PluginResponse) map[string]bool {
+		seen := map[string]bool{}
+		for i, resp := range responses {
+			var name, pid string
+			if len(resp.Warnings) != 1 {
+				t.Fatalf("%s: unexpected response %+v", names[i], resp)
+			}
+			fmt.Sscan(resp.Warnings[0], &name, &pid)
+			if name != names[i] {
+				t.Errorf("got response for %s, want %s", name, names[i])
+			}
+			seen[pid] = true
+		}
+		return seen
+	}
+
+	t.Run("SingleProcess", func(t *testing.T) {
+		context, started := countingContext("TestShellStreamPlugin")
+		cliContext = context
+		plugin, err := NewBinaryPluginWithOptions("stream", logrus.New(), Options{Streaming: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seen := pids(t, runObjects(t, plugin, names...)); len(seen) != 1 {
+			t.Errorf("expected a single plugin process, got %v", seen)
+		}
+		if err := plugin.(*BinaryPlugin).Close(); err != nil {
+			t.Errorf("Close() error = %v", err)
+		}
+		// One process for the metadata and one for the stream.
+		if *started != 2 {
+			t.Errorf("expected 2 processes, got %d", *started)
+		}
+		if _, err := plugin.Run(transform.PluginRequest{}); err == nil {
+			t.Errorf("expected an error running a closed plugin")
+		}
+	})
+
+	t.Run("NotRequested", func(t *testing.T) {
+		context, started := countingContext("TestShellStreamPlugin")
+		cliContext = context
+		plugin, err := NewBinaryPlugin("stream", logrus.New())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seen := pids(t, runObjects(t, plugin, names...)); len(seen) != len(names) {
+			t.Errorf("expected a process per object, got %v", seen)
+		}
+		if *started != int32(len(names))+1 {
+			t.Errorf("expected %d processes, got %d", len(names)+1, *started)
+		}
+	})
+
+	t.Run("NotAdvertised", func(t *testing.T) {
+		context, started := countingContext("TestShellStreamPlugin", "NO_STREAMING=1")
+		cliContext = context
+		plugin, err := NewBinaryPluginWithOptions("stream", logrus.New(), Options{Streaming: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seen := pids(t, runObjects(t, plugin, names...)); len(seen) != len(names) {
+			t.Errorf("expected a process per object, got %v", seen)
+		}
+		if *started != int32(len(names))+1 {
+			t.Errorf("expected %d processes, got %d", len(names)+1, *started)
+		}
+	})
+
+	t.Run("RestartsAfterExit", func(t *testing.T) {
+		context, _ := countingContext("TestShellStreamPlugin")
+		cliContext = context
+		plugin, err := NewBinaryPluginWithOptions("stream", logrus.New(), Options{Streaming: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer plugin.(*BinaryPlugin).Close()
+		first := pids(t, runObjects(t, plugin, "a"))
+		u := unstructured.Unstructured{}
+		u.SetAPIVersion("v1")
+		u.SetKind("Pod")
+		u.SetName("exit")
+		if _, err := plugin.Run(transform.PluginRequest{Unstructured: u}); err == nil {
+			t.Errorf("expected an error when the plugin exits")
+		}
+		second := pids(t, runObjects(t, plugin, "a"))
+		for pid := range second {
+			if first[pid] {
+				t.Errorf("expected a new process after exit, got %v twice", pid)
+			}
+		}
+	})
+}
+
+func TestBinaryPluginStreamingFallback(t *testing.T) {
+	defer func() { cliContext = nil }()
+	context, started := countingContext("TestShellBrokenStreamPlugin")
+	cliContext = context
+	plugin, err := NewBinaryPluginWithOptions("broken", logrus.New(), Options{Streaming: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	responses := runObjects(t, plugin, "a", "b", "c")
+	for _, resp := range responses {
+		if resp.Version != "v2" || len(resp.Warnings) != 1 {
+			t.Errorf("unexpected response %+v", resp)
+		}
+	}
+	// Metadata, the failed stream, then one process per object.
+	if *started != 5 {
+		t.Errorf("expected 5 processes, got %d", *started)
+	}
+	if err := plugin.(*BinaryPlugin).Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+}
+
+func TestBinaryPluginStreamingObjects(t *testing.T) {
+	defer func() { cliContext = nil }()
+	pluginContext, _ := countingContext("TestShellIndexStreamPlugin")
+	cliContext = pluginContext
+	plugin, err := NewBinaryPluginWithOptions("index", logrus.New(), Options{Streaming: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plugin.(*BinaryPlugin).Close()
+	runner := transform.NewRunner(logrus.New(), nil, nil)
+	runner.Workers = 4
+
+	warnings := func(objects []unstructured.Unstructured) map[string]bool {
+		responses, err := runner.RunBatch(context.Background(), objects, []transform.Plugin{plugin})
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen := map[string]bool{}
+		for _, resp := range responses {
+			for _, w := range resp.Warnings {
+				seen[w.Message] = true
+			}
+		}
+		return seen
+	}
+	objects := []unstructured.Unstructured{}
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		u := unstructured.Unstructured{}
+		u.SetAPIVersion("v1")
+		u.SetKind("Pod")
+		u.SetName(name)
+		objects = append(objects, u)
+	}
+	// Every request of a batch shares the objects received once.
+	for _, batch := range [][]unstructured.Unstructured{objects, objects[:2]} {
+		seen := warnings(batch)
+		if len(seen) != 1 {
+			t.Fatalf("expected the objects to be received once, got %v", seen)
+		}
+		for w := range seen {
+			if want := fmt.Sprintf("%d ", len(batch)); !strings.HasPrefix(w, want) {
+				t.Errorf("got warning %q, want the %d objects of the batch", w, len(batch))
+			}
+		}
+	}
+}
+
+func TestBinaryPluginStreamingLogs(t *testing.T) {
+	defer func() { cliContext = nil }()
+	pluginContext, _ := countingContext("TestShellStreamPlugin")
+	cliContext = pluginContext
+	logger, hook := test.NewNullLogger()
+	plugin, err := NewBinaryPluginWithOptions("stream", logger, Options{Streaming: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plugin.(*BinaryPlugin).Close()
+	runObjects(t, plugin, "a", "log", "b")
+
+	want := logrus.Fields{"pluginPath": "stream", "plugin": "fakeStreamPlugin", "kind": "Pod", "name": "log"}
+	// The logs of the plugin are read along with its replies.
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, entry := range hook.AllEntries() {
+			if entry.Message == "running log" {
+				if !reflect.DeepEqual(entry.Data, want) {
+					t.Errorf("plugin log has fields %v, want %v", entry.Data, want)
+				}
+				return
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("plugin log not found in %v", hook.AllEntries())
+}
@@ -0,0 +1,134 @@
+// Package celexpr compiles and evaluates Common Expression Language (CEL)
+// expressions over unstructured objects, for plugins to select objects or
+// compute values from their content. An expression sees the object as the
+// variable "object", such as in
+//
+//	object.kind == "ConfigMap" && object.metadata.name.startsWith("kube-")
+//
+// Accessing a missing field is an error when the expression is evaluated, so
+// optional fields are tested with has() first.
+package celexpr
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/ext"
+	"github.com/konveyor/crane-lib/transform/errors"
+	"google.golang.org/protobuf/types/known/structpb"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Variable is the name of the object in expressions.
+const Variable = "object"
+
+// Program is a compiled expression.
+type Program struct {
+	expression string
+	program    cel.Program
+}
+
+type cacheKey struct {
+	expression string
+	isBool     bool
+}
+
+var (
+	envOnce sync.Once
+	env     *cel.Env
+	envErr  error
+
+	cacheLock sync.Mutex
+	cache     = map[cacheKey]*Program{}
+)
+
+func getEnv() (*cel.Env, error) {
+	envOnce.Do(func() {
+		env, envErr = cel.NewEnv(
+			cel.Variable(Variable, cel.MapType(cel.StringType, cel.DynType)),
+			ext.Strings(),
+		)
+	})
+	return env, envErr
+}
+
+// CompileBool compiles an expression that must evaluate to a boolean.
+// Expressions are compiled once, and later calls with the same expression
+// return the same Program.
+func CompileBool(expression string) (*Program, error) {
+	return compile(cacheKey{expression: expression, isBool: true})
+}
+
+// CompileValue compiles an expression evaluating to any value that can be
+// converted to JSON.
+func CompileValue(expression string) (*Program, error) {
+	return compile(cacheKey{expression: expression})
+}
+
+func compile(key cacheKey) (*Program, error) {
+	cacheLock.Lock()
+	defer cacheLock.Unlock()
+	if p, ok := cache[key]; ok {
+		return p, nil
+	}
+
+	fail := func(err error) (*Program, error) {
+		return nil, &errors.ExpressionError{Expression: key.expression, Err: err}
+	}
+	e, err := getEnv()
+	if err != nil {
+		return fail(err)
+	}
+	ast, issues := e.Compile(key.expression)
+	if issues != nil && issues.Err() != nil {
+		return fail(issues.Err())
+	}
+	if key.isBool {
+		out := ast.OutputType()
+		if !out.IsExactType(cel.BoolType) && !out.IsExactType(cel.DynType) {
+			return fail(fmt.Errorf("returns %s, not bool", out))
+		}
+	}
+	program, err := e.Program(ast)
+	if err != nil {
+		return fail(err)
+	}
+	p := &Program{expression: key.expression, program: program}
+	cache[key] = p
+	return p, nil
+}
+
+// Expression returns the source of the program.
+func (p *Program) Expression() string {
+	return p.expression
+}
+
+// EvalBool evaluates a program compiled with CompileBool on obj.
+func (p *Program) EvalBool(obj unstructured.Unstructured) (bool, error) {
+	out, _, err := p.program.Eval(map[string]interface{}{Variable: obj.Object})
+	if err != nil {
+		return false, &errors.ExpressionError{Expression: p.expression, Err: err}
+	}
+	b, ok := out.Value().(bool)
+	if !ok {
+		return false, &errors.ExpressionError{Expression: p.expression, Err: fmt.Errorf("returned %s, not bool", out.Type())}
+	}
+	return b, nil
+}
+
+// Eval evaluates the program on obj and returns its result as a value of
+// the JSON encoding: nil, bool, float64, string, []interface{} or
+// map[string]interface{}.
+func (p *Program) Eval(obj unstructured.Unstructured) (interface{}, error) {
+	out, _, err := p.program.Eval(map[string]interface{}{Variable: obj.Object})
+	if err != nil {
+		return nil, &errors.ExpressionError{Expression: p.expression, Err: err}
+	}
+	v, err := out.ConvertToNative(reflect.TypeOf(&structpb.Value{}))
+	if err != nil {
+		return nil, &errors.ExpressionError{Expression: p.expression, Err: fmt.Errorf("result is not a JSON value: %v", err)}
+	}
+	return v.(*structpb.Value).AsInterface(), nil
+}
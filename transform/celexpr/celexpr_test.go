@@ -0,0 +1,151 @@
+package celexpr
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/konveyor/crane-lib/transform/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func testConfigMap() unstructured.Unstructured {
+	return unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name":      "kube-proxy-config",
+			"namespace": "shop",
+			"ownerReferences": []interface{}{
+				map[string]interface{}{"apiVersion": "operators.coreos.com/v1alpha1", "kind": "ClusterServiceVersion", "name": "proxy.v1"},
+			},
+		},
+		"data": map[string]interface{}{"replicas": "3"},
+		"spec": map[string]interface{}{"replicas": int64(3)},
+	}}
+}
+
+func TestEvalBool(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		want       bool
+		wantErr    string
+	}{
+		{
+			name:       "OwnedByOperator",
+			expression: `object.kind == "ConfigMap" && object.metadata.name.startsWith("kube-") && has(object.metadata.ownerReferences) && object.metadata.ownerReferences.exists(r, r.kind == "ClusterServiceVersion")`,
+			want:       true,
+		},
+		{
+			name:       "Has",
+			expression: `has(object.metadata.labels) && object.metadata.labels["app"] == "shop"`,
+			want:       false,
+		},
+		{
+			name:       "Int",
+			expression: `object.spec.replicas > 2`,
+			want:       true,
+		},
+		{
+			name:       "MissingField",
+			expression: `object.metadata.labels["app"] == "shop"`,
+			wantErr:    "no such key",
+		},
+		{
+			name:       "NotBool",
+			expression: `object.spec.replicas`,
+			wantErr:    "not bool",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := CompileBool(tt.expression)
+			if err != nil {
+				t.Fatalf("CompileBool() error = %v", err)
+			}
+			got, err := p.EvalBool(testConfigMap())
+			if tt.wantErr != "" {
+				if !errors.IsExpressionError(err) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("EvalBool() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("EvalBool() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("EvalBool() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		wantErr    string
+	}{
+		{name: "Syntax", expression: `object.kind ==`, wantErr: "Syntax error"},
+		{name: "UndeclaredVariable", expression: `obj.kind == "Pod"`, wantErr: "undeclared reference"},
+		{name: "NotBool", expression: `object.metadata.name + "-new"`, wantErr: "returns string, not bool"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := CompileBool(tt.expression)
+			if !errors.IsExpressionError(err) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("CompileBool() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCompileOnce(t *testing.T) {
+	first, err := CompileBool(`object.kind == "Pod"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := CompileBool(`object.kind == "Pod"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Errorf("CompileBool() compiled the same expression twice")
+	}
+	value, err := CompileValue(`object.kind == "Pod"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value == first {
+		t.Errorf("CompileValue() returned the program of CompileBool()")
+	}
+}
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       interface{}
+	}{
+		{expression: `object.metadata.name.replace("kube-", "")`, want: "proxy-config"},
+		{expression: `int(object.data.replicas) * 2`, want: float64(6)},
+		{expression: `{"app": object.metadata.namespace}`, want: map[string]interface{}{"app": "shop"}},
+		{expression: `object.metadata.ownerReferences.map(r, r.name)`, want: []interface{}{"proxy.v1"}},
+		{expression: `null`, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			p, err := CompileValue(tt.expression)
+			if err != nil {
+				t.Fatalf("CompileValue() error = %v", err)
+			}
+			got, err := p.Eval(testConfigMap())
+			if err != nil {
+				t.Fatalf("Eval() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Eval() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sync/atomic"
 
 	"github.com/sirupsen/logrus"
 
@@ -19,6 +20,8 @@ var (
 	reader io.Reader
 	exiter func(int)
 	logger *logrus.Logger
+	// frames tags the records of logger in streaming mode.
+	frames = &frameHook{}
 )
 
 func init() {
@@ -29,6 +32,14 @@ func init() {
 	exiter = os.Exit
 	logger = logrus.New()
 	logger.SetOutput(stdErr)
+	logger.SetFormatter(&logrus.JSONFormatter{
+		FieldMap: logrus.FieldMap{
+			logrus.FieldKeyLevel: transform.LogLevelKey,
+			logrus.FieldKeyMsg:   transform.LogMessageKey,
+			logrus.FieldKeyTime:  transform.LogTimeKey,
+		},
+	})
+	logger.AddHook(frames)
 }
 
 type customPlugin struct {
@@ -48,14 +59,18 @@ func (c *customPlugin) Metadata() transform.PluginMetadata {
 	return c.metadata
 }
 
-func NewCustomPlugin(name, version string, optionalFields []transform.OptionalFields, runFunc func(transform.PluginRequest) (transform.PluginResponse, error)) transform.Plugin {
+// NewCustomPlugin returns a plugin running runFunc. It supports streaming,
+// and advertises the given capabilities as well, for instance
+// transform.CapabilityResourceIndex.
+func NewCustomPlugin(name, version string, optionalFields []transform.OptionalFields, runFunc func(transform.PluginRequest) (transform.PluginResponse, error), capabilities ...transform.Capability) transform.Plugin {
 	return &customPlugin{
 		metadata: transform.PluginMetadata{
 			Name:            name,
 			Version:         version,
-			RequestVersion:  []transform.Version{transform.V1},
-			ResponseVersion: []transform.Version{transform.V1},
+			RequestVersion:  transform.SupportedVersions,
+			ResponseVersion: transform.SupportedVersions,
 			OptionalFields:  optionalFields,
+			Capabilities:    append([]transform.Capability{transform.CapabilityStreaming}, capabilities...),
 		},
 		runFunc: runFunc,
 	}
@@ -67,6 +82,8 @@ func WriterErrorAndExit(err error) {
 	exiter(1)
 }
 
+// Logger returns the logger plugins should use. It writes the structured
+// records the binary plugin runner re-emits in the caller's log.
 func Logger() *logrus.Logger {
 	return logger
 }
@@ -98,6 +115,12 @@ func RunAndExit(plugin transform.Plugin) {
 		return
 	}
 
+	// Determine if streaming mode was requested
+	if _, ok := m[transform.StreamVersionKey]; ok && len(m) == 1 {
+		runStream(plugin, decoder)
+		return
+	}
+
 	// Ignoring this error as anthing wrong here will be caught in the unmarshalJSON below
 	b, _ := json.Marshal(m)
 	req := transform.PluginRequest{}
@@ -109,28 +132,14 @@ func RunAndExit(plugin transform.Plugin) {
 			ErrorMessage: err.Error(),
 		})
 	}
-	extrasIn, ok := m["extras"]
-	var extrasInMap map[string]interface{}
-	if ok {
-		extrasInMap, ok = extrasIn.(map[string]interface{})
-	}
-	if ok {
-		extras := map[string]string{}
-		for key, value := range extrasInMap {
-			switch value.(type) {
-			case string:
-				extras[key] = value.(string)
-			default:
-				WriterErrorAndExit(&errors.PluginError{
-					Type:         errors.PluginInvalidIOError,
-					Message:      "error getting extras value string",
-					ErrorMessage: fmt.Sprintf("value %v for param %v is not a string", value, key),
-				})
-			}
-		}
-		req.Extras = extras
+	req.Extras, err = transform.ValidateOptionalFields(plugin.Metadata().OptionalFields, req.Extras)
+	if err != nil {
+		WriterErrorAndExit(&errors.PluginError{
+			Type:         errors.PluginInvalidInputError,
+			Message:      "invalid optional field",
+			ErrorMessage: err.Error(),
+		})
 	}
-
 	resp, err := plugin.Run(req)
 	if err != nil {
 		WriterErrorAndExit(&errors.PluginError{
@@ -158,3 +167,110 @@ func RunAndExit(plugin transform.Plugin) {
 		})
 	}
 }
+
+// frameHook tags the records logged while a request frame runs with the ID
+// of the frame, for the runner to tell which object they are about.
+type frameHook struct {
+	id atomic.Uint64
+}
+
+func (h *frameHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *frameHook) Fire(entry *logrus.Entry) error {
+	if id := h.id.Load(); id != 0 {
+		entry.Data[transform.LogStreamFrameKey] = id
+	}
+	return nil
+}
+
+// runStream answers the frames of the streaming protocol until it is asked to
+// shut down or its input is closed.
+func runStream(plugin transform.Plugin, decoder *json.Decoder) {
+	encoder := json.NewEncoder(stdOut)
+	objects := transform.StreamObjects{}
+	for {
+		// The request is decoded on its own so an invalid object only fails
+		// its frame.
+		frame := struct {
+			transform.StreamFrame
+			Request json.RawMessage `json:"request,omitempty"`
+		}{}
+		err := decoder.Decode(&frame)
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			WriterErrorAndExit(&errors.PluginError{
+				Type:         errors.PluginInvalidIOError,
+				Message:      "error reading stream frame from input",
+				ErrorMessage: err.Error(),
+			})
+			return
+		}
+
+		reply := transform.StreamFrame{ID: frame.ID}
+		switch frame.Type {
+		case transform.StreamFrameShutdown:
+			return
+		case transform.StreamFrameObjects:
+			objects.Receive(frame.Objects)
+			continue
+		case transform.StreamFrameHealth:
+			reply.Type = transform.StreamFrameHealth
+		case transform.StreamFrameRequest:
+			frames.id.Store(frame.ID)
+			reply = runFrame(plugin, frame.ID, frame.Request, &objects)
+			frames.id.Store(0)
+		default:
+			reply.Type = transform.StreamFrameError
+			reply.Error = &errors.PluginError{
+				Type:         errors.PluginInvalidInputError,
+				Message:      "unknown stream frame type",
+				ErrorMessage: string(frame.Type),
+			}
+		}
+
+		err = encoder.Encode(&reply)
+		if err != nil {
+			WriterErrorAndExit(&errors.PluginError{
+				Type:         errors.PluginInvalidIOError,
+				Message:      "error writing stream frame to stdOut",
+				ErrorMessage: err.Error(),
+			})
+			return
+		}
+	}
+}
+
+func runFrame(plugin transform.Plugin, id uint64, rawRequest json.RawMessage, objects *transform.StreamObjects) transform.StreamFrame {
+	req := transform.PluginRequest{}
+	err := json.Unmarshal(rawRequest, &req)
+	if err != nil {
+		return transform.StreamFrame{ID: id, Type: transform.StreamFrameError, Error: &errors.PluginError{
+			Type:         errors.PluginInvalidInputError,
+			Message:      "error reading plugin request from stream frame",
+			ErrorMessage: err.Error(),
+		}}
+	}
+	objects.Restore(&req)
+	req.Extras, err = transform.ValidateOptionalFields(plugin.Metadata().OptionalFields, req.Extras)
+	if err != nil {
+		return transform.StreamFrame{ID: id, Type: transform.StreamFrameError, Error: &errors.PluginError{
+			Type:         errors.PluginInvalidInputError,
+			Message:      "invalid optional field",
+			ErrorMessage: err.Error(),
+		}}
+	}
+
+	resp, err := plugin.Run(req)
+	if err != nil {
+		return transform.StreamFrame{ID: id, Type: transform.StreamFrameError, Error: &errors.PluginError{
+			Type:         errors.PluginRunError,
+			Message:      "error when running plugin",
+			ErrorMessage: err.Error(),
+		}}
+	}
+	return transform.StreamFrame{ID: id, Type: transform.StreamFrameResponse, Response: &resp}
+}
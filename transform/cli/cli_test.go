@@ -18,41 +18,30 @@ import (
 
 type fakeReader struct {
 	*unstructured.Unstructured
-	extras map[string]string
-	err error
-	readObj bool
-	readExtras bool
+	extras  map[string]string
+	version transform.Version
+	context *transform.RequestContext
+	err     error
+	buf     *bytes.Buffer
 }
 
 func (f *fakeReader) Read(p []byte) (int, error) {
 	if f.err != nil {
 		return 0, f.err
 	}
-	if !f.readObj {
-		b, err := f.Unstructured.MarshalJSON()
-		for i := range p {
-			if i >= len(b) {
-				f.readObj = true
-				return len(b), err
-			}
-			p[i] = b[i]
-		}
-		f.readObj = true
-		return len(b), err
-	}
-	if !f.readExtras {
-		b, err := json.Marshal(&f.extras)
-		for i := range p {
-			if i >= len(b) {
-				f.readExtras = true
-				return len(b), err
-			}
-			p[i] = b[i]
+	if f.buf == nil {
+		b, err := json.Marshal(transform.PluginRequest{
+			Unstructured: *f.Unstructured,
+			Extras:       f.extras,
+			Version:      f.version,
+			Context:      f.context,
+		})
+		if err != nil {
+			return 0, err
 		}
-		f.readExtras = true
-		return len(b), err
+		f.buf = bytes.NewBuffer(b)
 	}
-	return 0, io.EOF
+	return f.buf.Read(p)
 }
 
 func TestRunAndExit(t *testing.T) {
@@ -100,6 +89,65 @@ func TestRunAndExit(t *testing.T) {
 			errCapture: bytes.Buffer{},
 			outCapture: bytes.Buffer{},
 		},
+		{
+			name: "V2Request",
+			reader: &fakeReader{
+				Unstructured: &unstructured.Unstructured{Object: map[string]interface{}{
+					"apiVersion": "v1",
+					"kind":       "pod",
+					"metadata": map[string]interface{}{
+						"name":      "foo",
+						"namespace": "bar",
+					},
+				}},
+				extras:  map[string]string{"flag": "value"},
+				version: transform.V2,
+				context: &transform.RequestContext{TargetClusterVersion: "v1.27.0"},
+			},
+			response: transform.PluginResponse{
+				Version:     "v2",
+				Warnings:    []string{"foo in bar"},
+				Annotations: map[string]string{"flag": "value"},
+			},
+			fakeFunc: func(request transform.PluginRequest) (transform.PluginResponse, error) {
+				if request.Version != transform.V2 || request.Context == nil || request.Context.TargetClusterVersion != "v1.27.0" {
+					return transform.PluginResponse{}, fmt.Errorf("unexpected request: %+v", request)
+				}
+				if _, ok := request.Object["requestContext"]; ok {
+					return transform.PluginResponse{}, fmt.Errorf("requestContext left in the object")
+				}
+				return transform.PluginResponse{
+					Version:     "v2",
+					Warnings:    []string{request.GetName() + " in " + request.GetNamespace()},
+					Annotations: request.Extras,
+				}, nil
+			},
+			errCapture: bytes.Buffer{},
+			outCapture: bytes.Buffer{},
+		},
+		{
+			name:    "InvalidExtras",
+			version: "v1",
+			reader:  bytes.NewBufferString(`{"apiVersion": "v1", "kind": "pod", "extras": {"flag": true}}`),
+			wantErr: true,
+			wantedErr: errors.PluginError{
+				Type: errors.PluginInvalidInputError,
+			},
+			errCapture: bytes.Buffer{},
+			outCapture: bytes.Buffer{},
+		},
+		{
+			name:           "InvalidOptionalField",
+			version:        "v1",
+			reader:         bytes.NewBufferString(`{"apiVersion": "v1", "kind": "pod", "extras": {"flag": "maybe"}}`),
+			optionalFields: []transform.OptionalFields{{FlagName: "flag", Type: transform.OptionalFieldBool}},
+			wantErr:        true,
+			wantedErr: errors.PluginError{
+				Type: errors.PluginInvalidInputError,
+			},
+			errCapture: bytes.Buffer{},
+			outCapture: bytes.Buffer{},
+		},
 		{
 			name:    "MetadataRequest",
 			reader:  bytes.NewBufferString(bplugin.MetadataRequest),
@@ -107,8 +155,9 @@ func TestRunAndExit(t *testing.T) {
 			metadata: &transform.PluginMetadata{
 				Name:            "MetadataRequest",
 				Version:         "v2",
-				RequestVersion:  []transform.Version{transform.V1},
-				ResponseVersion: []transform.Version{transform.V1},
+				RequestVersion:  []transform.Version{transform.V1, transform.V2},
+				ResponseVersion: []transform.Version{transform.V1, transform.V2},
+				Capabilities:    []transform.Capability{transform.CapabilityStreaming},
 			},
 			errCapture: bytes.Buffer{},
 			outCapture: bytes.Buffer{},
@@ -230,10 +279,93 @@ func TestRunAndExit(t *testing.T) {
 				return
 			}
 
-			if pluginOutput.IsWhiteOut != tt.response.IsWhiteOut || !patchesEqual || pluginOutput.Version != tt.response.Version {
+			if pluginOutput.IsWhiteOut != tt.response.IsWhiteOut || !patchesEqual || pluginOutput.Version != tt.response.Version ||
+				!reflect.DeepEqual(pluginOutput.Warnings, tt.response.Warnings) || !reflect.DeepEqual(pluginOutput.Annotations, tt.response.Annotations) {
 				t.Errorf("output: %v \nnot equal to what is expected: %v", pluginOutput, tt.response)
 				return
 			}
 		})
 	}
 }
+
+func TestRunAndExitStream(t *testing.T) {
+	input := transform.StreamRequest + `
+{"id": 1, "type": "health"}
+{"id": 2, "type": "request", "request": {"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "foo"}}}
+{"id": 3, "type": "request", "request": {"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "fail"}}}
+{"id": 4, "type": "request", "request": {"apiVersion": "fake/v1"}}
+{"id": 5, "type": "unknown"}
+{"id": 6, "type": "shutdown"}
+{"id": 7, "type": "health"}
+`
+	plugin := NewCustomPlugin("StreamPlugin", "v1", nil, func(request transform.PluginRequest) (transform.PluginResponse, error) {
+		if request.GetName() == "fail" {
+			return transform.PluginResponse{}, fmt.Errorf("invalid run")
+		}
+		Logger().Infof("running %s", request.GetName())
+		return transform.PluginResponse{Version: "v1", Warnings: []string{request.GetName()}}, nil
+	})
+	logCapture := bytes.Buffer{}
+	Logger().SetOutput(&logCapture)
+	defer Logger().SetOutput(stdErr)
+	errCapture := bytes.Buffer{}
+	outCapture := bytes.Buffer{}
+	stdErr = &errCapture
+	stdOut = &outCapture
+	reader = bytes.NewBufferString(input)
+	exiter = func(i int) {
+		panic(fmt.Errorf("unexpected exit %d: %s", i, errCapture.String()))
+	}
+
+	RunAndExit(plugin)
+
+	want := []transform.StreamFrame{
+		{ID: 1, Type: transform.StreamFrameHealth},
+		{ID: 2, Type: transform.StreamFrameResponse, Response: &transform.PluginResponse{Version: "v1", Warnings: []string{"foo"}}},
+		{ID: 3, Type: transform.StreamFrameError, Error: &errors.PluginError{Type: errors.PluginRunError}},
+		{ID: 4, Type: transform.StreamFrameError, Error: &errors.PluginError{Type: errors.PluginInvalidInputError}},
+		{ID: 5, Type: transform.StreamFrameError, Error: &errors.PluginError{Type: errors.PluginInvalidInputError}},
+	}
+	decoder := json.NewDecoder(&outCapture)
+	for _, w := range want {
+		got := transform.StreamFrame{}
+		if err := decoder.Decode(&got); err != nil {
+			t.Fatalf("unable to read frame %d: %v", w.ID, err)
+		}
+		if got.Error != nil {
+			// Only the error type is stable.
+			got.Error = &errors.PluginError{Type: got.Error.Type}
+		}
+		if !reflect.DeepEqual(got, w) {
+			t.Errorf("got frame %+v, want %+v", got, w)
+		}
+	}
+	if decoder.More() {
+		t.Errorf("unexpected frames after shutdown: %s", outCapture.String())
+	}
+
+	// The logs of a request are tagged with its frame.
+	record := map[string]interface{}{}
+	if err := json.Unmarshal(logCapture.Bytes(), &record); err != nil {
+		t.Fatalf("unable to decode log record %q: %v", logCapture.String(), err)
+	}
+	if record[transform.LogMessageKey] != "running foo" || record[transform.LogStreamFrameKey] != float64(2) {
+		t.Errorf("unexpected log record: %v", record)
+	}
+}
+
+func TestLogger(t *testing.T) {
+	capture := bytes.Buffer{}
+	Logger().SetOutput(&capture)
+	defer Logger().SetOutput(stdErr)
+
+	Logger().WithField("field", "value").Warn("check me")
+
+	record := map[string]interface{}{}
+	if err := json.Unmarshal(capture.Bytes(), &record); err != nil {
+		t.Fatalf("unable to decode log record %q: %v", capture.String(), err)
+	}
+	if record[transform.LogLevelKey] != "warning" || record[transform.LogMessageKey] != "check me" || record["field"] != "value" {
+		t.Errorf("unexpected log record: %v", record)
+	}
+}
@@ -1,11 +1,26 @@
 package errors
 
-import "encoding/json"
+import (
+	"encoding/json"
+	goerrors "errors"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
 
 const (
 	PluginInvalidInputError = "PluginInvalidInputError"
 	PluginRunError          = "PluginRunError"
 	PluginInvalidIOError    = "PluginInvalidIOError"
+	// PluginTimeoutError is returned when a plugin does not finish in time.
+	PluginTimeoutError = "PluginTimeoutError"
+	// PluginOutputLimitError is returned when a plugin writes more than it is
+	// allowed to.
+	PluginOutputLimitError = "PluginOutputLimitError"
+	// PluginFuelExhaustedError is returned when a sandboxed plugin uses more
+	// fuel than it is given.
+	PluginFuelExhaustedError = "PluginFuelExhaustedError"
 )
 
 type PluginError struct {
@@ -20,25 +35,130 @@ func (p *PluginError) Error() string {
 }
 
 func IsInvalidInputError(err error) bool {
-	perr, ok := err.(*PluginError)
-	if !ok {
-		return false
-	}
-	return perr.Type == PluginInvalidInputError
+	return isPluginErrorType(err, PluginInvalidInputError)
 }
 
 func IsPluginRunError(err error) bool {
-	perr, ok := err.(*PluginError)
-	if !ok {
-		return false
-	}
-	return perr.Type == PluginRunError
+	return isPluginErrorType(err, PluginRunError)
 }
 
 func IsInvalidIOError(err error) bool {
-	perr, ok := err.(*PluginError)
-	if !ok {
+	return isPluginErrorType(err, PluginInvalidIOError)
+}
+
+func IsTimeoutError(err error) bool {
+	return isPluginErrorType(err, PluginTimeoutError)
+}
+
+func IsOutputLimitError(err error) bool {
+	return isPluginErrorType(err, PluginOutputLimitError)
+}
+
+func IsFuelExhaustedError(err error) bool {
+	return isPluginErrorType(err, PluginFuelExhaustedError)
+}
+
+func isPluginErrorType(err error, errorType string) bool {
+	perr := &PluginError{}
+	if !goerrors.As(err, &perr) {
 		return false
 	}
-	return perr.Type == PluginInvalidIOError
+	return perr.Type == errorType
+}
+
+// ObjectError records the failure of a single plugin on a single object.
+type ObjectError struct {
+	Plugin           string
+	GroupVersionKind schema.GroupVersionKind
+	Namespace        string
+	Name             string
+	Err              error
+}
+
+func (o *ObjectError) Error() string {
+	name := o.Name
+	if o.Namespace != "" {
+		name = o.Namespace + "/" + o.Name
+	}
+	return fmt.Sprintf("plugin %q failed on %s %q: %v", o.Plugin, o.GroupVersionKind.GroupKind(), name, o.Err)
+}
+
+func (o *ObjectError) Unwrap() error {
+	return o.Err
+}
+
+// MultiError aggregates the ObjectErrors collected while transforming one or
+// more objects, in the order they happened.
+type MultiError struct {
+	Errors []*ObjectError
+}
+
+func (m *MultiError) Error() string {
+	msgs := []string{}
+	for _, err := range m.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("%d plugin error(s): %s", len(m.Errors), strings.Join(msgs, "; "))
+}
+
+func (m *MultiError) Unwrap() []error {
+	errs := []error{}
+	for _, err := range m.Errors {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// ObjectErrors returns every ObjectError contained in err, whether err is a
+// single ObjectError or a MultiError.
+func ObjectErrors(err error) []*ObjectError {
+	multi := &MultiError{}
+	if goerrors.As(err, &multi) {
+		return multi.Errors
+	}
+	objErr := &ObjectError{}
+	if goerrors.As(err, &objErr) {
+		return []*ObjectError{objErr}
+	}
+	return nil
+}
+
+// OptionError records an optional field of a plugin that is missing or has an
+// invalid value.
+type OptionError struct {
+	Plugin   string
+	FlagName string
+	Err      error
+}
+
+func (o *OptionError) Error() string {
+	if o.Plugin == "" {
+		return fmt.Sprintf("invalid value for %q: %v", o.FlagName, o.Err)
+	}
+	return fmt.Sprintf("plugin %q: invalid value for %q: %v", o.Plugin, o.FlagName, o.Err)
+}
+
+func (o *OptionError) Unwrap() error {
+	return o.Err
+}
+
+// ExpressionError records an expression that does not compile, or that fails
+// or returns a value of the wrong type when evaluated on an object.
+type ExpressionError struct {
+	Expression string
+	Err        error
+}
+
+func (e *ExpressionError) Error() string {
+	return fmt.Sprintf("expression %q: %v", e.Expression, e.Err)
+}
+
+func (e *ExpressionError) Unwrap() error {
+	return e.Err
+}
+
+// IsExpressionError returns true if err is or wraps an ExpressionError.
+func IsExpressionError(err error) bool {
+	exprErr := &ExpressionError{}
+	return goerrors.As(err, &exprErr)
 }
@@ -1,6 +1,12 @@
 package errors
 
-import "testing"
+import (
+	goerrors "errors"
+	"fmt"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
 
 func TestPluginError_Error(t *testing.T) {
 	tests := []struct {
@@ -26,3 +32,96 @@ func TestPluginError_Error(t *testing.T) {
 		})
 	}
 }
+
+func TestIsPluginErrorTypeWrapped(t *testing.T) {
+	err := &ObjectError{
+		Plugin: "test-plugin",
+		Err:    &PluginError{Type: PluginInvalidInputError},
+	}
+	if !IsInvalidInputError(err) {
+		t.Errorf("expected wrapped PluginError to be detected as invalid input")
+	}
+	if IsPluginRunError(err) || IsInvalidIOError(err) || IsTimeoutError(err) || IsOutputLimitError(err) || IsFuelExhaustedError(err) {
+		t.Errorf("wrapped PluginError matched the wrong type")
+	}
+	if IsPluginRunError(fmt.Errorf("plain error")) {
+		t.Errorf("plain error should not be a PluginError")
+	}
+	if !IsTimeoutError(fmt.Errorf("run: %w", &PluginError{Type: PluginTimeoutError})) {
+		t.Errorf("expected wrapped PluginError to be detected as a timeout")
+	}
+	if !IsOutputLimitError(fmt.Errorf("run: %w", &PluginError{Type: PluginOutputLimitError})) {
+		t.Errorf("expected wrapped PluginError to be detected as an output limit")
+	}
+	if !IsFuelExhaustedError(fmt.Errorf("run: %w", &PluginError{Type: PluginFuelExhaustedError})) {
+		t.Errorf("expected wrapped PluginError to be detected as fuel exhaustion")
+	}
+}
+
+func TestObjectError_Error(t *testing.T) {
+	tests := []struct {
+		name string
+		err  ObjectError
+		want string
+	}{
+		{
+			name: "namespaced object",
+			err: ObjectError{
+				Plugin:           "KubernetesPlugin",
+				GroupVersionKind: schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+				Namespace:        "foo",
+				Name:             "bar",
+				Err:              fmt.Errorf("boom"),
+			},
+			want: `plugin "KubernetesPlugin" failed on Deployment.apps "foo/bar": boom`,
+		},
+		{
+			name: "cluster scoped object",
+			err: ObjectError{
+				Plugin:           "KubernetesPlugin",
+				GroupVersionKind: schema.GroupVersionKind{Version: "v1", Kind: "Namespace"},
+				Name:             "foo",
+				Err:              fmt.Errorf("boom"),
+			},
+			want: `plugin "KubernetesPlugin" failed on Namespace "foo": boom`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.err.Error(); got != tt.want {
+				t.Errorf("Error() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestObjectErrors(t *testing.T) {
+	first := &ObjectError{Plugin: "first", Err: fmt.Errorf("boom")}
+	second := &ObjectError{Plugin: "second", Err: fmt.Errorf("boom")}
+
+	if got := ObjectErrors(&MultiError{Errors: []*ObjectError{first, second}}); len(got) != 2 || got[0] != first || got[1] != second {
+		t.Errorf("ObjectErrors(MultiError) = %v", got)
+	}
+	if got := ObjectErrors(fmt.Errorf("wrapped: %w", first)); len(got) != 1 || got[0] != first {
+		t.Errorf("ObjectErrors(wrapped ObjectError) = %v", got)
+	}
+	if got := ObjectErrors(fmt.Errorf("plain")); got != nil {
+		t.Errorf("ObjectErrors(plain) = %v", got)
+	}
+	if !goerrors.Is(&MultiError{Errors: []*ObjectError{first}}, first) {
+		t.Errorf("expected MultiError to unwrap to its ObjectErrors")
+	}
+}
+
+func TestExpressionError(t *testing.T) {
+	err := fmt.Errorf("rule #0: %w", &ExpressionError{Expression: "object.spec", Err: fmt.Errorf("boom")})
+	if got, want := err.Error(), `rule #0: expression "object.spec": boom`; got != want {
+		t.Errorf("Error() = %v, want %v", got, want)
+	}
+	if !IsExpressionError(err) {
+		t.Errorf("expected wrapped ExpressionError to be detected")
+	}
+	if IsExpressionError(&ObjectError{Err: fmt.Errorf("boom")}) {
+		t.Errorf("ObjectError should not be an ExpressionError")
+	}
+}
@@ -0,0 +1,349 @@
+package grpc_plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/konveyor/crane-lib/transform"
+	transformerrors "github.com/konveyor/crane-lib/transform/errors"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+var (
+	// callTimeout bounds the metadata call and the stream health check.
+	callTimeout = 10 * time.Second
+	// streamShutdownTimeout is how long the plugin gets to end the stream
+	// after a shutdown frame.
+	streamShutdownTimeout = 5 * time.Second
+)
+
+// Options configures how a gRPC plugin is called.
+type Options struct {
+	// Streaming sends every object over a single RunStream call instead of
+	// one Run call per object. Plugins that do not implement RunStream are
+	// still called with Run.
+	Streaming bool
+	// DialOptions are added to the options used to connect to the plugin.
+	DialOptions []grpc.DialOption
+}
+
+// GRPCPlugin is a plugin served over gRPC, see ServiceName.
+type GRPCPlugin struct {
+	conn           *grpc.ClientConn
+	pluginMetadata transform.PluginMetadata
+	log            logrus.FieldLogger
+	// requestVersion and responseVersion are the highest versions supported
+	// by both the plugin and this library.
+	requestVersion  transform.Version
+	responseVersion transform.Version
+	streaming       bool
+
+	mu       sync.Mutex
+	stream   *clientStream
+	fallback bool
+	closed   bool
+}
+
+// NewGRPCPlugin connects to the plugin served on the Unix socket at
+// socketPath.
+func NewGRPCPlugin(socketPath string, logger *logrus.Logger) (transform.Plugin, error) {
+	return NewGRPCPluginWithOptions(socketPath, logger, Options{})
+}
+
+// NewGRPCPluginWithOptions is like NewGRPCPlugin but calls the plugin as
+// configured by opts. The returned plugin is a *GRPCPlugin, which must be
+// closed once done.
+func NewGRPCPluginWithOptions(socketPath string, logger *logrus.Logger, opts Options) (transform.Plugin, error) {
+	log := logger.WithField("pluginSocket", socketPath)
+
+	dialOptions := []grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}
+	conn, err := grpc.NewClient("unix:"+socketPath, append(dialOptions, opts.DialOptions...)...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to the plugin: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+	defer cancel()
+	metadata := transform.PluginMetadata{}
+	out := &MetadataResponse{}
+	err = conn.Invoke(ctx, metadataMethod, &MetadataRequest{}, out)
+	if err == nil {
+		err = decodeMessage(out.GetMetadata(), &metadata)
+	}
+	if err != nil {
+		conn.Close()
+		log.Errorf("error getting the plugin metadata")
+		return nil, fmt.Errorf("error getting the plugin metadata: %w", fromStatus(err))
+	}
+
+	requestVersion, requestOk := transform.NegotiateVersion(metadata.RequestVersion)
+	responseVersion, responseOk := transform.NegotiateVersion(metadata.ResponseVersion)
+	if !requestOk || !responseOk {
+		conn.Close()
+		return nil, fmt.Errorf("invalid versions supported by plugin defined by caller responseVersions: %v, requestVersions: %v", metadata.ResponseVersion, metadata.RequestVersion)
+	}
+	log.Debugf("using request version %v and response version %v", requestVersion, responseVersion)
+
+	return &GRPCPlugin{
+		conn:            conn,
+		pluginMetadata:  metadata,
+		log:             log,
+		requestVersion:  requestVersion,
+		responseVersion: responseVersion,
+		streaming:       opts.Streaming,
+	}, nil
+}
+
+func (g *GRPCPlugin) Metadata() transform.PluginMetadata {
+	return g.pluginMetadata
+}
+
+func (g *GRPCPlugin) Run(request transform.PluginRequest) (transform.PluginResponse, error) {
+	return g.RunWithContext(context.Background(), request)
+}
+
+// RunWithContext runs the plugin, cancelling the call when ctx is done.
+func (g *GRPCPlugin) RunWithContext(ctx context.Context, request transform.PluginRequest) (transform.PluginResponse, error) {
+	request = request.ForPlugin(g.requestVersion, g.pluginMetadata)
+	resp := transform.PluginResponse{}
+
+	stream, err := g.getStream()
+	if err != nil {
+		return resp, err
+	}
+	if stream != nil {
+		resp, err = stream.run(ctx, request)
+	} else if err = g.invokeRun(ctx, request, &resp); err != nil {
+		err = fromStatus(err)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return resp, ctx.Err()
+		}
+		g.log.Errorf("error running the plugin")
+		return resp, fmt.Errorf("error running the plugin: %w", err)
+	}
+
+	if g.responseVersion == transform.V1 {
+		// V1 responses have no warnings, annotations or renames.
+		resp.Warnings = nil
+		resp.Annotations = nil
+		resp.Renames = nil
+	}
+	return resp, nil
+}
+
+// invokeRun calls the Run method of the plugin.
+func (g *GRPCPlugin) invokeRun(ctx context.Context, request transform.PluginRequest, resp *transform.PluginResponse) error {
+	b, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	out := &RunResponse{}
+	if err := g.conn.Invoke(ctx, runMethod, &RunRequest{Request: b}, out); err != nil {
+		return err
+	}
+	return decodeMessage(out.GetResponse(), resp)
+}
+
+// getStream returns the open stream, opening it if needed. It returns nil if
+// the plugin must be called with Run.
+func (g *GRPCPlugin) getStream() (*clientStream, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		return nil, fmt.Errorf("plugin %v is closed", g.pluginMetadata.Name)
+	}
+	if !g.streaming || g.fallback {
+		return nil, nil
+	}
+	if g.stream != nil {
+		select {
+		case <-g.stream.done:
+			g.log.Warnf("plugin %v stream ended: %v, opening a new one", g.pluginMetadata.Name, g.stream.err)
+		default:
+			return g.stream, nil
+		}
+	}
+
+	stream, err := openStream(g.conn)
+	if err != nil {
+		g.log.Warnf("unable to stream to plugin %v, calling it once per object: %v", g.pluginMetadata.Name, err)
+		g.fallback = true
+		return nil, nil
+	}
+	g.stream = stream
+	return stream, nil
+}
+
+// Close ends the stream, if any, and the connection to the plugin.
+func (g *GRPCPlugin) Close() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.closed = true
+	if g.stream != nil {
+		g.stream.close()
+	}
+	return g.conn.Close()
+}
+
+// clientStream is an open RunStream call. Requests can be sent concurrently,
+// replies are matched to them by ID.
+type clientStream struct {
+	stream grpc.ClientStream
+	cancel context.CancelFunc
+
+	sendMu sync.Mutex
+	// objects are the objects of the export sent last, guarded by sendMu.
+	objects transform.StreamObjects
+	mu      sync.Mutex
+	nextID  uint64
+	pending map[uint64]chan transform.StreamFrame
+
+	// done is closed once the stream ended, err tells why.
+	done chan struct{}
+	err  error
+}
+
+func openStream(conn *grpc.ClientConn) (*clientStream, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := conn.NewStream(ctx, &serviceDesc.Streams[0], runStreamMethod)
+	if err != nil {
+		cancel()
+		return nil, fromStatus(err)
+	}
+	s := &clientStream{
+		stream:  stream,
+		cancel:  cancel,
+		pending: map[uint64]chan transform.StreamFrame{},
+		done:    make(chan struct{}),
+	}
+	go s.receive()
+
+	healthCtx, healthCancel := context.WithTimeout(ctx, callTimeout)
+	defer healthCancel()
+	reply, err := s.call(healthCtx, transform.StreamFrame{Type: transform.StreamFrameHealth})
+	if err == nil && reply.Type != transform.StreamFrameHealth {
+		err = fmt.Errorf("unexpected %v frame in reply to health check", reply.Type)
+	}
+	if err != nil {
+		cancel()
+		<-s.done
+		return nil, fmt.Errorf("plugin failed the health check: %v", err)
+	}
+	return s, nil
+}
+
+// receive hands every frame sent by the plugin to the request waiting for it
+// until the stream ends.
+func (s *clientStream) receive() {
+	var err error
+	for {
+		frame := transform.StreamFrame{}
+		if err = recvFrame(s.stream, &frame); err != nil {
+			break
+		}
+		s.mu.Lock()
+		reply, ok := s.pending[frame.ID]
+		delete(s.pending, frame.ID)
+		s.mu.Unlock()
+		if ok {
+			reply <- frame
+		}
+	}
+	if err == io.EOF {
+		s.err = fmt.Errorf("plugin closed the stream")
+	} else {
+		s.err = fromStatus(err)
+	}
+	close(s.done)
+}
+
+func (s *clientStream) run(ctx context.Context, request transform.PluginRequest) (transform.PluginResponse, error) {
+	reply, err := s.call(ctx, transform.StreamFrame{Type: transform.StreamFrameRequest, Request: &request})
+	if err != nil {
+		return transform.PluginResponse{}, err
+	}
+	switch {
+	case reply.Type == transform.StreamFrameResponse && reply.Response != nil:
+		return *reply.Response, nil
+	case reply.Type == transform.StreamFrameError && reply.Error != nil:
+		return transform.PluginResponse{}, reply.Error
+	default:
+		return transform.PluginResponse{}, &transformerrors.PluginError{
+			Type:         transformerrors.PluginInvalidIOError,
+			Message:      "unexpected stream frame sent by the plugin",
+			ErrorMessage: fmt.Sprintf("%v frame for request %v", reply.Type, reply.ID),
+		}
+	}
+}
+
+// call sends frame with a new ID and waits for the reply.
+func (s *clientStream) call(ctx context.Context, frame transform.StreamFrame) (transform.StreamFrame, error) {
+	reply := make(chan transform.StreamFrame, 1)
+	s.mu.Lock()
+	s.nextID++
+	frame.ID = s.nextID
+	s.pending[frame.ID] = reply
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.pending, frame.ID)
+		s.mu.Unlock()
+	}()
+
+	if err := s.send(frame); err != nil {
+		return transform.StreamFrame{}, err
+	}
+	select {
+	case r := <-reply:
+		return r, nil
+	case <-s.done:
+		select {
+		case r := <-reply:
+			return r, nil
+		default:
+			return transform.StreamFrame{}, s.err
+		}
+	case <-ctx.Done():
+		return transform.StreamFrame{}, ctx.Err()
+	}
+}
+
+// send sends frame, preceded by the objects of the export of its request if
+// the plugin does not have them yet.
+func (s *clientStream) send(frame transform.StreamFrame) error {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	for _, f := range s.objects.Frames(frame) {
+		if err := sendFrame(s.stream, f); err != nil {
+			// The reason the stream broke is returned by RecvMsg.
+			<-s.done
+			return s.err
+		}
+	}
+	return nil
+}
+
+// close asks the plugin to end the stream, and cancels it if the plugin does
+// not in time.
+func (s *clientStream) close() {
+	s.send(transform.StreamFrame{Type: transform.StreamFrameShutdown})
+	s.sendMu.Lock()
+	s.stream.CloseSend()
+	s.sendMu.Unlock()
+	select {
+	case <-s.done:
+	case <-time.After(streamShutdownTimeout):
+	}
+	s.cancel()
+	<-s.done
+}
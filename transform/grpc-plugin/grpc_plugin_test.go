@@ -0,0 +1,339 @@
+package grpc_plugin
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/konveyor/crane-lib/transform"
+	transformerrors "github.com/konveyor/crane-lib/transform/errors"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+type fakePlugin struct {
+	metadata transform.PluginMetadata
+	run      func(ctx context.Context, request transform.PluginRequest) (transform.PluginResponse, error)
+}
+
+func (f *fakePlugin) Run(request transform.PluginRequest) (transform.PluginResponse, error) {
+	return f.RunWithContext(context.Background(), request)
+}
+
+func (f *fakePlugin) RunWithContext(ctx context.Context, request transform.PluginRequest) (transform.PluginResponse, error) {
+	return f.run(ctx, request)
+}
+
+func (f *fakePlugin) Metadata() transform.PluginMetadata {
+	return f.metadata
+}
+
+// testServer serves plugin on a Unix socket and counts the calls.
+type testServer struct {
+	socketPath string
+	runs       int32
+	streams    int32
+}
+
+func startServer(t *testing.T, plugin transform.Plugin, withoutStream bool) *testServer {
+	ts := &testServer{socketPath: filepath.Join(t.TempDir(), "plugin.sock")}
+	listener, err := net.Listen("unix", ts.socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if info.FullMethod == runMethod {
+				atomic.AddInt32(&ts.runs, 1)
+			}
+			return handler(ctx, req)
+		}),
+		grpc.ChainStreamInterceptor(func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			atomic.AddInt32(&ts.streams, 1)
+			return handler(srv, ss)
+		}),
+	}
+	var s *grpc.Server
+	if withoutStream {
+		// A plugin written against an older definition of the service.
+		desc := serviceDesc
+		desc.Streams = nil
+		s = grpc.NewServer(opts...)
+		s.RegisterService(&desc, &server{plugin: plugin})
+	} else {
+		s = NewServer(plugin, opts...)
+	}
+	go s.Serve(listener)
+	t.Cleanup(s.Stop)
+	return ts
+}
+
+func pod(name string) transform.PluginRequest {
+	u := unstructured.Unstructured{}
+	u.SetAPIVersion("v1")
+	u.SetKind("Pod")
+	u.SetName(name)
+	return transform.PluginRequest{
+		Unstructured: u,
+		Extras:       map[string]string{"flag": "value"},
+		Context:      &transform.RequestContext{TargetClusterVersion: "v1.27.0"},
+	}
+}
+
+func echoPlugin(versions ...transform.Version) *fakePlugin {
+	return &fakePlugin{
+		metadata: transform.PluginMetadata{
+			Name:            "echo",
+			Version:         "v1",
+			RequestVersion:  versions,
+			ResponseVersion: versions,
+		},
+		run: func(ctx context.Context, request transform.PluginRequest) (transform.PluginResponse, error) {
+			switch request.GetName() {
+			case "invalid":
+				return transform.PluginResponse{}, &transformerrors.PluginError{
+					Type:         transformerrors.PluginInvalidInputError,
+					Message:      "invalid object",
+					ErrorMessage: "no spec",
+				}
+			case "fail":
+				return transform.PluginResponse{}, fmt.Errorf("plugin failed")
+			case "block":
+				<-ctx.Done()
+				return transform.PluginResponse{}, ctx.Err()
+			}
+			resp := transform.PluginResponse{
+				Version:     string(request.Version),
+				Warnings:    []string{request.GetName()},
+				Annotations: request.Extras,
+			}
+			if request.Context != nil {
+				resp.Annotations = map[string]string{"target": request.Context.TargetClusterVersion}
+			}
+			return resp, nil
+		},
+	}
+}
+
+func TestNewGRPCPlugin(t *testing.T) {
+	t.Run("Metadata", func(t *testing.T) {
+		plugin := echoPlugin(transform.V1, transform.V2)
+		ts := startServer(t, plugin, false)
+		p, err := NewGRPCPlugin(ts.socketPath, logrus.New())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer p.(*GRPCPlugin).Close()
+		if !reflect.DeepEqual(p.Metadata(), plugin.metadata) {
+			t.Errorf("Metadata() got = %v, want %v", p.Metadata(), plugin.metadata)
+		}
+	})
+
+	t.Run("NoCommonVersion", func(t *testing.T) {
+		ts := startServer(t, echoPlugin("v0"), false)
+		if _, err := NewGRPCPlugin(ts.socketPath, logrus.New()); err == nil {
+			t.Error("expected an error for a plugin without a common version")
+		}
+	})
+
+	t.Run("NoServer", func(t *testing.T) {
+		_, err := NewGRPCPlugin(filepath.Join(t.TempDir(), "missing.sock"), logrus.New())
+		if !transformerrors.IsInvalidIOError(err) {
+			t.Errorf("expected an IO error, got %v", err)
+		}
+	})
+}
+
+func TestGRPCPlugin_Run(t *testing.T) {
+	for _, streaming := range []bool{false, true} {
+		t.Run(fmt.Sprintf("Streaming=%v", streaming), func(t *testing.T) {
+			cases := []struct {
+				name     string
+				versions []transform.Version
+				request  transform.PluginRequest
+				want     transform.PluginResponse
+				wantErr  func(error) bool
+			}{
+				{
+					name:     "V2",
+					versions: []transform.Version{transform.V1, transform.V2},
+					request:  pod("pod"),
+					want: transform.PluginResponse{
+						Version:     "v2",
+						Warnings:    []string{"pod"},
+						Annotations: map[string]string{"target": "v1.27.0"},
+					},
+				},
+				{
+					name:     "V1",
+					versions: []transform.Version{transform.V1},
+					request:  pod("pod"),
+					// The request context is dropped, and so are the V2
+					// fields of the response.
+					want: transform.PluginResponse{},
+				},
+				{
+					name:     "PluginError",
+					versions: []transform.Version{transform.V2},
+					request:  pod("invalid"),
+					wantErr:  transformerrors.IsInvalidInputError,
+				},
+				{
+					name:     "RunError",
+					versions: []transform.Version{transform.V2},
+					request:  pod("fail"),
+					wantErr:  transformerrors.IsPluginRunError,
+				},
+			}
+			for _, c := range cases {
+				t.Run(c.name, func(t *testing.T) {
+					ts := startServer(t, echoPlugin(c.versions...), false)
+					p, err := NewGRPCPluginWithOptions(ts.socketPath, logrus.New(), Options{Streaming: streaming})
+					if err != nil {
+						t.Fatal(err)
+					}
+					defer p.(*GRPCPlugin).Close()
+					got, err := p.Run(c.request)
+					if c.wantErr != nil {
+						if !c.wantErr(err) {
+							t.Errorf("Run() got unexpected error %v", err)
+						}
+						return
+					}
+					if err != nil {
+						t.Fatalf("Run() error = %v", err)
+					}
+					if !reflect.DeepEqual(got, c.want) {
+						t.Errorf("Run() got = %+v, want %+v", got, c.want)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestGRPCPlugin_Streaming(t *testing.T) {
+	names := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	runAll := func(t *testing.T, p transform.Plugin) {
+		wg := sync.WaitGroup{}
+		for _, name := range names {
+			wg.Add(1)
+			go func(name string) {
+				defer wg.Done()
+				resp, err := p.Run(pod(name))
+				if err != nil {
+					t.Errorf("%s: Run() error = %v", name, err)
+					return
+				}
+				if !reflect.DeepEqual(resp.Warnings, []string{name}) {
+					t.Errorf("%s: got response for %v", name, resp.Warnings)
+				}
+			}(name)
+		}
+		wg.Wait()
+	}
+
+	t.Run("SingleStream", func(t *testing.T) {
+		ts := startServer(t, echoPlugin(transform.V2), false)
+		p, err := NewGRPCPluginWithOptions(ts.socketPath, logrus.New(), Options{Streaming: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		runAll(t, p)
+		if err := p.(*GRPCPlugin).Close(); err != nil {
+			t.Errorf("Close() error = %v", err)
+		}
+		if ts.streams != 1 || ts.runs != 0 {
+			t.Errorf("expected a single stream and no run calls, got %d streams and %d runs", ts.streams, ts.runs)
+		}
+		if _, err := p.Run(pod("a")); err == nil {
+			t.Error("expected an error running a closed plugin")
+		}
+	})
+
+	t.Run("FallbackWithoutRunStream", func(t *testing.T) {
+		ts := startServer(t, echoPlugin(transform.V2), true)
+		p, err := NewGRPCPluginWithOptions(ts.socketPath, logrus.New(), Options{Streaming: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer p.(*GRPCPlugin).Close()
+		runAll(t, p)
+		if ts.runs != int32(len(names)) {
+			t.Errorf("expected %d run calls, got %d", len(names), ts.runs)
+		}
+	})
+
+	t.Run("ObjectsSentOnce", func(t *testing.T) {
+		// The plugin reports where the objects of the export are in its
+		// memory, requests sharing them were sent the objects once.
+		seen := sync.Map{}
+		ts := startServer(t, &fakePlugin{
+			metadata: transform.PluginMetadata{
+				Name:            "index",
+				Version:         "v1",
+				RequestVersion:  []transform.Version{transform.V2},
+				ResponseVersion: []transform.Version{transform.V2},
+				Capabilities:    []transform.Capability{transform.CapabilityResourceIndex},
+			},
+			run: func(ctx context.Context, request transform.PluginRequest) (transform.PluginResponse, error) {
+				if objects := request.Context.Objects; len(objects) == request.Context.Index().Len() && len(objects) > 0 {
+					seen.Store(&objects[0], true)
+				}
+				return transform.PluginResponse{Version: string(transform.V2)}, nil
+			},
+		}, false)
+		p, err := NewGRPCPluginWithOptions(ts.socketPath, logrus.New(), Options{Streaming: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer p.(*GRPCPlugin).Close()
+		objects := []unstructured.Unstructured{}
+		for _, name := range names {
+			objects = append(objects, pod(name).Unstructured)
+		}
+		runner := transform.NewRunner(logrus.New(), nil, nil)
+		runner.Workers = 4
+		if _, err := runner.RunBatch(context.Background(), objects, []transform.Plugin{p}); err != nil {
+			t.Fatal(err)
+		}
+		count := 0
+		seen.Range(func(_, _ interface{}) bool {
+			count++
+			return true
+		})
+		if count != 1 {
+			t.Errorf("expected the objects to be received once, got %d copies", count)
+		}
+	})
+}
+
+func TestGRPCPlugin_RunWithContext(t *testing.T) {
+	for _, streaming := range []bool{false, true} {
+		t.Run(fmt.Sprintf("Streaming=%v", streaming), func(t *testing.T) {
+			ts := startServer(t, echoPlugin(transform.V2), false)
+			p, err := NewGRPCPluginWithOptions(ts.socketPath, logrus.New(), Options{Streaming: streaming})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer p.(*GRPCPlugin).Close()
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			_, err = p.(*GRPCPlugin).RunWithContext(ctx, pod("block"))
+			if err != context.DeadlineExceeded {
+				t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+			}
+			// The plugin is still usable.
+			if _, err := p.Run(pod("a")); err != nil {
+				t.Errorf("Run() error = %v", err)
+			}
+		})
+	}
+}
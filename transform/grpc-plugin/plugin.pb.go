@@ -0,0 +1,320 @@
+// The service served by gRPC plugins. Messages carry the JSON encoding of the
+// transform types, in the format binary plugins read and write, so that
+// plugins in any language share the documented JSON schema.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.7
+// 	protoc        (unknown)
+// source: transform/grpc-plugin/plugin.proto
+
+package grpc_plugin
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type MetadataRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MetadataRequest) Reset() {
+	*x = MetadataRequest{}
+	mi := &file_transform_grpc_plugin_plugin_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MetadataRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MetadataRequest) ProtoMessage() {}
+
+func (x *MetadataRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_transform_grpc_plugin_plugin_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MetadataRequest.ProtoReflect.Descriptor instead.
+func (*MetadataRequest) Descriptor() ([]byte, []int) {
+	return file_transform_grpc_plugin_plugin_proto_rawDescGZIP(), []int{0}
+}
+
+type MetadataResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// metadata is the JSON encoding of a transform.PluginMetadata.
+	Metadata      []byte `protobuf:"bytes,1,opt,name=metadata,proto3" json:"metadata,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MetadataResponse) Reset() {
+	*x = MetadataResponse{}
+	mi := &file_transform_grpc_plugin_plugin_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MetadataResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MetadataResponse) ProtoMessage() {}
+
+func (x *MetadataResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_transform_grpc_plugin_plugin_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MetadataResponse.ProtoReflect.Descriptor instead.
+func (*MetadataResponse) Descriptor() ([]byte, []int) {
+	return file_transform_grpc_plugin_plugin_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *MetadataResponse) GetMetadata() []byte {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
+type RunRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// request is the JSON encoding of a transform.PluginRequest.
+	Request       []byte `protobuf:"bytes,1,opt,name=request,proto3" json:"request,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RunRequest) Reset() {
+	*x = RunRequest{}
+	mi := &file_transform_grpc_plugin_plugin_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RunRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RunRequest) ProtoMessage() {}
+
+func (x *RunRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_transform_grpc_plugin_plugin_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RunRequest.ProtoReflect.Descriptor instead.
+func (*RunRequest) Descriptor() ([]byte, []int) {
+	return file_transform_grpc_plugin_plugin_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *RunRequest) GetRequest() []byte {
+	if x != nil {
+		return x.Request
+	}
+	return nil
+}
+
+type RunResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// response is the JSON encoding of a transform.PluginResponse.
+	Response      []byte `protobuf:"bytes,1,opt,name=response,proto3" json:"response,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RunResponse) Reset() {
+	*x = RunResponse{}
+	mi := &file_transform_grpc_plugin_plugin_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RunResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RunResponse) ProtoMessage() {}
+
+func (x *RunResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_transform_grpc_plugin_plugin_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RunResponse.ProtoReflect.Descriptor instead.
+func (*RunResponse) Descriptor() ([]byte, []int) {
+	return file_transform_grpc_plugin_plugin_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *RunResponse) GetResponse() []byte {
+	if x != nil {
+		return x.Response
+	}
+	return nil
+}
+
+type StreamFrame struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// frame is the JSON encoding of a transform.StreamFrame.
+	Frame         []byte `protobuf:"bytes,1,opt,name=frame,proto3" json:"frame,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamFrame) Reset() {
+	*x = StreamFrame{}
+	mi := &file_transform_grpc_plugin_plugin_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamFrame) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamFrame) ProtoMessage() {}
+
+func (x *StreamFrame) ProtoReflect() protoreflect.Message {
+	mi := &file_transform_grpc_plugin_plugin_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamFrame.ProtoReflect.Descriptor instead.
+func (*StreamFrame) Descriptor() ([]byte, []int) {
+	return file_transform_grpc_plugin_plugin_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *StreamFrame) GetFrame() []byte {
+	if x != nil {
+		return x.Frame
+	}
+	return nil
+}
+
+var File_transform_grpc_plugin_plugin_proto protoreflect.FileDescriptor
+
+const file_transform_grpc_plugin_plugin_proto_rawDesc = "" +
+	"\n" +
+	"\"transform/grpc-plugin/plugin.proto\x12\x12crane.transform.v1\"\x11\n" +
+	"\x0fMetadataRequest\".\n" +
+	"\x10MetadataResponse\x12\x1a\n" +
+	"\bmetadata\x18\x01 \x01(\fR\bmetadata\"&\n" +
+	"\n" +
+	"RunRequest\x12\x18\n" +
+	"\arequest\x18\x01 \x01(\fR\arequest\")\n" +
+	"\vRunResponse\x12\x1a\n" +
+	"\bresponse\x18\x01 \x01(\fR\bresponse\"#\n" +
+	"\vStreamFrame\x12\x14\n" +
+	"\x05frame\x18\x01 \x01(\fR\x05frame2\xfa\x01\n" +
+	"\x06Plugin\x12U\n" +
+	"\bMetadata\x12#.crane.transform.v1.MetadataRequest\x1a$.crane.transform.v1.MetadataResponse\x12F\n" +
+	"\x03Run\x12\x1e.crane.transform.v1.RunRequest\x1a\x1f.crane.transform.v1.RunResponse\x12Q\n" +
+	"\tRunStream\x12\x1f.crane.transform.v1.StreamFrame\x1a\x1f.crane.transform.v1.StreamFrame(\x010\x01BAZ?github.com/konveyor/crane-lib/transform/grpc-plugin;grpc_pluginb\x06proto3"
+
+var (
+	file_transform_grpc_plugin_plugin_proto_rawDescOnce sync.Once
+	file_transform_grpc_plugin_plugin_proto_rawDescData []byte
+)
+
+func file_transform_grpc_plugin_plugin_proto_rawDescGZIP() []byte {
+	file_transform_grpc_plugin_plugin_proto_rawDescOnce.Do(func() {
+		file_transform_grpc_plugin_plugin_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_transform_grpc_plugin_plugin_proto_rawDesc), len(file_transform_grpc_plugin_plugin_proto_rawDesc)))
+	})
+	return file_transform_grpc_plugin_plugin_proto_rawDescData
+}
+
+var file_transform_grpc_plugin_plugin_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_transform_grpc_plugin_plugin_proto_goTypes = []any{
+	(*MetadataRequest)(nil),  // 0: crane.transform.v1.MetadataRequest
+	(*MetadataResponse)(nil), // 1: crane.transform.v1.MetadataResponse
+	(*RunRequest)(nil),       // 2: crane.transform.v1.RunRequest
+	(*RunResponse)(nil),      // 3: crane.transform.v1.RunResponse
+	(*StreamFrame)(nil),      // 4: crane.transform.v1.StreamFrame
+}
+var file_transform_grpc_plugin_plugin_proto_depIdxs = []int32{
+	0, // 0: crane.transform.v1.Plugin.Metadata:input_type -> crane.transform.v1.MetadataRequest
+	2, // 1: crane.transform.v1.Plugin.Run:input_type -> crane.transform.v1.RunRequest
+	4, // 2: crane.transform.v1.Plugin.RunStream:input_type -> crane.transform.v1.StreamFrame
+	1, // 3: crane.transform.v1.Plugin.Metadata:output_type -> crane.transform.v1.MetadataResponse
+	3, // 4: crane.transform.v1.Plugin.Run:output_type -> crane.transform.v1.RunResponse
+	4, // 5: crane.transform.v1.Plugin.RunStream:output_type -> crane.transform.v1.StreamFrame
+	3, // [3:6] is the sub-list for method output_type
+	0, // [0:3] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_transform_grpc_plugin_plugin_proto_init() }
+func file_transform_grpc_plugin_plugin_proto_init() {
+	if File_transform_grpc_plugin_plugin_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_transform_grpc_plugin_plugin_proto_rawDesc), len(file_transform_grpc_plugin_plugin_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   5,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_transform_grpc_plugin_plugin_proto_goTypes,
+		DependencyIndexes: file_transform_grpc_plugin_plugin_proto_depIdxs,
+		MessageInfos:      file_transform_grpc_plugin_plugin_proto_msgTypes,
+	}.Build()
+	File_transform_grpc_plugin_plugin_proto = out.File
+	file_transform_grpc_plugin_plugin_proto_goTypes = nil
+	file_transform_grpc_plugin_plugin_proto_depIdxs = nil
+}
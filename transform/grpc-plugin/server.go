@@ -0,0 +1,161 @@
+package grpc_plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/konveyor/crane-lib/transform"
+	transformerrors "github.com/konveyor/crane-lib/transform/errors"
+	"google.golang.org/grpc"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+type server struct {
+	plugin transform.Plugin
+}
+
+// NewServer returns a gRPC server serving plugin. opts are passed on to
+// grpc.NewServer.
+func NewServer(plugin transform.Plugin, opts ...grpc.ServerOption) *grpc.Server {
+	s := grpc.NewServer(opts...)
+	s.RegisterService(&serviceDesc, &server{plugin: plugin})
+	return s
+}
+
+// ListenAndServe serves plugin on the Unix socket at socketPath until the
+// server fails. A socket left behind by a previous run is replaced.
+func ListenAndServe(socketPath string, plugin transform.Plugin) error {
+	if info, err := os.Lstat(socketPath); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return fmt.Errorf("%s exists and is not a socket", socketPath)
+		}
+		if err := os.Remove(socketPath); err != nil {
+			return err
+		}
+	}
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return err
+	}
+	return NewServer(plugin).Serve(listener)
+}
+
+func (s *server) metadata(_ context.Context) (transform.PluginMetadata, error) {
+	return s.plugin.Metadata(), nil
+}
+
+func (s *server) run(ctx context.Context, rawRequest json.RawMessage) (transform.PluginResponse, error) {
+	return s.runWithObjects(ctx, rawRequest, transform.StreamObjects{})
+}
+
+// runWithObjects runs the request with the objects of the export received
+// on its stream.
+func (s *server) runWithObjects(ctx context.Context, rawRequest json.RawMessage, objects transform.StreamObjects) (transform.PluginResponse, error) {
+	request := transform.PluginRequest{}
+	err := json.Unmarshal(rawRequest, &request)
+	if err != nil {
+		return transform.PluginResponse{}, &transformerrors.PluginError{
+			Type:         transformerrors.PluginInvalidInputError,
+			Message:      "error reading plugin request",
+			ErrorMessage: err.Error(),
+		}
+	}
+	objects.Restore(&request)
+	if p, ok := s.plugin.(transform.PluginRunWithContext); ok {
+		return p.RunWithContext(ctx, request)
+	}
+	return s.plugin.Run(request)
+}
+
+// rawFrame is a transform.StreamFrame whose request is decoded by the
+// service.
+type rawFrame struct {
+	ID      uint64                      `json:"id"`
+	Type    transform.StreamFrameType   `json:"type"`
+	Request json.RawMessage             `json:"request,omitempty"`
+	Objects []unstructured.Unstructured `json:"objects,omitempty"`
+}
+
+// runStream runs the requests of the stream concurrently and sends every
+// reply as soon as it is ready. A shutdown frame cancels the requests still
+// running, the end of the input waits for them.
+func (s *server) runStream(stream grpc.ServerStream) error {
+	ctx, cancel := context.WithCancel(stream.Context())
+	sendMu := sync.Mutex{}
+	send := func(frame transform.StreamFrame) error {
+		sendMu.Lock()
+		defer sendMu.Unlock()
+		return sendFrame(stream, frame)
+	}
+	// Replies cannot be sent once the handler returned.
+	wg := sync.WaitGroup{}
+	defer wg.Wait()
+	defer cancel()
+
+	objects := transform.StreamObjects{}
+	for {
+		in := rawFrame{}
+		err := recvFrame(stream, &in)
+		if err == io.EOF {
+			wg.Wait()
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch in.Type {
+		case transform.StreamFrameShutdown:
+			return nil
+		case transform.StreamFrameObjects:
+			objects.Receive(in.Objects)
+		case transform.StreamFrameHealth:
+			err = send(transform.StreamFrame{ID: in.ID, Type: transform.StreamFrameHealth})
+		case transform.StreamFrameRequest:
+			wg.Add(1)
+			// The request runs with the objects received before it.
+			go func(in rawFrame, objects transform.StreamObjects) {
+				defer wg.Done()
+				reply := transform.StreamFrame{ID: in.ID, Type: transform.StreamFrameResponse}
+				resp, err := s.runWithObjects(ctx, in.Request, objects)
+				if err != nil {
+					reply.Type = transform.StreamFrameError
+					reply.Error = asPluginError(err)
+				} else {
+					reply.Response = &resp
+				}
+				// A failed send breaks the stream, which RecvMsg reports.
+				send(reply)
+			}(in, objects)
+		default:
+			err = send(transform.StreamFrame{ID: in.ID, Type: transform.StreamFrameError, Error: &transformerrors.PluginError{
+				Type:         transformerrors.PluginInvalidInputError,
+				Message:      "unknown stream frame type",
+				ErrorMessage: string(in.Type),
+			}})
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// asPluginError returns err as an *errors.PluginError, wrapping it as a
+// run error if needed.
+func asPluginError(err error) *transformerrors.PluginError {
+	perr := &transformerrors.PluginError{}
+	if errors.As(err, &perr) {
+		return perr
+	}
+	return &transformerrors.PluginError{
+		Type:         transformerrors.PluginRunError,
+		Message:      "error when running plugin",
+		ErrorMessage: err.Error(),
+	}
+}
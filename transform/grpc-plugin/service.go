@@ -0,0 +1,187 @@
+package grpc_plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/konveyor/crane-lib/transform"
+	transformerrors "github.com/konveyor/crane-lib/transform/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// The plugin service is defined by plugin.proto. Its messages carry the JSON
+// encoding of the transform types:
+//
+//	Metadata(MetadataRequest) returns (MetadataResponse{transform.PluginMetadata})
+//	Run(RunRequest{transform.PluginRequest}) returns (RunResponse{transform.PluginResponse})
+//	RunStream(stream StreamFrame{transform.StreamFrame}) returns (stream StreamFrame{transform.StreamFrame})
+//
+// RunStream follows the streaming protocol of binary plugins without the
+// initial stream request. Failures are returned as a gRPC status whose
+// message is the JSON encoding of an errors.PluginError.
+const (
+	ServiceName = "crane.transform.v1.Plugin"
+
+	metadataMethod  = "/" + ServiceName + "/Metadata"
+	runMethod       = "/" + ServiceName + "/Run"
+	runStreamMethod = "/" + ServiceName + "/RunStream"
+)
+
+//go:generate protoc --proto_path=../.. --go_out=../.. --go_opt=paths=source_relative transform/grpc-plugin/plugin.proto
+
+// msgStream is either side of a RunStream stream.
+type msgStream interface {
+	SendMsg(m interface{}) error
+	RecvMsg(m interface{}) error
+}
+
+// sendFrame sends the JSON encoding of frame on stream.
+func sendFrame(stream msgStream, frame interface{}) error {
+	b, err := json.Marshal(frame)
+	if err != nil {
+		return err
+	}
+	return stream.SendMsg(&StreamFrame{Frame: b})
+}
+
+// decodeMessage decodes the JSON carried by a message.
+func decodeMessage(data []byte, v interface{}) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return &transformerrors.PluginError{
+			Type:         transformerrors.PluginInvalidIOError,
+			Message:      "invalid JSON in the message",
+			ErrorMessage: err.Error(),
+		}
+	}
+	return nil
+}
+
+// recvFrame receives the next message of stream and decodes its frame into
+// frame.
+func recvFrame(stream msgStream, frame interface{}) error {
+	msg := &StreamFrame{}
+	if err := stream.RecvMsg(msg); err != nil {
+		return err
+	}
+	return decodeMessage(msg.GetFrame(), frame)
+}
+
+// pluginService is implemented by the server side of the plugin service.
+type pluginService interface {
+	metadata(ctx context.Context) (transform.PluginMetadata, error)
+	// run returns the errors of the plugin, which the handler converts to a
+	// gRPC status.
+	run(ctx context.Context, rawRequest json.RawMessage) (transform.PluginResponse, error)
+	runStream(stream grpc.ServerStream) error
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*pluginService)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Metadata",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := &MetadataRequest{}
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				handler := func(ctx context.Context, _ interface{}) (interface{}, error) {
+					metadata, err := srv.(pluginService).metadata(ctx)
+					if err != nil {
+						return nil, err
+					}
+					b, err := json.Marshal(metadata)
+					if err != nil {
+						return nil, err
+					}
+					return &MetadataResponse{Metadata: b}, nil
+				}
+				if interceptor == nil {
+					return handler(ctx, in)
+				}
+				return interceptor(ctx, in, &grpc.UnaryServerInfo{Server: srv, FullMethod: metadataMethod}, handler)
+			},
+		},
+		{
+			MethodName: "Run",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				// The request is decoded by the service so an invalid object
+				// is reported as invalid input.
+				in := &RunRequest{}
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				handler := func(ctx context.Context, in interface{}) (interface{}, error) {
+					resp, err := srv.(pluginService).run(ctx, in.(*RunRequest).GetRequest())
+					if err != nil {
+						return nil, toStatus(err)
+					}
+					b, err := json.Marshal(resp)
+					if err != nil {
+						return nil, toStatus(err)
+					}
+					return &RunResponse{Response: b}, nil
+				}
+				if interceptor == nil {
+					return handler(ctx, in)
+				}
+				return interceptor(ctx, in, &grpc.UnaryServerInfo{Server: srv, FullMethod: runMethod}, handler)
+			},
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName: "RunStream",
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				return srv.(pluginService).runStream(stream)
+			},
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+}
+
+var pluginErrorCodes = map[string]codes.Code{
+	transformerrors.PluginInvalidInputError: codes.InvalidArgument,
+	transformerrors.PluginRunError:          codes.Internal,
+	transformerrors.PluginInvalidIOError:    codes.Unavailable,
+}
+
+// toStatus converts an error returned by a plugin into a gRPC status.
+func toStatus(err error) error {
+	perr := asPluginError(err)
+	code, ok := pluginErrorCodes[perr.Type]
+	if !ok {
+		code = codes.Unknown
+	}
+	return status.Error(code, perr.Error())
+}
+
+// fromStatus converts an error returned by a gRPC call into an
+// *errors.PluginError.
+func fromStatus(err error) error {
+	perr := &transformerrors.PluginError{}
+	if errors.As(err, &perr) {
+		return perr
+	}
+	st := status.Convert(err)
+	if json.Unmarshal([]byte(st.Message()), perr) == nil && perr.Type != "" {
+		return perr
+	}
+	perr = &transformerrors.PluginError{
+		Type:         transformerrors.PluginRunError,
+		Message:      "error calling the grpc plugin",
+		ErrorMessage: st.Message(),
+	}
+	switch st.Code() {
+	case codes.InvalidArgument:
+		perr.Type = transformerrors.PluginInvalidInputError
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Canceled, codes.ResourceExhausted:
+		perr.Type = transformerrors.PluginInvalidIOError
+	}
+	return perr
+}
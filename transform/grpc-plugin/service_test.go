@@ -0,0 +1,101 @@
+package grpc_plugin
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/bufbuild/protocompile"
+	"github.com/konveyor/crane-lib/transform"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const protoPath = "transform/grpc-plugin/plugin.proto"
+
+// compileProto compiles plugin.proto as protoc would from the root of the
+// repository.
+func compileProto(t *testing.T) protoreflect.FileDescriptor {
+	t.Helper()
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{ImportPaths: []string{"../.."}}),
+	}
+	files, err := compiler.Compile(context.Background(), protoPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files[0]
+}
+
+// TestProtoDefinition checks that the generated code matches plugin.proto.
+func TestProtoDefinition(t *testing.T) {
+	want := protodesc.ToFileDescriptorProto(compileProto(t))
+	got := protodesc.ToFileDescriptorProto(File_transform_grpc_plugin_plugin_proto)
+	got.SourceCodeInfo = nil
+	if !proto.Equal(got, want) {
+		t.Errorf("plugin.pb.go is out of date with plugin.proto, regenerate it with go generate")
+	}
+	service := File_transform_grpc_plugin_plugin_proto.Services().ByName("Plugin")
+	if service == nil || string(service.FullName()) != ServiceName {
+		t.Fatalf("plugin.proto does not define %s", ServiceName)
+	}
+	for _, method := range serviceDesc.Methods {
+		if m := service.Methods().ByName(protoreflect.Name(method.MethodName)); m == nil || m.IsStreamingClient() || m.IsStreamingServer() {
+			t.Errorf("plugin.proto does not define the unary method %s", method.MethodName)
+		}
+	}
+	for _, stream := range serviceDesc.Streams {
+		if m := service.Methods().ByName(protoreflect.Name(stream.StreamName)); m == nil || m.IsStreamingClient() != stream.ClientStreams || m.IsStreamingServer() != stream.ServerStreams {
+			t.Errorf("plugin.proto does not define the stream %s", stream.StreamName)
+		}
+	}
+}
+
+// TestProtoClient calls a plugin with messages built from plugin.proto only,
+// as a client generated in another language would.
+func TestProtoClient(t *testing.T) {
+	file := compileProto(t)
+	message := func(name string) *dynamicpb.Message {
+		return dynamicpb.NewMessage(file.Messages().ByName(protoreflect.Name(name)))
+	}
+	ts := startServer(t, echoPlugin(transform.V1, transform.V2), false)
+	conn, err := grpc.NewClient("unix:"+ts.socketPath, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	metadataResponse := message("MetadataResponse")
+	if err := conn.Invoke(context.Background(), metadataMethod, message("MetadataRequest"), metadataResponse); err != nil {
+		t.Fatal(err)
+	}
+	metadata := transform.PluginMetadata{}
+	if err := json.Unmarshal(metadataResponse.Get(file.Messages().ByName("MetadataResponse").Fields().ByName("metadata")).Bytes(), &metadata); err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Name != "echo" {
+		t.Errorf("Metadata() name = %q, want echo", metadata.Name)
+	}
+
+	b, err := json.Marshal(pod("web").ForVersion(transform.V2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runRequest := message("RunRequest")
+	runRequest.Set(file.Messages().ByName("RunRequest").Fields().ByName("request"), protoreflect.ValueOfBytes(b))
+	runResponse := message("RunResponse")
+	if err := conn.Invoke(context.Background(), runMethod, runRequest, runResponse); err != nil {
+		t.Fatal(err)
+	}
+	resp := transform.PluginResponse{}
+	if err := json.Unmarshal(runResponse.Get(file.Messages().ByName("RunResponse").Fields().ByName("response")).Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Warnings) != 1 || resp.Warnings[0] != "web" {
+		t.Errorf("Run() warnings = %v, want [web]", resp.Warnings)
+	}
+}
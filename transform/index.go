@@ -0,0 +1,139 @@
+package transform
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ResourceIndex is a read-only view of the objects of an export, for plugins
+// whose decisions depend on related objects. Every method returns copies, so
+// the index can be shared by plugins running concurrently. A nil
+// ResourceIndex is empty.
+type ResourceIndex struct {
+	objects []unstructured.Unstructured
+	byKind  map[schema.GroupKind][]int
+	byUID   map[types.UID]int
+}
+
+// NewResourceIndex indexes objects.
+func NewResourceIndex(objects []unstructured.Unstructured) *ResourceIndex {
+	index := &ResourceIndex{
+		objects: make([]unstructured.Unstructured, len(objects)),
+		byKind:  map[schema.GroupKind][]int{},
+		byUID:   map[types.UID]int{},
+	}
+	for i, o := range objects {
+		index.objects[i] = *o.DeepCopy()
+		gk := o.GroupVersionKind().GroupKind()
+		index.byKind[gk] = append(index.byKind[gk], i)
+		if uid := o.GetUID(); uid != "" {
+			index.byUID[uid] = i
+		}
+	}
+	return index
+}
+
+// Len returns the number of objects in the index.
+func (r *ResourceIndex) Len() int {
+	if r == nil {
+		return 0
+	}
+	return len(r.objects)
+}
+
+// Get returns the object with the given kind, namespace and name. An empty
+// version in gvk matches every version.
+func (r *ResourceIndex) Get(gvk schema.GroupVersionKind, namespace, name string) (*unstructured.Unstructured, bool) {
+	if r == nil {
+		return nil, false
+	}
+	for _, i := range r.byKind[gvk.GroupKind()] {
+		o := &r.objects[i]
+		if matchesVersion(o, gvk.Version) && o.GetNamespace() == namespace && o.GetName() == name {
+			return o.DeepCopy(), true
+		}
+	}
+	return nil, false
+}
+
+// List returns the objects of the given kind in namespace whose labels match
+// selector. An empty version in gvk matches every version, an empty namespace
+// every namespace and a nil selector every object.
+func (r *ResourceIndex) List(gvk schema.GroupVersionKind, namespace string, selector labels.Selector) []unstructured.Unstructured {
+	objects := []unstructured.Unstructured{}
+	if r == nil {
+		return objects
+	}
+	for _, i := range r.byKind[gvk.GroupKind()] {
+		o := &r.objects[i]
+		if !matchesVersion(o, gvk.Version) || (namespace != "" && o.GetNamespace() != namespace) {
+			continue
+		}
+		if selector != nil && !selector.Matches(labels.Set(o.GetLabels())) {
+			continue
+		}
+		objects = append(objects, *o.DeepCopy())
+	}
+	return objects
+}
+
+// Owner returns the object an owner reference of an object in namespace
+// points to. The reference is matched on its UID when the index knows it,
+// and on its kind and name otherwise, since exports may drop UIDs.
+func (r *ResourceIndex) Owner(namespace string, ref metav1.OwnerReference) (*unstructured.Unstructured, bool) {
+	if r == nil {
+		return nil, false
+	}
+	if i, ok := r.byUID[ref.UID]; ok && ref.UID != "" {
+		return r.objects[i].DeepCopy(), true
+	}
+	gv, err := schema.ParseGroupVersion(ref.APIVersion)
+	if err != nil {
+		return nil, false
+	}
+	// Owners are either in the same namespace or cluster scoped.
+	if o, ok := r.Get(gv.WithKind(ref.Kind), namespace, ref.Name); ok {
+		return o, true
+	}
+	return r.Get(gv.WithKind(ref.Kind), "", ref.Name)
+}
+
+// Owned returns the objects that have owner in their owner references.
+func (r *ResourceIndex) Owned(owner unstructured.Unstructured) []unstructured.Unstructured {
+	objects := []unstructured.Unstructured{}
+	if r == nil {
+		return objects
+	}
+	ownerGK := owner.GroupVersionKind().GroupKind()
+	for i := range r.objects {
+		o := &r.objects[i]
+		for _, ref := range o.GetOwnerReferences() {
+			if isOwnerReference(ref, o.GetNamespace(), owner, ownerGK) {
+				objects = append(objects, *o.DeepCopy())
+				break
+			}
+		}
+	}
+	return objects
+}
+
+func isOwnerReference(ref metav1.OwnerReference, namespace string, owner unstructured.Unstructured, ownerGK schema.GroupKind) bool {
+	if ref.UID != "" && owner.GetUID() != "" {
+		return ref.UID == owner.GetUID()
+	}
+	gv, err := schema.ParseGroupVersion(ref.APIVersion)
+	if err != nil {
+		return false
+	}
+	if owner.GetNamespace() != "" && owner.GetNamespace() != namespace {
+		return false
+	}
+	return gv.WithKind(ref.Kind).GroupKind() == ownerGK && ref.Name == owner.GetName()
+}
+
+func matchesVersion(o *unstructured.Unstructured, version string) bool {
+	return version == "" || o.GroupVersionKind().Version == version
+}
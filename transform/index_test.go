@@ -0,0 +1,108 @@
+package transform
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func indexObject(apiVersion, kind, namespace, name string, labels map[string]interface{}, owners ...interface{}) unstructured.Unstructured {
+	metadata := map[string]interface{}{"name": name}
+	if namespace != "" {
+		metadata["namespace"] = namespace
+	}
+	if labels != nil {
+		metadata["labels"] = labels
+	}
+	if len(owners) > 0 {
+		metadata["ownerReferences"] = owners
+	}
+	return unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": apiVersion,
+		"kind":       kind,
+		"metadata":   metadata,
+	}}
+}
+
+func names(objects []unstructured.Unstructured) []string {
+	n := []string{}
+	for _, o := range objects {
+		n = append(n, o.GetNamespace()+"/"+o.GetName())
+	}
+	return n
+}
+
+func TestResourceIndex(t *testing.T) {
+	deployment := indexObject("apps/v1", "Deployment", "ns", "app", map[string]interface{}{"app": "web"})
+	deployment.SetUID("deployment-uid")
+	replicaSet := indexObject("apps/v1", "ReplicaSet", "ns", "app-1", map[string]interface{}{"app": "web"},
+		map[string]interface{}{"apiVersion": "apps/v1", "kind": "Deployment", "name": "app", "uid": "deployment-uid"})
+	pod := indexObject("v1", "Pod", "ns", "app-1-a", map[string]interface{}{"app": "web"},
+		map[string]interface{}{"apiVersion": "apps/v1", "kind": "ReplicaSet", "name": "app-1", "uid": "unknown-uid"})
+	other := indexObject("v1", "Pod", "other", "db", map[string]interface{}{"app": "db"})
+	index := NewResourceIndex([]unstructured.Unstructured{deployment, replicaSet, pod, other})
+
+	if index.Len() != 4 {
+		t.Errorf("Len() = %d, want 4", index.Len())
+	}
+
+	deploymentGVK := schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+	if got, ok := index.Get(deploymentGVK, "ns", "app"); !ok || got.GetUID() != "deployment-uid" {
+		t.Errorf("Get() = %v, %v, want the deployment", got, ok)
+	}
+	if _, ok := index.Get(schema.GroupVersionKind{Group: "apps", Kind: "Deployment"}, "ns", "app"); !ok {
+		t.Errorf("Get() without a version did not find the deployment")
+	}
+	if _, ok := index.Get(schema.GroupVersionKind{Group: "apps", Version: "v1beta1", Kind: "Deployment"}, "ns", "app"); ok {
+		t.Errorf("Get() found the deployment with another version")
+	}
+
+	podGVK := schema.GroupVersionKind{Version: "v1", Kind: "Pod"}
+	if got := names(index.List(podGVK, "", nil)); !reflect.DeepEqual(got, []string{"ns/app-1-a", "other/db"}) {
+		t.Errorf("List() = %v", got)
+	}
+	if got := names(index.List(podGVK, "", labels.SelectorFromSet(labels.Set{"app": "db"}))); !reflect.DeepEqual(got, []string{"other/db"}) {
+		t.Errorf("List() with a selector = %v", got)
+	}
+	if got := names(index.List(podGVK, "ns", nil)); !reflect.DeepEqual(got, []string{"ns/app-1-a"}) {
+		t.Errorf("List() in a namespace = %v", got)
+	}
+
+	if got := names(index.Owned(deployment)); !reflect.DeepEqual(got, []string{"ns/app-1"}) {
+		t.Errorf("Owned() by UID = %v", got)
+	}
+	if got := names(index.Owned(replicaSet)); !reflect.DeepEqual(got, []string{"ns/app-1-a"}) {
+		t.Errorf("Owned() by name = %v", got)
+	}
+	if owner, ok := index.Owner("ns", metav1.OwnerReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "other", UID: "deployment-uid"}); !ok || owner.GetName() != "app" {
+		t.Errorf("Owner() by UID = %v, %v", owner, ok)
+	}
+	if owner, ok := index.Owner("ns", pod.GetOwnerReferences()[0]); !ok || owner.GetName() != "app-1" {
+		t.Errorf("Owner() by name = %v, %v", owner, ok)
+	}
+
+	// The index is read-only.
+	got, _ := index.Get(deploymentGVK, "ns", "app")
+	got.SetName("changed")
+	if _, ok := index.Get(deploymentGVK, "ns", "app"); !ok {
+		t.Errorf("modifying a returned object changed the index")
+	}
+}
+
+func TestNilResourceIndex(t *testing.T) {
+	var index *ResourceIndex
+	if index.Len() != 0 || len(index.List(schema.GroupVersionKind{Kind: "Pod"}, "", nil)) != 0 || len(index.Owned(unstructured.Unstructured{})) != 0 {
+		t.Errorf("expected a nil index to be empty")
+	}
+	if _, ok := index.Get(schema.GroupVersionKind{Kind: "Pod"}, "", "foo"); ok {
+		t.Errorf("expected a nil index to be empty")
+	}
+	var requestContext *RequestContext
+	if requestContext.Index().Len() != 0 {
+		t.Errorf("expected a nil request context to have an empty index")
+	}
+}
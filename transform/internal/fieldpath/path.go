@@ -0,0 +1,43 @@
+// Package fieldpath walks the fields of decoded objects, with the index of a
+// list item as its field.
+package fieldpath
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Value returns the value at path, which may go through lists with the index
+// of the item as a field, or nil if there is none.
+func Value(obj interface{}, path []string) interface{} {
+	current := obj
+	for _, field := range path {
+		switch c := current.(type) {
+		case map[string]interface{}:
+			current = c[field]
+		case []interface{}:
+			i, err := strconv.Atoi(field)
+			if err != nil || i < 0 || i >= len(c) {
+				return nil
+			}
+			current = c[i]
+		default:
+			return nil
+		}
+	}
+	return current
+}
+
+// Sub returns a new path made of path followed by fields.
+func Sub(path []string, fields ...string) []string {
+	return append(append(make([]string, 0, len(path)+len(fields)), path...), fields...)
+}
+
+// Pointer returns the JSON pointer to path.
+func Pointer(path []string) string {
+	escaped := make([]string, len(path))
+	for i, p := range path {
+		escaped[i] = strings.ReplaceAll(strings.ReplaceAll(p, "~", "~0"), "/", "~1")
+	}
+	return "/" + strings.Join(escaped, "/")
+}
@@ -0,0 +1,51 @@
+package fieldpath
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValue(t *testing.T) {
+	obj := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"containers": []interface{}{
+				map[string]interface{}{"name": "app"},
+			},
+			"replicas": int64(1),
+		},
+	}
+	tests := []struct {
+		name string
+		path []string
+		want interface{}
+	}{
+		{name: "Field", path: []string{"spec", "replicas"}, want: int64(1)},
+		{name: "ListItem", path: []string{"spec", "containers", "0", "name"}, want: "app"},
+		{name: "Missing", path: []string{"spec", "volumes"}},
+		{name: "OutOfRange", path: []string{"spec", "containers", "1", "name"}},
+		{name: "NotAnIndex", path: []string{"spec", "containers", "app"}},
+		{name: "ThroughScalar", path: []string{"spec", "replicas", "value"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Value(obj, tt.path); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Value() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSub(t *testing.T) {
+	path := make([]string, 1, 4)
+	path[0] = "spec"
+	first, second := Sub(path, "a"), Sub(path, "b")
+	if !reflect.DeepEqual(first, []string{"spec", "a"}) || !reflect.DeepEqual(second, []string{"spec", "b"}) {
+		t.Errorf("Sub() = %v and %v, share their backing array", first, second)
+	}
+}
+
+func TestPointer(t *testing.T) {
+	if got, want := Pointer([]string{"metadata", "annotations", "example.com/a~b"}), "/metadata/annotations/example.com~1a~0b"; got != want {
+		t.Errorf("Pointer() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,222 @@
+package jsonpatch
+
+import (
+	"strconv"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/konveyor/crane-lib/transform/internal/fieldpath"
+)
+
+// Conflict describes how two operations interfere with each other.
+type Conflict int
+
+const (
+	// NoConflict means both operations can be applied in either order.
+	NoConflict Conflict = iota
+	// SamePath means both operations target the same path.
+	SamePath
+	// ParentPath means one operation changes a parent of the path the other
+	// one targets, so applying one replaces or removes the other's target.
+	ParentPath
+	// ArrayIndexShift means one operation inserts or removes an array element
+	// before the element the other one targets, shifting its index.
+	ArrayIndexShift
+)
+
+// Conflicts reports whether op1 and op2 touch overlapping parts of doc, the
+// document decoded from JSON both operations apply to.
+func Conflicts(doc interface{}, op1, op2 jsonpatch.Operation) (Conflict, error) {
+	path1, err := op1.Path()
+	if err != nil {
+		return NoConflict, err
+	}
+	path2, err := op2.Path()
+	if err != nil {
+		return NoConflict, err
+	}
+	// Two elements added at the same position of an array are both kept.
+	if path1 == path2 && op1.Kind() == "add" && op2.Kind() == "add" && insertsIntoArray(doc, SplitPointer(path1)) {
+		return NoConflict, nil
+	}
+	if path1 == path2 {
+		return SamePath, nil
+	}
+	// test only reads the document.
+	if op1.Kind() == "test" || op2.Kind() == "test" {
+		return NoConflict, nil
+	}
+
+	for _, ops := range [][2]jsonpatch.Operation{{op1, op2}, {op2, op1}} {
+		changes, err := indexChanges(ops[0])
+		if err != nil {
+			return NoConflict, err
+		}
+		others, err := readPointers(ops[1])
+		if err != nil {
+			return NoConflict, err
+		}
+		for _, change := range changes {
+			for _, other := range others {
+				if shiftsIndex(doc, change, other) {
+					return ArrayIndexShift, nil
+				}
+			}
+		}
+	}
+
+	written1, err := writtenPointers(op1)
+	if err != nil {
+		return NoConflict, err
+	}
+	written2, err := writtenPointers(op2)
+	if err != nil {
+		return NoConflict, err
+	}
+	for _, w1 := range written1 {
+		for _, w2 := range written2 {
+			if isPrefix(w1, w2) || isPrefix(w2, w1) {
+				return ParentPath, nil
+			}
+		}
+	}
+
+	return NoConflict, nil
+}
+
+// SplitPointer splits a JSON pointer into its unescaped reference tokens.
+// The root pointer "" has no tokens.
+func SplitPointer(pointer string) []string {
+	if pointer == "" {
+		return []string{}
+	}
+	tokens := strings.Split(strings.TrimPrefix(pointer, "/"), "/")
+	for i, token := range tokens {
+		token = strings.ReplaceAll(token, "~1", "/")
+		tokens[i] = strings.ReplaceAll(token, "~0", "~")
+	}
+	return tokens
+}
+
+// writtenPointers returns the pointers the operation changes, which for move
+// includes the location it removes the value from. copy only reads its from.
+func writtenPointers(op jsonpatch.Operation) ([][]string, error) {
+	path, err := op.Path()
+	if err != nil {
+		return nil, err
+	}
+	pointers := [][]string{SplitPointer(path)}
+	if op.Kind() == "move" {
+		from, err := op.From()
+		if err != nil {
+			return nil, err
+		}
+		pointers = append(pointers, SplitPointer(from))
+	}
+	return pointers, nil
+}
+
+// isPrefix reports whether parent is a proper prefix of child.
+func isPrefix(parent, child []string) bool {
+	if len(parent) >= len(child) {
+		return false
+	}
+	for i := range parent {
+		if parent[i] != child[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// indexChange is the insertion or the removal of the element at pointer,
+// if pointer is in an array.
+type indexChange struct {
+	pointer []string
+	remove  bool
+}
+
+// indexChanges returns the elements op inserts or removes: move removes the
+// element at from before inserting it at path.
+func indexChanges(op jsonpatch.Operation) ([]indexChange, error) {
+	path, err := op.Path()
+	if err != nil {
+		return nil, err
+	}
+	switch op.Kind() {
+	case "add", "copy":
+		return []indexChange{{pointer: SplitPointer(path)}}, nil
+	case "remove":
+		return []indexChange{{pointer: SplitPointer(path), remove: true}}, nil
+	case "move":
+		from, err := op.From()
+		if err != nil {
+			return nil, err
+		}
+		return []indexChange{{pointer: SplitPointer(from), remove: true}, {pointer: SplitPointer(path)}}, nil
+	}
+	return nil, nil
+}
+
+// readPointers returns the pointers op reads or writes, which for move and
+// copy includes from.
+func readPointers(op jsonpatch.Operation) ([][]string, error) {
+	path, err := op.Path()
+	if err != nil {
+		return nil, err
+	}
+	pointers := [][]string{SplitPointer(path)}
+	if op.Kind() == "move" || op.Kind() == "copy" {
+		from, err := op.From()
+		if err != nil {
+			return nil, err
+		}
+		pointers = append(pointers, SplitPointer(from))
+	}
+	return pointers, nil
+}
+
+// insertsIntoArray reports whether adding at path inserts an element into an
+// array of doc, at an index or at the end with "-".
+func insertsIntoArray(doc interface{}, path []string) bool {
+	if len(path) == 0 {
+		return false
+	}
+	if last := path[len(path)-1]; last != "-" {
+		if _, err := strconv.Atoi(last); err != nil {
+			return false
+		}
+	}
+	_, ok := fieldpath.Value(doc, path[:len(path)-1]).([]interface{})
+	return ok
+}
+
+// shiftsIndex reports whether change moves the array element other points
+// into: an insert at or before it, or a removal before it. Only arrays of doc
+// have indexes, so numeric keys of objects shift nothing.
+func shiftsIndex(doc interface{}, change indexChange, other []string) bool {
+	path := change.pointer
+	if len(path) == 0 || len(other) < len(path) {
+		return false
+	}
+	index, err := strconv.Atoi(path[len(path)-1])
+	if err != nil {
+		// Appending with "-" shifts nothing.
+		return false
+	}
+	parent := path[:len(path)-1]
+	if !isPrefix(parent, other) {
+		return false
+	}
+	if _, ok := fieldpath.Value(doc, parent).([]interface{}); !ok {
+		return false
+	}
+	otherIndex, err := strconv.Atoi(other[len(parent)])
+	if err != nil {
+		return false
+	}
+	if change.remove {
+		return otherIndex > index
+	}
+	return otherIndex >= index
+}
@@ -0,0 +1,207 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	jsonpatch "github.com/evanphx/json-patch"
+)
+
+func testDocument(t *testing.T) interface{} {
+	t.Helper()
+	var doc interface{}
+	err := json.Unmarshal([]byte(`{
+		"metadata": {"labels": {"0": "a", "1": "b"}, "annotations": {"a/b": "c"}},
+		"data": {"1": "a", "2": "b"},
+		"spec": {
+			"template": {"spec": {"containers": [{"image": "nginx"}]}},
+			"initContainers": [{"image": "busybox"}],
+			"containers": [{"image": "nginx"}, {"image": "redis"}, {"image": "envoy"}]
+		}
+	}`), &doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestConflicts(t *testing.T) {
+	tests := []struct {
+		name string
+		op1  string
+		op2  string
+		want Conflict
+	}{
+		{
+			name: "SamePath",
+			op1:  `{"op": "add", "path": "/spec/testing", "value": "test"}`,
+			op2:  `{"op": "remove", "path": "/spec/testing"}`,
+			want: SamePath,
+		},
+		{
+			name: "SiblingPaths",
+			op1:  `{"op": "add", "path": "/spec/testing", "value": "test"}`,
+			op2:  `{"op": "add", "path": "/spec/testing2", "value": "test"}`,
+			want: NoConflict,
+		},
+		{
+			name: "RemoveParent",
+			op1:  `{"op": "remove", "path": "/spec/template"}`,
+			op2:  `{"op": "replace", "path": "/spec/template/spec/containers/0/image", "value": "quay.io/foo"}`,
+			want: ParentPath,
+		},
+		{
+			name: "ReplaceChildOfParent",
+			op1:  `{"op": "replace", "path": "/spec/template/spec/containers/0/image", "value": "quay.io/foo"}`,
+			op2:  `{"op": "replace", "path": "/spec/template", "value": {}}`,
+			want: ParentPath,
+		},
+		{
+			name: "SharedPrefixIsNotParent",
+			op1:  `{"op": "remove", "path": "/spec/temp"}`,
+			op2:  `{"op": "remove", "path": "/spec/template"}`,
+			want: NoConflict,
+		},
+		{
+			name: "MoveFromParent",
+			op1:  `{"op": "move", "from": "/spec/template", "path": "/spec/old"}`,
+			op2:  `{"op": "add", "path": "/spec/template/metadata", "value": {}}`,
+			want: ParentPath,
+		},
+		{
+			name: "CopyFromIsReadOnly",
+			op1:  `{"op": "copy", "from": "/spec/template", "path": "/spec/old"}`,
+			op2:  `{"op": "add", "path": "/spec/template/metadata", "value": {}}`,
+			want: NoConflict,
+		},
+		{
+			name: "TestIsReadOnly",
+			op1:  `{"op": "test", "path": "/spec", "value": {}}`,
+			op2:  `{"op": "add", "path": "/spec/template", "value": {}}`,
+			want: NoConflict,
+		},
+		{
+			name: "InsertBeforeIndex",
+			op1:  `{"op": "add", "path": "/spec/containers/0", "value": {}}`,
+			op2:  `{"op": "replace", "path": "/spec/containers/1/image", "value": "quay.io/foo"}`,
+			want: ArrayIndexShift,
+		},
+		{
+			name: "RemoveBeforeIndex",
+			op1:  `{"op": "replace", "path": "/spec/containers/2/image", "value": "quay.io/foo"}`,
+			op2:  `{"op": "remove", "path": "/spec/containers/1"}`,
+			want: ArrayIndexShift,
+		},
+		{
+			name: "InsertAtIndex",
+			op1:  `{"op": "add", "path": "/spec/containers/1", "value": {}}`,
+			op2:  `{"op": "replace", "path": "/spec/containers/1/image", "value": "quay.io/foo"}`,
+			want: ArrayIndexShift,
+		},
+		{
+			name: "RemoveTargetElement",
+			op1:  `{"op": "remove", "path": "/spec/containers/1"}`,
+			op2:  `{"op": "replace", "path": "/spec/containers/1/image", "value": "quay.io/foo"}`,
+			want: ParentPath,
+		},
+		{
+			name: "RemoveAfterIndex",
+			op1:  `{"op": "replace", "path": "/spec/containers/0/image", "value": "quay.io/foo"}`,
+			op2:  `{"op": "remove", "path": "/spec/containers/1"}`,
+			want: NoConflict,
+		},
+		{
+			name: "AppendShiftsNothing",
+			op1:  `{"op": "add", "path": "/spec/containers/-", "value": {}}`,
+			op2:  `{"op": "replace", "path": "/spec/containers/0/image", "value": "quay.io/foo"}`,
+			want: NoConflict,
+		},
+		{
+			name: "AppendTwice",
+			op1:  `{"op": "add", "path": "/spec/containers/-", "value": {"image": "a"}}`,
+			op2:  `{"op": "add", "path": "/spec/containers/-", "value": {"image": "b"}}`,
+			want: NoConflict,
+		},
+		{
+			name: "InsertTwiceAtIndex",
+			op1:  `{"op": "add", "path": "/spec/containers/1", "value": {"image": "a"}}`,
+			op2:  `{"op": "add", "path": "/spec/containers/1", "value": {"image": "b"}}`,
+			want: NoConflict,
+		},
+		{
+			name: "AddSameNumericObjectKey",
+			op1:  `{"op": "add", "path": "/metadata/labels/0", "value": "a"}`,
+			op2:  `{"op": "add", "path": "/metadata/labels/0", "value": "b"}`,
+			want: SamePath,
+		},
+		{
+			name: "NumericObjectKeys",
+			op1:  `{"op": "add", "path": "/metadata/labels/0", "value": "a"}`,
+			op2:  `{"op": "replace", "path": "/metadata/labels/1", "value": "b"}`,
+			want: NoConflict,
+		},
+		{
+			name: "RemoveNumericObjectKey",
+			op1:  `{"op": "remove", "path": "/data/1"}`,
+			op2:  `{"op": "replace", "path": "/data/2", "value": "b"}`,
+			want: NoConflict,
+		},
+		{
+			name: "MoveFromBeforeIndex",
+			op1:  `{"op": "move", "from": "/spec/containers/0", "path": "/spec/initContainers/-"}`,
+			op2:  `{"op": "replace", "path": "/spec/containers/1/image", "value": "quay.io/foo"}`,
+			want: ArrayIndexShift,
+		},
+		{
+			name: "RemoveShiftsCopyFrom",
+			op1:  `{"op": "copy", "from": "/spec/containers/2", "path": "/spec/initContainers/0"}`,
+			op2:  `{"op": "remove", "path": "/spec/containers/0"}`,
+			want: ArrayIndexShift,
+		},
+		{
+			name: "CopyInsertsBeforeIndex",
+			op1:  `{"op": "copy", "from": "/spec/initContainers/0", "path": "/spec/containers/0"}`,
+			op2:  `{"op": "replace", "path": "/spec/containers/1/image", "value": "quay.io/foo"}`,
+			want: ArrayIndexShift,
+		},
+		{
+			name: "EscapedPointers",
+			op1:  `{"op": "remove", "path": "/metadata/annotations/a~1b"}`,
+			op2:  `{"op": "remove", "path": "/metadata/annotations/a/b"}`,
+			want: NoConflict,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patch, err := jsonpatch.DecodePatch([]byte("[" + tt.op1 + "," + tt.op2 + "]"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Conflicts(testDocument(t), patch[0], patch[1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Conflicts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitPointer(t *testing.T) {
+	tests := []struct {
+		pointer string
+		want    []string
+	}{
+		{pointer: "", want: []string{}},
+		{pointer: "/", want: []string{""}},
+		{pointer: "/spec/containers/0", want: []string{"spec", "containers", "0"}},
+		{pointer: "/metadata/annotations/a~1b~0c", want: []string{"metadata", "annotations", "a/b~c"}},
+	}
+	for _, tt := range tests {
+		if got := SplitPointer(tt.pointer); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitPointer(%q) = %v, want %v", tt.pointer, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+// Package pluginlimit enforces the limits plugins running outside of the
+// caller's process run within.
+package pluginlimit
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	transformerrors "github.com/konveyor/crane-lib/transform/errors"
+)
+
+// WithTimeout returns ctx bounded by timeout. Zero means no timeout.
+func WithTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// Error returns the error for a run that ended because ctx, returned by
+// WithTimeout for parent and timeout, is done, or nil. The error of parent is
+// returned as is, hitting the timeout is a timeout error.
+func Error(parent, ctx context.Context, timeout time.Duration) error {
+	if parent.Err() != nil {
+		return parent.Err()
+	}
+	if ctx.Err() != nil {
+		return &transformerrors.PluginError{
+			Type:         transformerrors.PluginTimeoutError,
+			Message:      "plugin did not finish in time",
+			ErrorMessage: fmt.Sprintf("timed out after %v", timeout),
+		}
+	}
+	return nil
+}
+
+// OutputError is the error for a plugin whose output, described by what,
+// exceeds max bytes.
+func OutputError(max int64, what string) error {
+	return &transformerrors.PluginError{
+		Type:         transformerrors.PluginOutputLimitError,
+		Message:      "plugin output is too large",
+		ErrorMessage: fmt.Sprintf("%s exceeds %d bytes", what, max),
+	}
+}
+
+// Buffer is a buffer holding at most max bytes, zero means no limit.
+// onExceed is called the first time a write goes over the limit. The buffer
+// is not embedded, so io.Copy cannot bypass Write with Buffer.ReadFrom.
+type Buffer struct {
+	buf      bytes.Buffer
+	max      int64
+	exceeded bool
+	onExceed func()
+}
+
+// NewBuffer returns a buffer holding at most max bytes, calling onExceed the
+// first time a write goes over the limit.
+func NewBuffer(max int64, onExceed func()) *Buffer {
+	return &Buffer{max: max, onExceed: onExceed}
+}
+
+func (l *Buffer) Write(p []byte) (int, error) {
+	if l.max > 0 && int64(l.buf.Len()+len(p)) > l.max {
+		l.buf.Write(p[:l.max-int64(l.buf.Len())])
+		if !l.exceeded {
+			l.exceeded = true
+			l.onExceed()
+		}
+		return 0, fmt.Errorf("output limit of %d bytes exceeded", l.max)
+	}
+	return l.buf.Write(p)
+}
+
+func (l *Buffer) Bytes() []byte {
+	return l.buf.Bytes()
+}
+
+// Exceeded tells whether a write went over the limit.
+func (l *Buffer) Exceeded() bool {
+	return l.exceeded
+}
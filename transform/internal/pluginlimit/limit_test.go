@@ -0,0 +1,53 @@
+package pluginlimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	transformerrors "github.com/konveyor/crane-lib/transform/errors"
+)
+
+func TestBuffer(t *testing.T) {
+	exceeded := 0
+	b := NewBuffer(4, func() { exceeded++ })
+	if _, err := b.Write([]byte("abc")); err != nil {
+		t.Fatalf("Write() error = %v within the limit", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := b.Write([]byte("de")); err == nil {
+			t.Errorf("Write() expected an error past the limit")
+		}
+	}
+	if string(b.Bytes()) != "abcd" || !b.Exceeded() || exceeded != 1 {
+		t.Errorf("Buffer holds %q, exceeded %v, onExceed called %d times", b.Bytes(), b.Exceeded(), exceeded)
+	}
+
+	unlimited := NewBuffer(0, nil)
+	if _, err := unlimited.Write(make([]byte, 1<<20)); err != nil || unlimited.Exceeded() {
+		t.Errorf("Write() error = %v without a limit", err)
+	}
+}
+
+func TestError(t *testing.T) {
+	ctx, cancel := WithTimeout(context.Background(), 0)
+	if err := Error(context.Background(), ctx, 0); err != nil {
+		t.Errorf("Error() = %v for a running context", err)
+	}
+	cancel()
+
+	ctx, cancel = WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+	if err := Error(context.Background(), ctx, time.Millisecond); !transformerrors.IsTimeoutError(err) {
+		t.Errorf("Error() = %v, want a timeout error", err)
+	}
+
+	parent, cancelParent := context.WithCancel(context.Background())
+	ctx, cancel = WithTimeout(parent, time.Minute)
+	defer cancel()
+	cancelParent()
+	if err := Error(parent, ctx, time.Minute); err != context.Canceled {
+		t.Errorf("Error() = %v, want the error of the parent", err)
+	}
+}
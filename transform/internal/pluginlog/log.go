@@ -0,0 +1,123 @@
+// Package pluginlog re-emits the logs of plugins running out of the caller's
+// process in the caller's log.
+package pluginlog
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/konveyor/crane-lib/transform"
+	"github.com/sirupsen/logrus"
+)
+
+// Log fields identifying the plugin and the object it runs on. They are set
+// by the caller, never by the plugin.
+const (
+	FieldPluginPath = "pluginPath"
+	FieldPlugin     = "plugin"
+	FieldKind       = "kind"
+	FieldNamespace  = "namespace"
+	FieldName       = "name"
+)
+
+// ObjectFields are the log fields identifying the plugin and the object it
+// runs on.
+func ObjectFields(pluginName string, request transform.PluginRequest) logrus.Fields {
+	fields := logrus.Fields{
+		FieldPlugin: pluginName,
+		FieldKind:   request.GroupVersionKind().GroupKind().String(),
+		FieldName:   request.GetName(),
+	}
+	if request.GetNamespace() != "" {
+		fields[FieldNamespace] = request.GetNamespace()
+	}
+	return fields
+}
+
+// Output re-emits a line the plugin wrote to stderr. Lines are
+// expected to be JSON log records, see transform.LogLevelKey. The logrus
+// text format of older plugins is matched on its level, and any other
+// non-empty line is logged at info level. The fields of log are kept over the
+// fields of the record.
+func Output(log logrus.FieldLogger, line string) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return
+	}
+	if level, message, fields, ok := parseLogRecord(line); ok {
+		// The identity fields are set by this library, not by the plugin.
+		for _, key := range []string{FieldPluginPath, FieldPlugin, FieldKind, FieldNamespace, FieldName, transform.LogStreamFrameKey} {
+			delete(fields, key)
+		}
+		entry := log.WithFields(fields)
+		switch level {
+		case logrus.TraceLevel, logrus.DebugLevel:
+			entry.Debug(message)
+		case logrus.InfoLevel:
+			entry.Info(message)
+		case logrus.WarnLevel:
+			entry.Warn(message)
+		default:
+			// Fatal and panic records are logged as errors, the plugin
+			// already exited.
+			entry.Error(message)
+		}
+		return
+	}
+	switch {
+	case strings.Contains(line, "level=info"):
+		log.Info(line)
+	case strings.Contains(line, "level=warning"):
+		log.Warn(line)
+	case strings.Contains(line, "level=error"), strings.Contains(line, "level=fatal"), strings.Contains(line, "level=panic"):
+		log.Error(line)
+	case strings.Contains(line, "level=debug"), strings.Contains(line, "level=trace"):
+		log.Debug(line)
+	default:
+		log.Info(line)
+	}
+}
+
+// StreamFrame returns the ID of the stream frame a line the plugin wrote to
+// stderr was logged for, see transform.LogStreamFrameKey.
+func StreamFrame(line string) (uint64, bool) {
+	record := map[string]json.RawMessage{}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(line)), &record); err != nil {
+		return 0, false
+	}
+	raw, ok := record[transform.LogStreamFrameKey]
+	if !ok {
+		return 0, false
+	}
+	var id uint64
+	if err := json.Unmarshal(raw, &id); err != nil {
+		return 0, false
+	}
+	return id, true
+}
+
+// parseLogRecord decodes a JSON log record. The default logrus "msg" key is
+// accepted as well.
+func parseLogRecord(line string) (logrus.Level, string, logrus.Fields, bool) {
+	record := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(line), &record); err != nil {
+		return 0, "", nil, false
+	}
+	levelName, ok := record[transform.LogLevelKey].(string)
+	if !ok {
+		return 0, "", nil, false
+	}
+	level, err := logrus.ParseLevel(levelName)
+	if err != nil {
+		return 0, "", nil, false
+	}
+	message, ok := record[transform.LogMessageKey].(string)
+	if !ok {
+		message, _ = record[logrus.FieldKeyMsg].(string)
+		delete(record, logrus.FieldKeyMsg)
+	}
+	delete(record, transform.LogLevelKey)
+	delete(record, transform.LogMessageKey)
+	delete(record, transform.LogTimeKey)
+	return level, message, logrus.Fields(record), true
+}
@@ -0,0 +1,105 @@
+package pluginlog
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestOutput(t *testing.T) {
+	tests := []struct {
+		name       string
+		line       string
+		wantLevel  logrus.Level
+		wantMsg    string
+		wantFields logrus.Fields
+	}{
+		{
+			name:       "JSONRecord",
+			line:       `{"level": "warning", "message": "deprecated field", "time": "2021-01-01T00:00:00Z", "field": "spec.foo"}`,
+			wantLevel:  logrus.WarnLevel,
+			wantMsg:    "deprecated field",
+			wantFields: logrus.Fields{"plugin": "test", "field": "spec.foo"},
+		},
+		{
+			name:       "JSONRecordDefaultKeys",
+			line:       `{"level": "debug", "msg": "checking"}`,
+			wantLevel:  logrus.DebugLevel,
+			wantMsg:    "checking",
+			wantFields: logrus.Fields{"plugin": "test"},
+		},
+		{
+			name:       "JSONRecordFatal",
+			line:       `{"level": "fatal", "message": "giving up"}`,
+			wantLevel:  logrus.ErrorLevel,
+			wantMsg:    "giving up",
+			wantFields: logrus.Fields{"plugin": "test"},
+		},
+		{
+			name:       "JSONRecordIdentityKept",
+			line:       `{"level": "info", "message": "hello", "plugin": "other"}`,
+			wantLevel:  logrus.InfoLevel,
+			wantMsg:    "hello",
+			wantFields: logrus.Fields{"plugin": "test"},
+		},
+		{
+			name:       "JSONRecordStreamFrame",
+			line:       `{"level": "info", "message": "hello", "streamFrame": 3}`,
+			wantLevel:  logrus.InfoLevel,
+			wantMsg:    "hello",
+			wantFields: logrus.Fields{"plugin": "test"},
+		},
+		{
+			name:       "TextRecord",
+			line:       `time="2021-01-01T00:00:00Z" level=error msg="failed"`,
+			wantLevel:  logrus.ErrorLevel,
+			wantMsg:    `time="2021-01-01T00:00:00Z" level=error msg="failed"`,
+			wantFields: logrus.Fields{"plugin": "test"},
+		},
+		{
+			name:       "PlainLine",
+			line:       `{"level": "unknown"}`,
+			wantLevel:  logrus.InfoLevel,
+			wantMsg:    `{"level": "unknown"}`,
+			wantFields: logrus.Fields{"plugin": "test"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, hook := test.NewNullLogger()
+			logger.SetLevel(logrus.DebugLevel)
+			Output(logger.WithField("plugin", "test"), tt.line)
+			entry := hook.LastEntry()
+			if entry == nil || len(hook.AllEntries()) != 1 {
+				t.Fatalf("Output() logged %v entries, want 1", len(hook.AllEntries()))
+			}
+			if entry.Level != tt.wantLevel || entry.Message != tt.wantMsg || !reflect.DeepEqual(entry.Data, tt.wantFields) {
+				t.Errorf("Output() logged %v %q %v, want %v %q %v", entry.Level, entry.Message, entry.Data, tt.wantLevel, tt.wantMsg, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestStreamFrame(t *testing.T) {
+	tests := []struct {
+		name   string
+		line   string
+		want   uint64
+		wantOk bool
+	}{
+		{name: "Tagged", line: `{"level": "info", "message": "hello", "streamFrame": 3}`, want: 3, wantOk: true},
+		{name: "NotTagged", line: `{"level": "info", "message": "hello"}`},
+		{name: "InvalidID", line: `{"level": "info", "streamFrame": "3"}`},
+		{name: "TextRecord", line: `level=info msg="hello" streamFrame=3`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := StreamFrame(tt.line)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("StreamFrame() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
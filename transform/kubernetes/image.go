@@ -0,0 +1,111 @@
+package kubernetes
+
+import (
+	"fmt"
+	"strconv"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/konveyor/crane-lib/transform/internal/fieldpath"
+	"github.com/konveyor/crane-lib/transform/util"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var (
+	buildConfigGK = schema.GroupKind{Group: "build.openshift.io", Kind: "BuildConfig"}
+	imageStreamGK = schema.GroupKind{Group: "image.openshift.io", Kind: "ImageStream"}
+)
+
+// newImageRewriter returns the ImageRewriter of the image options, or nil if
+// none is set.
+func (k *KubernetesTransformPlugin) newImageRewriter() (*util.ImageRewriter, error) {
+	if len(k.RegistryReplacement) == 0 && k.LibraryImageRepository == "" && len(k.ImageDigests) == 0 {
+		return nil, nil
+	}
+	images, err := util.NewImageRewriter(k.RegistryReplacement, k.LibraryImageRepository, k.ImageDigests)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image options: %w", err)
+	}
+	return images, nil
+}
+
+// getImageTransforms rewrites the image references of ImageStreams and
+// BuildConfigs. The images of PodSpecs are rewritten by
+// getPodSpecTransforms.
+func (k *KubernetesTransformPlugin) getImageTransforms(obj unstructured.Unstructured) (jsonpatch.Patch, error) {
+	gk := obj.GroupVersionKind().GroupKind()
+	if gk != imageStreamGK && gk != buildConfigGK {
+		return nil, nil
+	}
+	if k.images == nil {
+		return nil, nil
+	}
+	content, err := jsonContent(obj)
+	if err != nil {
+		return nil, err
+	}
+	r := &imageReferenceRewriter{images: k.images, object: content}
+
+	if gk == imageStreamGK {
+		if repository, ok := fieldpath.Value(content, []string{"spec", "dockerImageRepository"}).(string); ok {
+			if updated, update := k.images.RewriteRepository(repository); update {
+				r.replace([]string{"spec", "dockerImageRepository"}, updated)
+			}
+		}
+		r.each([]string{"spec", "tags"}, func(tag []string) {
+			r.from(fieldpath.Sub(tag, "from"))
+		})
+	} else {
+		for _, strategy := range []string{"dockerStrategy", "sourceStrategy", "customStrategy"} {
+			r.from([]string{"spec", "strategy", strategy, "from"})
+		}
+		r.from([]string{"spec", "output", "to"})
+		r.each([]string{"spec", "source", "images"}, func(image []string) {
+			r.from(fieldpath.Sub(image, "from"))
+		})
+	}
+	return r.patch, r.err
+}
+
+// imageReferenceRewriter collects the operations rewriting the image
+// references of an object.
+type imageReferenceRewriter struct {
+	images *util.ImageRewriter
+	object map[string]interface{}
+	patch  jsonpatch.Patch
+	err    error
+}
+
+// from rewrites the object reference at path, such as the from of a
+// BuildConfig strategy, if it is a DockerImage.
+func (r *imageReferenceRewriter) from(path []string) {
+	if kind, _ := fieldpath.Value(r.object, fieldpath.Sub(path, "kind")).(string); kind != "DockerImage" {
+		return
+	}
+	image, ok := fieldpath.Value(r.object, fieldpath.Sub(path, "name")).(string)
+	if !ok {
+		return
+	}
+	if updated, update := r.images.Rewrite(image); update {
+		r.replace(fieldpath.Sub(path, "name"), updated)
+	}
+}
+
+func (r *imageReferenceRewriter) each(path []string, f func(item []string)) {
+	items, _ := fieldpath.Value(r.object, path).([]interface{})
+	for i := range items {
+		f(fieldpath.Sub(path, strconv.Itoa(i)))
+	}
+}
+
+func (r *imageReferenceRewriter) replace(path []string, value string) {
+	if r.err != nil {
+		return
+	}
+	patch, err := replaceOp(path, value)
+	if err != nil {
+		r.err = err
+		return
+	}
+	r.patch = append(r.patch, patch...)
+}
@@ -0,0 +1,125 @@
+package kubernetes_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	transform "github.com/konveyor/crane-lib/transform"
+	internaljsonpatch "github.com/konveyor/crane-lib/transform/internal/jsonpatch"
+	"github.com/konveyor/crane-lib/transform/kubernetes"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const testDigest = "sha256:0d17b565c37bcbd895e9d92315a05c1c3c9a29f762b011a10c54a66cd53c9b31"
+
+func TestRunImages(t *testing.T) {
+	extras := map[string]string{
+		kubernetes.RegistryReplacementFlag:    "quay.io=registry.example.com",
+		kubernetes.LibraryImageRepositoryFlag: "registry.example.com/library",
+		kubernetes.ImageDigestsFlag:           "quay.io/foo/app:v1=" + testDigest,
+	}
+	cases := []struct {
+		Name    string
+		Object  map[string]interface{}
+		Patches string
+	}{
+		{
+			Name: "Pod",
+			Object: map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "Pod",
+				"metadata":   map[string]interface{}{"name": "web", "namespace": "shop"},
+				"spec": map[string]interface{}{
+					"containers":          []interface{}{map[string]interface{}{"name": "web", "image": "quay.io/foo/app:v1"}},
+					"initContainers":      []interface{}{map[string]interface{}{"name": "init", "image": "busybox"}},
+					"ephemeralContainers": []interface{}{map[string]interface{}{"name": "debug", "image": "quay.io/foo/debug@" + testDigest}},
+				},
+			},
+			Patches: `[
+				{"op": "remove", "path": "/spec/nodeName"},
+				{"op": "remove", "path": "/spec/nodeSelector"},
+				{"op": "remove", "path": "/spec/priority"},
+				{"op": "replace", "path": "/spec/containers/0/image", "value": "registry.example.com/foo/app@` + testDigest + `"},
+				{"op": "replace", "path": "/spec/initContainers/0/image", "value": "registry.example.com/library/busybox"},
+				{"op": "replace", "path": "/spec/ephemeralContainers/0/image", "value": "registry.example.com/foo/debug@` + testDigest + `"}
+			]`,
+		},
+		{
+			Name: "ImageStream",
+			Object: map[string]interface{}{
+				"apiVersion": "image.openshift.io/v1",
+				"kind":       "ImageStream",
+				"metadata":   map[string]interface{}{"name": "app", "namespace": "shop"},
+				"spec": map[string]interface{}{
+					"dockerImageRepository": "quay.io/foo/app",
+					"tags": []interface{}{
+						map[string]interface{}{"name": "v1", "from": map[string]interface{}{"kind": "DockerImage", "name": "quay.io/foo/app:v1"}},
+						map[string]interface{}{"name": "latest", "from": map[string]interface{}{"kind": "ImageStreamTag", "name": "app:v1"}},
+					},
+				},
+			},
+			Patches: `[
+				{"op": "replace", "path": "/spec/dockerImageRepository", "value": "registry.example.com/foo/app"},
+				{"op": "replace", "path": "/spec/tags/0/from/name", "value": "registry.example.com/foo/app@` + testDigest + `"}
+			]`,
+		},
+		{
+			Name: "BuildConfig",
+			Object: map[string]interface{}{
+				"apiVersion": "build.openshift.io/v1",
+				"kind":       "BuildConfig",
+				"metadata":   map[string]interface{}{"name": "app", "namespace": "shop"},
+				"spec": map[string]interface{}{
+					"source": map[string]interface{}{
+						"images": []interface{}{
+							map[string]interface{}{"from": map[string]interface{}{"kind": "DockerImage", "name": "quay.io/foo/assets:v3"}},
+						},
+					},
+					"strategy": map[string]interface{}{
+						"type":           "Source",
+						"sourceStrategy": map[string]interface{}{"from": map[string]interface{}{"kind": "DockerImage", "name": "python:3.12"}},
+					},
+					"output": map[string]interface{}{"to": map[string]interface{}{"kind": "ImageStreamTag", "name": "app:latest"}},
+				},
+			},
+			Patches: `[
+				{"op": "replace", "path": "/spec/source/images/0/from/name", "value": "registry.example.com/foo/assets:v3"},
+				{"op": "replace", "path": "/spec/strategy/sourceStrategy/from/name", "value": "registry.example.com/library/python:3.12"}
+			]`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			k := kubernetes.KubernetesTransformPlugin{}
+			resp, err := k.Run(transform.PluginRequest{Unstructured: unstructured.Unstructured{Object: c.Object}, Extras: extras})
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected, err := jsonpatch.DecodePatch([]byte(c.Patches))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok, err := internaljsonpatch.Equal(resp.Patches, expected); !ok || err != nil {
+				actual, _ := json.Marshal(resp.Patches)
+				t.Errorf("Invalid patches. Actual: %s, Expected: %s", actual, c.Patches)
+			}
+		})
+	}
+}
+
+func TestRunInvalidImageOptions(t *testing.T) {
+	obj := unstructured.Unstructured{Object: map[string]interface{}{
+		"kind":       "Service",
+		"apiVersion": "v1",
+	}}
+	for flag, value := range map[string]string{
+		kubernetes.ImageDigestsFlag:           "nginx=sha256:abc",
+		kubernetes.LibraryImageRepositoryFlag: "quay.io/Mirror",
+	} {
+		k := kubernetes.KubernetesTransformPlugin{}
+		if _, err := k.Run(transform.PluginRequest{Unstructured: obj, Extras: map[string]string{flag: value}}); err == nil {
+			t.Errorf("expected an error for %s=%s", flag, value)
+		}
+	}
+}
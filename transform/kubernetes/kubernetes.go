@@ -8,40 +8,47 @@ import (
 
 	jsonpatch "github.com/evanphx/json-patch"
 	transform "github.com/konveyor/crane-lib/transform"
+	"github.com/konveyor/crane-lib/transform/celexpr"
+	"github.com/konveyor/crane-lib/transform/internal/fieldpath"
 	"github.com/konveyor/crane-lib/transform/types"
 	"github.com/konveyor/crane-lib/transform/util"
 	"github.com/konveyor/crane-lib/version"
-	"github.com/sirupsen/logrus"
 	appsv1 "k8s.io/api/apps/v1"
-	batchv1 "k8s.io/api/batch/v1"
 	v1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
-var logger logrus.FieldLogger
-
 const (
-	AddAnnotationsFlag       = "add-annotations"
-	RemoveAnnotationsFlag    = "remove-annotations"
-	RegistryReplacementFlag  = "registry-replacement"
-	ExtraWhiteoutsFlag       = "extra-whiteouts"
-	IncludeOnlyFlag          = "include-only"
-	DisableWhiteoutOwnedFlag = "disable-whiteout-owned"
-	StripDefaultRBACFlag     = "strip-default-rbac"
-	StripDefaultCABundleFlag = "strip-default-cabundle"
-	PVCRenameMap             = "pvc-rename-map"
+	AddAnnotationsFlag           = "add-annotations"
+	RemoveAnnotationsFlag        = "remove-annotations"
+	RegistryReplacementFlag      = "registry-replacement"
+	LibraryImageRepositoryFlag   = "library-image-repository"
+	ImageDigestsFlag             = "image-digests"
+	ExtraWhiteoutsFlag           = "extra-whiteouts"
+	IncludeOnlyFlag              = "include-only"
+	WhiteoutExpressionFlag       = "whiteout-expression"
+	IncludeExpressionFlag        = "include-expression"
+	DisableWhiteoutOwnedFlag     = "disable-whiteout-owned"
+	StripDefaultRBACFlag         = "strip-default-rbac"
+	StripDefaultCABundleFlag     = "strip-default-cabundle"
+	PVCRenameMap                 = "pvc-rename-map"
+	PodSpecPathsFlag             = "pod-spec-paths"
+	StorageClassMapFlag          = "storageclass-map"
+	PVCAccessModesFlag           = "pvc-access-modes"
+	PVCVolumeModeFlag            = "pvc-volume-mode"
+	NamespaceMapFlag             = "namespace-map"
+	NamespaceMapServiceDNSFlag   = "namespace-map-service-dns"
 	CraneJobIdempotentAnnotation = "crane.konveyor.io/job-idempotent"
 )
 
 const (
-	containerImageUpdate        = "/spec/template/spec/containers/%v/image"
-	initContainerImageUpdate    = "/spec/template/spec/initContainers/%v/image"
-	podContainerImageUpdate     = "/spec/containers/%v/image"
-	podInitContainerImageUpdate = "/spec/initContainers/%v/image"
-	annotationInitial           = `%v
+	podSpecContainerImage  = "%s/%s/%d/image"
+	podSpecVolumeClaimName = "%s/volumes/%%d/persistentVolumeClaim/claimName"
+	annotationInitial      = `%v
 {"op": "add", "path": "/metadata/annotations/%v", "value": "%v"}`
 	annotationNext = `%v,
 {"op": "add", "path": "/metadata/annotations/%v", "value": "%v"}`
@@ -124,31 +131,70 @@ var gksToWhiteout = []schema.GroupKind{
 }
 
 type KubernetesTransformPlugin struct {
-	AddAnnotations       map[string]string
-	RemoveAnnotations    []string
-	RegistryReplacement  map[string]string
+	AddAnnotations      map[string]string
+	RemoveAnnotations   []string
+	RegistryReplacement map[string]string
+	// LibraryImageRepository replaces docker.io/library in the references
+	// to the official Docker Hub images, such as nginx.
+	LibraryImageRepository string
+	// ImageDigests pins tagged images to digests.
+	ImageDigests         map[string]string
 	DisableWhiteoutOwned bool
 	ExtraWhiteouts       []schema.GroupKind
 	IncludeOnly          []schema.GroupKind
+	// WhiteoutExpression is a CEL expression over the object, which is a
+	// whiteout when it returns true.
+	WhiteoutExpression string
+	// IncludeExpression is a CEL expression over the object, which is a
+	// whiteout when it returns false.
+	IncludeExpression    string
 	StripDefaultRBAC     bool
 	StripDefaultCABundle bool
 	PVCRenameMap         map[string]string
+	// PodSpecPaths are the paths to the PodSpec of kinds unknown to
+	// types.PodSpecPath, such as custom resources embedding a pod template.
+	PodSpecPaths map[schema.GroupKind][]string
+	// NamespaceMap maps the namespaces of the source cluster to those of the
+	// target cluster, for objects and the namespaces they reference.
+	NamespaceMap map[string]string
+	// NamespaceMapServiceDNS also rewrites the namespaces of the Service DNS
+	// names in environment variables and ConfigMaps.
+	NamespaceMapServiceDNS bool
+	// StorageClassMap maps the storage classes of the claims of the source
+	// cluster to those of the target cluster.
+	StorageClassMap map[string]string
+	// PVCAccessModes and PVCVolumeMode, if set, override the access modes and
+	// the volume mode of the claims.
+	PVCAccessModes []string
+	PVCVolumeMode  string
+
+	// images rewrites the image references as the image options say, or is
+	// nil if none is set. setOptionalFields builds it.
+	images *util.ImageRewriter
 }
 
+// Run transforms the object. The extras of the request are applied to a copy
+// of the plugin, so that the plugin can run concurrently.
 func (k *KubernetesTransformPlugin) Run(request transform.PluginRequest) (transform.PluginResponse, error) {
-	logger = logrus.New()
 	resp := transform.PluginResponse{}
-	err := k.setOptionalFields(request.Extras)
+	options := *k
+	err := options.setOptionalFields(request.Extras)
 	if err != nil {
 		return resp, err
 	}
-	// Set version in the future
 	resp.Version = string(transform.V1)
-	resp.IsWhiteOut = k.getWhiteOuts(request.Unstructured)
-	if resp.IsWhiteOut {
+	if request.Version != "" && request.Version != transform.V1 {
+		resp.Version = string(request.Version)
+	}
+	if request.Context != nil && request.Context.Phase == transform.PhaseAnalyze {
+		resp.Renames = options.getRenames()
 		return resp, nil
 	}
-	resp.Patches, err = k.getKubernetesTransforms(request.Unstructured)
+	resp.IsWhiteOut, err = options.getWhiteOuts(request.Unstructured)
+	if err != nil || resp.IsWhiteOut {
+		return resp, err
+	}
+	resp.Patches, err = options.getKubernetesTransforms(request.Unstructured)
 	return resp, err
 
 }
@@ -157,53 +203,126 @@ func (k *KubernetesTransformPlugin) Metadata() transform.PluginMetadata {
 	return transform.PluginMetadata{
 		Name:            "KubernetesPlugin",
 		Version:         version.Version,
-		RequestVersion:  []transform.Version{transform.V1},
-		ResponseVersion: []transform.Version{transform.V1},
+		RequestVersion:  transform.SupportedVersions,
+		ResponseVersion: transform.SupportedVersions,
+		Capabilities:    []transform.Capability{transform.CapabilityRenames},
 		OptionalFields: []transform.OptionalFields{
 			{
 				FlagName: AddAnnotationsFlag,
 				Help:     "Annotations to add to each resource",
 				Example:  "annotation1=value1,annotation2=value2",
+				Type:     transform.OptionalFieldMap,
 			},
 			{
 				FlagName: RegistryReplacementFlag,
 				Help:     "Map of image registry paths to swap on transform, in the format original-registry1=target-registry1,original-registry2=target-registry2...",
 				Example:  "docker-registry.default.svc:5000=image-registry.openshift-image-registry.svc:5000,docker.io/foo=quay.io/bar",
+				Type:     transform.OptionalFieldMap,
+			},
+			{
+				FlagName: LibraryImageRepositoryFlag,
+				Help:     "Repository replacing docker.io/library in the references to the official Docker Hub images, such as nginx",
+				Example:  "quay.io/mirror",
+				Type:     transform.OptionalFieldString,
+			},
+			{
+				FlagName: ImageDigestsFlag,
+				Help:     "Map of tagged images to the digests to pin them to, in the format image1:tag1=digest1,image2:tag2=digest2... Images without a tag are latest.",
+				Example:  "nginx:1.25=sha256:0d17b565c37bcbd895e9d92315a05c1c3c9a29f762b011a10c54a66cd53c9b31",
+				Type:     transform.OptionalFieldMap,
 			},
 			{
 				FlagName: RemoveAnnotationsFlag,
 				Help:     "Annotations to remove",
 				Example:  "annotation1,annotation2",
+				Type:     transform.OptionalFieldStringList,
 			},
 			{
 				FlagName: DisableWhiteoutOwnedFlag,
 				Help:     "Disable whiting out owned pods and pod template resources",
 				Example:  "true",
+				Type:     transform.OptionalFieldBool,
 			},
 			{
 				FlagName: ExtraWhiteoutsFlag,
 				Help:     "Additional resources to whiteout specified as a comma-separated list of GroupKind strings.",
 				Example:  "Deployment.apps,Service,Route.route.openshift.io",
+				Type:     transform.OptionalFieldGroupKindList,
 			},
 			{
 				FlagName: IncludeOnlyFlag,
 				Help:     "If specified, every resource not listed here will be a whiteout. extra-whiteouts is ignored when include-only is specified. Specified as a comma-separated list of GroupKind strings.",
 				Example:  "Deployment.apps,Service,Route.route.openshift.io",
+				Type:     transform.OptionalFieldGroupKindList,
+			},
+			{
+				FlagName: WhiteoutExpressionFlag,
+				Help:     "CEL expression over the resource, as the variable object. Resources for which it returns true will be a whiteout.",
+				Example:  `object.kind == "ConfigMap" && object.metadata.name.startsWith("kube-")`,
+				Type:     transform.OptionalFieldString,
+			},
+			{
+				FlagName: IncludeExpressionFlag,
+				Help:     "CEL expression over the resource, as the variable object. Resources for which it returns false will be a whiteout.",
+				Example:  `has(object.metadata.labels) && object.metadata.labels["app"] == "shop"`,
+				Type:     transform.OptionalFieldString,
 			},
 			{
 				FlagName: StripDefaultRBACFlag,
 				Help:     "Whether to strip default RBAC including default serviceAccount (default: true)",
 				Example:  "true",
+				Type:     transform.OptionalFieldBool,
+				Default:  "true",
 			},
 			{
 				FlagName: StripDefaultCABundleFlag,
 				Help:     "Whether to strip default CA Bundle (default: true)",
 				Example:  "true",
+				Type:     transform.OptionalFieldBool,
+				Default:  "true",
 			},
 			{
 				FlagName: PVCRenameMap,
 				Help:     "A comma-separated list of colon separated pvc renames.",
 				Example:  "old-pvc1-name:new-pvc1-name,old-pvc2-name:new-pvc2-name",
+				Type:     transform.OptionalFieldStringList,
+			},
+			{
+				FlagName: PodSpecPathsFlag,
+				Help:     "Map of GroupKinds to the dot-separated path of their PodSpec, for resources with a pod template the plugin does not know, in the format kind1.group1=path1,kind2.group2=path2...",
+				Example:  "Workflow.example.com=spec.worker.template.spec",
+				Type:     transform.OptionalFieldMap,
+			},
+			{
+				FlagName: StorageClassMapFlag,
+				Help:     "Map of source storage classes to target storage classes, for the PVCs kept with include-only and the volumeClaimTemplates of StatefulSets, in the format source1=target1,source2=target2...",
+				Example:  "gp2=gp3-csi,standard=standard-csi",
+				Type:     transform.OptionalFieldMap,
+			},
+			{
+				FlagName: PVCAccessModesFlag,
+				Help:     "Access modes replacing those of the PVCs and volumeClaimTemplates",
+				Example:  "ReadWriteOnce",
+				Type:     transform.OptionalFieldStringList,
+			},
+			{
+				FlagName: PVCVolumeModeFlag,
+				Help:     "Volume mode replacing that of the PVCs and volumeClaimTemplates",
+				Example:  "Filesystem",
+				Type:     transform.OptionalFieldEnum,
+				Enum:     []string{string(v1.PersistentVolumeFilesystem), string(v1.PersistentVolumeBlock)},
+			},
+			{
+				FlagName: NamespaceMapFlag,
+				Help:     "Map of source namespaces to target namespaces, in the format source1=target1,source2=target2... Moves resources and rewrites the namespaces in RoleBinding subjects, service account users and groups, and NetworkPolicy namespaceSelectors. Resources are only moved when the whole export is transformed at once.",
+				Example:  "shop=shop-prod,shop-db=shop-prod-db",
+				Type:     transform.OptionalFieldMap,
+			},
+			{
+				FlagName: NamespaceMapServiceDNSFlag,
+				Help:     "Whether namespace-map also rewrites the namespaces of Service DNS names in container environment variables and ConfigMaps: <service>.<namespace>, such as db.shop, and <service>.<namespace>.svc with any cluster domain, such as db.shop.svc.cluster.local. Any other name ending with a mapped namespace is taken for a Service too (default: false)",
+				Example:  "true",
+				Type:     transform.OptionalFieldBool,
 			},
 		},
 	}
@@ -223,24 +342,58 @@ func (k *KubernetesTransformPlugin) setOptionalFields(extras map[string]string)
 	if len(extras[RegistryReplacementFlag]) > 0 {
 		k.RegistryReplacement = transform.ParseOptionalFieldMapVal(extras[RegistryReplacementFlag])
 	}
+	if len(extras[LibraryImageRepositoryFlag]) > 0 {
+		k.LibraryImageRepository = extras[LibraryImageRepositoryFlag]
+	}
+	if len(extras[ImageDigestsFlag]) > 0 {
+		k.ImageDigests = transform.ParseOptionalFieldMapVal(extras[ImageDigestsFlag])
+	}
+	var err error
+	k.images, err = k.newImageRewriter()
+	if err != nil {
+		return err
+	}
 	if len(extras[ExtraWhiteoutsFlag]) > 0 {
-		k.ExtraWhiteouts = parseGroupKindSlice(transform.ParseOptionalFieldSliceVal(extras[ExtraWhiteoutsFlag]))
+		k.ExtraWhiteouts, err = transform.ParseOptionalFieldGroupKindSliceVal(extras[ExtraWhiteoutsFlag])
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", ExtraWhiteoutsFlag, err)
+		}
 	}
 	if len(extras[IncludeOnlyFlag]) > 0 {
-		k.IncludeOnly = parseGroupKindSlice(transform.ParseOptionalFieldSliceVal(extras[IncludeOnlyFlag]))
+		k.IncludeOnly, err = transform.ParseOptionalFieldGroupKindSliceVal(extras[IncludeOnlyFlag])
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", IncludeOnlyFlag, err)
+		}
+	}
+	if len(extras[WhiteoutExpressionFlag]) > 0 {
+		k.WhiteoutExpression = extras[WhiteoutExpressionFlag]
+		if _, err := celexpr.CompileBool(k.WhiteoutExpression); err != nil {
+			return fmt.Errorf("invalid %s: %w", WhiteoutExpressionFlag, err)
+		}
+	}
+	if len(extras[IncludeExpressionFlag]) > 0 {
+		k.IncludeExpression = extras[IncludeExpressionFlag]
+		if _, err := celexpr.CompileBool(k.IncludeExpression); err != nil {
+			return fmt.Errorf("invalid %s: %w", IncludeExpressionFlag, err)
+		}
 	}
 	if len(extras[DisableWhiteoutOwnedFlag]) > 0 {
-		var err error
-		k.DisableWhiteoutOwned, err = strconv.ParseBool(extras[DisableWhiteoutOwnedFlag])
+		k.DisableWhiteoutOwned, err = transform.ParseOptionalFieldBoolVal(extras[DisableWhiteoutOwnedFlag])
 		if err != nil {
-			k.DisableWhiteoutOwned = false
+			return fmt.Errorf("invalid %s: %w", DisableWhiteoutOwnedFlag, err)
 		}
 	}
 	if len(extras[StripDefaultRBACFlag]) > 0 {
-		k.StripDefaultRBAC, _ = strconv.ParseBool(extras[StripDefaultRBACFlag])
+		k.StripDefaultRBAC, err = transform.ParseOptionalFieldBoolVal(extras[StripDefaultRBACFlag])
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", StripDefaultRBACFlag, err)
+		}
 	}
 	if len(extras[StripDefaultCABundleFlag]) > 0 {
-		k.StripDefaultCABundle, _ = strconv.ParseBool(extras[StripDefaultCABundleFlag])
+		k.StripDefaultCABundle, err = transform.ParseOptionalFieldBoolVal(extras[StripDefaultCABundleFlag])
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", StripDefaultCABundleFlag, err)
+		}
 	}
 	if len(extras[PVCRenameMap]) > 0 {
 		pvcMap, err := util.ProcessPVCMap(extras[PVCRenameMap])
@@ -249,67 +402,131 @@ func (k *KubernetesTransformPlugin) setOptionalFields(extras map[string]string)
 		}
 		k.PVCRenameMap = pvcMap
 	}
+	if len(extras[StorageClassMapFlag]) > 0 {
+		k.StorageClassMap = transform.ParseOptionalFieldMapVal(extras[StorageClassMapFlag])
+	}
+	if len(extras[PVCAccessModesFlag]) > 0 {
+		k.PVCAccessModes = transform.ParseOptionalFieldSliceVal(extras[PVCAccessModesFlag])
+		for _, mode := range k.PVCAccessModes {
+			switch v1.PersistentVolumeAccessMode(mode) {
+			case v1.ReadWriteOnce, v1.ReadOnlyMany, v1.ReadWriteMany, v1.ReadWriteOncePod:
+			default:
+				return fmt.Errorf("invalid %s: unknown access mode %q", PVCAccessModesFlag, mode)
+			}
+		}
+	}
+	if len(extras[PVCVolumeModeFlag]) > 0 {
+		k.PVCVolumeMode = extras[PVCVolumeModeFlag]
+		switch v1.PersistentVolumeMode(k.PVCVolumeMode) {
+		case v1.PersistentVolumeFilesystem, v1.PersistentVolumeBlock:
+		default:
+			return fmt.Errorf("invalid %s: unknown volume mode %q", PVCVolumeModeFlag, k.PVCVolumeMode)
+		}
+	}
+	if len(extras[NamespaceMapFlag]) > 0 {
+		k.NamespaceMap = transform.ParseOptionalFieldMapVal(extras[NamespaceMapFlag])
+		for source, target := range k.NamespaceMap {
+			for _, namespace := range []string{source, target} {
+				if errs := validation.IsDNS1123Label(namespace); len(errs) != 0 {
+					return fmt.Errorf("invalid %s: %s=%s: %s", NamespaceMapFlag, source, target, strings.Join(errs, ","))
+				}
+			}
+		}
+	}
+	if len(extras[NamespaceMapServiceDNSFlag]) > 0 {
+		k.NamespaceMapServiceDNS, err = transform.ParseOptionalFieldBoolVal(extras[NamespaceMapServiceDNSFlag])
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", NamespaceMapServiceDNSFlag, err)
+		}
+	}
+	if len(extras[PodSpecPathsFlag]) > 0 {
+		k.PodSpecPaths = map[schema.GroupKind][]string{}
+		for kind, path := range transform.ParseOptionalFieldMapVal(extras[PodSpecPathsFlag]) {
+			fields := strings.Split(path, ".")
+			if kind == "" || sets.New(fields...).Has("") {
+				return fmt.Errorf("invalid %s: %q=%q", PodSpecPathsFlag, kind, path)
+			}
+			k.PodSpecPaths[schema.ParseGroupKind(kind)] = fields
+		}
+	}
 	return nil
 }
 
 var _ transform.Plugin = &KubernetesTransformPlugin{}
 
-func (k *KubernetesTransformPlugin) getWhiteOuts(obj unstructured.Unstructured) bool {
+func (k *KubernetesTransformPlugin) getWhiteOuts(obj unstructured.Unstructured) (bool, error) {
 	groupKind := obj.GroupVersionKind().GroupKind()
 	if len(k.IncludeOnly) > 0 {
 		if !groupKindInList(groupKind, k.IncludeOnly) {
-			return true
+			return true, nil
 		}
 	} else {
 		if groupKindInList(groupKind, gksToWhiteout) {
-			return true
+			return true, nil
 		}
 		if groupKindInList(groupKind, k.ExtraWhiteouts) {
-			return true
+			return true, nil
+		}
+	}
+	if k.IncludeExpression != "" {
+		include, err := evalExpression(k.IncludeExpression, obj)
+		if err != nil {
+			return false, err
+		}
+		if !include {
+			return true, nil
+		}
+	}
+	if k.WhiteoutExpression != "" {
+		whiteout, err := evalExpression(k.WhiteoutExpression, obj)
+		if err != nil || whiteout {
+			return whiteout, err
 		}
 	}
 	if groupKind == secretGK {
 		if secretType, found, _ := unstructured.NestedString(obj.Object, "type"); found {
 			switch secretType {
 			case "kubernetes.io/service-account-token", "kubernetes.io/dockercfg":
-				return true
+				return true, nil
 			}
 		}
 	}
 	if k.DisableWhiteoutOwned {
-		return false
+		return false, nil
 	}
 	if len(obj.GetOwnerReferences()) > 0 {
-		return true
+		return true, nil
 	}
 	// drop the default serviceaccount
 	if groupKind == serviceAccountGK && obj.GetName() == "default" && k.StripDefaultRBAC {
-		return true
+		return true, nil
 	}
 	// drop any Secrets belonging to default serviceaccount
 	if groupKind == secretGK && k.StripDefaultRBAC {
 		if sa, ok := obj.GetAnnotations()["kubernetes.io/service-account.name"]; ok && sa == "default" {
-			return true
+			return true, nil
 		}
 	}
 	// drop kube-root-ca.crt configmap
 	if groupKind == configMapGK && obj.GetName() == "kube-root-ca.crt" && k.StripDefaultCABundle {
-		return true
+		return true, nil
 	}
 
 	if groupKind.Group == extensionsGroup {
-		return true
+		return true, nil
 	}
 
-	return false
+	return false, nil
 }
 
-func parseGroupKindSlice(gkStrings []string) []schema.GroupKind {
-	gks := []schema.GroupKind{}
-	for _, gk := range gkStrings {
-		gks = append(gks, schema.ParseGroupKind(gk))
+// evalExpression evaluates a boolean CEL expression, compiled on first use,
+// on obj.
+func evalExpression(expression string, obj unstructured.Unstructured) (bool, error) {
+	program, err := celexpr.CompileBool(expression)
+	if err != nil {
+		return false, err
 	}
-	return gks
+	return program.EvalBool(obj)
 }
 
 func groupKindInList(gk schema.GroupKind, list []schema.GroupKind) bool {
@@ -343,99 +560,21 @@ func (k *KubernetesTransformPlugin) getKubernetesTransforms(obj unstructured.Uns
 		}
 		jsonPatch = append(jsonPatch, patches...)
 	}
-	if cronJobGK == obj.GetObjectKind().GroupVersionKind().GroupKind() {
-		js, err := obj.MarshalJSON()
-		if err != nil {
-			return nil, err
-		}
-		cronJob := &batchv1.CronJob{}
-		err = json.Unmarshal(js, cronJob)
-		if err != nil {
-			return nil, err
-		}
-
-		patches, err := util.RenamePVCs(cronJob.Spec.JobTemplate.Spec.Template.Spec.Volumes, k.PVCRenameMap, util.PVCPathCronJobString)
-		if err != nil {
-			return nil, err
-		}
-		jsonPatch = append(jsonPatch, patches...)
+	patches, err = k.getPodSpecTransforms(obj)
+	if err != nil {
+		return nil, err
 	}
+	jsonPatch = append(jsonPatch, patches...)
 
 	if podGK == obj.GetObjectKind().GroupVersionKind().GroupKind() {
-		js, err := obj.MarshalJSON()
-		if err != nil {
-			return nil, err
-		}
-		pod := &v1.Pod{}
-		err = json.Unmarshal(js, pod)
-		if err != nil {
-			return nil, err
-		}
-
 		patches, err := removePodFields()
 		if err != nil {
 			return nil, err
 		}
 		jsonPatch = append(jsonPatch, patches...)
-
-		patches, err = util.RenamePVCs(pod.Spec.Volumes, k.PVCRenameMap, util.PVCPathPodString)
-		if err != nil {
-			return nil, err
-		}
-		jsonPatch = append(jsonPatch, patches...)
-	}
-	if daemonSetGK == obj.GetObjectKind().GroupVersionKind().GroupKind() {
-		js, err := obj.MarshalJSON()
-		if err != nil {
-			return nil, err
-		}
-		daemonSet := &appsv1.DaemonSet{}
-		err = json.Unmarshal(js, daemonSet)
-		if err != nil {
-			return nil, err
-		}
-
-		patches, err := util.RenamePVCs(daemonSet.Spec.Template.Spec.Volumes, k.PVCRenameMap, util.PVCPathGenericString)
-		if err != nil {
-			return nil, err
-		}
-		jsonPatch = append(jsonPatch, patches...)
-	}
-	if deploymentGK == obj.GetObjectKind().GroupVersionKind().GroupKind() {
-		js, err := obj.MarshalJSON()
-		if err != nil {
-			return nil, err
-		}
-		deployment := &appsv1.Deployment{}
-		err = json.Unmarshal(js, deployment)
-		if err != nil {
-			return nil, err
-		}
-
-		patches, err := util.RenamePVCs(deployment.Spec.Template.Spec.Volumes, k.PVCRenameMap, util.PVCPathGenericString)
-		if err != nil {
-			return nil, err
-		}
-		jsonPatch = append(jsonPatch, patches...)
 	}
 	if jobGK == obj.GetObjectKind().GroupVersionKind().GroupKind() {
-		js, err := obj.MarshalJSON()
-		if err != nil {
-			return nil, err
-		}
-		job := &batchv1.Job{}
-		err = json.Unmarshal(js, job)
-		if err != nil {
-			return nil, err
-		}
-
-		patches, err := util.RenamePVCs(job.Spec.Template.Spec.Volumes, k.PVCRenameMap, util.PVCPathGenericString)
-		if err != nil {
-			return nil, err
-		}
-		jsonPatch = append(jsonPatch, patches...)
-
-		patches, err = removeJobControllerUID(obj)
+		patches, err := removeJobControllerUID(obj)
 		if err != nil {
 			return nil, err
 		}
@@ -447,40 +586,6 @@ func (k *KubernetesTransformPlugin) getKubernetesTransforms(obj unstructured.Uns
 		}
 		jsonPatch = append(jsonPatch, patches...)
 	}
-	if replicationControllerGK == obj.GetObjectKind().GroupVersionKind().GroupKind() {
-		js, err := obj.MarshalJSON()
-		if err != nil {
-			return nil, err
-		}
-		replicationController := &v1.ReplicationController{}
-		err = json.Unmarshal(js, replicationController)
-		if err != nil {
-			return nil, err
-		}
-
-		patches, err := util.RenamePVCs(replicationController.Spec.Template.Spec.Volumes, k.PVCRenameMap, util.PVCPathGenericString)
-		if err != nil {
-			return nil, err
-		}
-		jsonPatch = append(jsonPatch, patches...)
-	}
-	if replicaSetGK == obj.GetObjectKind().GroupVersionKind().GroupKind() {
-		js, err := obj.MarshalJSON()
-		if err != nil {
-			return nil, err
-		}
-		replicaSet := &appsv1.ReplicaSet{}
-		err = json.Unmarshal(js, replicaSet)
-		if err != nil {
-			return nil, err
-		}
-
-		patches, err := util.RenamePVCs(replicaSet.Spec.Template.Spec.Volumes, k.PVCRenameMap, util.PVCPathGenericString)
-		if err != nil {
-			return nil, err
-		}
-		jsonPatch = append(jsonPatch, patches...)
-	}
 	if roleBindingGK == obj.GetObjectKind().GroupVersionKind().GroupKind() {
 		js, err := obj.MarshalJSON()
 		if err != nil {
@@ -514,13 +619,7 @@ func (k *KubernetesTransformPlugin) getKubernetesTransforms(obj unstructured.Uns
 			return nil, err
 		}
 
-		patches, err := util.RenamePVCs(statefulSet.Spec.Template.Spec.Volumes, k.PVCRenameMap, util.PVCPathGenericString)
-		if err != nil {
-			return nil, err
-		}
-		jsonPatch = append(jsonPatch, patches...)
-
-		patches, err = renamePVCTemplates(statefulSet.Spec.VolumeClaimTemplates, k.PVCRenameMap, util.PVCPathTemplateString)
+		patches, err := renamePVCTemplates(statefulSet.Spec.VolumeClaimTemplates, k.PVCRenameMap, util.PVCPathTemplateString)
 		if err != nil {
 			return nil, err
 		}
@@ -535,64 +634,6 @@ func (k *KubernetesTransformPlugin) getKubernetesTransforms(obj unstructured.Uns
 			jsonPatch = append(jsonPatch, patch...)
 		}
 	}
-	if k.RegistryReplacement != nil && len(k.RegistryReplacement) > 0 {
-		if podGK == obj.GetObjectKind().GroupVersionKind().GroupKind() {
-			js, err := obj.MarshalJSON()
-			if err != nil {
-				return nil, err
-			}
-			pod := &v1.Pod{}
-			err = json.Unmarshal(js, pod)
-			if err != nil {
-				return nil, err
-			}
-			jps := jsonpatch.Patch{}
-			for i, container := range pod.Spec.Containers {
-				updatedImage, update := util.UpdateImageRegistry(k.RegistryReplacement, container.Image)
-				if update {
-					jp, err := util.UpdateImage(fmt.Sprintf(podContainerImageUpdate, i), updatedImage)
-					if err != nil {
-						return nil, err
-					}
-					jps = append(jps, jp...)
-				}
-			}
-			for i, container := range pod.Spec.InitContainers {
-				updatedImage, update := util.UpdateImageRegistry(k.RegistryReplacement, container.Image)
-				if update {
-					jp, err := util.UpdateImage(fmt.Sprintf(podInitContainerImageUpdate, i), updatedImage)
-					if err != nil {
-						return nil, err
-					}
-					jps = append(jps, jp...)
-				}
-			}
-			jsonPatch = append(jsonPatch, jps...)
-		} else if template, ok := types.IsPodSpecable(obj); ok {
-			jps := jsonpatch.Patch{}
-			for i, container := range template.Spec.Containers {
-				updatedImage, update := util.UpdateImageRegistry(k.RegistryReplacement, container.Image)
-				if update {
-					jp, err := util.UpdateImage(fmt.Sprintf(containerImageUpdate, i), updatedImage)
-					if err != nil {
-						return nil, err
-					}
-					jps = append(jps, jp...)
-				}
-			}
-			for i, container := range template.Spec.InitContainers {
-				updatedImage, update := util.UpdateImageRegistry(k.RegistryReplacement, container.Image)
-				if update {
-					jp, err := util.UpdateImage(fmt.Sprintf(initContainerImageUpdate, i), updatedImage)
-					if err != nil {
-						return nil, err
-					}
-					jps = append(jps, jp...)
-				}
-			}
-			jsonPatch = append(jsonPatch, jps...)
-		}
-	}
 	if obj.GetObjectKind().GroupVersionKind().GroupKind() == serviceGK {
 		patches, err := removeServiceFields(obj)
 		if err != nil {
@@ -600,17 +641,91 @@ func (k *KubernetesTransformPlugin) getKubernetesTransforms(obj unstructured.Uns
 		}
 		jsonPatch = append(jsonPatch, patches...)
 	}
+	patches, err = k.getStorageTransforms(obj)
+	if err != nil {
+		return nil, err
+	}
+	jsonPatch = append(jsonPatch, patches...)
+	patches, err = k.getImageTransforms(obj)
+	if err != nil {
+		return nil, err
+	}
+	jsonPatch = append(jsonPatch, patches...)
+	patches, err = k.getNamespaceTransforms(obj)
+	if err != nil {
+		return nil, err
+	}
+	jsonPatch = append(jsonPatch, patches...)
 
 	return jsonPatch, nil
 }
 
-// escapeJSONPointer escapes a string for use in a JSON Pointer path according to RFC 6901
-// ~ must be escaped as ~0
-// / must be escaped as ~1
-func escapeJSONPointer(s string) string {
-	s = strings.ReplaceAll(s, "~", "~0")
-	s = strings.ReplaceAll(s, "/", "~1")
-	return s
+// podSpecPath returns the path to the PodSpec of obj, as registered with the
+// pod-spec-paths option or known to types.PodSpecPath.
+func (k *KubernetesTransformPlugin) podSpecPath(obj unstructured.Unstructured) ([]string, bool) {
+	if path, ok := k.PodSpecPaths[obj.GroupVersionKind().GroupKind()]; ok {
+		return path, true
+	}
+	return types.PodSpecPath(obj)
+}
+
+// getPodSpecTransforms returns the transforms of the PodSpec of every kind
+// with a pod template, wherever the PodSpec is in the object.
+func (k *KubernetesTransformPlugin) getPodSpecTransforms(obj unstructured.Unstructured) (jsonpatch.Patch, error) {
+	path, ok := k.podSpecPath(obj)
+	if !ok {
+		return nil, nil
+	}
+	content, err := jsonContent(obj)
+	if err != nil {
+		return nil, err
+	}
+	spec, found, err := unstructured.NestedFieldNoCopy(content, path...)
+	if err != nil || !found {
+		return nil, err
+	}
+	js, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+	podSpec := &v1.PodSpec{}
+	if err := json.Unmarshal(js, podSpec); err != nil {
+		return nil, err
+	}
+	pointer := fieldpath.Pointer(path)
+
+	// RenamePVCs formats the path with the index of the volume
+	volumeClaimName := fmt.Sprintf(podSpecVolumeClaimName, strings.ReplaceAll(pointer, "%", "%%"))
+	jsonPatch, err := util.RenamePVCs(podSpec.Volumes, k.PVCRenameMap, volumeClaimName)
+	if err != nil {
+		return nil, err
+	}
+	if k.images == nil {
+		return jsonPatch, nil
+	}
+	containers := map[string][]string{}
+	for _, c := range podSpec.Containers {
+		containers["containers"] = append(containers["containers"], c.Image)
+	}
+	for _, c := range podSpec.InitContainers {
+		containers["initContainers"] = append(containers["initContainers"], c.Image)
+	}
+	for _, c := range podSpec.EphemeralContainers {
+		containers["ephemeralContainers"] = append(containers["ephemeralContainers"], c.Image)
+	}
+	for _, field := range []string{"containers", "initContainers", "ephemeralContainers"} {
+		for i, image := range containers[field] {
+			updatedImage, update := k.images.Rewrite(image)
+			if update {
+				jp, err := util.UpdateImage(fmt.Sprintf(podSpecContainerImage, pointer, field, i), updatedImage)
+				if err != nil {
+					return nil, err
+				}
+				jsonPatch = append(jsonPatch, jp...)
+			}
+		}
+	}
+	return jsonPatch, nil
 }
 
 func stripFields(obj unstructured.Unstructured) (jsonpatch.Patch, error) {
@@ -621,13 +736,7 @@ func stripFields(obj unstructured.Unstructured) (jsonpatch.Patch, error) {
 			return patches, err
 		}
 		if found {
-			// Build the JSON Pointer path with proper escaping
-			var pathParts []string
-			for _, f := range field {
-				pathParts = append(pathParts, escapeJSONPointer(f))
-			}
-			path := "/" + strings.Join(pathParts, "/")
-			patch, err := jsonpatch.DecodePatch([]byte(fmt.Sprintf(opRemove, path)))
+			patch, err := jsonpatch.DecodePatch([]byte(fmt.Sprintf(opRemove, fieldpath.Pointer(field))))
 			if err != nil {
 				return nil, err
 			}
@@ -985,7 +1094,7 @@ func removeJobControllerUID(obj unstructured.Unstructured) (jsonpatch.Patch, err
 				return patches, err
 			}
 			if found {
-				path := "/spec/selector/matchLabels/" + escapeJSONPointer(key)
+				path := fieldpath.Pointer([]string{"spec", "selector", "matchLabels", key})
 				patch, err := jsonpatch.DecodePatch([]byte(fmt.Sprintf(opRemove, path)))
 				if err != nil {
 					return nil, err
@@ -1002,7 +1111,7 @@ func removeJobControllerUID(obj unstructured.Unstructured) (jsonpatch.Patch, err
 			return patches, err
 		}
 		if found {
-			path := "/spec/template/metadata/labels/" + escapeJSONPointer(key)
+			path := fieldpath.Pointer([]string{"spec", "template", "metadata", "labels", key})
 			patch, err := jsonpatch.DecodePatch([]byte(fmt.Sprintf(opRemove, path)))
 			if err != nil {
 				return nil, err
@@ -1,16 +1,19 @@
 package kubernetes_test
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"testing"
 
 	jsonpatch "github.com/evanphx/json-patch"
 	transform "github.com/konveyor/crane-lib/transform"
+	"github.com/konveyor/crane-lib/transform/errors"
 	internaljsonpatch "github.com/konveyor/crane-lib/transform/internal/jsonpatch"
 	"github.com/konveyor/crane-lib/transform/kubernetes"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
@@ -1190,3 +1193,257 @@ func TestRun(t *testing.T) {
 		})
 	}
 }
+
+func TestRunInvalidOptionalFields(t *testing.T) {
+	obj := unstructured.Unstructured{Object: map[string]interface{}{
+		"kind":       "Service",
+		"apiVersion": "v1",
+	}}
+	for _, flag := range []string{kubernetes.DisableWhiteoutOwnedFlag, kubernetes.StripDefaultRBACFlag, kubernetes.StripDefaultCABundleFlag} {
+		k := kubernetes.KubernetesTransformPlugin{}
+		_, err := k.Run(transform.PluginRequest{Unstructured: obj, Extras: map[string]string{flag: "maybe"}})
+		if err == nil {
+			t.Errorf("expected an error for %s=maybe", flag)
+		}
+	}
+	k := kubernetes.KubernetesTransformPlugin{}
+	if _, err := k.Run(transform.PluginRequest{Unstructured: obj, Extras: map[string]string{kubernetes.IncludeOnlyFlag: "Service,"}}); err == nil {
+		t.Errorf("expected an error for an invalid %s", kubernetes.IncludeOnlyFlag)
+	}
+	for _, flag := range []string{kubernetes.WhiteoutExpressionFlag, kubernetes.IncludeExpressionFlag} {
+		k := kubernetes.KubernetesTransformPlugin{}
+		_, err := k.Run(transform.PluginRequest{Unstructured: obj, Extras: map[string]string{flag: "object.kind +"}})
+		if !errors.IsExpressionError(err) {
+			t.Errorf("expected an ExpressionError for an invalid %s, got %v", flag, err)
+		}
+	}
+}
+
+func TestRunPodSpecKinds(t *testing.T) {
+	podSpec := map[string]interface{}{
+		"containers":     []interface{}{map[string]interface{}{"name": "app", "image": "quay.io/foo/app:v1"}},
+		"initContainers": []interface{}{map[string]interface{}{"name": "init", "image": "docker.io/foo/init:v1"}},
+		"volumes": []interface{}{
+			map[string]interface{}{"name": "cache", "emptyDir": map[string]interface{}{}},
+			map[string]interface{}{"name": "data", "persistentVolumeClaim": map[string]interface{}{"claimName": "data"}},
+		},
+	}
+	object := func(apiVersion, kind string, path ...string) unstructured.Unstructured {
+		u := unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": apiVersion,
+			"kind":       kind,
+			"metadata":   map[string]interface{}{"name": "app", "namespace": "ns"},
+		}}
+		if err := unstructured.SetNestedField(u.Object, runtime.DeepCopyJSONValue(podSpec), path...); err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+	extras := map[string]string{
+		kubernetes.PVCRenameMap:            "data:data-new",
+		kubernetes.RegistryReplacementFlag: "quay.io=registry.example.com",
+		kubernetes.PodSpecPathsFlag:        "Workflow.example.com=spec.worker.template.spec",
+	}
+	cases := []struct {
+		Name   string
+		Object unstructured.Unstructured
+		Prefix string
+	}{
+		{Name: "Pod", Object: object("v1", "Pod", "spec"), Prefix: "/spec"},
+		{Name: "Deployment", Object: object("apps/v1", "Deployment", "spec", "template", "spec"), Prefix: "/spec/template/spec"},
+		{Name: "DeploymentConfig", Object: object("apps.openshift.io/v1", "DeploymentConfig", "spec", "template", "spec"), Prefix: "/spec/template/spec"},
+		{Name: "CronJob", Object: object("batch/v1", "CronJob", "spec", "jobTemplate", "spec", "template", "spec"), Prefix: "/spec/jobTemplate/spec/template/spec"},
+		{Name: "Rollout", Object: object("argoproj.io/v1alpha1", "Rollout", "spec", "template", "spec"), Prefix: "/spec/template/spec"},
+		{Name: "RegisteredCRD", Object: object("example.com/v1", "Workflow", "spec", "worker", "template", "spec"), Prefix: "/spec/worker/template/spec"},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			k := kubernetes.KubernetesTransformPlugin{}
+			resp, err := k.Run(transform.PluginRequest{Unstructured: c.Object, Extras: extras})
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []string{
+				fmt.Sprintf(`{"op": "replace", "path": "%s/volumes/1/persistentVolumeClaim/claimName", "value": "data-new"}`, c.Prefix),
+				fmt.Sprintf(`{"op": "replace", "path": "%s/containers/0/image", "value": "registry.example.com/foo/app:v1"}`, c.Prefix),
+			}
+			for _, op := range want {
+				expected, err := jsonpatch.DecodePatch([]byte("[" + op + "]"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				found := false
+				for _, actual := range resp.Patches {
+					if internaljsonpatch.EqualOperation(actual, expected[0]) {
+						found = true
+					}
+				}
+				if !found {
+					actual, _ := json.Marshal(resp.Patches)
+					t.Errorf("Patch %s not found in %s", op, actual)
+				}
+			}
+		})
+	}
+
+	k := kubernetes.KubernetesTransformPlugin{}
+	_, err := k.Run(transform.PluginRequest{Unstructured: object("v1", "Pod", "spec"), Extras: map[string]string{kubernetes.PodSpecPathsFlag: "Workflow.example.com=spec..spec"}})
+	if err == nil {
+		t.Errorf("expected an error for an invalid %s", kubernetes.PodSpecPathsFlag)
+	}
+	malformed := unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "example.com/v1",
+		"kind":       "Workflow",
+		"metadata":   map[string]interface{}{"name": "app", "namespace": "ns"},
+		"spec":       map[string]interface{}{"worker": "app"},
+	}}
+	_, err = k.Run(transform.PluginRequest{Unstructured: malformed, Extras: extras})
+	if err == nil {
+		t.Errorf("expected an error for a PodSpec path through a string")
+	}
+}
+
+func TestRunWhiteoutExpressions(t *testing.T) {
+	operatorConfigMap := unstructured.Unstructured{Object: map[string]interface{}{
+		"kind":       "ConfigMap",
+		"apiVersion": "v1",
+		"metadata": map[string]interface{}{
+			"name":      "kube-proxy-config",
+			"namespace": "ns",
+			"ownerReferences": []interface{}{
+				map[string]interface{}{"apiVersion": "operators.coreos.com/v1alpha1", "kind": "ClusterServiceVersion", "name": "proxy.v1"},
+			},
+		},
+	}}
+	configMap := unstructured.Unstructured{Object: map[string]interface{}{
+		"kind":       "ConfigMap",
+		"apiVersion": "v1",
+		"metadata":   map[string]interface{}{"name": "kube-settings", "namespace": "ns", "labels": map[string]interface{}{"app": "shop"}},
+	}}
+	ownedByOperator := `object.kind == "ConfigMap" && object.metadata.name.startsWith("kube-") && has(object.metadata.ownerReferences) && object.metadata.ownerReferences.exists(r, r.kind == "ClusterServiceVersion")`
+	cases := []struct {
+		Name         string
+		Extras       map[string]string
+		Object       unstructured.Unstructured
+		WantWhiteOut bool
+		WantErr      bool
+	}{
+		{
+			Name:         "WhiteoutExpressionMatches",
+			Extras:       map[string]string{kubernetes.WhiteoutExpressionFlag: ownedByOperator},
+			Object:       operatorConfigMap,
+			WantWhiteOut: true,
+		},
+		{
+			Name:   "WhiteoutExpressionDoesNotMatch",
+			Extras: map[string]string{kubernetes.WhiteoutExpressionFlag: ownedByOperator},
+			Object: configMap,
+		},
+		{
+			Name:   "IncludeExpressionMatches",
+			Extras: map[string]string{kubernetes.IncludeExpressionFlag: `has(object.metadata.labels) && object.metadata.labels["app"] == "shop"`},
+			Object: configMap,
+		},
+		{
+			Name:         "IncludeExpressionDoesNotMatch",
+			Extras:       map[string]string{kubernetes.IncludeExpressionFlag: `has(object.metadata.labels) && object.metadata.labels["app"] == "shop"`},
+			Object:       operatorConfigMap,
+			WantWhiteOut: true,
+		},
+		{
+			Name:    "EvaluationError",
+			Extras:  map[string]string{kubernetes.WhiteoutExpressionFlag: `object.metadata.labels["app"] == "shop"`},
+			Object:  operatorConfigMap,
+			WantErr: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			k := kubernetes.KubernetesTransformPlugin{}
+			extras := map[string]string{kubernetes.DisableWhiteoutOwnedFlag: "true"}
+			for key, value := range c.Extras {
+				extras[key] = value
+			}
+			resp, err := k.Run(transform.PluginRequest{Unstructured: c.Object, Extras: extras})
+			if c.WantErr {
+				if !errors.IsExpressionError(err) {
+					t.Errorf("expected an ExpressionError, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.IsWhiteOut != c.WantWhiteOut {
+				t.Errorf("Invalid whiteout. Actual: %v, Expected: %v", resp.IsWhiteOut, c.WantWhiteOut)
+			}
+		})
+	}
+}
+
+func TestRunResponseVersion(t *testing.T) {
+	k := kubernetes.KubernetesTransformPlugin{}
+	pod := unstructured.Unstructured{Object: map[string]interface{}{
+		"kind":       "Pod",
+		"apiVersion": "v1",
+		"metadata":   map[string]interface{}{"name": "pod", "namespace": "ns"},
+	}}
+	for requestVersion, want := range map[transform.Version]string{"": "v1", transform.V1: "v1", transform.V2: "v2"} {
+		resp, err := k.Run(transform.PluginRequest{Unstructured: pod, Version: requestVersion})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Version != want {
+			t.Errorf("Run() with request version %q = version %q, want %q", requestVersion, resp.Version, want)
+		}
+	}
+}
+
+// TestRunBatchConcurrent shares one plugin between the workers of RunBatch,
+// for go test -race to catch the plugin keeping request state.
+func TestRunBatchConcurrent(t *testing.T) {
+	objects := []unstructured.Unstructured{}
+	for i := 0; i < 32; i++ {
+		objects = append(objects,
+			unstructured.Unstructured{Object: map[string]interface{}{
+				"apiVersion": "apps/v1",
+				"kind":       "Deployment",
+				"metadata":   map[string]interface{}{"name": fmt.Sprintf("web-%d", i), "namespace": "shop"},
+				"spec": map[string]interface{}{"template": map[string]interface{}{"spec": map[string]interface{}{
+					"containers": []interface{}{map[string]interface{}{"name": "web", "image": "quay.io/shop/web:1"}},
+				}}},
+			}},
+			unstructured.Unstructured{Object: map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "Service",
+				"metadata":   map[string]interface{}{"name": fmt.Sprintf("web-%d", i), "namespace": "shop"},
+				"spec":       map[string]interface{}{"clusterIP": "10.0.0.1"},
+			}},
+		)
+	}
+	plugins := []transform.Plugin{&kubernetes.KubernetesTransformPlugin{}}
+	runner := transform.NewRunner(nil, nil, map[string]string{
+		kubernetes.AddAnnotationsFlag:      "migrated=true",
+		kubernetes.RegistryReplacementFlag: "quay.io=registry.example.com",
+		kubernetes.NamespaceMapFlag:        "shop=shop-prod",
+	})
+	runner.Workers = 8
+	batch, err := runner.RunBatch(context.Background(), objects, plugins)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Run can not analyze the export, it is given the renames instead.
+	runner.Renames, err = runner.Analyze(context.Background(), objects, plugins)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, object := range objects {
+		want, err := runner.Run(object, plugins)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(batch[i].TransformFile) != string(want.TransformFile) {
+			t.Errorf("RunBatch() of %s = %s, want %s", object.GetName(), batch[i].TransformFile, want.TransformFile)
+		}
+	}
+}
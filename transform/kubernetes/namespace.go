@@ -0,0 +1,338 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	transform "github.com/konveyor/crane-lib/transform"
+	"github.com/konveyor/crane-lib/transform/internal/fieldpath"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// namespaceNameLabel is set by Kubernetes on every namespace, with its
+	// name as value, for namespaceSelectors to select namespaces by name.
+	namespaceNameLabel = "kubernetes.io/metadata.name"
+	// serviceAccountUserPrefix and serviceAccountGroupPrefix start the user
+	// name of a service account, system:serviceaccount:<namespace>:<name>,
+	// and the group of the service accounts of a namespace,
+	// system:serviceaccounts:<namespace>.
+	serviceAccountUserPrefix  = "system:serviceaccount:"
+	serviceAccountGroupPrefix = "system:serviceaccounts:"
+)
+
+var (
+	clusterRoleBindingGK = schema.GroupKind{Group: "rbac.authorization.k8s.io", Kind: "ClusterRoleBinding"}
+	namespaceGK          = schema.GroupKind{Group: "", Kind: "Namespace"}
+	networkPolicyGK      = schema.GroupKind{Group: "networking.k8s.io", Kind: "NetworkPolicy"}
+	sccGK                = schema.GroupKind{Group: "security.openshift.io", Kind: "SecurityContextConstraints"}
+)
+
+// namespaceMapper collects the operations rewriting the namespaces of
+// NamespaceMap in an object.
+type namespaceMapper struct {
+	namespaces map[string]string
+	serviceDNS *regexp.Regexp
+	object     map[string]interface{}
+	patch      jsonpatch.Patch
+}
+
+// getRenames declares the namespaces of NamespaceMap as renamed. The runner
+// then moves the objects they contain, and rewrites the namespaces of the
+// references it knows about, such as the ServiceAccount subjects of role
+// bindings.
+func (k *KubernetesTransformPlugin) getRenames() []transform.Rename {
+	namespaces := make([]string, 0, len(k.NamespaceMap))
+	for namespace := range k.NamespaceMap {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	renames := make([]transform.Rename, 0, len(namespaces))
+	for _, namespace := range namespaces {
+		renames = append(renames, transform.Rename{
+			From: transform.ResourceReference{APIVersion: "v1", Kind: namespaceGK.Kind, Name: namespace},
+			Name: k.NamespaceMap[namespace],
+		})
+	}
+	return renames
+}
+
+// getNamespaceTransforms returns the operations rewriting the namespaces obj
+// references that the runner does not rewrite for the renames of getRenames.
+func (k *KubernetesTransformPlugin) getNamespaceTransforms(obj unstructured.Unstructured) (jsonpatch.Patch, error) {
+	if len(k.NamespaceMap) == 0 {
+		return nil, nil
+	}
+	content, err := jsonContent(obj)
+	if err != nil {
+		return nil, err
+	}
+	m := &namespaceMapper{namespaces: k.NamespaceMap, object: content}
+	if k.NamespaceMapServiceDNS {
+		m.serviceDNS = serviceDNSRegexp(k.NamespaceMap)
+	}
+
+	switch obj.GroupVersionKind().GroupKind() {
+	case roleBindingGK, clusterRoleBindingGK:
+		err = m.subjects()
+	case sccGK:
+		err = m.users([]string{"users"}, []string{"groups"})
+	case networkPolicyGK:
+		err = m.networkPolicy()
+	case configMapGK:
+		err = m.configMapData()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if path, ok := k.podSpecPath(obj); ok {
+		if err := m.podSpecEnv(path); err != nil {
+			return nil, err
+		}
+	}
+	return m.patch, nil
+}
+
+// namespace replaces the namespace at path if it is mapped.
+func (m *namespaceMapper) namespace(path []string) error {
+	namespace, ok := fieldpath.Value(m.object, path).(string)
+	if !ok {
+		return nil
+	}
+	if newNamespace, ok := m.namespaces[namespace]; ok {
+		return m.replace(path, newNamespace)
+	}
+	return nil
+}
+
+// subjects rewrites the service account names of the User and Group subjects
+// of a role binding.
+func (m *namespaceMapper) subjects() error {
+	return m.each([]string{"subjects"}, func(subject []string) error {
+		switch kind, _ := fieldpath.Value(m.object, fieldpath.Sub(subject, "kind")).(string); kind {
+		case "User", "Group":
+			return m.serviceAccountName(fieldpath.Sub(subject, "name"))
+		}
+		return nil
+	})
+}
+
+// users rewrites the service account users and groups of the lists at
+// usersPath and groupsPath.
+func (m *namespaceMapper) users(usersPath, groupsPath []string) error {
+	if err := m.each(usersPath, m.serviceAccountName); err != nil {
+		return err
+	}
+	return m.each(groupsPath, m.serviceAccountName)
+}
+
+// serviceAccountName rewrites the namespace in the service account user or
+// group name at path.
+func (m *namespaceMapper) serviceAccountName(path []string) error {
+	name, ok := fieldpath.Value(m.object, path).(string)
+	if !ok {
+		return nil
+	}
+	for _, prefix := range []string{serviceAccountUserPrefix, serviceAccountGroupPrefix} {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		rest := strings.TrimPrefix(name, prefix)
+		namespace, saName, found := strings.Cut(rest, ":")
+		newNamespace, ok := m.namespaces[namespace]
+		if !ok {
+			return nil
+		}
+		if found {
+			return m.replace(path, prefix+newNamespace+":"+saName)
+		}
+		return m.replace(path, prefix+newNamespace)
+	}
+	return nil
+}
+
+// networkPolicy rewrites the namespace names selected by the
+// namespaceSelectors of the peers of a NetworkPolicy.
+func (m *namespaceMapper) networkPolicy() error {
+	for _, peers := range [][2]string{{"ingress", "from"}, {"egress", "to"}} {
+		err := m.each([]string{"spec", peers[0]}, func(rule []string) error {
+			return m.each(fieldpath.Sub(rule, peers[1]), func(peer []string) error {
+				selector := fieldpath.Sub(peer, "namespaceSelector")
+				if err := m.namespace(fieldpath.Sub(selector, "matchLabels", namespaceNameLabel)); err != nil {
+					return err
+				}
+				return m.each(fieldpath.Sub(selector, "matchExpressions"), func(expression []string) error {
+					if key, _ := fieldpath.Value(m.object, fieldpath.Sub(expression, "key")).(string); key != namespaceNameLabel {
+						return nil
+					}
+					return m.each(fieldpath.Sub(expression, "values"), m.namespace)
+				})
+			})
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// configMapData rewrites the Service DNS names in the data of a ConfigMap.
+func (m *namespaceMapper) configMapData() error {
+	data, _ := fieldpath.Value(m.object, []string{"data"}).(map[string]interface{})
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := m.serviceDNSNames([]string{"data", key}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// podSpecEnv rewrites the Service DNS names in the environment variables of
+// the containers of the PodSpec at path.
+func (m *namespaceMapper) podSpecEnv(path []string) error {
+	for _, containers := range []string{"containers", "initContainers", "ephemeralContainers"} {
+		err := m.each(fieldpath.Sub(path, containers), func(container []string) error {
+			return m.each(fieldpath.Sub(container, "env"), func(env []string) error {
+				return m.serviceDNSNames(fieldpath.Sub(env, "value"))
+			})
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// serviceDNSNames rewrites the namespace of the Service DNS names in the
+// string at path, when NamespaceMapServiceDNS is set.
+func (m *namespaceMapper) serviceDNSNames(path []string) error {
+	if m.serviceDNS == nil {
+		return nil
+	}
+	value, ok := fieldpath.Value(m.object, path).(string)
+	if !ok {
+		return nil
+	}
+	var newValue strings.Builder
+	last := 0
+	for _, match := range m.serviceDNS.FindAllStringSubmatchIndex(value, -1) {
+		if !dnsNameEnd(value, match[1]) {
+			continue
+		}
+		newValue.WriteString(value[last:match[4]])
+		newValue.WriteString(m.namespaces[value[match[4]:match[5]]])
+		last = match[5]
+	}
+	newValue.WriteString(value[last:])
+	if newValue.String() != value {
+		return m.replace(path, newValue.String())
+	}
+	return nil
+}
+
+// dnsLabel matches a DNS label as Kubernetes names them.
+const dnsLabel = `[a-z0-9](?:[-a-z0-9]*[a-z0-9])?`
+
+// serviceDNSRegexp returns the regular expression matching the DNS names of
+// the Services of the namespaces of namespaces: <service>.<namespace>, or
+// <service>.<namespace>.svc followed by any cluster domain. It captures the
+// service, the namespace and the rest of the name.
+func serviceDNSRegexp(namespaces map[string]string) *regexp.Regexp {
+	quoted := make([]string, 0, len(namespaces))
+	for namespace := range namespaces {
+		quoted = append(quoted, regexp.QuoteMeta(namespace))
+	}
+	// The first namespace matching wins, shop-db must go before shop.
+	sort.Slice(quoted, func(i, j int) bool {
+		if len(quoted[i]) != len(quoted[j]) {
+			return len(quoted[i]) > len(quoted[j])
+		}
+		return quoted[i] < quoted[j]
+	})
+	return regexp.MustCompile(`\b(` + dnsLabel + `)\.(` + strings.Join(quoted, "|") + `)((?:\.svc(?:\.` + dnsLabel + `)*)?)`)
+}
+
+// dnsNameEnd returns whether the DNS name matched up to end in s ends there,
+// rather than going on with more characters or labels, as db.shop.com does.
+func dnsNameEnd(s string, end int) bool {
+	inLabel := func(i int) bool {
+		if i >= len(s) {
+			return false
+		}
+		c := s[i]
+		return c == '-' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+	}
+	return !inLabel(end) && !(end < len(s) && s[end] == '.' && inLabel(end+1))
+}
+
+// each calls f with the path of every item of the list at path, until f
+// fails.
+func (m *namespaceMapper) each(path []string, f func(item []string) error) error {
+	items, _ := fieldpath.Value(m.object, path).([]interface{})
+	for i := range items {
+		if err := f(fieldpath.Sub(path, strconv.Itoa(i))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *namespaceMapper) replace(path []string, value string) error {
+	patch, err := replaceOp(path, value)
+	if err != nil {
+		return err
+	}
+	m.patch = append(m.patch, patch...)
+	return nil
+}
+
+// replaceOp returns the operation replacing the value at path, escaping both
+// the path and the value.
+func replaceOp(path []string, value interface{}) (jsonpatch.Patch, error) {
+	return operation(map[string]interface{}{"op": "replace", "value": value}, path)
+}
+
+// addOp returns the operation adding value at path.
+func addOp(path []string, value interface{}) (jsonpatch.Patch, error) {
+	return operation(map[string]interface{}{"op": "add", "value": value}, path)
+}
+
+// removeOp returns the operation removing the value at path.
+func removeOp(path []string) (jsonpatch.Patch, error) {
+	return operation(map[string]interface{}{"op": "remove"}, path)
+}
+
+// operation returns op with the JSON pointer to path.
+func operation(op map[string]interface{}, path []string) (jsonpatch.Patch, error) {
+	op["path"] = fieldpath.Pointer(path)
+	b, err := json.Marshal([]map[string]interface{}{op})
+	if err != nil {
+		return nil, err
+	}
+	return jsonpatch.DecodePatch(b)
+}
+
+// jsonContent returns the content of obj as decoded from JSON, whatever the
+// types of its values.
+func jsonContent(obj unstructured.Unstructured) (map[string]interface{}, error) {
+	js, err := obj.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	content := map[string]interface{}{}
+	if err := json.Unmarshal(js, &content); err != nil {
+		return nil, fmt.Errorf("unable to decode the object: %w", err)
+	}
+	return content, nil
+}
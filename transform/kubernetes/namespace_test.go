@@ -0,0 +1,269 @@
+package kubernetes_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	transform "github.com/konveyor/crane-lib/transform"
+	internaljsonpatch "github.com/konveyor/crane-lib/transform/internal/jsonpatch"
+	"github.com/konveyor/crane-lib/transform/kubernetes"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestRunNamespaceMap(t *testing.T) {
+	cases := []struct {
+		Name       string
+		Object     map[string]interface{}
+		ServiceDNS bool
+		// Patches are the namespace rewrites, among the other patches of
+		// the plugin.
+		Patches string
+		// Unchanged are paths that must not be patched.
+		Unchanged []string
+	}{
+		{
+			Name: "Namespace",
+			Object: map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "Namespace",
+				"metadata":   map[string]interface{}{"name": "shop"},
+			},
+			Patches: `[{"op": "replace", "path": "/metadata/name", "value": "shop-prod"}]`,
+		},
+		{
+			Name: "UnmappedNamespace",
+			Object: map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "ConfigMap",
+				"metadata":   map[string]interface{}{"name": "settings", "namespace": "other"},
+			},
+			Unchanged: []string{"/metadata/namespace"},
+		},
+		{
+			Name: "RoleBinding",
+			Object: map[string]interface{}{
+				"apiVersion": "rbac.authorization.k8s.io/v1",
+				"kind":       "RoleBinding",
+				"metadata":   map[string]interface{}{"name": "view", "namespace": "shop"},
+				"subjects": []interface{}{
+					map[string]interface{}{"kind": "ServiceAccount", "name": "default", "namespace": "shop"},
+					map[string]interface{}{"kind": "ServiceAccount", "name": "builder", "namespace": "shop-db"},
+					map[string]interface{}{"kind": "User", "name": "system:serviceaccount:shop-db:deployer"},
+					map[string]interface{}{"kind": "Group", "name": "system:serviceaccounts:shop-db"},
+					map[string]interface{}{"kind": "User", "name": "system:serviceaccount:other:deployer"},
+				},
+			},
+			Patches: `[
+				{"op": "replace", "path": "/metadata/namespace", "value": "shop-prod"},
+				{"op": "remove", "path": "/subjects/0/namespace"},
+				{"op": "replace", "path": "/subjects/1/namespace", "value": "shop-prod-db"},
+				{"op": "replace", "path": "/subjects/2/name", "value": "system:serviceaccount:shop-prod-db:deployer"},
+				{"op": "replace", "path": "/subjects/3/name", "value": "system:serviceaccounts:shop-prod-db"}
+			]`,
+			Unchanged: []string{"/subjects/4/name"},
+		},
+		{
+			Name: "ClusterRoleBinding",
+			Object: map[string]interface{}{
+				"apiVersion": "rbac.authorization.k8s.io/v1",
+				"kind":       "ClusterRoleBinding",
+				"metadata":   map[string]interface{}{"name": "view"},
+				"subjects": []interface{}{
+					map[string]interface{}{"kind": "ServiceAccount", "name": "default", "namespace": "shop"},
+				},
+			},
+			Patches: `[{"op": "replace", "path": "/subjects/0/namespace", "value": "shop-prod"}]`,
+		},
+		{
+			Name: "SecurityContextConstraints",
+			Object: map[string]interface{}{
+				"apiVersion": "security.openshift.io/v1",
+				"kind":       "SecurityContextConstraints",
+				"metadata":   map[string]interface{}{"name": "shop-scc"},
+				"users":      []interface{}{"system:serviceaccount:shop:default", "admin"},
+				"groups":     []interface{}{"system:serviceaccounts:shop"},
+			},
+			Patches: `[
+				{"op": "replace", "path": "/users/0", "value": "system:serviceaccount:shop-prod:default"},
+				{"op": "replace", "path": "/groups/0", "value": "system:serviceaccounts:shop-prod"}
+			]`,
+			Unchanged: []string{"/users/1"},
+		},
+		{
+			Name: "NetworkPolicy",
+			Object: map[string]interface{}{
+				"apiVersion": "networking.k8s.io/v1",
+				"kind":       "NetworkPolicy",
+				"metadata":   map[string]interface{}{"name": "allow-db", "namespace": "shop-db"},
+				"spec": map[string]interface{}{
+					"ingress": []interface{}{
+						map[string]interface{}{"from": []interface{}{
+							map[string]interface{}{"namespaceSelector": map[string]interface{}{
+								"matchLabels": map[string]interface{}{"kubernetes.io/metadata.name": "shop"},
+							}},
+						}},
+					},
+					"egress": []interface{}{
+						map[string]interface{}{"to": []interface{}{
+							map[string]interface{}{"namespaceSelector": map[string]interface{}{
+								"matchExpressions": []interface{}{
+									map[string]interface{}{"key": "team", "operator": "In", "values": []interface{}{"shop"}},
+									map[string]interface{}{"key": "kubernetes.io/metadata.name", "operator": "In", "values": []interface{}{"other", "shop"}},
+								},
+							}},
+						}},
+					},
+				},
+			},
+			Patches: `[
+				{"op": "replace", "path": "/metadata/namespace", "value": "shop-prod-db"},
+				{"op": "replace", "path": "/spec/ingress/0/from/0/namespaceSelector/matchLabels/kubernetes.io~1metadata.name", "value": "shop-prod"},
+				{"op": "replace", "path": "/spec/egress/0/to/0/namespaceSelector/matchExpressions/1/values/1", "value": "shop-prod"}
+			]`,
+			Unchanged: []string{
+				"/spec/egress/0/to/0/namespaceSelector/matchExpressions/0/values/0",
+				"/spec/egress/0/to/0/namespaceSelector/matchExpressions/1/values/0",
+			},
+		},
+		{
+			Name: "ServiceDNSDisabled",
+			Object: map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "ConfigMap",
+				"metadata":   map[string]interface{}{"name": "settings", "namespace": "shop"},
+				"data":       map[string]interface{}{"url": "postgres://db.shop-db.svc:5432/shop"},
+			},
+			Patches:   `[{"op": "replace", "path": "/metadata/namespace", "value": "shop-prod"}]`,
+			Unchanged: []string{"/data/url"},
+		},
+		{
+			Name: "ServiceDNSConfigMap",
+			Object: map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "ConfigMap",
+				"metadata":   map[string]interface{}{"name": "settings", "namespace": "shop"},
+				"data": map[string]interface{}{
+					"url":     "postgres://db.shop-db.svc:5432/shop",
+					"servers": "cache.shop.svc.cluster.local:6379,cache.other.svc:6379",
+					"name":    "shop",
+				},
+			},
+			ServiceDNS: true,
+			Patches: `[
+				{"op": "replace", "path": "/metadata/namespace", "value": "shop-prod"},
+				{"op": "replace", "path": "/data/url", "value": "postgres://db.shop-prod-db.svc:5432/shop"},
+				{"op": "replace", "path": "/data/servers", "value": "cache.shop-prod.svc.cluster.local:6379,cache.other.svc:6379"}
+			]`,
+			Unchanged: []string{"/data/name"},
+		},
+		{
+			Name: "ServiceDNSShortFormAndClusterDomain",
+			Object: map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "ConfigMap",
+				"metadata":   map[string]interface{}{"name": "settings", "namespace": "shop"},
+				"data": map[string]interface{}{
+					"url":     "http://api.shop/v1, http://db.shop-db:5432",
+					"servers": "cache.shop.svc.example.internal:6379",
+					"site":    "https://www.shop.com",
+					"other":   "db.shop-other.svc",
+				},
+			},
+			ServiceDNS: true,
+			Patches: `[
+				{"op": "replace", "path": "/metadata/namespace", "value": "shop-prod"},
+				{"op": "replace", "path": "/data/url", "value": "http://api.shop-prod/v1, http://db.shop-prod-db:5432"},
+				{"op": "replace", "path": "/data/servers", "value": "cache.shop-prod.svc.example.internal:6379"}
+			]`,
+			Unchanged: []string{"/data/site", "/data/other"},
+		},
+		{
+			Name: "ServiceDNSEnv",
+			Object: map[string]interface{}{
+				"apiVersion": "apps/v1",
+				"kind":       "Deployment",
+				"metadata":   map[string]interface{}{"name": "web", "namespace": "shop"},
+				"spec": map[string]interface{}{"template": map[string]interface{}{"spec": map[string]interface{}{
+					"containers": []interface{}{
+						map[string]interface{}{"name": "web", "image": "web", "env": []interface{}{
+							map[string]interface{}{"name": "NAMESPACE", "value": "shop"},
+							map[string]interface{}{"name": "DB_HOST", "value": "db.shop-db.svc.cluster.local"},
+						}},
+					},
+				}}},
+			},
+			ServiceDNS: true,
+			Patches: `[
+				{"op": "replace", "path": "/metadata/namespace", "value": "shop-prod"},
+				{"op": "replace", "path": "/spec/template/spec/containers/0/env/1/value", "value": "db.shop-prod-db.svc.cluster.local"}
+			]`,
+			Unchanged: []string{"/spec/template/spec/containers/0/env/0/value"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			extras := map[string]string{kubernetes.NamespaceMapFlag: "shop=shop-prod,shop-db=shop-prod-db"}
+			if c.ServiceDNS {
+				extras[kubernetes.NamespaceMapServiceDNSFlag] = "true"
+			}
+			obj := unstructured.Unstructured{Object: c.Object}
+			// The objects are moved by the runner, for the renames the
+			// plugin declares.
+			runner := transform.NewRunner(logrus.New(), nil, extras)
+			responses, err := runner.RunBatch(context.Background(), []unstructured.Unstructured{obj}, []transform.Plugin{&kubernetes.KubernetesTransformPlugin{}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual := responses[0].TransformFile
+			patches, err := jsonpatch.DecodePatch(actual)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.Patches != "" {
+				expected, err := jsonpatch.DecodePatch([]byte(c.Patches))
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, op := range expected {
+					found := false
+					for _, actualOp := range patches {
+						if internaljsonpatch.EqualOperation(actualOp, op) {
+							found = true
+						}
+					}
+					if !found {
+						expectedOp, _ := json.Marshal(op)
+						t.Errorf("Patch %s not found in %s", expectedOp, actual)
+					}
+				}
+			}
+			for _, path := range c.Unchanged {
+				for _, op := range patches {
+					if p, _ := op.Path(); p == path {
+						t.Errorf("Unexpected patch of %s in %s", path, actual)
+					}
+				}
+			}
+			doc, _ := obj.MarshalJSON()
+			if _, err := patches.Apply(doc); err != nil {
+				t.Errorf("Patches %s do not apply: %v", actual, err)
+			}
+		})
+	}
+}
+
+func TestRunInvalidNamespaceMap(t *testing.T) {
+	obj := unstructured.Unstructured{Object: map[string]interface{}{
+		"kind":       "Service",
+		"apiVersion": "v1",
+	}}
+	for _, value := range []string{"shop=Shop", "shop=", "shop_db=shop-db"} {
+		k := kubernetes.KubernetesTransformPlugin{}
+		if _, err := k.Run(transform.PluginRequest{Unstructured: obj, Extras: map[string]string{kubernetes.NamespaceMapFlag: value}}); err == nil {
+			t.Errorf("expected an error for %s=%s", kubernetes.NamespaceMapFlag, value)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package kubernetes
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/konveyor/crane-lib/transform/internal/fieldpath"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+const (
+	// storageClassAnnotation is the storage class of claims created before
+	// spec.storageClassName.
+	storageClassAnnotation = "volume.beta.kubernetes.io/storage-class"
+	// boundAnnotationPrefix starts the annotations of the binding of a claim
+	// to a volume, such as pv.kubernetes.io/bind-completed.
+	boundAnnotationPrefix = "pv.kubernetes.io/"
+)
+
+// claimAnnotationsToStrip are the annotations tying a claim to the
+// provisioner and node of the source cluster, besides those starting with
+// boundAnnotationPrefix.
+var claimAnnotationsToStrip = []string{
+	"volume.beta.kubernetes.io/storage-provisioner",
+	"volume.kubernetes.io/storage-provisioner",
+	"volume.kubernetes.io/selected-node",
+}
+
+// getStorageTransforms returns the transforms of the PVCs the plugin is told
+// to keep and of the volumeClaimTemplates of StatefulSets, for them to bind
+// to new volumes on the target cluster.
+func (k *KubernetesTransformPlugin) getStorageTransforms(obj unstructured.Unstructured) (jsonpatch.Patch, error) {
+	gk := obj.GroupVersionKind().GroupKind()
+	if gk != pvcGK && gk != statefulSetGK {
+		return nil, nil
+	}
+	content, err := jsonContent(obj)
+	if err != nil {
+		return nil, err
+	}
+	if gk == pvcGK {
+		return k.claimTransforms(content, nil)
+	}
+	jsonPatch := jsonpatch.Patch{}
+	templates, _ := fieldpath.Value(content, []string{"spec", "volumeClaimTemplates"}).([]interface{})
+	for i := range templates {
+		patches, err := k.claimTransforms(content, []string{"spec", "volumeClaimTemplates", strconv.Itoa(i)})
+		if err != nil {
+			return nil, err
+		}
+		jsonPatch = append(jsonPatch, patches...)
+	}
+	return jsonPatch, nil
+}
+
+// claimTransforms returns the transforms of the claim at path in content.
+func (k *KubernetesTransformPlugin) claimTransforms(content map[string]interface{}, path []string) (jsonpatch.Patch, error) {
+	jsonPatch := jsonpatch.Patch{}
+	appendOp := func(patch jsonpatch.Patch, err error) error {
+		jsonPatch = append(jsonPatch, patch...)
+		return err
+	}
+	at := func(fields ...string) []string {
+		return fieldpath.Sub(path, fields...)
+	}
+	spec, ok := fieldpath.Value(content, at("spec")).(map[string]interface{})
+	if !ok {
+		return nil, nil
+	}
+
+	for _, field := range []string{"volumeName", "dataSource", "dataSourceRef"} {
+		if _, ok := spec[field]; ok {
+			if err := appendOp(removeOp(at("spec", field))); err != nil {
+				return nil, err
+			}
+		}
+	}
+	annotations, _ := fieldpath.Value(content, at(metadata, "annotations")).(map[string]interface{})
+	keys := make([]string, 0, len(annotations))
+	for key := range annotations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if strings.HasPrefix(key, boundAnnotationPrefix) || sets.New(claimAnnotationsToStrip...).Has(key) {
+			if err := appendOp(removeOp(at(metadata, "annotations", key))); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if storageClass, ok := spec["storageClassName"].(string); ok {
+		if newStorageClass, ok := k.StorageClassMap[storageClass]; ok {
+			if err := appendOp(replaceOp(at("spec", "storageClassName"), newStorageClass)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if storageClass, ok := annotations[storageClassAnnotation].(string); ok {
+		if newStorageClass, ok := k.StorageClassMap[storageClass]; ok {
+			if err := appendOp(replaceOp(at(metadata, "annotations", storageClassAnnotation), newStorageClass)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(k.PVCAccessModes) > 0 {
+		if err := appendOp(addOp(at("spec", "accessModes"), k.PVCAccessModes)); err != nil {
+			return nil, err
+		}
+	}
+	if k.PVCVolumeMode != "" {
+		if err := appendOp(addOp(at("spec", "volumeMode"), k.PVCVolumeMode)); err != nil {
+			return nil, err
+		}
+	}
+	return jsonPatch, nil
+}
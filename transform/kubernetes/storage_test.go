@@ -0,0 +1,157 @@
+package kubernetes_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	transform "github.com/konveyor/crane-lib/transform"
+	internaljsonpatch "github.com/konveyor/crane-lib/transform/internal/jsonpatch"
+	"github.com/konveyor/crane-lib/transform/kubernetes"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func testClaim() map[string]interface{} {
+	return map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name": "data",
+			"annotations": map[string]interface{}{
+				"pv.kubernetes.io/bind-completed":               "yes",
+				"pv.kubernetes.io/bound-by-controller":          "yes",
+				"volume.kubernetes.io/selected-node":            "node-1",
+				"volume.beta.kubernetes.io/storage-provisioner": "kubernetes.io/aws-ebs",
+				"volume.beta.kubernetes.io/storage-class":       "gp2",
+				"owner": "team-a",
+			},
+		},
+		"spec": map[string]interface{}{
+			"accessModes":      []interface{}{"ReadWriteMany"},
+			"storageClassName": "gp2",
+			"volumeName":       "pvc-0123",
+			"dataSource":       map[string]interface{}{"kind": "VolumeSnapshot", "name": "snap", "apiGroup": "snapshot.storage.k8s.io"},
+			"resources":        map[string]interface{}{"requests": map[string]interface{}{"storage": "1Gi"}},
+		},
+	}
+}
+
+func TestRunStorage(t *testing.T) {
+	pvc := testClaim()
+	pvc["apiVersion"] = "v1"
+	pvc["kind"] = "PersistentVolumeClaim"
+	pvc["metadata"].(map[string]interface{})["namespace"] = "shop"
+
+	statefulSet := map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "StatefulSet",
+		"metadata":   map[string]interface{}{"name": "db", "namespace": "shop"},
+		"spec": map[string]interface{}{
+			"volumeClaimTemplates": []interface{}{
+				map[string]interface{}{
+					"metadata": map[string]interface{}{"name": "data"},
+					"spec":     map[string]interface{}{"accessModes": []interface{}{"ReadWriteOnce"}, "storageClassName": "standard"},
+				},
+				map[string]interface{}{
+					"metadata": map[string]interface{}{"name": "logs"},
+					"spec":     map[string]interface{}{"accessModes": []interface{}{"ReadWriteOnce"}},
+				},
+			},
+		},
+	}
+
+	cases := []struct {
+		Name    string
+		Object  map[string]interface{}
+		Extras  map[string]string
+		Patches string
+	}{
+		{
+			Name:   "PVC",
+			Object: pvc,
+			Extras: map[string]string{
+				kubernetes.IncludeOnlyFlag:     "PersistentVolumeClaim",
+				kubernetes.StorageClassMapFlag: "gp2=gp3-csi",
+				kubernetes.PVCAccessModesFlag:  "ReadWriteOnce",
+				kubernetes.PVCVolumeModeFlag:   "Filesystem",
+			},
+			Patches: `[
+				{"op": "remove", "path": "/spec/volumeName"},
+				{"op": "remove", "path": "/spec/dataSource"},
+				{"op": "remove", "path": "/metadata/annotations/pv.kubernetes.io~1bind-completed"},
+				{"op": "remove", "path": "/metadata/annotations/pv.kubernetes.io~1bound-by-controller"},
+				{"op": "remove", "path": "/metadata/annotations/volume.kubernetes.io~1selected-node"},
+				{"op": "remove", "path": "/metadata/annotations/volume.beta.kubernetes.io~1storage-provisioner"},
+				{"op": "replace", "path": "/spec/storageClassName", "value": "gp3-csi"},
+				{"op": "replace", "path": "/metadata/annotations/volume.beta.kubernetes.io~1storage-class", "value": "gp3-csi"},
+				{"op": "add", "path": "/spec/accessModes", "value": ["ReadWriteOnce"]},
+				{"op": "add", "path": "/spec/volumeMode", "value": "Filesystem"}
+			]`,
+		},
+		{
+			Name:   "PVCWithoutOptions",
+			Object: pvc,
+			Extras: map[string]string{kubernetes.IncludeOnlyFlag: "PersistentVolumeClaim"},
+			Patches: `[
+				{"op": "remove", "path": "/spec/volumeName"},
+				{"op": "remove", "path": "/spec/dataSource"},
+				{"op": "remove", "path": "/metadata/annotations/pv.kubernetes.io~1bind-completed"},
+				{"op": "remove", "path": "/metadata/annotations/pv.kubernetes.io~1bound-by-controller"},
+				{"op": "remove", "path": "/metadata/annotations/volume.kubernetes.io~1selected-node"},
+				{"op": "remove", "path": "/metadata/annotations/volume.beta.kubernetes.io~1storage-provisioner"}
+			]`,
+		},
+		{
+			Name:   "VolumeClaimTemplates",
+			Object: statefulSet,
+			Extras: map[string]string{
+				kubernetes.StorageClassMapFlag: "standard=standard-csi",
+				kubernetes.PVCAccessModesFlag:  "ReadWriteOncePod",
+			},
+			Patches: `[
+				{"op": "replace", "path": "/spec/volumeClaimTemplates/0/spec/storageClassName", "value": "standard-csi"},
+				{"op": "add", "path": "/spec/volumeClaimTemplates/0/spec/accessModes", "value": ["ReadWriteOncePod"]},
+				{"op": "add", "path": "/spec/volumeClaimTemplates/1/spec/accessModes", "value": ["ReadWriteOncePod"]}
+			]`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			k := kubernetes.KubernetesTransformPlugin{}
+			obj := unstructured.Unstructured{Object: c.Object}
+			resp, err := k.Run(transform.PluginRequest{Unstructured: obj, Extras: c.Extras})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.IsWhiteOut {
+				t.Fatalf("Unexpected whiteout")
+			}
+			expected, err := jsonpatch.DecodePatch([]byte(c.Patches))
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual, _ := json.Marshal(resp.Patches)
+			if ok, err := internaljsonpatch.Equal(resp.Patches, expected); !ok || err != nil {
+				t.Errorf("Invalid patches. Actual: %s, Expected: %s", actual, c.Patches)
+			}
+			doc, _ := obj.MarshalJSON()
+			if _, err := resp.Patches.Apply(doc); err != nil {
+				t.Errorf("Patches %s do not apply: %v", actual, err)
+			}
+		})
+	}
+}
+
+func TestRunInvalidStorageOptions(t *testing.T) {
+	obj := unstructured.Unstructured{Object: map[string]interface{}{
+		"kind":       "Service",
+		"apiVersion": "v1",
+	}}
+	for flag, value := range map[string]string{
+		kubernetes.PVCAccessModesFlag: "ReadWriteOnce,WriteOnly",
+		kubernetes.PVCVolumeModeFlag:  "Raw",
+	} {
+		k := kubernetes.KubernetesTransformPlugin{}
+		if _, err := k.Run(transform.PluginRequest{Unstructured: obj, Extras: map[string]string{flag: value}}); err == nil {
+			t.Errorf("expected an error for %s=%s", flag, value)
+		}
+	}
+}
@@ -4,9 +4,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"sort"
-	"strings"
 
 	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/konveyor/crane-lib/transform/internal/fieldpath"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
@@ -88,7 +88,7 @@ func buildPatchOps(full, skeleton map[string]interface{}) []patchOp {
 			if _, inSkel := skelMeta[key]; !inSkel {
 				ops = append(ops, patchOp{
 					Op:    "add",
-					Path:  "/metadata/" + escapeJSONPointer(key),
+					Path:  fieldpath.Pointer([]string{"metadata", key}),
 					Value: fullMeta[key],
 				})
 			}
@@ -101,7 +101,7 @@ func buildPatchOps(full, skeleton map[string]interface{}) []patchOp {
 		if _, inSkel := skeleton[key]; !inSkel {
 			ops = append(ops, patchOp{
 				Op:    "add",
-				Path:  "/" + escapeJSONPointer(key),
+				Path:  fieldpath.Pointer([]string{key}),
 				Value: full[key],
 			})
 		}
@@ -124,11 +124,3 @@ func sortedKeys(m map[string]interface{}) []string {
 	sort.Strings(keys)
 	return keys
 }
-
-// escapeJSONPointer escapes ~ and / per RFC 6901.
-func escapeJSONPointer(s string) string {
-	// ~ must be escaped first (before /)
-	s = strings.ReplaceAll(s, "~", "~0")
-	s = strings.ReplaceAll(s, "/", "~1")
-	return s
-}
@@ -0,0 +1,176 @@
+package transform
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	transformerrors "github.com/konveyor/crane-lib/transform/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// OptionalFieldType is how the value of an optional field is parsed.
+//
+// Lists and maps are comma-separated, and map entries are key=value pairs. A
+// backslash escapes a comma, an equal sign or a backslash in an item, key or
+// value, as in "key=a\,b".
+type OptionalFieldType string
+
+const (
+	OptionalFieldString OptionalFieldType = "string"
+	// OptionalFieldBool is parsed with strconv.ParseBool.
+	OptionalFieldBool OptionalFieldType = "bool"
+	OptionalFieldInt  OptionalFieldType = "int"
+	// OptionalFieldStringList is parsed with ParseOptionalFieldSliceVal.
+	OptionalFieldStringList OptionalFieldType = "stringList"
+	// OptionalFieldMap is parsed with ParseOptionalFieldMapVal.
+	OptionalFieldMap OptionalFieldType = "map"
+	// OptionalFieldGroupKindList is parsed with
+	// ParseOptionalFieldGroupKindSliceVal.
+	OptionalFieldGroupKindList OptionalFieldType = "groupKindList"
+	// OptionalFieldEnum accepts one of the values in OptionalFields.Enum.
+	OptionalFieldEnum OptionalFieldType = "enum"
+)
+
+// Validate returns an error if value can not be parsed as the type of the
+// field.
+func (f OptionalFields) Validate(value string) error {
+	switch f.Type {
+	case "", OptionalFieldString, OptionalFieldStringList:
+		return nil
+	case OptionalFieldBool:
+		_, err := ParseOptionalFieldBoolVal(value)
+		return err
+	case OptionalFieldInt:
+		_, err := ParseOptionalFieldIntVal(value)
+		return err
+	case OptionalFieldMap:
+		for key := range ParseOptionalFieldMapVal(value) {
+			if key == "" {
+				return fmt.Errorf("empty key in %q", value)
+			}
+		}
+		return nil
+	case OptionalFieldGroupKindList:
+		_, err := ParseOptionalFieldGroupKindSliceVal(value)
+		return err
+	case OptionalFieldEnum:
+		for _, v := range f.Enum {
+			if v == value {
+				return nil
+			}
+		}
+		return fmt.Errorf("%q is not one of %s", value, strings.Join(f.Enum, ", "))
+	default:
+		return fmt.Errorf("unknown type %q", f.Type)
+	}
+}
+
+// ValidateOptionalFields checks extras against the fields a plugin declares
+// and returns a copy of extras with the default of every unset field. Empty
+// values are unset. Extras that are not declared are kept as they are; the
+// Runner only sends a plugin the flags it declares, but a plugin run directly
+// may be given others. The error is an *errors.OptionError.
+func ValidateOptionalFields(fields []OptionalFields, extras map[string]string) (map[string]string, error) {
+	validated := make(map[string]string, len(extras))
+	for k, v := range extras {
+		validated[k] = v
+	}
+	for _, field := range fields {
+		value := extras[field.FlagName]
+		if value == "" {
+			value = field.Default
+		}
+		if value == "" {
+			if field.Required {
+				return nil, &transformerrors.OptionError{FlagName: field.FlagName, Err: fmt.Errorf("required")}
+			}
+			continue
+		}
+		if err := field.Validate(value); err != nil {
+			return nil, &transformerrors.OptionError{FlagName: field.FlagName, Err: err}
+		}
+		validated[field.FlagName] = value
+	}
+	return validated, nil
+}
+
+func ParseOptionalFieldSliceVal(sliceVal string) []string {
+	items := splitEscaped(sliceVal, ',', -1)
+	for i := range items {
+		items[i] = unescape(items[i])
+	}
+	return items
+}
+
+func ParseOptionalFieldMapVal(sliceVal string) map[string]string {
+	mapVal := make(map[string]string)
+	for _, kvPair := range splitEscaped(sliceVal, ',', -1) {
+		kvSlice := splitEscaped(kvPair, '=', 2)
+		if len(kvSlice) == 1 {
+			mapVal[unescape(kvSlice[0])] = ""
+		} else {
+			mapVal[unescape(kvSlice[0])] = unescape(kvSlice[1])
+		}
+	}
+	return mapVal
+}
+
+func ParseOptionalFieldBoolVal(val string) (bool, error) {
+	return strconv.ParseBool(val)
+}
+
+func ParseOptionalFieldIntVal(val string) (int, error) {
+	return strconv.Atoi(val)
+}
+
+// ParseOptionalFieldGroupKindSliceVal parses a list of GroupKind strings, as
+// in "Deployment.apps,Service".
+func ParseOptionalFieldGroupKindSliceVal(sliceVal string) ([]schema.GroupKind, error) {
+	gks := []schema.GroupKind{}
+	for _, item := range ParseOptionalFieldSliceVal(sliceVal) {
+		gk := schema.ParseGroupKind(item)
+		if gk.Kind == "" {
+			return nil, fmt.Errorf("invalid GroupKind %q", item)
+		}
+		gks = append(gks, gk)
+	}
+	return gks, nil
+}
+
+// isEscapable returns true for the characters a backslash escapes.
+func isEscapable(c byte) bool {
+	return c == ',' || c == '=' || c == '\\'
+}
+
+// splitEscaped splits s around the unescaped occurrences of sep, into at
+// most n parts when n is positive. Escapes are kept in the parts.
+func splitEscaped(s string, sep byte, n int) []string {
+	parts := []string{}
+	start := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && isEscapable(s[i+1]) {
+			i++
+			continue
+		}
+		if s[i] == sep && (n <= 0 || len(parts) < n-1) {
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	b := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && isEscapable(s[i+1]) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,86 @@
+package transform
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestParseOptionalFieldSliceVal(t *testing.T) {
+	tests := []struct {
+		val  string
+		want []string
+	}{
+		{val: "a,b", want: []string{"a", "b"}},
+		{val: `a\,b,c`, want: []string{"a,b", "c"}},
+		{val: `a\\,b`, want: []string{`a\`, "b"}},
+		{val: `a\b`, want: []string{`a\b`}},
+		{val: "", want: []string{""}},
+	}
+	for _, tt := range tests {
+		if got := ParseOptionalFieldSliceVal(tt.val); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseOptionalFieldSliceVal(%q) = %q, want %q", tt.val, got, tt.want)
+		}
+	}
+}
+
+func TestParseOptionalFieldMapVal(t *testing.T) {
+	tests := []struct {
+		val  string
+		want map[string]string
+	}{
+		{val: "a=1,b=2", want: map[string]string{"a": "1", "b": "2"}},
+		{val: "a", want: map[string]string{"a": ""}},
+		{val: "a=b=c", want: map[string]string{"a": "b=c"}},
+		{val: `a\=b=c\,d,e=f`, want: map[string]string{"a=b": "c,d", "e": "f"}},
+	}
+	for _, tt := range tests {
+		if got := ParseOptionalFieldMapVal(tt.val); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseOptionalFieldMapVal(%q) = %v, want %v", tt.val, got, tt.want)
+		}
+	}
+}
+
+func TestParseOptionalFieldGroupKindSliceVal(t *testing.T) {
+	got, err := ParseOptionalFieldGroupKindSliceVal("Deployment.apps,Service")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []schema.GroupKind{{Group: "apps", Kind: "Deployment"}, {Kind: "Service"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if _, err := ParseOptionalFieldGroupKindSliceVal("Service,,Route"); err == nil {
+		t.Errorf("expected an error for an empty GroupKind")
+	}
+}
+
+func TestOptionalFieldsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		field   OptionalFields
+		value   string
+		wantErr bool
+	}{
+		{name: "String", field: OptionalFields{}, value: "anything"},
+		{name: "Bool", field: OptionalFields{Type: OptionalFieldBool}, value: "true"},
+		{name: "InvalidBool", field: OptionalFields{Type: OptionalFieldBool}, value: "yes please", wantErr: true},
+		{name: "Int", field: OptionalFields{Type: OptionalFieldInt}, value: "42"},
+		{name: "InvalidInt", field: OptionalFields{Type: OptionalFieldInt}, value: "4.2", wantErr: true},
+		{name: "Map", field: OptionalFields{Type: OptionalFieldMap}, value: "a=1"},
+		{name: "InvalidMap", field: OptionalFields{Type: OptionalFieldMap}, value: "a=1,=2", wantErr: true},
+		{name: "GroupKindList", field: OptionalFields{Type: OptionalFieldGroupKindList}, value: "Route.route.openshift.io"},
+		{name: "InvalidGroupKindList", field: OptionalFields{Type: OptionalFieldGroupKindList}, value: ".apps", wantErr: true},
+		{name: "Enum", field: OptionalFields{Type: OptionalFieldEnum, Enum: []string{"a", "b"}}, value: "b"},
+		{name: "InvalidEnum", field: OptionalFields{Type: OptionalFieldEnum, Enum: []string{"a", "b"}}, value: "c", wantErr: true},
+		{name: "UnknownType", field: OptionalFields{Type: "float"}, value: "1.0", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.field.Validate(tt.value); (err != nil) != tt.wantErr {
+				t.Errorf("Validate(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+		})
+	}
+}
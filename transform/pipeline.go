@@ -0,0 +1,251 @@
+package transform
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/konveyor/crane-lib/apply"
+	transformerrors "github.com/konveyor/crane-lib/transform/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Stage is a step of a Pipeline. Its plugins run on the objects output by the
+// previous stage.
+type Stage struct {
+	// Name identifies the stage, to resume the pipeline from it. It must be
+	// unique in the pipeline and may not contain path separators.
+	Name    string
+	Plugins []Plugin
+	// Runner runs the plugins of the stage. Nil uses the Runner of the
+	// Pipeline.
+	Runner *Runner
+}
+
+// Pipeline runs ordered stages of plugins. The patches of every stage are
+// applied before the next stage runs, and the objects whited out are dropped.
+type Pipeline struct {
+	Stages []Stage
+	// Runner runs the stages that do not have their own. Nil uses a default
+	// Runner.
+	Runner *Runner
+	// Dir, when set, is where the input, artifacts and output of every stage
+	// are written, in one directory per stage, so the pipeline can be resumed.
+	Dir string
+}
+
+// StageResult is what a stage of a Pipeline did.
+type StageResult struct {
+	Name string
+	// Artifacts has one artifact per input object of the stage, in the same
+	// order, followed by one per new resource, see ObjectArtifacts.
+	// PluginName is set to the name of the stage.
+	Artifacts []TransformArtifact
+	// Output are the objects passed to the next stage: the input objects
+	// that were not whited out, patched, followed by the new resources.
+	Output []unstructured.Unstructured
+	// Errors are the plugin failures the Runner continued after, with
+	// ErrorPolicyContinue. The objects they happened on are still output,
+	// with the patches of the other plugins. They are not written to Dir.
+	Errors []*transformerrors.ObjectError `json:"-"`
+}
+
+const (
+	stageInputFile     = "input.json"
+	stageArtifactsFile = "artifacts.json"
+	stageOutputFile    = "output.json"
+)
+
+// Run runs every stage on objects and returns the result of every stage. On
+// error, the results of the stages that completed are returned. The failures
+// continued after, see StageResult.Errors, do not stop the pipeline; they are
+// returned at the end in one *errors.MultiError.
+func (p *Pipeline) Run(ctx context.Context, objects []unstructured.Unstructured) ([]StageResult, error) {
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	return p.run(ctx, 0, objects)
+}
+
+// Resume runs the pipeline from the named stage, with the input of the stage
+// as written to Dir by an earlier run. The results of the stages that ran
+// are returned.
+func (p *Pipeline) Resume(ctx context.Context, stage string) ([]StageResult, error) {
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	if p.Dir == "" {
+		return nil, fmt.Errorf("unable to resume stage %q: the pipeline has no directory", stage)
+	}
+	for i, s := range p.Stages {
+		if s.Name != stage {
+			continue
+		}
+		objects := []unstructured.Unstructured{}
+		if err := readStageFile(filepath.Join(p.stageDir(i), stageInputFile), &objects); err != nil {
+			return nil, fmt.Errorf("unable to resume stage %q: %w", stage, err)
+		}
+		return p.run(ctx, i, objects)
+	}
+	return nil, fmt.Errorf("unknown stage %q", stage)
+}
+
+// LoadStageResult reads the result of the named stage from Dir.
+func (p *Pipeline) LoadStageResult(stage string) (StageResult, error) {
+	for i, s := range p.Stages {
+		if s.Name != stage {
+			continue
+		}
+		result := StageResult{Name: stage}
+		if err := readStageFile(filepath.Join(p.stageDir(i), stageArtifactsFile), &result.Artifacts); err != nil {
+			return result, err
+		}
+		if err := readStageFile(filepath.Join(p.stageDir(i), stageOutputFile), &result.Output); err != nil {
+			return result, err
+		}
+		return result, nil
+	}
+	return StageResult{}, fmt.Errorf("unknown stage %q", stage)
+}
+
+func (p *Pipeline) validate() error {
+	names := map[string]bool{}
+	for _, s := range p.Stages {
+		if s.Name == "" || strings.ContainsAny(s.Name, `/\`) || s.Name == "." || s.Name == ".." {
+			return fmt.Errorf("invalid stage name %q", s.Name)
+		}
+		if names[s.Name] {
+			return fmt.Errorf("duplicate stage name %q", s.Name)
+		}
+		names[s.Name] = true
+	}
+	return nil
+}
+
+func (p *Pipeline) run(ctx context.Context, first int, objects []unstructured.Unstructured) ([]StageResult, error) {
+	results := []StageResult{}
+	objErrs := []*transformerrors.ObjectError{}
+	for i := first; i < len(p.Stages); i++ {
+		stage := p.Stages[i]
+		if p.Dir != "" {
+			if err := writeStageFile(p.stageDir(i), stageInputFile, objects); err != nil {
+				return results, err
+			}
+		}
+		result, err := p.runStage(ctx, stage, objects)
+		if err != nil {
+			return results, fmt.Errorf("stage %q: %w", stage.Name, err)
+		}
+		if p.Dir != "" {
+			if err := writeStageFile(p.stageDir(i), stageArtifactsFile, result.Artifacts); err != nil {
+				return results, err
+			}
+			if err := writeStageFile(p.stageDir(i), stageOutputFile, result.Output); err != nil {
+				return results, err
+			}
+		}
+		results = append(results, result)
+		objErrs = append(objErrs, result.Errors...)
+		objects = result.Output
+	}
+	if len(objErrs) > 0 {
+		return results, &transformerrors.MultiError{Errors: objErrs}
+	}
+	return results, nil
+}
+
+func (p *Pipeline) runStage(ctx context.Context, stage Stage, objects []unstructured.Unstructured) (StageResult, error) {
+	runner := stage.Runner
+	if runner == nil {
+		runner = p.Runner
+	}
+	if runner == nil {
+		runner = NewRunner(nil, nil, nil)
+	}
+	artifacts, err := runner.RunArtifacts(ctx, objects, stage.Plugins)
+	// Only the failures the Runner continued after leave the artifacts
+	// complete.
+	multi := &transformerrors.MultiError{}
+	if err != nil && !errors.As(err, &multi) {
+		return StageResult{}, err
+	}
+
+	result := StageResult{Name: stage.Name, Output: []unstructured.Unstructured{}, Errors: multi.Errors}
+	newArtifacts := []TransformArtifact{}
+	newResources := []unstructured.Unstructured{}
+	for _, a := range artifacts {
+		artifact := a.Artifact
+		artifact.PluginName = stage.Name
+		result.Artifacts = append(result.Artifacts, artifact)
+		for _, n := range a.NewResources {
+			resource, err := applyPatches(n.Resource, n.Patches)
+			if err != nil {
+				return result, fmt.Errorf("unable to build new resource %s from plugin %s: %w", n.Resource.GetName(), n.PluginName, err)
+			}
+			n.PluginName = stage.Name
+			newArtifacts = append(newArtifacts, n)
+			newResources = append(newResources, resource)
+		}
+		if artifact.HaveWhiteOut {
+			continue
+		}
+		output, err := applyPatches(artifact.Resource, artifact.Patches)
+		if err != nil {
+			return result, fmt.Errorf("unable to patch %s: %w", artifact.Resource.GetName(), err)
+		}
+		result.Output = append(result.Output, output)
+	}
+	result.Artifacts = append(result.Artifacts, newArtifacts...)
+	result.Output = append(result.Output, newResources...)
+	return result, nil
+}
+
+// applyPatches returns a patched copy of object.
+func applyPatches(object unstructured.Unstructured, patches jsonpatch.Patch) (unstructured.Unstructured, error) {
+	if len(patches) == 0 {
+		return *object.DeepCopy(), nil
+	}
+	patchData, err := json.Marshal(patches)
+	if err != nil {
+		return unstructured.Unstructured{}, err
+	}
+	doc, err := apply.Applier{}.Apply(*object.DeepCopy(), patchData)
+	if err != nil {
+		return unstructured.Unstructured{}, err
+	}
+	patched := unstructured.Unstructured{}
+	if err := patched.UnmarshalJSON(doc); err != nil {
+		return unstructured.Unstructured{}, err
+	}
+	return patched, nil
+}
+
+// stageDir is the directory of the stage at index i, numbered so the
+// directories sort in stage order.
+func (p *Pipeline) stageDir(i int) string {
+	return filepath.Join(p.Dir, fmt.Sprintf("%02d-%s", i, p.Stages[i].Name))
+}
+
+func writeStageFile(dir, name string, v interface{}) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, name), b, 0644)
+}
+
+func readStageFile(path string, v interface{}) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,184 @@
+package transform
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	transformerrors "github.com/konveyor/crane-lib/transform/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestPipeline(t *testing.T) {
+	deployment := decodeObject(t, `{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {"name": "app", "namespace": "ns"}}`)
+	configMap := decodeObject(t, `{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "config", "namespace": "ns"}}`)
+	service := decodeObject(t, `{"apiVersion": "v1", "kind": "Service", "metadata": {"name": "app", "namespace": "ns"}}`)
+
+	label := fakePlugin{
+		name: "label",
+		Func: func(request PluginRequest) (PluginResponse, error) {
+			if request.GetKind() == "ConfigMap" {
+				return PluginResponse{IsWhiteOut: true}, nil
+			}
+			p, err := jsonpatch.DecodePatch([]byte(`[{"op": "add", "path": "/metadata/labels", "value": {"stage": "first"}}]`))
+			resp := PluginResponse{Patches: p}
+			if request.GetKind() == "Deployment" {
+				resp.NewResources = []unstructured.Unstructured{service}
+			}
+			return resp, err
+		},
+	}
+	seen := map[string]map[string]string{}
+	relabel := fakePlugin{
+		name: "relabel",
+		Func: func(request PluginRequest) (PluginResponse, error) {
+			seen[request.GetKind()] = request.GetLabels()
+			p, err := jsonpatch.DecodePatch([]byte(`[{"op": "replace", "path": "/metadata/labels/stage", "value": "second"}]`))
+			if request.GetKind() == "Service" {
+				p = nil
+			}
+			return PluginResponse{Patches: p}, err
+		},
+	}
+	dir := t.TempDir()
+	pipeline := &Pipeline{
+		Stages: []Stage{
+			{Name: "first", Plugins: []Plugin{label}},
+			{Name: "second", Plugins: []Plugin{relabel}},
+		},
+		Dir: dir,
+	}
+
+	results, err := pipeline.Run(context.Background(), []unstructured.Unstructured{deployment, configMap})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 stage results, got %d", len(results))
+	}
+	first := results[0]
+	if len(first.Artifacts) != 3 || first.Artifacts[0].PluginName != "first" || first.Artifacts[0].Target.Kind != "Deployment" ||
+		!first.Artifacts[1].HaveWhiteOut || len(first.Artifacts[0].Patches) != 1 ||
+		first.Artifacts[2].PluginName != "first" || first.Artifacts[2].Target.Kind != "Service" {
+		t.Errorf("unexpected first stage artifacts: %+v", first.Artifacts)
+	}
+	wantSeen := map[string]map[string]string{"Deployment": {"stage": "first"}, "Service": nil}
+	if !reflect.DeepEqual(seen, wantSeen) {
+		t.Errorf("second stage did not run on the first stage output, saw labels %v", seen)
+	}
+	output := results[1].Output
+	if len(output) != 2 || output[0].GetLabels()["stage"] != "second" || output[1].GetKind() != "Service" {
+		t.Errorf("unexpected pipeline output: %v", output)
+	}
+
+	for _, stage := range []string{"00-first", "01-second"} {
+		for _, file := range []string{stageInputFile, stageArtifactsFile, stageOutputFile} {
+			if _, err := os.Stat(filepath.Join(dir, stage, file)); err != nil {
+				t.Errorf("stage state not written: %v", err)
+			}
+		}
+	}
+	loaded, err := pipeline.LoadStageResult("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, first) {
+		t.Errorf("loaded stage result %+v, want %+v", loaded, first)
+	}
+
+	seen = map[string]map[string]string{}
+	resumed, err := pipeline.Resume(context.Background(), "second")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resumed) != 1 || !reflect.DeepEqual(resumed[0].Output, output) || !reflect.DeepEqual(seen, wantSeen) {
+		t.Errorf("resumed pipeline result %+v, want output %v", resumed, output)
+	}
+}
+
+func TestPipelineContinue(t *testing.T) {
+	objects := namedObjects(3)
+	// The plugin fails on the second object and patches the others.
+	patchOrFail := fakePlugin{
+		name: "patch-or-fail",
+		Func: func(request PluginRequest) (PluginResponse, error) {
+			if request.GetName() == objects[1].GetName() {
+				return PluginResponse{}, fmt.Errorf("failing plugin")
+			}
+			p, err := jsonpatch.DecodePatch([]byte(`[{"op": "add", "path": "/metadata/labels", "value": {"patched": "true"}}]`))
+			return PluginResponse{Patches: p}, err
+		},
+	}
+	noop := fakePlugin{Func: func(PluginRequest) (PluginResponse, error) { return PluginResponse{}, nil }}
+	runner := NewRunner(nil, nil, nil)
+	runner.ErrorPolicy = ErrorPolicyContinue
+	pipeline := &Pipeline{
+		Stages: []Stage{
+			{Name: "first", Plugins: []Plugin{patchOrFail}},
+			{Name: "second", Plugins: []Plugin{noop}},
+		},
+		Runner: runner,
+	}
+
+	results, err := pipeline.Run(context.Background(), objects)
+	objErrs := transformerrors.ObjectErrors(err)
+	if len(objErrs) != 1 || objErrs[0].Name != objects[1].GetName() {
+		t.Fatalf("expected the error of %s, got %v", objects[1].GetName(), err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 stage results, got %d", len(results))
+	}
+	first := results[0]
+	if len(first.Errors) != 1 || first.Errors[0] != objErrs[0] || len(results[1].Errors) != 0 {
+		t.Errorf("unexpected stage errors: %v, %v", first.Errors, results[1].Errors)
+	}
+	if len(first.Artifacts) != 3 || len(first.Artifacts[0].Patches) != 1 || len(first.Artifacts[1].Patches) != 0 || len(first.Artifacts[2].Patches) != 1 {
+		t.Errorf("unexpected first stage artifacts: %+v", first.Artifacts)
+	}
+	output := results[1].Output
+	wantLabels := []map[string]string{{"patched": "true"}, nil, {"patched": "true"}}
+	if len(output) != len(objects) {
+		t.Fatalf("expected every object in the output, got %v", output)
+	}
+	for i, o := range output {
+		if o.GetName() != objects[i].GetName() || !reflect.DeepEqual(o.GetLabels(), wantLabels[i]) {
+			t.Errorf("output %d: got %s with labels %v, want %s with labels %v", i, o.GetName(), o.GetLabels(), objects[i].GetName(), wantLabels[i])
+		}
+	}
+
+	// Without ErrorPolicyContinue the first stage fails.
+	runner.ErrorPolicy = ErrorPolicyFailFast
+	results, err = pipeline.Run(context.Background(), objects)
+	if err == nil || len(results) != 0 {
+		t.Errorf("expected the first stage to fail, got %v, %+v", err, results)
+	}
+}
+
+func TestPipelineErrors(t *testing.T) {
+	object := decodeObject(t, `{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "config"}}`)
+	noop := fakePlugin{Func: func(PluginRequest) (PluginResponse, error) { return PluginResponse{}, nil }}
+	for _, stages := range [][]Stage{
+		{{Name: ""}},
+		{{Name: "a/b"}},
+		{{Name: "a"}, {Name: "a"}},
+	} {
+		if _, err := (&Pipeline{Stages: stages}).Run(context.Background(), []unstructured.Unstructured{object}); err == nil {
+			t.Errorf("expected an error for stages %+v", stages)
+		}
+	}
+	pipeline := &Pipeline{Stages: []Stage{{Name: "only", Plugins: []Plugin{noop}}}}
+	if _, err := pipeline.Resume(context.Background(), "only"); err == nil {
+		t.Errorf("expected an error resuming without a directory")
+	}
+	pipeline.Dir = t.TempDir()
+	if _, err := pipeline.Resume(context.Background(), "only"); err == nil {
+		t.Errorf("expected an error resuming a stage that never ran")
+	}
+	if _, err := pipeline.Resume(context.Background(), "unknown"); err == nil {
+		t.Errorf("expected an error resuming an unknown stage")
+	}
+}
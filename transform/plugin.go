@@ -1,7 +1,9 @@
 package transform
 
 import (
-	"strings"
+	"context"
+	"encoding/json"
+	"fmt"
 
 	jsonpatch "github.com/evanphx/json-patch"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -12,25 +14,214 @@ type PluginRun interface {
 	Run(PluginRequest) (PluginResponse, error)
 }
 
+// PluginRunWithContext is implemented by plugins that can stop their work when
+// the caller's context is done. The Runner prefers it over PluginRun.
+type PluginRunWithContext interface {
+	RunWithContext(context.Context, PluginRequest) (PluginResponse, error)
+}
+
 type Metadata interface {
 	Metadata() PluginMetadata
 }
 
+// Plugin is run by the Runner. Plugins must be safe for concurrent use:
+// RunBatch runs the same plugin on several objects at once, so Run must not
+// keep the state of a request, such as its Extras, in the plugin.
 type Plugin interface {
 	PluginRun
 	Metadata
 }
 
+// PluginRequest is sent to a plugin for every object. On the wire the object
+// is sent as is, with the other fields added at its top level.
 type PluginRequest struct {
 	unstructured.Unstructured `json:",inline"`
-	Extras map[string]string  `json:"extras,omitempty"`
+	Extras                    map[string]string `json:"extras,omitempty"`
+	// Version is the request version negotiated with the plugin. It is empty
+	// for V1, which keeps the V1 wire format unchanged.
+	Version Version `json:"requestVersion,omitempty"`
+	// Context is only sent to plugins speaking V2 or later.
+	Context *RequestContext `json:"requestContext,omitempty"`
+}
+
+// ForVersion returns the request as sent to a plugin speaking version v,
+// without the fields that version does not know about.
+func (p PluginRequest) ForVersion(v Version) PluginRequest {
+	if v == "" || v == V1 {
+		p.Version = ""
+		p.Context = nil
+		return p
+	}
+	p.Version = v
+	return p
+}
+
+// ForPlugin is like ForVersion, for a plugin running in its own process. The
+// objects of the export indexed by the Runner are added to the context when
+// the plugin advertises CapabilityResourceIndex, and left out otherwise.
+func (p PluginRequest) ForPlugin(v Version, metadata PluginMetadata) PluginRequest {
+	p = p.ForVersion(v).forCapabilities(metadata)
+	if p.Context == nil {
+		return p
+	}
+	if metadata.HasCapability(CapabilityResourceIndex) && p.Context.Objects == nil && p.Context.index.Len() > 0 {
+		c := *p.Context
+		c.Objects = c.index.objects
+		p.Context = &c
+	}
+	return p
+}
+
+// forCapabilities returns the request without the parts of its context the
+// plugin did not ask for: the Resources, Objects and index of the export are
+// left out unless it advertises CapabilityResourceIndex.
+func (p PluginRequest) forCapabilities(metadata PluginMetadata) PluginRequest {
+	if p.Context == nil || metadata.HasCapability(CapabilityResourceIndex) {
+		return p
+	}
+	if p.Context.Resources == nil && p.Context.Objects == nil && p.Context.index == nil {
+		return p
+	}
+	c := *p.Context
+	c.Resources = nil
+	c.Objects = nil
+	c.index = nil
+	p.Context = &c
+	return p
+}
+
+// RequestContext describes the export the object is part of.
+type RequestContext struct {
+	SourceClusterVersion string `json:"sourceClusterVersion,omitempty"`
+	TargetClusterVersion string `json:"targetClusterVersion,omitempty"`
+	// Resources references every object in the export. It is only sent to
+	// plugins advertising CapabilityResourceIndex.
+	Resources []ResourceReference `json:"resources,omitempty"`
+	// Objects are the objects of the export. They are only sent to plugins
+	// running in their own process and advertising CapabilityResourceIndex,
+	// see ForPlugin. Plugins running in the same process as the Runner only
+	// get the read-only Index. They must not be modified.
+	Objects []unstructured.Unstructured `json:"objects,omitempty"`
+	// Phase is only sent to plugins advertising CapabilityRenames.
+	Phase Phase `json:"phase,omitempty"`
+
+	// index is built by the Runner and shared with the plugins running in
+	// the same process and advertising CapabilityResourceIndex.
+	index *ResourceIndex
+}
+
+// Index returns the index of the objects of the export. It is empty when the
+// export is unknown, or when the plugin does not advertise
+// CapabilityResourceIndex. Plugins running in their own process should call
+// it once per request, since it indexes the Objects on every call, except in
+// streaming mode, see StreamObjects.
+func (c *RequestContext) Index() *ResourceIndex {
+	if c == nil {
+		return nil
+	}
+	if c.index != nil {
+		return c.index
+	}
+	return NewResourceIndex(c.Objects)
+}
+
+// ResourceReference identifies an object without carrying its content.
+type ResourceReference struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+}
+
+// NewResourceReference returns the reference to the given object.
+func NewResourceReference(u unstructured.Unstructured) ResourceReference {
+	return ResourceReference{
+		APIVersion: u.GetAPIVersion(),
+		Kind:       u.GetKind(),
+		Namespace:  u.GetNamespace(),
+		Name:       u.GetName(),
+	}
+}
+
+const (
+	requestExtrasKey  = "extras"
+	requestVersionKey = "requestVersion"
+	requestContextKey = "requestContext"
+)
+
+// MarshalJSON encodes the request in the wire format used by binary plugins.
+func (p PluginRequest) MarshalJSON() ([]byte, error) {
+	objJson, err := p.Unstructured.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	objMap := map[string]interface{}{}
+	if err := json.Unmarshal(objJson, &objMap); err != nil {
+		return nil, err
+	}
+	if p.Extras != nil {
+		objMap[requestExtrasKey] = p.Extras
+	}
+	if p.Version != "" {
+		objMap[requestVersionKey] = p.Version
+	}
+	if p.Context != nil {
+		objMap[requestContextKey] = p.Context
+	}
+	return json.Marshal(objMap)
+}
+
+// UnmarshalJSON decodes the wire format written by MarshalJSON. The request
+// fields are removed from the object.
+func (p *PluginRequest) UnmarshalJSON(b []byte) error {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+	req := PluginRequest{}
+	if raw, ok := fields[requestExtrasKey]; ok {
+		if err := json.Unmarshal(raw, &req.Extras); err != nil {
+			return fmt.Errorf("extras must be a map of strings: %v", err)
+		}
+		delete(fields, requestExtrasKey)
+	}
+	if raw, ok := fields[requestVersionKey]; ok {
+		if err := json.Unmarshal(raw, &req.Version); err != nil {
+			return fmt.Errorf("invalid %s: %v", requestVersionKey, err)
+		}
+		delete(fields, requestVersionKey)
+	}
+	if raw, ok := fields[requestContextKey]; ok {
+		req.Context = &RequestContext{}
+		if err := json.Unmarshal(raw, req.Context); err != nil {
+			return fmt.Errorf("invalid %s: %v", requestContextKey, err)
+		}
+		delete(fields, requestContextKey)
+	}
+	objJson, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	if err := req.Unstructured.UnmarshalJSON(objJson); err != nil {
+		return err
+	}
+	*p = req
+	return nil
 }
 
 type PluginResponse struct {
-	Version      string                        `json:"version,omitempty"`
-	IsWhiteOut   bool                          `json:"isWhiteOut,omitempty"`
-	Patches      jsonpatch.Patch               `json:"patches,omitempty"`
-	NewResources []unstructured.Unstructured   `json:"newResources,omitempty"`
+	Version      string                      `json:"version,omitempty"`
+	IsWhiteOut   bool                        `json:"isWhiteOut,omitempty"`
+	Patches      jsonpatch.Patch             `json:"patches,omitempty"`
+	NewResources []unstructured.Unstructured `json:"newResources,omitempty"`
+	// Warnings are reported to the user. V2 or later.
+	Warnings []string `json:"warnings,omitempty"`
+	// Annotations are notes for whoever reviews the transform output. They
+	// are not applied to the object. V2 or later.
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Renames are declared in PhaseAnalyze by plugins advertising
+	// CapabilityRenames. V2 or later.
+	Renames []Rename `json:"renames,omitempty"`
 }
 
 type PluginMetadata struct {
@@ -39,18 +230,56 @@ type PluginMetadata struct {
 	RequestVersion  []Version        `json:"requestVersion"`
 	ResponseVersion []Version        `json:"responseVersion"`
 	OptionalFields  []OptionalFields `json:"optionalFields,omitempty"`
+	Capabilities    []Capability     `json:"capabilities,omitempty"`
+}
+
+// Capability is an optional feature a plugin supports.
+type Capability string
+
+const (
+	// CapabilityStreaming means the plugin can run as a long-running process
+	// speaking the streaming protocol, see StreamFrame.
+	CapabilityStreaming Capability = "streaming"
+	// CapabilityResourceIndex means the plugin needs the objects of the
+	// export in its RequestContext, see RequestContext.Index. V2 or later.
+	CapabilityResourceIndex Capability = "resourceIndex"
+	// CapabilityRenames means the plugin renames or moves objects, see
+	// Rename. V2 or later.
+	CapabilityRenames Capability = "renames"
+)
+
+// HasCapability returns true if the plugin advertises capability.
+func (m PluginMetadata) HasCapability(capability Capability) bool {
+	for _, c := range m.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
 }
 
 type Version string
 
+// OptionalFields declares a flag a plugin accepts. The value reaches the
+// plugin in PluginRequest.Extras, as a string. The Runner checks the value
+// against the declaration before running any object.
 type OptionalFields struct {
 	FlagName string `json:"flagName"`
 	Help     string `json:"help"`
 	Example  string `json:"example"`
+	// Type is how the value is parsed. Empty means OptionalFieldString.
+	Type OptionalFieldType `json:"type,omitempty"`
+	// Required fields must be set, unless they have a Default.
+	Required bool `json:"required,omitempty"`
+	// Default is sent to the plugin when the field is not set.
+	Default string `json:"default,omitempty"`
+	// Enum lists the values an OptionalFieldEnum field accepts.
+	Enum []string `json:"enum,omitempty"`
 }
 
 const (
 	V1 Version = "v1"
+	V2 Version = "v2"
 )
 
 const (
@@ -58,26 +287,36 @@ const (
 	ResponseVersion = V1
 )
 
+// Plugins log to stderr, one JSON object per line. Every record has a level,
+// one of the logrus levels, and a message; the other keys are log fields.
 const (
-	// Metadata string is the constant string that will be used by the binary-pluigin helper and the cli helpers
-	// To notice that
-	MetadataString string = "METADATA"
+	LogLevelKey   = "level"
+	LogMessageKey = "message"
+	LogTimeKey    = "time"
+	// LogStreamFrameKey holds the ID of the stream frame a record was logged
+	// for, by a plugin running in streaming mode.
+	LogStreamFrameKey = "streamFrame"
 )
 
-func ParseOptionalFieldSliceVal(sliceVal string) []string {
-	return strings.Split(sliceVal,",")
-}
+// SupportedVersions lists the request and response versions this library
+// speaks, oldest first.
+var SupportedVersions = []Version{V1, V2}
 
-func ParseOptionalFieldMapVal(sliceVal string) map[string]string {
-	mapVal := make(map[string]string)
-	kvPairs := strings.Split(sliceVal,",")
-	for _, kvPair := range kvPairs {
-		kvSlice := strings.Split(kvPair,"=")
-		if len(kvSlice) == 1 {
-			mapVal[kvSlice[0]] = ""
-		} else {
-			mapVal[kvSlice[0]] = kvSlice[1]
+// NegotiateVersion returns the highest of the SupportedVersions that the
+// plugin also supports.
+func NegotiateVersion(pluginVersions []Version) (Version, bool) {
+	for i := len(SupportedVersions) - 1; i >= 0; i-- {
+		for _, v := range pluginVersions {
+			if v == SupportedVersions[i] {
+				return v, true
+			}
 		}
 	}
-	return mapVal
+	return "", false
 }
+
+const (
+	// Metadata string is the constant string that will be used by the binary-pluigin helper and the cli helpers
+	// To notice that
+	MetadataString string = "METADATA"
+)
@@ -0,0 +1,141 @@
+package transform
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestNegotiateVersion(t *testing.T) {
+	cases := []struct {
+		Name           string
+		PluginVersions []Version
+		Version        Version
+		Ok             bool
+	}{
+		{Name: "V1Only", PluginVersions: []Version{V1}, Version: V1, Ok: true},
+		{Name: "HighestCommon", PluginVersions: []Version{V1, V2}, Version: V2, Ok: true},
+		{Name: "UnknownVersionsIgnored", PluginVersions: []Version{"v3", V1}, Version: V1, Ok: true},
+		{Name: "NoCommonVersion", PluginVersions: []Version{"v3"}},
+		{Name: "NoVersions"},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			version, ok := NegotiateVersion(c.PluginVersions)
+			if version != c.Version || ok != c.Ok {
+				t.Errorf("NegotiateVersion() = %v, %v, expected %v, %v", version, ok, c.Version, c.Ok)
+			}
+		})
+	}
+}
+
+func TestPluginRequestJSON(t *testing.T) {
+	object := unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Pod",
+			"metadata": map[string]interface{}{
+				"name":      "pod",
+				"namespace": "test",
+			},
+		},
+	}
+	cases := []struct {
+		Name    string
+		Request PluginRequest
+		JSON    string
+	}{
+		{
+			Name:    "V1WithoutExtras",
+			Request: PluginRequest{Unstructured: object},
+			JSON:    `{"apiVersion":"v1","kind":"Pod","metadata":{"name":"pod","namespace":"test"}}`,
+		},
+		{
+			Name:    "V1WithExtras",
+			Request: PluginRequest{Unstructured: object, Extras: map[string]string{"flag": "value"}},
+			JSON:    `{"apiVersion":"v1","extras":{"flag":"value"},"kind":"Pod","metadata":{"name":"pod","namespace":"test"}}`,
+		},
+		{
+			Name: "V2",
+			Request: PluginRequest{
+				Unstructured: object,
+				Version:      V2,
+				Context: &RequestContext{
+					SourceClusterVersion: "v1.21.0",
+					Resources:            []ResourceReference{NewResourceReference(object)},
+				},
+			},
+			JSON: `{"apiVersion":"v1","kind":"Pod","metadata":{"name":"pod","namespace":"test"},` +
+				`"requestContext":{"sourceClusterVersion":"v1.21.0","resources":[{"apiVersion":"v1","kind":"Pod","namespace":"test","name":"pod"}]},` +
+				`"requestVersion":"v2"}`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			b, err := json.Marshal(c.Request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != c.JSON {
+				t.Errorf("incorrect json, actual: %s expected: %s", string(b), c.JSON)
+			}
+			decoded := PluginRequest{}
+			if err := json.Unmarshal(b, &decoded); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(decoded, c.Request) {
+				t.Errorf("incorrect round trip, actual: %+v expected: %+v", decoded, c.Request)
+			}
+		})
+	}
+
+	t.Run("ExtrasMustBeStrings", func(t *testing.T) {
+		err := json.Unmarshal([]byte(`{"apiVersion":"v1","kind":"Pod","extras":{"flag":true}}`), &PluginRequest{})
+		if err == nil {
+			t.Error("expected an error for a non string extra")
+		}
+	})
+}
+
+func TestPluginRequestForPlugin(t *testing.T) {
+	object := unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata":   map[string]interface{}{"name": "pod"},
+	}}
+	requestContext := &RequestContext{
+		Resources: []ResourceReference{NewResourceReference(object)},
+		Objects:   []unstructured.Unstructured{object},
+	}
+	request := PluginRequest{Unstructured: object, Context: requestContext}
+
+	got := request.ForPlugin(V2, PluginMetadata{})
+	if got.Context.Objects != nil || got.Context.Resources != nil {
+		t.Errorf("expected the objects and resources to be left out, got %+v", got.Context)
+	}
+	if requestContext.Objects == nil || requestContext.Resources == nil {
+		t.Errorf("ForPlugin modified the original request context")
+	}
+
+	got = request.ForPlugin(V2, PluginMetadata{Capabilities: []Capability{CapabilityResourceIndex}})
+	b, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := PluginRequest{}
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := decoded.Context.Index().Get(object.GroupVersionKind(), "", "pod"); !ok {
+		t.Errorf("expected the decoded request to index the objects, got %s", string(b))
+	}
+	if !reflect.DeepEqual(decoded.Context.Resources, requestContext.Resources) {
+		t.Errorf("expected the resources to be sent, got %s", string(b))
+	}
+
+	if got := request.ForPlugin(V1, PluginMetadata{Capabilities: []Capability{CapabilityResourceIndex}}); got.Context != nil {
+		t.Errorf("expected no context for V1, got %+v", got.Context)
+	}
+}
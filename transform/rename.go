@@ -0,0 +1,299 @@
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/konveyor/crane-lib/transform/internal/fieldpath"
+	"github.com/konveyor/crane-lib/transform/types"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Rename changes the name or the namespace of an object. Plugins advertising
+// CapabilityRenames declare renames when they are called with PhaseAnalyze,
+// and the Runner then renames the objects and rewrites the references to
+// them. Renaming a Namespace moves every object it contains.
+type Rename struct {
+	From ResourceReference `json:"from"`
+	// Namespace and Name are the new namespace and name of the object. Empty
+	// values are left unchanged.
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name,omitempty"`
+}
+
+// Phase tells a plugin advertising CapabilityRenames what the Runner expects
+// from a request.
+type Phase string
+
+const (
+	// PhaseAnalyze requests the renames of the object, in
+	// PluginResponse.Renames. Anything else in the response is ignored.
+	PhaseAnalyze Phase = "analyze"
+	// PhaseApply requests the patches of the object, as for plugins without
+	// CapabilityRenames.
+	PhaseApply Phase = "apply"
+)
+
+// ReferenceRewriterName is the plugin name of the operations the Runner adds
+// to rename objects and rewrite references. It can be given a priority in
+// PluginPriorities; otherwise the plugins win conflicts with these
+// operations.
+const ReferenceRewriterName = "ReferenceRewriter"
+
+type renameKey struct {
+	gk        schema.GroupKind
+	namespace string
+	name      string
+}
+
+// renameSet resolves the new namespace and name of objects.
+type renameSet struct {
+	objects    map[renameKey]Rename
+	namespaces map[string]string
+}
+
+var namespaceGK = schema.GroupKind{Kind: "Namespace"}
+
+func newRenameSet(renames []Rename) *renameSet {
+	s := &renameSet{objects: map[renameKey]Rename{}, namespaces: map[string]string{}}
+	for _, r := range renames {
+		key := referenceKey(r.From)
+		s.objects[key] = r
+		if key.gk == namespaceGK && r.Name != "" {
+			s.namespaces[key.name] = r.Name
+		}
+	}
+	return s
+}
+
+func referenceKey(ref ResourceReference) renameKey {
+	gv, _ := schema.ParseGroupVersion(ref.APIVersion)
+	return renameKey{gk: gv.WithKind(ref.Kind).GroupKind(), namespace: ref.Namespace, name: ref.Name}
+}
+
+func (s *renameSet) empty() bool {
+	return s == nil || len(s.objects) == 0
+}
+
+// resolve returns the new namespace and name of an object.
+func (s *renameSet) resolve(gk schema.GroupKind, namespace, name string) (string, string) {
+	newNamespace, newName := namespace, name
+	if namespace != "" {
+		if ns, ok := s.namespaces[namespace]; ok {
+			newNamespace = ns
+		}
+	}
+	if r, ok := s.objects[renameKey{gk: gk, namespace: namespace, name: name}]; ok {
+		if r.Namespace != "" {
+			newNamespace = r.Namespace
+		}
+		if r.Name != "" {
+			newName = r.Name
+		}
+	}
+	return newNamespace, newName
+}
+
+var (
+	configMapGK      = schema.GroupKind{Kind: "ConfigMap"}
+	secretGK         = schema.GroupKind{Kind: "Secret"}
+	serviceGK        = schema.GroupKind{Kind: "Service"}
+	serviceAccountGK = schema.GroupKind{Kind: "ServiceAccount"}
+	pvcGK            = schema.GroupKind{Kind: "PersistentVolumeClaim"}
+	roleGK           = schema.GroupKind{Group: "rbac.authorization.k8s.io", Kind: "Role"}
+	clusterRoleGK    = schema.GroupKind{Group: "rbac.authorization.k8s.io", Kind: "ClusterRole"}
+)
+
+// referenceRewriter collects the operations renaming an object and the
+// references it holds.
+type referenceRewriter struct {
+	renames   *renameSet
+	object    unstructured.Unstructured
+	namespace string
+	// newNamespace is the namespace of the object once renamed.
+	newNamespace string
+	patch        jsonpatch.Patch
+	warnings     []string
+}
+
+// referencePatches returns the operations renaming object and rewriting the
+// references it holds to renamed objects, along with warnings about
+// references that can not follow their target.
+func referencePatches(object unstructured.Unstructured, renames *renameSet) (jsonpatch.Patch, []string) {
+	if renames.empty() {
+		return nil, nil
+	}
+	gk := object.GroupVersionKind().GroupKind()
+	newNamespace, newName := renames.resolve(gk, object.GetNamespace(), object.GetName())
+	w := &referenceRewriter{
+		renames:      renames,
+		object:       object,
+		namespace:    object.GetNamespace(),
+		newNamespace: newNamespace,
+	}
+	if newName != object.GetName() {
+		w.replace([]string{"metadata", "name"}, newName)
+	}
+	if newNamespace != object.GetNamespace() {
+		w.replace([]string{"metadata", "namespace"}, newNamespace)
+	}
+
+	for i, owner := range object.GetOwnerReferences() {
+		gv, err := schema.ParseGroupVersion(owner.APIVersion)
+		if err != nil {
+			continue
+		}
+		w.localReference([]string{"metadata", "ownerReferences", strconv.Itoa(i), "name"}, gv.WithKind(owner.Kind).GroupKind(), owner.Name)
+	}
+	if podSpec, ok := types.PodSpecPath(object); ok {
+		w.podSpec(podSpec)
+	}
+	switch gk {
+	case schema.GroupKind{Group: "apps", Kind: "StatefulSet"}:
+		w.localField([]string{"spec", "serviceName"}, serviceGK)
+	case schema.GroupKind{Group: "rbac.authorization.k8s.io", Kind: "RoleBinding"},
+		schema.GroupKind{Group: "rbac.authorization.k8s.io", Kind: "ClusterRoleBinding"}:
+		w.roleBinding()
+	case schema.GroupKind{Group: "route.openshift.io", Kind: "Route"}:
+		w.route()
+	case schema.GroupKind{Group: "networking.k8s.io", Kind: "Ingress"}:
+		w.ingress()
+	}
+	return w.patch, w.warnings
+}
+
+func (w *referenceRewriter) podSpec(spec []string) {
+	at := func(fields ...string) []string {
+		return fieldpath.Sub(spec, fields...)
+	}
+	w.localField(at("serviceAccountName"), serviceAccountGK)
+	w.localField(at("serviceAccount"), serviceAccountGK)
+	w.each(at("imagePullSecrets"), func(item []string) {
+		w.localField(fieldpath.Sub(item, "name"), secretGK)
+	})
+	w.each(at("volumes"), func(item []string) {
+		w.localField(fieldpath.Sub(item, "persistentVolumeClaim", "claimName"), pvcGK)
+		w.localField(fieldpath.Sub(item, "configMap", "name"), configMapGK)
+		w.localField(fieldpath.Sub(item, "secret", "secretName"), secretGK)
+		w.each(fieldpath.Sub(item, "projected", "sources"), func(source []string) {
+			w.localField(fieldpath.Sub(source, "configMap", "name"), configMapGK)
+			w.localField(fieldpath.Sub(source, "secret", "name"), secretGK)
+		})
+	})
+	for _, containers := range []string{"containers", "initContainers", "ephemeralContainers"} {
+		w.each(at(containers), func(container []string) {
+			w.each(fieldpath.Sub(container, "envFrom"), func(envFrom []string) {
+				w.localField(fieldpath.Sub(envFrom, "configMapRef", "name"), configMapGK)
+				w.localField(fieldpath.Sub(envFrom, "secretRef", "name"), secretGK)
+			})
+			w.each(fieldpath.Sub(container, "env"), func(env []string) {
+				w.localField(fieldpath.Sub(env, "valueFrom", "configMapKeyRef", "name"), configMapGK)
+				w.localField(fieldpath.Sub(env, "valueFrom", "secretKeyRef", "name"), secretGK)
+			})
+		})
+	}
+}
+
+func (w *referenceRewriter) roleBinding() {
+	roleRef, _, _ := unstructured.NestedMap(w.object.Object, "roleRef")
+	if name, ok := roleRef["name"].(string); ok {
+		kind, _ := roleRef["kind"].(string)
+		switch kind {
+		case roleGK.Kind:
+			w.localReference([]string{"roleRef", "name"}, roleGK, name)
+		case clusterRoleGK.Kind:
+			w.clusterReference([]string{"roleRef", "name"}, clusterRoleGK, name)
+		}
+	}
+	w.each([]string{"subjects"}, func(subject []string) {
+		fields, _ := fieldpath.Value(w.object.Object, subject).(map[string]interface{})
+		kind, _ := fields["kind"].(string)
+		name, _ := fields["name"].(string)
+		namespace, _ := fields["namespace"].(string)
+		if kind != serviceAccountGK.Kind || name == "" || namespace == "" {
+			return
+		}
+		newNamespace, newName := w.renames.resolve(serviceAccountGK, namespace, name)
+		if newName != name {
+			w.replace(fieldpath.Sub(subject, "name"), newName)
+		}
+		if newNamespace != namespace {
+			w.replace(fieldpath.Sub(subject, "namespace"), newNamespace)
+		}
+	})
+}
+
+func (w *referenceRewriter) route() {
+	w.routeBackend([]string{"spec", "to"})
+	w.each([]string{"spec", "alternateBackends"}, w.routeBackend)
+}
+
+func (w *referenceRewriter) routeBackend(backend []string) {
+	kind, _ := fieldpath.Value(w.object.Object, fieldpath.Sub(backend, "kind")).(string)
+	if kind == "" || kind == serviceGK.Kind {
+		w.localField(fieldpath.Sub(backend, "name"), serviceGK)
+	}
+}
+
+func (w *referenceRewriter) ingress() {
+	w.localField([]string{"spec", "defaultBackend", "service", "name"}, serviceGK)
+	w.each([]string{"spec", "rules"}, func(rule []string) {
+		w.each(fieldpath.Sub(rule, "http", "paths"), func(path []string) {
+			w.localField(fieldpath.Sub(path, "backend", "service", "name"), serviceGK)
+		})
+	})
+	w.each([]string{"spec", "tls"}, func(tls []string) {
+		w.localField(fieldpath.Sub(tls, "secretName"), secretGK)
+	})
+}
+
+// each calls f with the path of every item of the list at path.
+func (w *referenceRewriter) each(path []string, f func(item []string)) {
+	items, ok := fieldpath.Value(w.object.Object, path).([]interface{})
+	if !ok {
+		return
+	}
+	for i := range items {
+		f(fieldpath.Sub(path, strconv.Itoa(i)))
+	}
+}
+
+// localField rewrites the name at path, a reference to an object of kind gk
+// in the namespace of the object.
+func (w *referenceRewriter) localField(path []string, gk schema.GroupKind) {
+	name, ok := fieldpath.Value(w.object.Object, path).(string)
+	if !ok || name == "" {
+		return
+	}
+	w.localReference(path, gk, name)
+}
+
+func (w *referenceRewriter) localReference(path []string, gk schema.GroupKind, name string) {
+	newNamespace, newName := w.renames.resolve(gk, w.namespace, name)
+	if newNamespace != w.newNamespace {
+		w.warnings = append(w.warnings, fmt.Sprintf("%s %q referenced at %s is moved to namespace %q, away from %s %q",
+			gk, name, fieldpath.Pointer(path), newNamespace, w.object.GroupVersionKind().GroupKind(), w.object.GetName()))
+	}
+	if newName != name {
+		w.replace(path, newName)
+	}
+}
+
+func (w *referenceRewriter) clusterReference(path []string, gk schema.GroupKind, name string) {
+	if _, newName := w.renames.resolve(gk, "", name); newName != name {
+		w.replace(path, newName)
+	}
+}
+
+func (w *referenceRewriter) replace(path []string, value string) {
+	op := jsonpatch.Operation{}
+	for k, v := range map[string]string{"op": "replace", "path": fieldpath.Pointer(path), "value": value} {
+		b, _ := json.Marshal(v)
+		raw := json.RawMessage(b)
+		op[k] = &raw
+	}
+	w.patch = append(w.patch, op)
+}
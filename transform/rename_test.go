@@ -0,0 +1,232 @@
+package transform
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	internaljsonpatch "github.com/konveyor/crane-lib/transform/internal/jsonpatch"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func decodeObject(t *testing.T, s string) unstructured.Unstructured {
+	u := unstructured.Unstructured{}
+	if err := json.Unmarshal([]byte(s), &u.Object); err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestReferencePatches(t *testing.T) {
+	renames := newRenameSet([]Rename{
+		{From: ResourceReference{APIVersion: "v1", Kind: "PersistentVolumeClaim", Namespace: "ns", Name: "data"}, Name: "data-new"},
+		{From: ResourceReference{APIVersion: "v1", Kind: "ConfigMap", Namespace: "ns", Name: "config"}, Name: "config-new"},
+		{From: ResourceReference{APIVersion: "v1", Kind: "Secret", Namespace: "ns", Name: "creds"}, Name: "creds-new"},
+		{From: ResourceReference{APIVersion: "v1", Kind: "ServiceAccount", Namespace: "ns", Name: "runner"}, Name: "runner-new"},
+		{From: ResourceReference{APIVersion: "v1", Kind: "Service", Namespace: "ns", Name: "web"}, Name: "web-new"},
+		{From: ResourceReference{APIVersion: "apps/v1", Kind: "Deployment", Namespace: "ns", Name: "app"}, Name: "app-new"},
+		{From: ResourceReference{APIVersion: "v1", Kind: "Secret", Namespace: "ns", Name: "moved"}, Namespace: "elsewhere"},
+		{From: ResourceReference{APIVersion: "v1", Kind: "Namespace", Name: "old"}, Name: "new"},
+	})
+	tests := []struct {
+		name         string
+		object       string
+		wantPatch    map[string]string
+		wantWarnings int
+	}{
+		{
+			name: "Deployment",
+			object: `{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {"name": "app", "namespace": "ns"},
+				"spec": {"template": {"spec": {
+					"serviceAccountName": "runner",
+					"imagePullSecrets": [{"name": "other"}, {"name": "creds"}],
+					"volumes": [
+						{"name": "a", "persistentVolumeClaim": {"claimName": "data"}},
+						{"name": "b", "configMap": {"name": "config"}},
+						{"name": "c", "projected": {"sources": [{"secret": {"name": "creds"}}]}}
+					],
+					"containers": [{"name": "c", "envFrom": [{"configMapRef": {"name": "config"}}],
+						"env": [{"name": "E", "valueFrom": {"secretKeyRef": {"name": "creds", "key": "k"}}}]}]
+				}}}}`,
+			wantPatch: map[string]string{
+				"/metadata/name":                                                     "app-new",
+				"/spec/template/spec/serviceAccountName":                             "runner-new",
+				"/spec/template/spec/imagePullSecrets/1/name":                        "creds-new",
+				"/spec/template/spec/volumes/0/persistentVolumeClaim/claimName":      "data-new",
+				"/spec/template/spec/volumes/1/configMap/name":                       "config-new",
+				"/spec/template/spec/volumes/2/projected/sources/0/secret/name":      "creds-new",
+				"/spec/template/spec/containers/0/envFrom/0/configMapRef/name":       "config-new",
+				"/spec/template/spec/containers/0/env/0/valueFrom/secretKeyRef/name": "creds-new",
+			},
+		},
+		{
+			name: "CronJob",
+			object: `{"apiVersion": "batch/v1", "kind": "CronJob", "metadata": {"name": "job", "namespace": "ns"},
+				"spec": {"jobTemplate": {"spec": {"template": {"spec": {"volumes": [{"name": "a", "persistentVolumeClaim": {"claimName": "data"}}]}}}}}}`,
+			wantPatch: map[string]string{
+				"/spec/jobTemplate/spec/template/spec/volumes/0/persistentVolumeClaim/claimName": "data-new",
+			},
+		},
+		{
+			name: "OwnedReplicaSet",
+			object: `{"apiVersion": "apps/v1", "kind": "ReplicaSet", "metadata": {"name": "app-1", "namespace": "ns",
+				"ownerReferences": [{"apiVersion": "apps/v1", "kind": "Deployment", "name": "app", "uid": "1"}]}}`,
+			wantPatch: map[string]string{
+				"/metadata/ownerReferences/0/name": "app-new",
+			},
+		},
+		{
+			name: "RoleBinding",
+			object: `{"apiVersion": "rbac.authorization.k8s.io/v1", "kind": "RoleBinding", "metadata": {"name": "rb", "namespace": "old"},
+				"roleRef": {"apiGroup": "rbac.authorization.k8s.io", "kind": "ClusterRole", "name": "view"},
+				"subjects": [
+					{"kind": "ServiceAccount", "name": "runner", "namespace": "ns"},
+					{"kind": "ServiceAccount", "name": "default", "namespace": "old"},
+					{"kind": "User", "name": "runner", "namespace": "ns"}
+				]}`,
+			wantPatch: map[string]string{
+				"/metadata/namespace":   "new",
+				"/subjects/0/name":      "runner-new",
+				"/subjects/1/namespace": "new",
+			},
+		},
+		{
+			name: "Route",
+			object: `{"apiVersion": "route.openshift.io/v1", "kind": "Route", "metadata": {"name": "r", "namespace": "ns"},
+				"spec": {"to": {"kind": "Service", "name": "web"}, "alternateBackends": [{"kind": "Service", "name": "other"}, {"kind": "Service", "name": "web"}]}}`,
+			wantPatch: map[string]string{
+				"/spec/to/name":                  "web-new",
+				"/spec/alternateBackends/1/name": "web-new",
+			},
+		},
+		{
+			name: "Ingress",
+			object: `{"apiVersion": "networking.k8s.io/v1", "kind": "Ingress", "metadata": {"name": "i", "namespace": "ns"},
+				"spec": {"defaultBackend": {"service": {"name": "web"}},
+					"rules": [{"http": {"paths": [{"path": "/", "backend": {"service": {"name": "web"}}}]}}],
+					"tls": [{"secretName": "creds"}]}}`,
+			wantPatch: map[string]string{
+				"/spec/defaultBackend/service/name":               "web-new",
+				"/spec/rules/0/http/paths/0/backend/service/name": "web-new",
+				"/spec/tls/0/secretName":                          "creds-new",
+			},
+		},
+		{
+			name: "ReferenceMovedAway",
+			object: `{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "p", "namespace": "ns"},
+				"spec": {"volumes": [{"name": "a", "secret": {"secretName": "moved"}}]}}`,
+			wantPatch:    map[string]string{},
+			wantWarnings: 1,
+		},
+		{
+			name:      "Unrelated",
+			object:    `{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "other", "namespace": "ns"}}`,
+			wantPatch: map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patch, warnings := referencePatches(decodeObject(t, tt.object), renames)
+			got := map[string]string{}
+			for _, op := range patch {
+				if op.Kind() != "replace" {
+					t.Errorf("unexpected operation %v", op)
+				}
+				path, _ := op.Path()
+				value, _ := op.ValueInterface()
+				got[path] = value.(string)
+			}
+			if !reflect.DeepEqual(got, tt.wantPatch) {
+				t.Errorf("referencePatches() = %v, want %v", got, tt.wantPatch)
+			}
+			if len(warnings) != tt.wantWarnings {
+				t.Errorf("referencePatches() warnings = %v, want %d", warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestRunnerAnalyze(t *testing.T) {
+	pvc := decodeObject(t, `{"apiVersion": "v1", "kind": "PersistentVolumeClaim", "metadata": {"name": "data", "namespace": "ns"}}`)
+	pod := decodeObject(t, `{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "p", "namespace": "ns"},
+		"spec": {"volumes": [{"name": "a", "persistentVolumeClaim": {"claimName": "data"}}]}}`)
+	renamer := func(name, newName string) fakePlugin {
+		return fakePlugin{
+			name:         name,
+			capabilities: []Capability{CapabilityRenames},
+			Func: func(request PluginRequest) (PluginResponse, error) {
+				switch request.Context.Phase {
+				case PhaseAnalyze:
+					if request.GetKind() == "PersistentVolumeClaim" {
+						return PluginResponse{Renames: []Rename{{From: NewResourceReference(request.Unstructured), Name: newName}}}, nil
+					}
+				case PhaseApply:
+				default:
+					t.Errorf("unexpected phase %q", request.Context.Phase)
+				}
+				return PluginResponse{}, nil
+			},
+		}
+	}
+	// This plugin already rewrites the claim name itself.
+	patcher := fakePlugin{
+		name: "patcher",
+		Func: func(request PluginRequest) (PluginResponse, error) {
+			if request.Context.Phase != "" {
+				t.Errorf("unexpected phase %q for a plugin without renames", request.Context.Phase)
+			}
+			if request.GetKind() != "Pod" {
+				return PluginResponse{}, nil
+			}
+			p, err := jsonpatch.DecodePatch([]byte(`[{"op": "replace", "path": "/spec/volumes/0/persistentVolumeClaim/claimName", "value": "data-new"}]`))
+			return PluginResponse{Patches: p}, err
+		},
+	}
+	plugins := []Plugin{renamer("low", "data-low"), renamer("high", "data-new"), patcher}
+	runner := NewRunner(logrus.New(), map[string]int{"high": 0}, nil)
+
+	renames, err := runner.Analyze(context.Background(), []unstructured.Unstructured{pvc, pod}, plugins)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Rename{{From: NewResourceReference(pvc), Name: "data-new"}}
+	if !reflect.DeepEqual(renames, want) {
+		t.Errorf("Analyze() = %v, want %v", renames, want)
+	}
+
+	responses, err := runner.RunBatch(context.Background(), []unstructured.Unstructured{pvc, pod}, plugins)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantPatches := []string{
+		`[{"op":"replace","path":"/metadata/name","value":"data-new"}]`,
+		`[{"op":"replace","path":"/spec/volumes/0/persistentVolumeClaim/claimName","value":"data-new"}]`,
+	}
+	for i, response := range responses {
+		ok, err := internaljsonpatch.Equal(mustDecodePatch(t, wantPatches[i]), mustDecodePatch(t, string(response.TransformFile)))
+		if err != nil || !ok {
+			t.Errorf("object %d: incorrect patch, actual: %s expected: %s", i, response.TransformFile, wantPatches[i])
+		}
+	}
+
+	// Run has no export to analyze and only applies the given renames.
+	runner.Renames = want
+	response, err := runner.Run(pvc, []Plugin{patcher})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(response.TransformFile) != wantPatches[0] {
+		t.Errorf("incorrect patch, actual: %s expected: %s", response.TransformFile, wantPatches[0])
+	}
+}
+
+func mustDecodePatch(t *testing.T, s string) jsonpatch.Patch {
+	p, err := jsonpatch.DecodePatch([]byte(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
@@ -0,0 +1,388 @@
+package route
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/konveyor/crane-lib/transform"
+	routev1 "github.com/openshift/api/route/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	ingressAPIVersion  = "networking.k8s.io/v1"
+	gatewayAPIVersion  = "gateway.networking.k8s.io/v1"
+	tlsRouteAPIVersion = "gateway.networking.k8s.io/v1alpha2"
+
+	// routerAnnotationPrefix starts the annotations configuring the
+	// OpenShift router, such as haproxy.router.openshift.io/timeout.
+	routerAnnotationPrefix = "haproxy.router.openshift.io/"
+	// defaultWeight is the weight of the backends of a Route without one.
+	defaultWeight = 100
+)
+
+var serviceGVK = corev1.SchemeGroupVersion.WithKind("Service")
+
+// backend is a Service a Route sends traffic to.
+type backend struct {
+	name   string
+	weight int32
+	// port is the number of the Service port, or 0 if it is only known by
+	// portName.
+	port     int32
+	portName string
+}
+
+// converter converts one Route, collecting warnings about what the new
+// resources can not express.
+type converter struct {
+	route       routev1.Route
+	index       *transform.ResourceIndex
+	annotations map[string]string
+	warnings    []string
+}
+
+func newConverter(obj unstructured.Unstructured, index *transform.ResourceIndex) (*converter, error) {
+	c := &converter{index: index}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &c.route); err != nil {
+		return nil, fmt.Errorf("unable to decode the route: %w", err)
+	}
+	c.filterAnnotations()
+	return c, nil
+}
+
+func (c *converter) warnf(format string, args ...interface{}) {
+	c.warnings = append(c.warnings, fmt.Sprintf(format, args...))
+}
+
+// termination returns the TLS termination of the Route, empty for plain HTTP.
+func (c *converter) termination() routev1.TLSTerminationType {
+	if c.route.Spec.TLS == nil {
+		return ""
+	}
+	return c.route.Spec.TLS.Termination
+}
+
+// host returns the host the Route is exposed on, as a wildcard when the
+// Route admits all the subdomains of its domain. Routes without a host get
+// one from the router, which is read from their status.
+func (c *converter) host() string {
+	host := c.route.Spec.Host
+	if host == "" {
+		for _, ingress := range c.route.Status.Ingress {
+			if ingress.Host != "" {
+				host = ingress.Host
+				break
+			}
+		}
+		if host == "" {
+			c.warnf("route has no host, the new resources match every host")
+			return ""
+		}
+		c.warnf("host %s was generated by the router of the source cluster, it may not resolve to the target cluster", host)
+	}
+	if c.route.Spec.WildcardPolicy == routev1.WildcardPolicySubdomain {
+		if _, domain, ok := strings.Cut(host, "."); ok {
+			return "*." + domain
+		}
+	}
+	return host
+}
+
+// path returns the path prefix of the Route.
+func (c *converter) path() string {
+	if c.route.Spec.Path == "" {
+		return "/"
+	}
+	return c.route.Spec.Path
+}
+
+// prefixPath returns the path of the prefix match named match replacing the
+// path of the Route. A Route matches the paths starting with its path, when
+// Ingress and Gateway API prefix matches go by whole path segments: /cart
+// matches /cart/items but not /cartoon. Paths ending with / match the same
+// paths either way.
+func (c *converter) prefixPath(match string) string {
+	path := c.path()
+	if !strings.HasSuffix(path, "/") {
+		c.warnf("%s path %s matches whole path segments, requests to paths such as %sx that the Route matched are not routed", match, path, path)
+	}
+	return path
+}
+
+// backends returns the Services of the Route, spec.to first.
+func (c *converter) backends() []backend {
+	backends := []backend{}
+	for _, target := range append([]routev1.RouteTargetReference{c.route.Spec.To}, c.route.Spec.AlternateBackends...) {
+		if target.Kind != "" && target.Kind != "Service" {
+			c.warnf("backend %s %s is not a Service and is dropped", target.Kind, target.Name)
+			continue
+		}
+		b := backend{name: target.Name, weight: defaultWeight}
+		if target.Weight != nil {
+			b.weight = *target.Weight
+		}
+		b.port, b.portName = c.servicePort(target.Name)
+		backends = append(backends, b)
+	}
+	return backends
+}
+
+// servicePort returns the port of the Service name matching the target port
+// of the Route, which is a port of the pods. The Service comes from the
+// index of the export; without it, a numbered target port is assumed to be
+// the Service port, and a named one the name of the Service port.
+func (c *converter) servicePort(name string) (int32, string) {
+	var ports []corev1.ServicePort
+	if obj, ok := c.index.Get(serviceGVK, c.route.Namespace, name); ok {
+		service := corev1.Service{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &service); err == nil {
+			ports = service.Spec.Ports
+		}
+	}
+	if c.route.Spec.Port == nil {
+		if len(ports) == 1 {
+			return ports[0].Port, ""
+		}
+		c.warnf("route has no port and Service %s does not have exactly one port, set the port of its backend", name)
+		return 0, ""
+	}
+	targetPort := c.route.Spec.Port.TargetPort
+	for _, port := range ports {
+		if targetPort.Type == intstr.String && (port.Name == targetPort.StrVal || port.TargetPort.StrVal == targetPort.StrVal) {
+			return port.Port, ""
+		}
+		if targetPort.Type == intstr.Int && (port.TargetPort.IntVal == targetPort.IntVal || port.TargetPort.IntValue() == 0 && port.Port == targetPort.IntVal) {
+			return port.Port, ""
+		}
+	}
+	if ports != nil {
+		c.warnf("Service %s has no port for target port %s", name, targetPort.String())
+	}
+	if targetPort.Type == intstr.String {
+		return 0, targetPort.StrVal
+	}
+	return targetPort.IntVal, ""
+}
+
+// objectMeta returns the metadata of a resource replacing the Route.
+func (c *converter) objectMeta(name string) map[string]interface{} {
+	meta := map[string]interface{}{"name": name}
+	if c.route.Namespace != "" {
+		meta["namespace"] = c.route.Namespace
+	}
+	if len(c.route.Labels) > 0 {
+		labels := map[string]interface{}{}
+		for k, v := range c.route.Labels {
+			labels[k] = v
+		}
+		meta["labels"] = labels
+	}
+	if len(c.annotations) > 0 {
+		annotations := map[string]interface{}{}
+		for k, v := range c.annotations {
+			annotations[k] = v
+		}
+		meta["annotations"] = annotations
+	}
+	return meta
+}
+
+// filterAnnotations keeps the annotations of the Route that are not about
+// OpenShift, and warns about those of the OpenShift router.
+func (c *converter) filterAnnotations() {
+	keys := make([]string, 0, len(c.route.Annotations))
+	for k := range c.route.Annotations {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	c.annotations = map[string]string{}
+	for _, k := range keys {
+		switch {
+		case strings.HasPrefix(k, routerAnnotationPrefix):
+			c.warnf("annotation %s of the OpenShift router is not converted", k)
+		case strings.Contains(k, "openshift.io/"):
+		default:
+			c.annotations[k] = c.route.Annotations[k]
+		}
+	}
+}
+
+// tlsSecret returns the kubernetes.io/tls Secret holding the certificate of
+// the Route, or nil if the Route uses the default certificate of the router.
+func (c *converter) tlsSecret() map[string]interface{} {
+	tls := c.route.Spec.TLS
+	if tls.Certificate == "" && tls.Key == "" {
+		return nil
+	}
+	if tls.Certificate == "" || tls.Key == "" {
+		c.warnf("route has a certificate or a key but not both, they are dropped")
+		return nil
+	}
+	certificate := tls.Certificate
+	if tls.CACertificate != "" {
+		certificate = strings.TrimRight(certificate, "\n") + "\n" + tls.CACertificate
+	}
+	return map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   c.objectMeta(c.route.Name + "-tls"),
+		"type":       string(corev1.SecretTypeTLS),
+		"data": map[string]interface{}{
+			corev1.TLSCertKey:       base64.StdEncoding.EncodeToString([]byte(certificate)),
+			corev1.TLSPrivateKeyKey: base64.StdEncoding.EncodeToString([]byte(tls.Key)),
+		},
+	}
+}
+
+// tlsWarnings warns about the TLS settings the new resources can not carry.
+func (c *converter) tlsWarnings() {
+	tls := c.route.Spec.TLS
+	if tls == nil {
+		return
+	}
+	if tls.Termination == routev1.TLSTerminationReencrypt {
+		c.warnf("reencrypt termination is converted to edge termination, configure TLS to the backends on the target cluster")
+	}
+	if tls.DestinationCACertificate != "" {
+		c.warnf("destinationCACertificate is not converted")
+	}
+	if tls.InsecureEdgeTerminationPolicy != "" && tls.InsecureEdgeTerminationPolicy != routev1.InsecureEdgeTerminationPolicyNone {
+		c.warnf("insecureEdgeTerminationPolicy %s is not converted, whether HTTP is served depends on the target cluster", tls.InsecureEdgeTerminationPolicy)
+	}
+}
+
+// ingress returns the Ingress replacing the Route, with the Secret of its
+// certificate.
+func (c *converter) ingress(ingressClassName string) ([]unstructured.Unstructured, error) {
+	if c.termination() == routev1.TLSTerminationPassthrough {
+		return nil, fmt.Errorf("an Ingress can not pass TLS through to the backends")
+	}
+	host := c.host()
+	backends := c.backends()
+	if len(backends) == 0 {
+		return nil, fmt.Errorf("route has no Service backend")
+	}
+	if len(backends) > 1 {
+		c.warnf("an Ingress has no backend weights, only Service %s is kept", backends[0].name)
+	}
+	port := map[string]interface{}{}
+	switch {
+	case backends[0].port != 0:
+		port["number"] = int64(backends[0].port)
+	case backends[0].portName != "":
+		port["name"] = backends[0].portName
+	}
+	rule := map[string]interface{}{
+		"http": map[string]interface{}{
+			"paths": []interface{}{
+				map[string]interface{}{
+					"path":     c.prefixPath("Prefix"),
+					"pathType": "Prefix",
+					"backend": map[string]interface{}{
+						"service": map[string]interface{}{"name": backends[0].name, "port": port},
+					},
+				},
+			},
+		},
+	}
+	if host != "" {
+		rule["host"] = host
+	}
+	spec := map[string]interface{}{"rules": []interface{}{rule}}
+	if ingressClassName != "" {
+		spec["ingressClassName"] = ingressClassName
+	}
+
+	resources := []unstructured.Unstructured{}
+	if c.route.Spec.TLS != nil {
+		tls := map[string]interface{}{}
+		if host != "" {
+			tls["hosts"] = []interface{}{host}
+		}
+		if secret := c.tlsSecret(); secret != nil {
+			tls["secretName"] = c.route.Name + "-tls"
+			resources = append(resources, unstructured.Unstructured{Object: secret})
+		} else {
+			c.warnf("route uses the default certificate of the router, the Ingress uses that of the ingress controller")
+		}
+		spec["tls"] = []interface{}{tls}
+		c.tlsWarnings()
+	}
+	ingress := map[string]interface{}{
+		"apiVersion": ingressAPIVersion,
+		"kind":       "Ingress",
+		"metadata":   c.objectMeta(c.route.Name),
+		"spec":       spec,
+	}
+	return append([]unstructured.Unstructured{{Object: ingress}}, resources...), nil
+}
+
+// gatewayRoute returns the HTTPRoute, or the TLSRoute for passthrough
+// termination, replacing the Route, with the Secret of its certificate.
+// parentRef is the Gateway the route attaches to.
+func (c *converter) gatewayRoute(parentRef map[string]interface{}) ([]unstructured.Unstructured, error) {
+	host := c.host()
+	backends := c.backends()
+	if len(backends) == 0 {
+		return nil, fmt.Errorf("route has no Service backend")
+	}
+	backendRefs := []interface{}{}
+	for _, b := range backends {
+		ref := map[string]interface{}{"name": b.name, "weight": int64(b.weight)}
+		if b.port != 0 {
+			ref["port"] = int64(b.port)
+		} else if b.portName != "" {
+			c.warnf("Gateway API backends need a port number, set the port of Service %s for port %s", b.name, b.portName)
+		}
+		backendRefs = append(backendRefs, ref)
+	}
+
+	spec := map[string]interface{}{}
+	if parentRef != nil {
+		spec["parentRefs"] = []interface{}{parentRef}
+	} else {
+		c.warnf("the new route is not attached to a Gateway, set its parentRefs")
+	}
+	if host != "" {
+		spec["hostnames"] = []interface{}{host}
+	}
+	apiVersion, kind := gatewayAPIVersion, "HTTPRoute"
+	rule := map[string]interface{}{"backendRefs": backendRefs}
+	resources := []unstructured.Unstructured{}
+	if c.termination() == routev1.TLSTerminationPassthrough {
+		apiVersion, kind = tlsRouteAPIVersion, "TLSRoute"
+		if c.route.Spec.Path != "" {
+			c.warnf("a TLSRoute does not match paths, path %s is dropped", c.route.Spec.Path)
+		}
+		if c.route.Spec.TLS.InsecureEdgeTerminationPolicy != "" && c.route.Spec.TLS.InsecureEdgeTerminationPolicy != routev1.InsecureEdgeTerminationPolicyNone {
+			c.warnf("insecureEdgeTerminationPolicy %s is not converted, whether HTTP is served depends on the target cluster", c.route.Spec.TLS.InsecureEdgeTerminationPolicy)
+		}
+	} else {
+		rule["matches"] = []interface{}{
+			map[string]interface{}{"path": map[string]interface{}{"type": "PathPrefix", "value": c.prefixPath("PathPrefix")}},
+		}
+		if c.route.Spec.TLS != nil {
+			if secret := c.tlsSecret(); secret != nil {
+				resources = append(resources, unstructured.Unstructured{Object: secret})
+				c.warnf("TLS is terminated by the Gateway, reference Secret %s-tls from the certificateRefs of its HTTPS listener", c.route.Name)
+			} else {
+				c.warnf("TLS is terminated by the Gateway, give its HTTPS listener a certificate for the host")
+			}
+			c.tlsWarnings()
+		}
+	}
+	spec["rules"] = []interface{}{rule}
+	route := map[string]interface{}{
+		"apiVersion": apiVersion,
+		"kind":       kind,
+		"metadata":   c.objectMeta(c.route.Name),
+		"spec":       spec,
+	}
+	return append([]unstructured.Unstructured{{Object: route}}, resources...), nil
+}
@@ -0,0 +1,122 @@
+package route
+
+import (
+	"testing"
+
+	"github.com/konveyor/crane-lib/transform"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestServicePort(t *testing.T) {
+	tests := []struct {
+		name         string
+		port         string
+		service      string
+		wantPort     int32
+		wantPortName string
+		wantWarning  bool
+	}{
+		{name: "TargetPortNumber", port: `{targetPort: 8080}`, service: "web", wantPort: 80},
+		{name: "TargetPortName", port: `{targetPort: metrics}`, service: "web", wantPort: 9090},
+		{name: "ServicePortName", port: `{targetPort: http}`, service: "web", wantPort: 80},
+		{name: "UnknownTargetPort", port: `{targetPort: 8443}`, service: "web", wantPort: 8443, wantWarning: true},
+		{name: "NoPort", port: `null`, service: "web", wantWarning: true},
+		{name: "NoPortSinglePort", port: `null`, service: "db", wantPort: 5432},
+		{name: "UnknownServiceNumber", port: `{targetPort: 8080}`, service: "cache", wantPort: 8080},
+		{name: "UnknownServiceName", port: `{targetPort: redis}`, service: "cache", wantPortName: "redis"},
+	}
+	index := transform.NewResourceIndex([]unstructured.Unstructured{
+		decode(t, testService),
+		decode(t, `
+apiVersion: v1
+kind: Service
+metadata: {name: db, namespace: shop}
+spec:
+  ports:
+  - {port: 5432}
+`),
+	})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := newConverter(decode(t, `
+apiVersion: route.openshift.io/v1
+kind: Route
+metadata: {name: web, namespace: shop}
+spec:
+  to: {kind: Service, name: `+tt.service+`}
+  port: `+tt.port+`
+`), index)
+			if err != nil {
+				t.Fatal(err)
+			}
+			port, portName := c.servicePort(tt.service)
+			if port != tt.wantPort || portName != tt.wantPortName {
+				t.Errorf("servicePort() = %d, %q, want %d, %q", port, portName, tt.wantPort, tt.wantPortName)
+			}
+			if (len(c.warnings) > 0) != tt.wantWarning {
+				t.Errorf("servicePort() warnings = %q", c.warnings)
+			}
+		})
+	}
+}
+
+func TestHost(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+		want string
+	}{
+		{name: "Host", spec: `{host: shop.apps.example.com}`, want: "shop.apps.example.com"},
+		{name: "Wildcard", spec: `{host: www.example.com, wildcardPolicy: Subdomain}`, want: "*.example.com"},
+		{name: "NoWildcard", spec: `{host: www.example.com, wildcardPolicy: None}`, want: "www.example.com"},
+		{name: "NoHost", spec: `{}`, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := newConverter(decode(t, `
+apiVersion: route.openshift.io/v1
+kind: Route
+metadata: {name: web, namespace: shop}
+spec: `+tt.spec+`
+`), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := c.host(); got != tt.want {
+				t.Errorf("host() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrefixPath(t *testing.T) {
+	tests := []struct {
+		name        string
+		spec        string
+		want        string
+		wantWarning bool
+	}{
+		{name: "NoPath", spec: `{}`, want: "/"},
+		{name: "Segment", spec: `{path: /cart}`, want: "/cart", wantWarning: true},
+		{name: "TrailingSlash", spec: `{path: /cart/}`, want: "/cart/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := newConverter(decode(t, `
+apiVersion: route.openshift.io/v1
+kind: Route
+metadata: {name: web, namespace: shop}
+spec: `+tt.spec+`
+`), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := c.prefixPath("Prefix"); got != tt.want {
+				t.Errorf("prefixPath() = %q, want %q", got, tt.want)
+			}
+			if (len(c.warnings) > 0) != tt.wantWarning {
+				t.Errorf("prefixPath() warnings = %q", c.warnings)
+			}
+		})
+	}
+}
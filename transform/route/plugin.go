@@ -0,0 +1,165 @@
+// Package route is a transform plugin replacing the OpenShift Routes of an
+// export with resources any Kubernetes cluster understands: a
+// networking.k8s.io Ingress, or a Gateway API HTTPRoute or TLSRoute.
+package route
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/konveyor/crane-lib/transform"
+	"github.com/konveyor/crane-lib/version"
+	routev1 "github.com/openshift/api/route/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	TargetFlag           = "route-target"
+	IngressClassNameFlag = "ingress-class-name"
+	GatewayFlag          = "gateway"
+)
+
+// The resources replacing Routes.
+const (
+	// TargetIngress replaces Routes with Ingresses. Passthrough Routes can
+	// not be replaced and are left as they are.
+	TargetIngress = "Ingress"
+	// TargetGateway replaces Routes with HTTPRoutes, and passthrough Routes
+	// with TLSRoutes.
+	TargetGateway = "Gateway"
+)
+
+var routeGK = schema.GroupKind{Group: routev1.GroupName, Kind: "Route"}
+
+// RoutePlugin whites out Routes and returns the resources replacing them as
+// new resources. What they can not express is reported as warnings.
+type RoutePlugin struct {
+	// Target is TargetIngress or TargetGateway. Empty means TargetIngress.
+	Target string
+	// IngressClassName is the class of the Ingresses.
+	IngressClassName string
+	// Gateway is the Gateway the Gateway API routes attach to, as
+	// [namespace/]name.
+	Gateway string
+}
+
+var _ transform.Plugin = &RoutePlugin{}
+
+func (p *RoutePlugin) Metadata() transform.PluginMetadata {
+	return transform.PluginMetadata{
+		Name:            "RoutePlugin",
+		Version:         version.Version,
+		RequestVersion:  transform.SupportedVersions,
+		ResponseVersion: transform.SupportedVersions,
+		Capabilities:    []transform.Capability{transform.CapabilityResourceIndex},
+		OptionalFields: []transform.OptionalFields{
+			{
+				FlagName: TargetFlag,
+				Help:     "Resources replacing Routes: Ingress, or Gateway for Gateway API HTTPRoutes and TLSRoutes (default: Ingress)",
+				Example:  TargetGateway,
+				Type:     transform.OptionalFieldEnum,
+				Enum:     []string{TargetIngress, TargetGateway},
+				Default:  TargetIngress,
+			},
+			{
+				FlagName: IngressClassNameFlag,
+				Help:     "IngressClass of the Ingresses replacing Routes",
+				Example:  "nginx",
+				Type:     transform.OptionalFieldString,
+			},
+			{
+				FlagName: GatewayFlag,
+				Help:     "Gateway the HTTPRoutes and TLSRoutes replacing Routes attach to, in the format namespace/name, or name for a Gateway in the namespace of the Route",
+				Example:  "gateway-system/public",
+				Type:     transform.OptionalFieldString,
+			},
+		},
+	}
+}
+
+// Run whites out Routes and returns the resources replacing them. Warnings
+// are only returned to V2 requests.
+func (p *RoutePlugin) Run(request transform.PluginRequest) (transform.PluginResponse, error) {
+	resp := transform.PluginResponse{Version: string(transform.V1)}
+	options := *p
+	if err := options.setOptionalFields(request.Extras); err != nil {
+		return resp, err
+	}
+	if request.GroupVersionKind().GroupKind() != routeGK {
+		return resp, nil
+	}
+	if request.Context != nil && request.Context.Phase == transform.PhaseAnalyze {
+		return resp, nil
+	}
+
+	c, err := newConverter(request.Unstructured, request.Context.Index())
+	if err != nil {
+		return resp, err
+	}
+	if options.Target == TargetGateway {
+		resp.NewResources, err = c.gatewayRoute(options.parentRef())
+	} else {
+		resp.NewResources, err = c.ingress(options.IngressClassName)
+	}
+	if err != nil {
+		// The Route is kept for the user to replace it.
+		c.warnf("route is not replaced: %v", err)
+		resp.NewResources = nil
+	} else {
+		resp.IsWhiteOut = true
+	}
+	if request.Version != "" && request.Version != transform.V1 {
+		resp.Version = string(request.Version)
+		resp.Warnings = c.warnings
+	}
+	return resp, nil
+}
+
+func (p *RoutePlugin) setOptionalFields(extras map[string]string) error {
+	if len(extras[TargetFlag]) > 0 {
+		p.Target = extras[TargetFlag]
+	}
+	switch p.Target {
+	case "", TargetIngress, TargetGateway:
+	default:
+		return fmt.Errorf("invalid %s: %q is neither %s nor %s", TargetFlag, p.Target, TargetIngress, TargetGateway)
+	}
+	if len(extras[IngressClassNameFlag]) > 0 {
+		p.IngressClassName = extras[IngressClassNameFlag]
+	}
+	if p.IngressClassName != "" {
+		if errs := validation.IsDNS1123Subdomain(p.IngressClassName); len(errs) != 0 {
+			return fmt.Errorf("invalid %s: %s", IngressClassNameFlag, strings.Join(errs, ","))
+		}
+	}
+	if len(extras[GatewayFlag]) > 0 {
+		p.Gateway = extras[GatewayFlag]
+	}
+	if p.Gateway != "" {
+		namespace, name, found := strings.Cut(p.Gateway, "/")
+		if !found {
+			namespace, name = "", p.Gateway
+		}
+		errs := validation.IsDNS1123Subdomain(name)
+		if found {
+			errs = append(errs, validation.IsDNS1123Label(namespace)...)
+		}
+		if len(errs) != 0 {
+			return fmt.Errorf("invalid %s: %s", GatewayFlag, strings.Join(errs, ","))
+		}
+	}
+	return nil
+}
+
+// parentRef returns the reference to Gateway, or nil if it is not set.
+func (p *RoutePlugin) parentRef() map[string]interface{} {
+	if p.Gateway == "" {
+		return nil
+	}
+	namespace, name, found := strings.Cut(p.Gateway, "/")
+	if !found {
+		return map[string]interface{}{"name": p.Gateway}
+	}
+	return map[string]interface{}{"namespace": namespace, "name": name}
+}
@@ -0,0 +1,307 @@
+package route
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/konveyor/crane-lib/transform"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+func decode(t *testing.T, y string) unstructured.Unstructured {
+	t.Helper()
+	obj := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(y), &obj); err != nil {
+		t.Fatal(err)
+	}
+	return unstructured.Unstructured{Object: obj}
+}
+
+const testService = `
+apiVersion: v1
+kind: Service
+metadata: {name: web, namespace: shop}
+spec:
+  ports:
+  - {name: http, port: 80, targetPort: 8080}
+  - {name: metrics, port: 9090, targetPort: metrics}
+`
+
+func TestRoutePluginRun(t *testing.T) {
+	tests := []struct {
+		name             string
+		extras           map[string]string
+		route            string
+		wantWhiteOut     bool
+		wantNewResources string
+		wantWarnings     []string
+	}{
+		{
+			name: "NotARoute",
+			route: `
+apiVersion: v1
+kind: Service
+metadata: {name: web, namespace: shop}
+`,
+			wantNewResources: `null`,
+		},
+		{
+			name: "IngressEdge",
+			extras: map[string]string{
+				IngressClassNameFlag: "nginx",
+			},
+			route: `
+apiVersion: route.openshift.io/v1
+kind: Route
+metadata:
+  name: web
+  namespace: shop
+  labels: {app: web}
+  annotations:
+    haproxy.router.openshift.io/timeout: 60s
+    openshift.io/host.generated: "false"
+    owner: team-shop
+spec:
+  host: shop.apps.example.com
+  path: /cart
+  to: {kind: Service, name: web, weight: 100}
+  port: {targetPort: 8080}
+  tls:
+    termination: edge
+    certificate: CERT
+    key: KEY
+    caCertificate: CA
+    insecureEdgeTerminationPolicy: Redirect
+`,
+			wantWhiteOut: true,
+			wantNewResources: `[
+				{
+					"apiVersion": "networking.k8s.io/v1",
+					"kind": "Ingress",
+					"metadata": {"name": "web", "namespace": "shop", "labels": {"app": "web"}, "annotations": {"owner": "team-shop"}},
+					"spec": {
+						"ingressClassName": "nginx",
+						"rules": [{
+							"host": "shop.apps.example.com",
+							"http": {"paths": [{"path": "/cart", "pathType": "Prefix", "backend": {"service": {"name": "web", "port": {"number": 80}}}}]}
+						}],
+						"tls": [{"hosts": ["shop.apps.example.com"], "secretName": "web-tls"}]
+					}
+				},
+				{
+					"apiVersion": "v1",
+					"kind": "Secret",
+					"metadata": {"name": "web-tls", "namespace": "shop", "labels": {"app": "web"}, "annotations": {"owner": "team-shop"}},
+					"type": "kubernetes.io/tls",
+					"data": {"tls.crt": "Q0VSVApDQQ==", "tls.key": "S0VZ"}
+				}
+			]`,
+			wantWarnings: []string{
+				"annotation haproxy.router.openshift.io/timeout of the OpenShift router is not converted",
+				"Prefix path /cart matches whole path segments, requests to paths such as /cartx that the Route matched are not routed",
+				"insecureEdgeTerminationPolicy Redirect is not converted, whether HTTP is served depends on the target cluster",
+			},
+		},
+		{
+			name: "IngressWeights",
+			route: `
+apiVersion: route.openshift.io/v1
+kind: Route
+metadata: {name: web, namespace: shop}
+spec:
+  host: shop.apps.example.com
+  to: {kind: Service, name: web, weight: 90}
+  alternateBackends:
+  - {kind: Service, name: web-canary, weight: 10}
+  port: {targetPort: http}
+`,
+			wantWhiteOut: true,
+			wantNewResources: `[
+				{
+					"apiVersion": "networking.k8s.io/v1",
+					"kind": "Ingress",
+					"metadata": {"name": "web", "namespace": "shop"},
+					"spec": {
+						"rules": [{
+							"host": "shop.apps.example.com",
+							"http": {"paths": [{"path": "/", "pathType": "Prefix", "backend": {"service": {"name": "web", "port": {"number": 80}}}}]}
+						}]
+					}
+				}
+			]`,
+			wantWarnings: []string{
+				"an Ingress has no backend weights, only Service web is kept",
+			},
+		},
+		{
+			name: "IngressPassthrough",
+			route: `
+apiVersion: route.openshift.io/v1
+kind: Route
+metadata: {name: db, namespace: shop}
+spec:
+  host: db.apps.example.com
+  to: {kind: Service, name: db}
+  tls: {termination: passthrough}
+`,
+			wantNewResources: `null`,
+			wantWarnings: []string{
+				"route is not replaced: an Ingress can not pass TLS through to the backends",
+			},
+		},
+		{
+			name: "HTTPRoute",
+			extras: map[string]string{
+				TargetFlag:  TargetGateway,
+				GatewayFlag: "gateway-system/public",
+			},
+			route: `
+apiVersion: route.openshift.io/v1
+kind: Route
+metadata: {name: web, namespace: shop}
+spec:
+  host: www.apps.example.com
+  wildcardPolicy: Subdomain
+  to: {kind: Service, name: web, weight: 3}
+  alternateBackends:
+  - {kind: Service, name: web-canary, weight: 1}
+  port: {targetPort: 8080}
+  tls:
+    termination: reencrypt
+    destinationCACertificate: CA
+`,
+			wantWhiteOut: true,
+			wantNewResources: `[
+				{
+					"apiVersion": "gateway.networking.k8s.io/v1",
+					"kind": "HTTPRoute",
+					"metadata": {"name": "web", "namespace": "shop"},
+					"spec": {
+						"parentRefs": [{"namespace": "gateway-system", "name": "public"}],
+						"hostnames": ["*.apps.example.com"],
+						"rules": [{
+							"matches": [{"path": {"type": "PathPrefix", "value": "/"}}],
+							"backendRefs": [
+								{"name": "web", "port": 80, "weight": 3},
+								{"name": "web-canary", "port": 8080, "weight": 1}
+							]
+						}]
+					}
+				}
+			]`,
+			wantWarnings: []string{
+				"TLS is terminated by the Gateway, give its HTTPS listener a certificate for the host",
+				"reencrypt termination is converted to edge termination, configure TLS to the backends on the target cluster",
+				"destinationCACertificate is not converted",
+			},
+		},
+		{
+			name: "TLSRoute",
+			extras: map[string]string{
+				TargetFlag: TargetGateway,
+			},
+			route: `
+apiVersion: route.openshift.io/v1
+kind: Route
+metadata: {name: db, namespace: shop}
+spec:
+  path: /admin
+  to: {kind: Service, name: db}
+  port: {targetPort: 5432}
+  tls: {termination: passthrough}
+status:
+  ingress:
+  - {host: db-shop.apps.example.com, routerName: default}
+`,
+			wantWhiteOut: true,
+			wantNewResources: `[
+				{
+					"apiVersion": "gateway.networking.k8s.io/v1alpha2",
+					"kind": "TLSRoute",
+					"metadata": {"name": "db", "namespace": "shop"},
+					"spec": {
+						"hostnames": ["db-shop.apps.example.com"],
+						"rules": [{"backendRefs": [{"name": "db", "port": 5432, "weight": 100}]}]
+					}
+				}
+			]`,
+			wantWarnings: []string{
+				"host db-shop.apps.example.com was generated by the router of the source cluster, it may not resolve to the target cluster",
+				"the new route is not attached to a Gateway, set its parentRefs",
+				"a TLSRoute does not match paths, path /admin is dropped",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &RoutePlugin{}
+			resp, err := p.Run(transform.PluginRequest{
+				Unstructured: decode(t, tt.route),
+				Extras:       tt.extras,
+				Version:      transform.V2,
+				Context:      &transform.RequestContext{Objects: []unstructured.Unstructured{decode(t, testService)}},
+			})
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if resp.IsWhiteOut != tt.wantWhiteOut {
+				t.Errorf("Run() IsWhiteOut = %v, want %v", resp.IsWhiteOut, tt.wantWhiteOut)
+			}
+			var want, got interface{}
+			if err := json.Unmarshal([]byte(tt.wantNewResources), &want); err != nil {
+				t.Fatal(err)
+			}
+			b, _ := json.Marshal(resp.NewResources)
+			if err := json.Unmarshal(b, &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Run() NewResources = %s, want %s", b, tt.wantNewResources)
+			}
+			if !reflect.DeepEqual(resp.Warnings, tt.wantWarnings) {
+				t.Errorf("Run() Warnings = %q, want %q", resp.Warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestRoutePluginRunV1(t *testing.T) {
+	p := &RoutePlugin{}
+	resp, err := p.Run(transform.PluginRequest{Unstructured: decode(t, `
+apiVersion: route.openshift.io/v1
+kind: Route
+metadata: {name: web, namespace: shop}
+spec:
+  to: {kind: Service, name: web}
+`)})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if !resp.IsWhiteOut || len(resp.NewResources) != 1 {
+		t.Errorf("Run() = %+v, want a whiteout and an Ingress", resp)
+	}
+	if resp.Version != string(transform.V1) || resp.Warnings != nil {
+		t.Errorf("Run() Version = %s, Warnings = %q, want v1 without warnings", resp.Version, resp.Warnings)
+	}
+}
+
+func TestRoutePluginInvalidFlags(t *testing.T) {
+	route := decode(t, `
+apiVersion: route.openshift.io/v1
+kind: Route
+metadata: {name: web, namespace: shop}
+`)
+	for _, extras := range []map[string]string{
+		{TargetFlag: "Service"},
+		{IngressClassNameFlag: "Nginx"},
+		{GatewayFlag: "gateway_system/public"},
+		{GatewayFlag: "/public"},
+	} {
+		p := &RoutePlugin{}
+		if _, err := p.Run(transform.PluginRequest{Unstructured: route, Extras: extras}); err == nil {
+			t.Errorf("Run() expected an error for %v", extras)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package rules
+
+import (
+	"fmt"
+	"regexp"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// matches returns true if the rule matches obj.
+func (c *compiledRule) matches(obj unstructured.Unstructured) (bool, error) {
+	if !matchGlob(c.apiVersion, obj.GetAPIVersion()) ||
+		!matchGlob(c.kind, obj.GetKind()) ||
+		!matchGlob(c.name, obj.GetName()) {
+		return false, nil
+	}
+	if len(c.namespaces) > 0 {
+		found := false
+		for _, namespace := range c.namespaces {
+			if matchGlob(namespace, obj.GetNamespace()) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false, nil
+		}
+	}
+	if !c.selector.Matches(labels.Set(obj.GetLabels())) {
+		return false, nil
+	}
+	annotations := obj.GetAnnotations()
+	for key, value := range c.annotations {
+		v, ok := annotations[key]
+		if !ok || !matchGlob(value, v) {
+			return false, nil
+		}
+	}
+	for i, path := range c.conditions {
+		ok, err := matchCondition(path, c.Match.Conditions[i], obj)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	if c.expression != nil {
+		return c.expression.EvalBool(obj)
+	}
+	return true, nil
+}
+
+func matchGlob(glob *regexp.Regexp, s string) bool {
+	return glob == nil || glob.MatchString(s)
+}
+
+func matchCondition(path *jsonpath.JSONPath, condition Condition, obj unstructured.Unstructured) (bool, error) {
+	results, err := path.FindResults(obj.Object)
+	if err != nil {
+		return false, fmt.Errorf("unable to evaluate %q: %v", condition.Path, err)
+	}
+	values := []string{}
+	for _, result := range results {
+		for _, v := range result {
+			if v.IsValid() && v.CanInterface() && v.Interface() != nil {
+				values = append(values, fmt.Sprint(v.Interface()))
+			}
+		}
+	}
+
+	switch condition.Operator {
+	case ConditionExists:
+		return len(values) > 0, nil
+	case ConditionDoesNotExist:
+		return len(values) == 0, nil
+	}
+	in := false
+	for _, v := range values {
+		for _, want := range condition.Values {
+			if v == want {
+				in = true
+			}
+		}
+	}
+	if condition.Operator == ConditionNotIn {
+		return !in, nil
+	}
+	return in, nil
+}
@@ -0,0 +1,104 @@
+package rules
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func testService() unstructured.Unstructured {
+	return unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Service",
+		"metadata": map[string]interface{}{
+			"name":        "frontend",
+			"namespace":   "shop",
+			"labels":      map[string]interface{}{"app": "shop", "tier": "web"},
+			"annotations": map[string]interface{}{"owner": "team-a"},
+		},
+		"spec": map[string]interface{}{
+			"type": "LoadBalancer",
+			"ports": []interface{}{
+				map[string]interface{}{"port": int64(80)},
+				map[string]interface{}{"port": int64(443)},
+			},
+		},
+	}}
+}
+
+func TestMatches(t *testing.T) {
+	tests := []struct {
+		name  string
+		match Match
+		want  bool
+	}{
+		{name: "Empty", match: Match{}, want: true},
+		{name: "Kind", match: Match{APIVersion: "v1", Kind: "Service"}, want: true},
+		{name: "OtherKind", match: Match{Kind: "Deployment"}, want: false},
+		{name: "NameGlob", match: Match{Name: "front*"}, want: true},
+		{name: "OtherName", match: Match{Name: "back*"}, want: false},
+		{name: "Namespaces", match: Match{Namespaces: []string{"dev", "sh*"}}, want: true},
+		{name: "OtherNamespaces", match: Match{Namespaces: []string{"dev"}}, want: false},
+		{name: "Labels", match: Match{Labels: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "shop"}}}, want: true},
+		{
+			name: "LabelExpression",
+			match: Match{Labels: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "tier", Operator: metav1.LabelSelectorOpNotIn, Values: []string{"web"}},
+			}}},
+			want: false,
+		},
+		{name: "Annotations", match: Match{Annotations: map[string]string{"owner": "team-*"}}, want: true},
+		{name: "MissingAnnotation", match: Match{Annotations: map[string]string{"contact": "*"}}, want: false},
+		{
+			name:  "ConditionIn",
+			match: Match{Conditions: []Condition{{Path: "{.spec.type}", Operator: ConditionIn, Values: []string{"NodePort", "LoadBalancer"}}}},
+			want:  true,
+		},
+		{
+			name:  "ConditionInList",
+			match: Match{Conditions: []Condition{{Path: "{.spec.ports[*].port}", Operator: ConditionIn, Values: []string{"443"}}}},
+			want:  true,
+		},
+		{
+			name:  "ConditionNotIn",
+			match: Match{Conditions: []Condition{{Path: "{.spec.type}", Operator: ConditionNotIn, Values: []string{"LoadBalancer"}}}},
+			want:  false,
+		},
+		{
+			name:  "ConditionExists",
+			match: Match{Conditions: []Condition{{Path: "{.spec.clusterIP}", Operator: ConditionExists}}},
+			want:  false,
+		},
+		{
+			name:  "ConditionDoesNotExist",
+			match: Match{Conditions: []Condition{{Path: "{.spec.clusterIP}", Operator: ConditionDoesNotExist}}},
+			want:  true,
+		},
+		{
+			name:  "Expression",
+			match: Match{Expression: `object.spec.ports.exists(p, p.port == 443) && object.metadata.name.startsWith("front")`},
+			want:  true,
+		},
+		{
+			name:  "OtherExpression",
+			match: Match{Kind: "Service", Expression: `has(object.spec.clusterIP)`},
+			want:  false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := compile(0, Rule{Match: tt.match, Actions: []Action{{Op: ActionWhiteOut}}})
+			if err != nil {
+				t.Fatalf("compile() error = %v", err)
+			}
+			got, err := rule.matches(testService())
+			if err != nil {
+				t.Fatalf("matches() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/konveyor/crane-lib/transform"
+	"github.com/konveyor/crane-lib/version"
+)
+
+// RulesPlugin runs the rules of a RuleSet. Its patches go through
+// PluginPriorities like those of any other plugin.
+type RulesPlugin struct {
+	name  string
+	rules []compiledRule
+}
+
+var _ transform.Plugin = &RulesPlugin{}
+
+// NewRulesPlugin checks the rules of ruleSet and returns the plugin running
+// them.
+func NewRulesPlugin(ruleSet RuleSet) (*RulesPlugin, error) {
+	p := &RulesPlugin{name: ruleSet.Name}
+	if p.name == "" {
+		p.name = DefaultName
+	}
+	for i, rule := range ruleSet.Rules {
+		c, err := compile(i, rule)
+		if err != nil {
+			return nil, err
+		}
+		p.rules = append(p.rules, c)
+	}
+	return p, nil
+}
+
+func (p *RulesPlugin) Metadata() transform.PluginMetadata {
+	return transform.PluginMetadata{
+		Name:            p.name,
+		Version:         version.Version,
+		RequestVersion:  transform.SupportedVersions,
+		ResponseVersion: transform.SupportedVersions,
+	}
+}
+
+// Run applies the actions of every rule matching the object. Each rule sees
+// the object as patched by the rules before it.
+func (p *RulesPlugin) Run(request transform.PluginRequest) (transform.PluginResponse, error) {
+	resp := transform.PluginResponse{Version: string(transform.V1)}
+	doc, err := request.Unstructured.MarshalJSON()
+	if err != nil {
+		return resp, err
+	}
+	object := request.Unstructured.DeepCopy()
+
+	for i := range p.rules {
+		rule := &p.rules[i]
+		ok, err := rule.matches(*object)
+		if err != nil {
+			return resp, fmt.Errorf("rule %s: %w", ruleName(i, rule.Rule), err)
+		}
+		if !ok {
+			continue
+		}
+		for j, action := range rule.Actions {
+			if action.Op == ActionWhiteOut {
+				return transform.PluginResponse{Version: resp.Version, IsWhiteOut: true}, nil
+			}
+			if rule.values[j] != nil {
+				value, err := rule.values[j].Eval(*object)
+				if err != nil {
+					return resp, fmt.Errorf("rule %s: %w", ruleName(i, rule.Rule), err)
+				}
+				if action.Value, err = json.Marshal(value); err != nil {
+					return resp, err
+				}
+			}
+			patch, err := actionPatch(doc, action)
+			if err != nil {
+				return resp, fmt.Errorf("rule %s: %w", ruleName(i, rule.Rule), err)
+			}
+			if len(patch) == 0 {
+				continue
+			}
+			doc, err = patch.Apply(doc)
+			if err != nil {
+				return resp, fmt.Errorf("rule %s: unable to %s %s: %w", ruleName(i, rule.Rule), action.Op, action.Path, err)
+			}
+			resp.Patches = append(resp.Patches, patch...)
+		}
+		if err := object.UnmarshalJSON(doc); err != nil {
+			return resp, err
+		}
+	}
+	return resp, nil
+}
+
+func ruleName(i int, rule Rule) string {
+	if rule.Name != "" {
+		return rule.Name
+	}
+	return fmt.Sprintf("#%d", i)
+}
+
+// actionPatch returns the operations taking action on doc: none when the
+// path to replace, remove, move or copy does not exist, and the creation of
+// the missing parents of the path to add, move or copy to.
+func actionPatch(doc []byte, action Action) (jsonpatch.Patch, error) {
+	object := map[string]interface{}{}
+	if err := json.Unmarshal(doc, &object); err != nil {
+		return nil, err
+	}
+	ops := []map[string]interface{}{}
+	switch action.Op {
+	case ActionAdd:
+		parents, err := parentOps(object, action.Path)
+		if err != nil {
+			return nil, err
+		}
+		ops = append(parents, map[string]interface{}{"op": action.Op, "path": action.Path, "value": action.Value})
+	case ActionReplace:
+		if !exists(object, action.Path) {
+			return nil, nil
+		}
+		ops = append(ops, map[string]interface{}{"op": action.Op, "path": action.Path, "value": action.Value})
+	case ActionRemove:
+		if !exists(object, action.Path) {
+			return nil, nil
+		}
+		ops = append(ops, map[string]interface{}{"op": action.Op, "path": action.Path})
+	case ActionMove, ActionCopy:
+		if !exists(object, action.From) {
+			return nil, nil
+		}
+		parents, err := parentOps(object, action.Path)
+		if err != nil {
+			return nil, err
+		}
+		ops = append(parents, map[string]interface{}{"op": action.Op, "from": action.From, "path": action.Path})
+	default:
+		return nil, fmt.Errorf("unknown op %q", action.Op)
+	}
+	b, err := json.Marshal(ops)
+	if err != nil {
+		return nil, err
+	}
+	return jsonpatch.DecodePatch(b)
+}
+
+// parentOps returns the operations adding the missing parents of pointer as
+// empty objects.
+func parentOps(object map[string]interface{}, pointer string) ([]map[string]interface{}, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	ops := []map[string]interface{}{}
+	var current interface{} = object
+	for i, token := range tokens[:len(tokens)-1] {
+		switch c := current.(type) {
+		case map[string]interface{}:
+			next, ok := c[token]
+			if !ok {
+				ops = append(ops, map[string]interface{}{"op": ActionAdd, "path": joinPointer(tokens[:i+1]), "value": map[string]interface{}{}})
+				next = map[string]interface{}{}
+			}
+			current = next
+		case []interface{}:
+			index, err := strconv.Atoi(token)
+			if err != nil || index < 0 || index >= len(c) {
+				return nil, fmt.Errorf("%s: no item %q in the list at %s", pointer, token, joinPointer(tokens[:i]))
+			}
+			current = c[index]
+		default:
+			return nil, fmt.Errorf("%s: %s is not an object or a list", pointer, joinPointer(tokens[:i]))
+		}
+	}
+	return ops, nil
+}
+
+// exists returns true if pointer has a value in object.
+func exists(object map[string]interface{}, pointer string) bool {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return false
+	}
+	var current interface{} = object
+	for _, token := range tokens {
+		switch c := current.(type) {
+		case map[string]interface{}:
+			next, ok := c[token]
+			if !ok {
+				return false
+			}
+			current = next
+		case []interface{}:
+			index, err := strconv.Atoi(token)
+			if err != nil || index < 0 || index >= len(c) {
+				return false
+			}
+			current = c[index]
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func joinPointer(tokens []string) string {
+	escaped := make([]string, len(tokens))
+	for i, t := range tokens {
+		escaped[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~", "~0"), "/", "~1")
+	}
+	return "/" + strings.Join(escaped, "/")
+}
@@ -0,0 +1,206 @@
+package rules
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/konveyor/crane-lib/transform"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestRulesPluginRun(t *testing.T) {
+	tests := []struct {
+		name         string
+		rules        string
+		wantWhiteOut bool
+		wantPatches  string
+		wantErr      bool
+	}{
+		{
+			name: "NoMatch",
+			rules: `
+rules:
+- match: {kind: Deployment}
+  actions: [{op: whiteout}]
+`,
+			wantPatches: `null`,
+		},
+		{
+			name: "WhiteOut",
+			rules: `
+rules:
+- match: {kind: Service, conditions: [{path: "{.spec.type}", operator: In, values: [LoadBalancer]}]}
+  actions:
+  - {op: add, path: /metadata/labels/ignored, value: "true"}
+  - {op: whiteout}
+`,
+			wantWhiteOut: true,
+			wantPatches:  `null`,
+		},
+		{
+			name: "AddCreatesParents",
+			rules: `
+rules:
+- match: {kind: Service}
+  actions:
+  - {op: add, path: /spec/externalTrafficPolicy, value: Local}
+  - {op: add, path: /spec/sessionAffinityConfig/clientIP/timeoutSeconds, value: 60}
+`,
+			wantPatches: `[
+				{"op": "add", "path": "/spec/externalTrafficPolicy", "value": "Local"},
+				{"op": "add", "path": "/spec/sessionAffinityConfig", "value": {}},
+				{"op": "add", "path": "/spec/sessionAffinityConfig/clientIP", "value": {}},
+				{"op": "add", "path": "/spec/sessionAffinityConfig/clientIP/timeoutSeconds", "value": 60}
+			]`,
+		},
+		{
+			name: "SkipsMissingPaths",
+			rules: `
+rules:
+- match: {kind: Service}
+  actions:
+  - {op: remove, path: /spec/clusterIP}
+  - {op: replace, path: /spec/loadBalancerIP, value: 10.0.0.1}
+  - {op: copy, from: /metadata/labels/missing, path: /metadata/labels/copy}
+  - {op: replace, path: /spec/type, value: ClusterIP}
+`,
+			wantPatches: `[{"op": "replace", "path": "/spec/type", "value": "ClusterIP"}]`,
+		},
+		{
+			name: "MoveAndCopy",
+			rules: `
+rules:
+- match: {kind: Service}
+  actions:
+  - {op: move, from: /metadata/labels/tier, path: /metadata/labels/layer}
+  - {op: copy, from: /metadata/labels/app, path: /metadata/annotations/app}
+`,
+			wantPatches: `[
+				{"op": "move", "from": "/metadata/labels/tier", "path": "/metadata/labels/layer"},
+				{"op": "add", "path": "/metadata/annotations", "value": {}},
+				{"op": "copy", "from": "/metadata/labels/app", "path": "/metadata/annotations/app"}
+			]`,
+		},
+		{
+			name: "RulesSeeEarlierRules",
+			rules: `
+rules:
+- match: {kind: Service}
+  actions: [{op: add, path: /metadata/labels/migrated, value: "true"}]
+- match: {labels: {matchLabels: {migrated: "true"}}}
+  actions: [{op: remove, path: /spec/ports/0}]
+`,
+			wantPatches: `[
+				{"op": "add", "path": "/metadata/labels/migrated", "value": "true"},
+				{"op": "remove", "path": "/spec/ports/0"}
+			]`,
+		},
+		{
+			name: "ValueExpression",
+			rules: `
+rules:
+- match: {kind: Service, expression: "object.spec.type == 'LoadBalancer'"}
+  actions:
+  - {op: add, path: /metadata/labels/ports, valueExpression: "string(size(object.spec.ports))"}
+  - {op: replace, path: /spec/ports/0, valueExpression: "{'port': object.spec.ports[0].port + 8000}"}
+`,
+			wantPatches: `[
+				{"op": "add", "path": "/metadata/labels/ports", "value": "2"},
+				{"op": "replace", "path": "/spec/ports/0", "value": {"port": 8080}}
+			]`,
+		},
+		{
+			name: "ExpressionError",
+			rules: `
+rules:
+- match: {expression: "object.spec.clusterIP == ''"}
+  actions: [{op: whiteout}]
+`,
+			wantErr: true,
+		},
+		{
+			name: "InvalidTarget",
+			rules: `
+rules:
+- match: {kind: Service}
+  actions: [{op: add, path: /spec/type/name, value: x}]
+`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugin, err := Parse([]byte(tt.rules))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			object := testObject()
+			resp, err := plugin.Run(transform.PluginRequest{Unstructured: object})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if resp.IsWhiteOut != tt.wantWhiteOut {
+				t.Errorf("Run() IsWhiteOut = %v, want %v", resp.IsWhiteOut, tt.wantWhiteOut)
+			}
+			got, _ := json.Marshal(resp.Patches)
+			if !jsonpatch.Equal(got, []byte(tt.wantPatches)) {
+				t.Errorf("Run() patches = %s, want %s", got, tt.wantPatches)
+			}
+			if !reflect.DeepEqual(object, testObject()) {
+				t.Errorf("Run() modified the request")
+			}
+			if len(resp.Patches) > 0 {
+				doc, _ := object.MarshalJSON()
+				if _, err := resp.Patches.Apply(doc); err != nil {
+					t.Errorf("patches do not apply to the object: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// testObject is the Service of testService, without annotations.
+func testObject() unstructured.Unstructured {
+	object := testService()
+	unstructured.RemoveNestedField(object.Object, "metadata", "annotations")
+	return object
+}
+
+func TestRulesPluginPriorities(t *testing.T) {
+	low, err := Parse([]byte(`
+name: LowRules
+rules:
+- match: {kind: Service}
+  actions: [{op: replace, path: /spec/type, value: NodePort}]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	high, err := Parse([]byte(`
+name: HighRules
+rules:
+- match: {kind: Service}
+  actions: [{op: replace, path: /spec/type, value: ClusterIP}]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := transform.NewRunner(logrus.New(), map[string]int{"HighRules": 0, "LowRules": 1}, nil)
+	resp, err := runner.Run(testService(), []transform.Plugin{low, high})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"op": "replace", "path": "/spec/type", "value": "ClusterIP"}]`
+	if !jsonpatch.Equal(resp.TransformFile, []byte(want)) {
+		t.Errorf("TransformFile = %s, want %s", resp.TransformFile, want)
+	}
+	if len(resp.IgnoredOperations) != 1 || resp.IgnoredOperations[0].Plugin != "LowRules" {
+		t.Errorf("IgnoredOperations = %v, want the operation of LowRules", resp.IgnoredOperations)
+	}
+}
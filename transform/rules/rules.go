@@ -0,0 +1,287 @@
+// Package rules is a transform plugin driven by a file of declarative rules
+// instead of code. Every rule matches objects and lists the actions to take on
+// them, in the form of JSON patch operations or a whiteout.
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/konveyor/crane-lib/transform/celexpr"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/util/jsonpath"
+	"sigs.k8s.io/yaml"
+)
+
+// DefaultName is the name of the plugin when the RuleSet does not set one.
+const DefaultName = "RulesPlugin"
+
+// RuleSet is the content of a rule file.
+type RuleSet struct {
+	// Name is the name of the plugin, to give it a priority in
+	// PluginPriorities. Empty means DefaultName.
+	Name  string `json:"name,omitempty"`
+	Rules []Rule `json:"rules"`
+}
+
+// Rule takes Actions on the objects matching Match. The rules of a RuleSet
+// are applied in order, each one to the object as patched by the previous
+// ones.
+type Rule struct {
+	// Name identifies the rule in errors.
+	Name    string   `json:"name,omitempty"`
+	Match   Match    `json:"match"`
+	Actions []Action `json:"actions"`
+}
+
+// Match selects objects. Every criterion that is set must match. The
+// APIVersion, Kind, Namespaces, Name and Annotations values are globs, where
+// "*" matches any string and "?" any character.
+type Match struct {
+	APIVersion string `json:"apiVersion,omitempty"`
+	Kind       string `json:"kind,omitempty"`
+	// Namespaces match the namespace of the object if any of them does.
+	Namespaces []string              `json:"namespaces,omitempty"`
+	Name       string                `json:"name,omitempty"`
+	Labels     *metav1.LabelSelector `json:"labels,omitempty"`
+	// Annotations must all be set on the object, with a matching value.
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Conditions  []Condition       `json:"conditions,omitempty"`
+	// Expression is a CEL expression over the object, as the variable
+	// "object", that must return true.
+	Expression string `json:"expression,omitempty"`
+}
+
+// Condition tests the values found at a JSONPath of the object, such as
+// "{.spec.type}".
+type Condition struct {
+	Path     string            `json:"path"`
+	Operator ConditionOperator `json:"operator"`
+	// Values are compared to the values found at Path, formatted as strings.
+	Values []string `json:"values,omitempty"`
+}
+
+type ConditionOperator string
+
+const (
+	// ConditionIn matches when a value found at the path is one of the
+	// Values.
+	ConditionIn ConditionOperator = "In"
+	// ConditionNotIn matches when no value found at the path is one of the
+	// Values.
+	ConditionNotIn ConditionOperator = "NotIn"
+	// ConditionExists matches when the path has a value.
+	ConditionExists ConditionOperator = "Exists"
+	// ConditionDoesNotExist matches when the path has no value.
+	ConditionDoesNotExist ConditionOperator = "DoesNotExist"
+)
+
+// Action changes a matching object. Path and From are JSON pointers.
+type Action struct {
+	Op    ActionOp        `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+	// ValueExpression is a CEL expression computing the value of add or
+	// replace from the object matched by the rule, instead of Value.
+	ValueExpression string `json:"valueExpression,omitempty"`
+}
+
+type ActionOp string
+
+const (
+	// ActionAdd sets Value at Path, creating the missing parent objects.
+	ActionAdd ActionOp = "add"
+	// ActionReplace sets Value at Path if Path exists.
+	ActionReplace ActionOp = "replace"
+	// ActionRemove removes Path if it exists.
+	ActionRemove ActionOp = "remove"
+	// ActionMove moves From to Path if From exists, creating the missing
+	// parent objects of Path.
+	ActionMove ActionOp = "move"
+	// ActionCopy copies From to Path if From exists, creating the missing
+	// parent objects of Path.
+	ActionCopy ActionOp = "copy"
+	// ActionWhiteOut whites out the object. The other actions on the object
+	// are ignored.
+	ActionWhiteOut ActionOp = "whiteout"
+)
+
+// LoadFile reads a rule file, in YAML or JSON, and returns the plugin running
+// its rules.
+func LoadFile(path string) (*RulesPlugin, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the rule file: %w", err)
+	}
+	plugin, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rule file %s: %w", path, err)
+	}
+	return plugin, nil
+}
+
+// Parse returns the plugin running the rules of a rule file, in YAML or
+// JSON. Unknown fields are rejected.
+func Parse(data []byte) (*RulesPlugin, error) {
+	ruleSet := RuleSet{}
+	if err := yaml.UnmarshalStrict(data, &ruleSet); err != nil {
+		return nil, err
+	}
+	return NewRulesPlugin(ruleSet)
+}
+
+// compiledRule is a Rule with its globs, selector and JSONPaths parsed and its
+// expressions compiled. Nil globs and expressions match anything. values has
+// the program computing the value of each action, or nil.
+type compiledRule struct {
+	Rule
+	apiVersion  *regexp.Regexp
+	kind        *regexp.Regexp
+	namespaces  []*regexp.Regexp
+	name        *regexp.Regexp
+	selector    labels.Selector
+	annotations map[string]*regexp.Regexp
+	conditions  []*jsonpath.JSONPath
+	expression  *celexpr.Program
+	values      []*celexpr.Program
+}
+
+func compile(i int, rule Rule) (compiledRule, error) {
+	c := compiledRule{
+		Rule:        rule,
+		apiVersion:  globRegexp(rule.Match.APIVersion),
+		kind:        globRegexp(rule.Match.Kind),
+		name:        globRegexp(rule.Match.Name),
+		selector:    labels.Everything(),
+		annotations: map[string]*regexp.Regexp{},
+	}
+	for _, namespace := range rule.Match.Namespaces {
+		c.namespaces = append(c.namespaces, globRegexp(namespace))
+	}
+	for k, v := range rule.Match.Annotations {
+		c.annotations[k] = globRegexp(v)
+	}
+	name := ruleName(i, rule)
+	fail := func(format string, args ...interface{}) (compiledRule, error) {
+		return c, fmt.Errorf("rule %s: %s", name, fmt.Sprintf(format, args...))
+	}
+
+	if rule.Match.Labels != nil {
+		selector, err := metav1.LabelSelectorAsSelector(rule.Match.Labels)
+		if err != nil {
+			return fail("invalid label selector: %v", err)
+		}
+		c.selector = selector
+	}
+	for _, condition := range rule.Match.Conditions {
+		switch condition.Operator {
+		case ConditionIn, ConditionNotIn:
+			if len(condition.Values) == 0 {
+				return fail("operator %s of %q needs values", condition.Operator, condition.Path)
+			}
+		case ConditionExists, ConditionDoesNotExist:
+			if len(condition.Values) != 0 {
+				return fail("operator %s of %q takes no values", condition.Operator, condition.Path)
+			}
+		default:
+			return fail("unknown operator %q", condition.Operator)
+		}
+		path := jsonpath.New(name).AllowMissingKeys(true)
+		if err := path.Parse(condition.Path); err != nil {
+			return fail("invalid path %q: %v", condition.Path, err)
+		}
+		c.conditions = append(c.conditions, path)
+	}
+
+	if rule.Match.Expression != "" {
+		expression, err := celexpr.CompileBool(rule.Match.Expression)
+		if err != nil {
+			return c, fmt.Errorf("rule %s: %w", name, err)
+		}
+		c.expression = expression
+	}
+
+	if len(rule.Actions) == 0 {
+		return fail("no actions")
+	}
+	for _, action := range rule.Actions {
+		if err := validateAction(action); err != nil {
+			return fail("%v", err)
+		}
+		var value *celexpr.Program
+		if action.ValueExpression != "" {
+			var err error
+			value, err = celexpr.CompileValue(action.ValueExpression)
+			if err != nil {
+				return c, fmt.Errorf("rule %s: %w", name, err)
+			}
+		}
+		c.values = append(c.values, value)
+	}
+	return c, nil
+}
+
+func validateAction(action Action) error {
+	switch action.Op {
+	case ActionWhiteOut:
+		if action.Path != "" || action.From != "" || len(action.Value) != 0 || action.ValueExpression != "" {
+			return fmt.Errorf("%s takes no path, from or value", action.Op)
+		}
+		return nil
+	case ActionAdd, ActionReplace:
+		if (len(action.Value) == 0) == (action.ValueExpression == "") {
+			return fmt.Errorf("%s %s needs a value or a valueExpression", action.Op, action.Path)
+		}
+	case ActionRemove:
+	case ActionMove, ActionCopy:
+		if _, err := parsePointer(action.From); err != nil {
+			return fmt.Errorf("%s from %q: %v", action.Op, action.From, err)
+		}
+	default:
+		return fmt.Errorf("unknown op %q", action.Op)
+	}
+	if _, err := parsePointer(action.Path); err != nil {
+		return fmt.Errorf("%s path %q: %v", action.Op, action.Path, err)
+	}
+	return nil
+}
+
+// parsePointer returns the unescaped tokens of a JSON pointer. The root of
+// the object can not be changed, so the pointer has at least one token.
+func parsePointer(pointer string) ([]string, error) {
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("a JSON pointer starts with /")
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// globRegexp returns the regular expression matching glob, or nil for an
+// empty glob.
+func globRegexp(glob string) *regexp.Regexp {
+	if glob == "" {
+		return nil
+	}
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range glob {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
@@ -0,0 +1,167 @@
+package rules
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{
+			name: "Valid",
+			data: `
+name: MyRules
+rules:
+- name: drop-debug
+  match:
+    kind: ConfigMap
+    name: debug-*
+    labels:
+      matchExpressions:
+      - {key: app, operator: Exists}
+    conditions:
+    - {path: "{.data.level}", operator: In, values: [debug]}
+  actions:
+  - op: whiteout
+- match:
+    apiVersion: apps/*
+  actions:
+  - {op: add, path: /metadata/labels/migrated, value: "true"}
+  - {op: move, from: /spec/template/metadata/labels/old, path: /spec/template/metadata/labels/new}
+`,
+		},
+		{
+			name:    "UnknownField",
+			data:    "rules:\n- match: {kinds: [Pod]}\n  actions: [{op: whiteout}]\n",
+			wantErr: "unknown field",
+		},
+		{
+			name:    "NoActions",
+			data:    "rules:\n- name: empty\n  match: {kind: Pod}\n",
+			wantErr: "rule empty: no actions",
+		},
+		{
+			name:    "UnknownOp",
+			data:    "rules:\n- match: {kind: Pod}\n  actions: [{op: test, path: /spec}]\n",
+			wantErr: `rule #0: unknown op "test"`,
+		},
+		{
+			name:    "MissingValue",
+			data:    "rules:\n- match: {kind: Pod}\n  actions: [{op: replace, path: /spec/replicas}]\n",
+			wantErr: "needs a value",
+		},
+		{
+			name:    "InvalidPointer",
+			data:    "rules:\n- match: {kind: Pod}\n  actions: [{op: remove, path: spec}]\n",
+			wantErr: "a JSON pointer starts with /",
+		},
+		{
+			name:    "MissingFrom",
+			data:    "rules:\n- match: {kind: Pod}\n  actions: [{op: copy, path: /spec/a}]\n",
+			wantErr: "copy from",
+		},
+		{
+			name:    "WhiteOutWithPath",
+			data:    "rules:\n- match: {kind: Pod}\n  actions: [{op: whiteout, path: /spec}]\n",
+			wantErr: "whiteout takes no path",
+		},
+		{
+			name:    "InvalidSelector",
+			data:    "rules:\n- match: {labels: {matchExpressions: [{key: app, operator: Exists, values: [a]}]}}\n  actions: [{op: whiteout}]\n",
+			wantErr: "invalid label selector",
+		},
+		{
+			name:    "InvalidJSONPath",
+			data:    "rules:\n- match: {conditions: [{path: \"{.spec[\", operator: Exists}]}\n  actions: [{op: whiteout}]\n",
+			wantErr: "invalid path",
+		},
+		{
+			name:    "UnknownOperator",
+			data:    "rules:\n- match: {conditions: [{path: \"{.spec}\", operator: Equals}]}\n  actions: [{op: whiteout}]\n",
+			wantErr: `unknown operator "Equals"`,
+		},
+		{
+			name:    "InWithoutValues",
+			data:    "rules:\n- match: {conditions: [{path: \"{.spec.type}\", operator: In}]}\n  actions: [{op: whiteout}]\n",
+			wantErr: "needs values",
+		},
+		{
+			name:    "InvalidExpression",
+			data:    "rules:\n- match: {expression: \"object.kind ==\"}\n  actions: [{op: whiteout}]\n",
+			wantErr: `rule #0: expression "object.kind =="`,
+		},
+		{
+			name:    "ExpressionNotBool",
+			data:    "rules:\n- match: {expression: \"size(object.metadata)\"}\n  actions: [{op: whiteout}]\n",
+			wantErr: "not bool",
+		},
+		{
+			name:    "InvalidValueExpression",
+			data:    "rules:\n- match: {kind: Pod}\n  actions: [{op: add, path: /metadata/labels/a, valueExpression: \"obj.kind\"}]\n",
+			wantErr: "undeclared reference",
+		},
+		{
+			name:    "ValueAndValueExpression",
+			data:    "rules:\n- match: {kind: Pod}\n  actions: [{op: add, path: /metadata/labels/a, value: x, valueExpression: \"object.kind\"}]\n",
+			wantErr: "needs a value or a valueExpression",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.data))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Parse() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Parse() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	if err := os.WriteFile(path, []byte("rules:\n- match: {kind: Pod}\n  actions: [{op: whiteout}]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	plugin, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	if plugin.Metadata().Name != DefaultName {
+		t.Errorf("Metadata().Name = %q, want %q", plugin.Metadata().Name, DefaultName)
+	}
+	if _, err := LoadFile(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Errorf("LoadFile() expected an error for a missing file")
+	}
+}
+
+func TestGlobRegexp(t *testing.T) {
+	tests := []struct {
+		glob string
+		s    string
+		want bool
+	}{
+		{glob: "", s: "anything", want: true},
+		{glob: "kube-*", s: "kube-root-ca.crt", want: true},
+		{glob: "kube-*", s: "my-kube-config", want: false},
+		{glob: "*", s: "apps/v1", want: true},
+		{glob: "apps/v?", s: "apps/v1", want: true},
+		{glob: "apps/v?", s: "apps/v1beta1", want: false},
+		{glob: "a.b", s: "axb", want: false},
+	}
+	for _, tt := range tests {
+		if got := matchGlob(globRegexp(tt.glob), tt.s); got != tt.want {
+			t.Errorf("glob %q on %q = %v, want %v", tt.glob, tt.s, got, tt.want)
+		}
+	}
+}
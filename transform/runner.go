@@ -1,10 +1,15 @@
 package transform
 
 import (
+	"context"
 	"encoding/json"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
 
 	jsonpatch "github.com/evanphx/json-patch"
+	transformerrors "github.com/konveyor/crane-lib/transform/errors"
 	ijsonpatch "github.com/konveyor/crane-lib/transform/internal/jsonpatch"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -17,10 +22,60 @@ type Runner struct {
 	// This also needs to handle the options that it will need.
 	// TODO: Figure out options that the runner will need and implement here.
 	PluginPriorities map[string]int
-	OptionalFlags    map[string]string
-	Log              *logrus.Logger
+	// OptionalFlags are sent to the plugins that declare them in their
+	// OptionalFields. A flag named "<plugin>.<flag>", see ScopedFlagName, is
+	// only sent to that plugin and overrides the global flag.
+	OptionalFlags map[string]string
+	Log           *logrus.Logger
+	// Workers is the maximum number of objects RunBatch processes at the
+	// same time. Zero or a negative value uses runtime.NumCPU().
+	Workers int
+	// ErrorPolicy decides what happens when a plugin fails. The zero value
+	// behaves like ErrorPolicyFailFast.
+	ErrorPolicy ErrorPolicy
+	// IgnoreErrorsFrom lists plugin names whose errors are logged and
+	// otherwise ignored, whatever the ErrorPolicy.
+	IgnoreErrorsFrom []string
+	// WhiteOutPolicy decides whether a whiteout overrides the patches of the
+	// other plugins. The zero value behaves like WhiteOutPolicyAny.
+	WhiteOutPolicy WhiteOutPolicy
+	// SourceClusterVersion and TargetClusterVersion are passed to the plugins
+	// in the RequestContext.
+	SourceClusterVersion string
+	TargetClusterVersion string
+	// Renames are applied by Run and RunWithContext, which can not analyze
+	// the whole export; see Analyze. RunBatch applies them along with the
+	// renames it collects.
+	Renames []Rename
+
+	// warnedFlags are the unclaimed OptionalFlags already logged.
+	warnedFlags sync.Map
 }
 
+type WhiteOutPolicy string
+
+const (
+	// WhiteOutPolicyAny whites out the object as soon as any plugin asks for
+	// it and ignores the patches of every plugin.
+	WhiteOutPolicyAny WhiteOutPolicy = "any"
+	// WhiteOutPolicyPriority lets a plugin that patches the object veto the
+	// whiteout of plugins with a lower priority, in which case the object is
+	// kept and patched as usual.
+	WhiteOutPolicyPriority WhiteOutPolicy = "priority"
+)
+
+type ErrorPolicy string
+
+const (
+	// ErrorPolicyFailFast stops at the first plugin error and returns it as
+	// an *errors.ObjectError.
+	ErrorPolicyFailFast ErrorPolicy = "fail-fast"
+	// ErrorPolicyContinue keeps running the remaining plugins and objects,
+	// returns the responses built from the plugins that succeeded and reports
+	// every failure in an *errors.MultiError.
+	ErrorPolicyContinue ErrorPolicy = "continue"
+)
+
 // NewRunner creates a new Runner with the required logger.
 // If logger is nil, a new default logger is created.
 func NewRunner(logger *logrus.Logger, pluginPriorities map[string]int, optionalFlags map[string]string) *Runner {
@@ -37,11 +92,28 @@ func NewRunner(logger *logrus.Logger, pluginPriorities map[string]int, optionalF
 // RunnerResponse will be responsble for
 // TransformFile is a marshaled jsonpatch.Patch
 // IgnoredPatches is a marshaled []PluginOperation
+// IgnoredOperations holds the same operations as IgnoredPatches along with
+// why each one was dropped and which plugin won.
+// Warnings and Annotations are collected from V2 plugins; when two plugins
+// set the same annotation the one with the higher priority wins.
 type RunnerResponse struct {
-	TransformFile  []byte
-	HaveWhiteOut   bool
-	IgnoredPatches []byte
-	NewResources   []unstructured.Unstructured
+	TransformFile     []byte
+	HaveWhiteOut      bool
+	IgnoredPatches    []byte
+	IgnoredOperations []IgnoredOperation
+	NewResources      []unstructured.Unstructured
+	Warnings          []PluginWarning
+	Annotations       map[string]string
+
+	// newResourcePlugins are the names of the plugins that created each of
+	// the NewResources.
+	newResourcePlugins []string
+}
+
+// PluginWarning is a warning reported by a plugin for an object.
+type PluginWarning struct {
+	PluginName string
+	Message    string
 }
 
 type PluginOperation struct {
@@ -57,6 +129,13 @@ func PluginOperationsFromPatch(pluginName string, patches jsonpatch.Patch) []Plu
 	return pluginOpList
 }
 
+// sourcedOperation is a PluginOperation along with the position of the plugin
+// that produced it, which tells apart plugins that share a name.
+type sourcedOperation struct {
+	PluginOperation
+	source int
+}
+
 func EqualPluginOperationList(pluginOps1, pluginOps2 []PluginOperation) bool {
 	if len(pluginOps1) != len(pluginOps2) {
 		return false
@@ -73,57 +152,384 @@ func EqualPluginOperation(pluginOp1, pluginOp2 PluginOperation) bool {
 	return pluginOp1.PluginName == pluginOp2.PluginName && ijsonpatch.EqualOperation(pluginOp1.Operation, pluginOp2.Operation)
 }
 
+// Run runs every plugin against a single object and merges their responses.
 func (r *Runner) Run(object unstructured.Unstructured, plugins []Plugin) (RunnerResponse, error) {
-	haveWhiteOut := false
-	havePatches := false
-	patches := []PluginOperation{}
-	newResources := []unstructured.Unstructured{}
-	errs := []error{}
+	return r.RunWithContext(context.Background(), object, plugins)
+}
+
+// RunWithContext is like Run, but stops before the next plugin once ctx is
+// done. Plugins implementing PluginRunWithContext also receive ctx.
+func (r *Runner) RunWithContext(ctx context.Context, object unstructured.Unstructured, plugins []Plugin) (RunnerResponse, error) {
+	extras, err := r.pluginExtras(plugins)
+	if err != nil {
+		return emptyRunnerResponse(), err
+	}
+	return r.runObject(ctx, object, plugins, newRunState(extras, r.requestContext(nil), r.Renames))
+}
 
+// runState is what the plugins are run with, shared by every object.
+type runState struct {
+	extras         []map[string]string
+	requestContext *RequestContext
+	// applyContext is sent to plugins advertising CapabilityRenames.
+	applyContext *RequestContext
+	renames      *renameSet
+}
+
+func newRunState(extras []map[string]string, requestContext *RequestContext, renames []Rename) *runState {
+	applyContext := *requestContext
+	applyContext.Phase = PhaseApply
+	return &runState{
+		extras:         extras,
+		requestContext: requestContext,
+		applyContext:   &applyContext,
+		renames:        newRenameSet(renames),
+	}
+}
+
+// Analyze runs the analysis phase: it asks the plugins advertising
+// CapabilityRenames for the renames of every object. When two plugins rename
+// the same object differently, the one with the higher priority wins. With
+// ErrorPolicyContinue every object is analyzed, and the renames found are
+// returned along with all failures in one *errors.MultiError.
+func (r *Runner) Analyze(ctx context.Context, objects []unstructured.Unstructured, plugins []Plugin) ([]Rename, error) {
+	extras, err := r.pluginExtras(plugins)
+	if err != nil {
+		return nil, err
+	}
+	renames, objErrs, err := r.analyze(ctx, objects, plugins, extras)
+	if err != nil {
+		return nil, err
+	}
+	errs := []*transformerrors.ObjectError{}
+	for _, e := range objErrs {
+		errs = append(errs, e...)
+	}
+	if len(errs) > 0 {
+		return renames, &transformerrors.MultiError{Errors: errs}
+	}
+	return renames, nil
+}
+
+// analyze is Analyze with the extras of the plugins already validated. The
+// failures collected under ErrorPolicyContinue are returned per object.
+func (r *Runner) analyze(ctx context.Context, objects []unstructured.Unstructured, plugins []Plugin, extras []map[string]string) ([]Rename, [][]*transformerrors.ObjectError, error) {
+	analyzeContext := r.requestContext(objects)
+	analyzeContext.Phase = PhaseAnalyze
+
+	// Renames are V2, a plugin speaking V1 can not declare them.
+	analyzers := make([]bool, len(plugins))
+	for source, plugin := range plugins {
+		metadata := plugin.Metadata()
+		if !metadata.HasCapability(CapabilityRenames) {
+			continue
+		}
+		if pluginVersion(metadata) == V1 {
+			r.Log.Warnf("Ignoring capability %v of plugin %v, it does not support request version %v", CapabilityRenames, metadata.Name, V2)
+			continue
+		}
+		analyzers[source] = true
+	}
+
+	renames := []Rename{}
+	declaredBy := map[renameKey]int{}
+	renamers := map[renameKey]string{}
+	objErrs := make([][]*transformerrors.ObjectError, len(objects))
+	for i, object := range objects {
+		for source, plugin := range plugins {
+			if err := ctx.Err(); err != nil {
+				return nil, nil, err
+			}
+			if !analyzers[source] {
+				continue
+			}
+			name := plugin.Metadata().Name
+			resp, err := runPlugin(ctx, plugin, pluginRequest(plugin, PluginRequest{
+				Unstructured: *object.DeepCopy(),
+				Extras:       extras[source],
+				Context:      analyzeContext,
+			}))
+			if err != nil {
+				objErr := newObjectError(name, object, err)
+				switch {
+				case r.ignoresErrorsFrom(name):
+					r.Log.Warnf("Ignoring error: %v", objErr)
+				case r.ErrorPolicy == ErrorPolicyContinue:
+					r.Log.Debugf("Continuing after error: %v", objErr)
+					objErrs[i] = append(objErrs[i], objErr)
+				default:
+					return nil, nil, objErr
+				}
+				continue
+			}
+			for _, rename := range resp.Renames {
+				key := referenceKey(rename.From)
+				j, ok := declaredBy[key]
+				switch {
+				case !ok:
+					declaredBy[key] = len(renames)
+					renamers[key] = name
+					renames = append(renames, rename)
+				case renames[j] == rename:
+				case r.hasPriorityOver(name, renamers[key]):
+					r.Log.Warnf("Rename of %v from plugin %v overrides the one from %v", rename.From, name, renamers[key])
+					renames[j] = rename
+					renamers[key] = name
+				default:
+					r.Log.Warnf("Ignoring rename of %v from plugin %v, already renamed by %v", rename.From, name, renamers[key])
+				}
+			}
+		}
+	}
+	return renames, objErrs, nil
+}
+
+// FlagScopeSeparator separates the plugin name from the flag name in an
+// optional flag scoped to one plugin, as in "KubernetesPlugin.add-annotations".
+const FlagScopeSeparator = "."
+
+// ScopedFlagName returns the name of flag scoped to the named plugin.
+func ScopedFlagName(pluginName, flag string) string {
+	return pluginName + FlagScopeSeparator + flag
+}
+
+// pluginExtras returns the extras sent to each plugin: the OptionalFlags the
+// plugin declared, with the flags scoped to the plugin taking precedence over
+// the global ones, validated and with defaults applied. The error is an
+// *errors.OptionError.
+func (r *Runner) pluginExtras(plugins []Plugin) ([]map[string]string, error) {
+	names := map[string]bool{}
 	for _, plugin := range plugins {
+		names[plugin.Metadata().Name] = true
+	}
+	global := map[string]string{}
+	scoped := map[string]map[string]string{}
+	for flag, value := range r.OptionalFlags {
+		pluginName, name, ok := splitScopedFlag(flag, names)
+		if !ok {
+			global[flag] = value
+			continue
+		}
+		if scoped[pluginName] == nil {
+			scoped[pluginName] = map[string]string{}
+		}
+		scoped[pluginName][name] = value
+	}
+
+	claimed := map[string]bool{}
+	extras := make([]map[string]string, len(plugins))
+	for i, plugin := range plugins {
+		metadata := plugin.Metadata()
+		flags := map[string]string{}
+		for _, field := range metadata.OptionalFields {
+			if value, ok := global[field.FlagName]; ok {
+				flags[field.FlagName] = value
+				claimed[field.FlagName] = true
+			}
+			if value, ok := scoped[metadata.Name][field.FlagName]; ok {
+				flags[field.FlagName] = value
+				claimed[ScopedFlagName(metadata.Name, field.FlagName)] = true
+			}
+		}
+		pluginExtras, err := ValidateOptionalFields(metadata.OptionalFields, flags)
+		if err != nil {
+			optErr := &transformerrors.OptionError{}
+			if errors.As(err, &optErr) {
+				optErr.Plugin = metadata.Name
+			}
+			return nil, err
+		}
+		extras[i] = pluginExtras
+	}
+
+	unclaimed := []string{}
+	for flag := range r.OptionalFlags {
+		if !claimed[flag] {
+			unclaimed = append(unclaimed, flag)
+		}
+	}
+	sort.Strings(unclaimed)
+	for _, flag := range unclaimed {
+		// Run is called once per object, the warning is only useful once.
+		if _, warned := r.warnedFlags.LoadOrStore(flag, true); warned {
+			continue
+		}
+		if pluginName, name, ok := splitScopedFlag(flag, names); ok {
+			r.Log.Warnf("Ignoring flag %q: plugin %q does not declare %q", flag, pluginName, name)
+		} else {
+			r.Log.Warnf("Ignoring flag %q: no plugin declares it", flag)
+		}
+	}
+	return extras, nil
+}
+
+// splitScopedFlag returns the plugin and the flag name of a flag scoped to
+// one of the named plugins. The longest plugin name wins, since plugin names
+// may contain the separator.
+func splitScopedFlag(flag string, pluginNames map[string]bool) (string, string, bool) {
+	pluginName := ""
+	for name := range pluginNames {
+		if len(name) > len(pluginName) && strings.HasPrefix(flag, name+FlagScopeSeparator) {
+			pluginName = name
+		}
+	}
+	if pluginName == "" {
+		return "", "", false
+	}
+	return pluginName, strings.TrimPrefix(flag, pluginName+FlagScopeSeparator), true
+}
+
+// requestContext returns the context sent along with every object of an
+// export made of objects. The objects are only reachable through the index,
+// which holds copies of them, so plugins can not modify the export.
+func (r *Runner) requestContext(objects []unstructured.Unstructured) *RequestContext {
+	requestContext := &RequestContext{
+		SourceClusterVersion: r.SourceClusterVersion,
+		TargetClusterVersion: r.TargetClusterVersion,
+	}
+	for _, o := range objects {
+		requestContext.Resources = append(requestContext.Resources, NewResourceReference(o))
+	}
+	if len(objects) > 0 {
+		requestContext.index = NewResourceIndex(objects)
+	}
+	return requestContext
+}
+
+// pluginVersion returns the request version negotiated with a plugin, V1 when
+// it supports none of the SupportedVersions.
+func pluginVersion(metadata PluginMetadata) Version {
+	if v, ok := NegotiateVersion(metadata.RequestVersion); ok {
+		return v
+	}
+	return V1
+}
+
+// pluginRequest returns request as sent to plugin, in the version negotiated
+// with it and with the context its capabilities ask for.
+func pluginRequest(plugin Plugin, request PluginRequest) PluginRequest {
+	metadata := plugin.Metadata()
+	return request.ForVersion(pluginVersion(metadata)).forCapabilities(metadata)
+}
+
+func (r *Runner) runObject(ctx context.Context, object unstructured.Unstructured, plugins []Plugin, state *runState) (RunnerResponse, error) {
+	whiteOutPlugins := []string{}
+	patchingPlugins := []string{}
+	patches := []sourcedOperation{}
+	newResources := []unstructured.Unstructured{}
+	newResourcePlugins := []string{}
+	warnings := []PluginWarning{}
+	annotations := map[string]string{}
+	annotationPlugins := map[string]string{}
+	errs := []*transformerrors.ObjectError{}
+
+	for source, plugin := range plugins {
+		if err := ctx.Err(); err != nil {
+			return emptyRunnerResponse(), err
+		}
 		// We want to keep the original while we run each plugin.
 		c := object.DeepCopy()
-		// TODO: Handle Version things here
-		resp, err := plugin.Run(PluginRequest{Unstructured:*c, Extras:r.OptionalFlags})
+		requestContext := state.requestContext
+		if plugin.Metadata().HasCapability(CapabilityRenames) {
+			requestContext = state.applyContext
+		}
+		resp, err := runPlugin(ctx, plugin, pluginRequest(plugin, PluginRequest{
+			Unstructured: *c,
+			Extras:       state.extras[source],
+			Context:      requestContext,
+		}))
 		if err != nil {
-			//TODO: add debug level logging here
-			errs = append(errs, err)
+			objErr := newObjectError(plugin.Metadata().Name, object, err)
+			switch {
+			case r.ignoresErrorsFrom(plugin.Metadata().Name):
+				r.Log.Warnf("Ignoring error: %v", objErr)
+			case r.ErrorPolicy == ErrorPolicyContinue:
+				r.Log.Debugf("Continuing after error: %v", objErr)
+				errs = append(errs, objErr)
+			default:
+				return emptyRunnerResponse(), objErr
+			}
 			continue
 		}
 		if resp.IsWhiteOut {
-			haveWhiteOut = true
+			whiteOutPlugins = append(whiteOutPlugins, plugin.Metadata().Name)
 		}
 		if len(resp.Patches) > 0 {
-			havePatches = true
-			patches = append(patches, PluginOperationsFromPatch(plugin.Metadata().Name, resp.Patches)...)
+			patchingPlugins = append(patchingPlugins, plugin.Metadata().Name)
+			for _, op := range PluginOperationsFromPatch(plugin.Metadata().Name, resp.Patches) {
+				patches = append(patches, sourcedOperation{PluginOperation: op, source: source})
+			}
 		}
 		if len(resp.NewResources) > 0 {
 			newResources = append(newResources, resp.NewResources...)
+			for range resp.NewResources {
+				newResourcePlugins = append(newResourcePlugins, plugin.Metadata().Name)
+			}
 			r.Log.Debugf("Plugin %s generated %d new resource(s)",
 				plugin.Metadata().Name, len(resp.NewResources))
 		}
+		for _, w := range resp.Warnings {
+			warnings = append(warnings, PluginWarning{PluginName: plugin.Metadata().Name, Message: w})
+		}
+		for k, v := range resp.Annotations {
+			if previous, ok := annotationPlugins[k]; ok && !r.hasPriorityOver(plugin.Metadata().Name, previous) {
+				continue
+			}
+			annotations[k] = v
+			annotationPlugins[k] = plugin.Metadata().Name
+		}
+	}
+	renamePatch, renameWarnings := referencePatches(object, state.renames)
+	for _, op := range PluginOperationsFromPatch(ReferenceRewriterName, renamePatch) {
+		patches = append(patches, sourcedOperation{PluginOperation: op, source: len(plugins)})
+	}
+	for _, w := range renameWarnings {
+		warnings = append(warnings, PluginWarning{PluginName: ReferenceRewriterName, Message: w})
 	}
+
+	// New resources, warnings and annotations are kept whatever happens to
+	// the object itself, so a plugin can replace the object it whites out.
 	response := RunnerResponse{
 		TransformFile:  []byte(`[]`),
-		HaveWhiteOut:   haveWhiteOut,
 		IgnoredPatches: []byte(`[]`),
 		NewResources:   newResources,
+
+		newResourcePlugins: newResourcePlugins,
+	}
+	if len(warnings) > 0 {
+		response.Warnings = warnings
+	}
+	if len(annotations) > 0 {
+		response.Annotations = annotations
 	}
 
-	// TODO: in the future we should consider a way to speed this up with go routines.
+	var runErr error
 	if len(errs) > 0 {
-		// TODO: handle error in a reasonable way. Probably needs an enhancement
-		// Should Consider option to ignore errors
-		return response, errs[0]
+		runErr = &transformerrors.MultiError{Errors: errs}
 	}
-	if haveWhiteOut {
-		// TODO: handle if we should skip whiteOut if there is a transform
-		response.HaveWhiteOut = haveWhiteOut
-		return response, nil
+	if len(whiteOutPlugins) > 0 {
+		winner, vetoedBy := r.resolveWhiteOut(whiteOutPlugins, patchingPlugins)
+		if vetoedBy == "" {
+			response.HaveWhiteOut = true
+			ignoredOps := []IgnoredOperation{}
+			for _, o := range patches {
+				ignoredOps = append(ignoredOps, IgnoredOperation{
+					Operation:    o.Operation,
+					Plugin:       o.PluginName,
+					Reason:       IgnoredReasonWhiteOut,
+					WinnerPlugin: winner,
+				})
+			}
+			if err := setIgnoredOperations(&response, ignoredOps); err != nil {
+				return response, err
+			}
+			return response, runErr
+		}
+		r.Log.Debugf("Whiteout from plugin %v vetoed by higher priority plugin %v", winner, vetoedBy)
 	}
 
-	if havePatches {
-		patches, ignoredPatches, err := r.sanitizePatches(patches)
+	if len(patches) > 0 {
+		patches, ignoredOps, err := r.sanitizePatches(object, patches)
 		if err != nil {
 			return response, err
 		}
@@ -134,83 +540,412 @@ func (r *Runner) Run(object unstructured.Unstructured, plugins []Plugin) (Runner
 		if err != nil {
 			return response, err
 		}
-		response.IgnoredPatches, err = json.Marshal(ignoredPatches)
-		if err != nil {
+		if err := setIgnoredOperations(&response, ignoredOps); err != nil {
 			return response, err
 		}
+	}
+	return response, runErr
+}
 
-		return response, err
+func setIgnoredOperations(response *RunnerResponse, ignoredOps []IgnoredOperation) error {
+	ignoredPatches := []PluginOperation{}
+	for _, ignored := range ignoredOps {
+		ignoredPatches = append(ignoredPatches, PluginOperation{PluginName: ignored.Plugin, Operation: ignored.Operation})
+	}
+	b, err := json.Marshal(ignoredPatches)
+	if err != nil {
+		return err
 	}
-	return response, nil
+	response.IgnoredOperations = ignoredOps
+	response.IgnoredPatches = b
+	return nil
 }
 
+// resolveWhiteOut returns the highest priority plugin asking for a whiteout.
+// Under WhiteOutPolicyPriority it also returns the highest priority patching
+// plugin that outranks it, which keeps the object; vetoedBy is empty when the
+// whiteout stands.
+func (r *Runner) resolveWhiteOut(whiteOutPlugins, patchingPlugins []string) (winner string, vetoedBy string) {
+	winner = whiteOutPlugins[0]
+	for _, name := range whiteOutPlugins[1:] {
+		if r.hasPriorityOver(name, winner) {
+			winner = name
+		}
+	}
+	if r.WhiteOutPolicy != WhiteOutPolicyPriority {
+		return winner, ""
+	}
+	for _, name := range patchingPlugins {
+		if r.hasPriorityOver(name, winner) && (vetoedBy == "" || r.hasPriorityOver(name, vetoedBy)) {
+			vetoedBy = name
+		}
+	}
+	return winner, vetoedBy
+}
 
-// sanitizePatches removes duplicate patch operations as well as find
-// conflicting operations where path is the same, but different kind or values.
-// TODO: Handle where paths are the same, but operations are different.
-func (r *Runner) sanitizePatches(pluginOps []PluginOperation) (jsonpatch.Patch, []PluginOperation, error) {
-	patchMap := map[string]PluginOperation{}
-	ignoredPatches := []PluginOperation{}
-	for _, o := range pluginOps {
-		key, err := o.Operation.Path()
+func emptyRunnerResponse() RunnerResponse {
+	return RunnerResponse{
+		TransformFile:  []byte(`[]`),
+		IgnoredPatches: []byte(`[]`),
+	}
+}
+
+// emptyRunnerResponses returns n empty responses, for the objects RunBatch
+// did not get to.
+func emptyRunnerResponses(n int) []RunnerResponse {
+	responses := make([]RunnerResponse, n)
+	for i := range responses {
+		responses[i] = emptyRunnerResponse()
+	}
+	return responses
+}
+
+func newObjectError(pluginName string, object unstructured.Unstructured, err error) *transformerrors.ObjectError {
+	return &transformerrors.ObjectError{
+		Plugin:           pluginName,
+		GroupVersionKind: object.GroupVersionKind(),
+		Namespace:        object.GetNamespace(),
+		Name:             object.GetName(),
+		Err:              err,
+	}
+}
+
+func (r *Runner) ignoresErrorsFrom(pluginName string) bool {
+	for _, name := range r.IgnoreErrorsFrom {
+		if name == pluginName {
+			return true
+		}
+	}
+	return false
+}
+
+// RunBatch runs the plugins against every object, processing up to Workers
+// objects concurrently, after collecting the renames of the objects with
+// Analyze. Every plugin is shared by the workers, see Plugin. The responses
+// are returned in the same order as objects. Every plugin request references
+// all the objects of the batch. With ErrorPolicyFailFast the first error, in
+// object order, cancels the remaining work and is returned. With
+// ErrorPolicyContinue every object is processed and all failures, those of
+// the analysis first for each object, are returned in one
+// *errors.MultiError. An error from ctx is returned if it ends the batch
+// early.
+func (r *Runner) RunBatch(ctx context.Context, objects []unstructured.Unstructured, plugins []Plugin) ([]RunnerResponse, error) {
+	extras, err := r.pluginExtras(plugins)
+	if err != nil {
+		return emptyRunnerResponses(len(objects)), err
+	}
+	renames, analyzeErrs, err := r.analyze(ctx, objects, plugins, extras)
+	if err != nil {
+		return emptyRunnerResponses(len(objects)), err
+	}
+	batchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	state := newRunState(extras, r.requestContext(objects), append(append([]Rename{}, r.Renames...), renames...))
+
+	responses := emptyRunnerResponses(len(objects))
+	errs := make([]error, len(objects))
+	indexes := make(chan int)
+
+	wg := sync.WaitGroup{}
+	for w := 0; w < r.workers(len(objects)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				responses[i], errs[i] = r.runObject(batchCtx, objects[i], plugins, state)
+				if errs[i] != nil && r.ErrorPolicy != ErrorPolicyContinue {
+					cancel()
+				}
+			}
+		}()
+	}
+
+feed:
+	for i := range objects {
+		select {
+		case indexes <- i:
+		case <-batchCtx.Done():
+			break feed
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return responses, ctx.Err()
+	}
+	objErrs := []*transformerrors.ObjectError{}
+	for i, err := range errs {
+		objErrs = append(objErrs, analyzeErrs[i]...)
+		if err == nil {
+			continue
+		}
+		if r.ErrorPolicy != ErrorPolicyContinue {
+			// Objects interrupted by our own cancellation only echo an earlier failure.
+			if errors.Is(err, context.Canceled) {
+				continue
+			}
+			return responses, err
+		}
+		objErrs = append(objErrs, transformerrors.ObjectErrors(err)...)
+	}
+	if len(objErrs) > 0 {
+		return responses, &transformerrors.MultiError{Errors: objErrs}
+	}
+	return responses, nil
+}
+
+// ObjectArtifacts is what the Runner did with an object, in the form used to
+// generate Kustomize output.
+type ObjectArtifacts struct {
+	// Artifact holds the patches of the object, from every plugin, so its
+	// PluginName is empty.
+	Artifact TransformArtifact
+	// NewResources has one artifact per resource created by the plugins.
+	// Its Resource is the skeleton of the new resource and its Patches add
+	// the rest, see SplitNewResourceToSkeletonAndPatch. PluginName is the
+	// plugin that created it.
+	NewResources []TransformArtifact
+	Warnings     []PluginWarning
+	Annotations  map[string]string
+}
+
+// RunArtifacts is like RunBatch, but returns the result for every object as
+// artifacts instead of marshaled patches. The artifacts are returned in the
+// same order as objects, along with the errors of RunBatch.
+func (r *Runner) RunArtifacts(ctx context.Context, objects []unstructured.Unstructured, plugins []Plugin) ([]ObjectArtifacts, error) {
+	responses, runErr := r.RunBatch(ctx, objects, plugins)
+	artifacts := make([]ObjectArtifacts, len(objects))
+	for i, response := range responses {
+		a, err := newObjectArtifacts(objects[i], response)
 		if err != nil {
-			return nil, nil, err
-		}
-		if foundOp, ok := patchMap[key]; ok {
-			currentPrio, currentOk := r.PluginPriorities[o.PluginName]
-			previousPrio, previousOk := r.PluginPriorities[foundOp.PluginName]
-			// replace value if current plugin is higher (lower int) priority than prior
-			replaceVal := currentOk && (!previousOk || currentPrio < previousPrio)
-			equalOp := ijsonpatch.EqualOperation(foundOp.Operation, o.Operation)
-			// Handle Collision
-			val, err := o.Operation.ValueInterface()
-			isMissing := err != nil && (errors.Cause(err) == jsonpatch.ErrMissing || strings.Contains(err.Error(), "missing value"))
-			if err != nil && !isMissing {
-				return nil, nil, err
+			return artifacts, err
+		}
+		artifacts[i] = a
+	}
+	return artifacts, runErr
+}
+
+func newObjectArtifacts(object unstructured.Unstructured, response RunnerResponse) (ObjectArtifacts, error) {
+	artifacts := ObjectArtifacts{
+		Artifact: TransformArtifact{
+			Resource:     object,
+			HaveWhiteOut: response.HaveWhiteOut,
+			IgnoredOps:   response.IgnoredOperations,
+			Target:       DeriveTargetFromResource(object),
+		},
+		NewResources: []TransformArtifact{},
+		Warnings:     response.Warnings,
+		Annotations:  response.Annotations,
+	}
+	if len(response.TransformFile) > 0 {
+		if err := json.Unmarshal(response.TransformFile, &artifacts.Artifact.Patches); err != nil {
+			return artifacts, errors.Wrapf(err, "invalid patches for %s %q", object.GroupVersionKind().GroupKind(), object.GetName())
+		}
+	}
+	for i, resource := range response.NewResources {
+		pluginName := ""
+		if i < len(response.newResourcePlugins) {
+			pluginName = response.newResourcePlugins[i]
+		}
+		skeleton, patches, err := SplitNewResourceToSkeletonAndPatch(resource)
+		if err != nil {
+			return artifacts, newObjectError(pluginName, object, errors.Wrap(err, "invalid new resource"))
+		}
+		artifact := TransformArtifact{
+			Resource:   skeleton,
+			Patches:    patches,
+			Target:     DeriveTargetFromResource(skeleton),
+			PluginName: pluginName,
+		}
+		artifacts.NewResources = append(artifacts.NewResources, artifact)
+	}
+	return artifacts, nil
+}
+
+func (r *Runner) workers(objects int) int {
+	workers := r.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if workers > objects {
+		workers = objects
+	}
+	return workers
+}
+
+func runPlugin(ctx context.Context, plugin Plugin, request PluginRequest) (PluginResponse, error) {
+	if p, ok := plugin.(PluginRunWithContext); ok {
+		return p.RunWithContext(ctx, request)
+	}
+	return plugin.Run(request)
+}
+
+// sanitizePatches removes duplicate patch operations as well as find
+// conflicting operations. Two operations from different plugins conflict when
+// they target the same path, when one changes a parent of the other's path, or
+// when one inserts or removes an array element that shifts the other's index.
+// The operation from the plugin with the higher priority is kept and the
+// others are returned as ignored; a plugin's own operations never conflict.
+// The returned patch is ordered by plugin priority, then by the order the
+// plugins ran in, and keeps each plugin's own operation order, so the same
+// input always produces the same patch.
+func (r *Runner) sanitizePatches(object unstructured.Unstructured, pluginOps []sourcedOperation) (jsonpatch.Patch, []IgnoredOperation, error) {
+	kept := make([]bool, len(pluginOps))
+	ignoredOps := []IgnoredOperation{}
+	for i, o := range pluginOps {
+		type conflict struct {
+			index  int
+			reason string
+		}
+		conflicts := []conflict{}
+		duplicate := false
+		for k, keptOp := range pluginOps[:i] {
+			if !kept[k] || keptOp.source == o.source {
+				continue
 			}
-			previousVal, err := foundOp.Operation.ValueInterface()
-			isPreviousMissing := err != nil && (errors.Cause(err) == jsonpatch.ErrMissing || strings.Contains(err.Error(), "missing value"))
-			if err != nil && !isPreviousMissing {
+			c, err := ijsonpatch.Conflicts(object.Object, keptOp.Operation, o.Operation)
+			if err != nil {
 				return nil, nil, err
 			}
-			if replaceVal {
-				patchMap[key] = o
-			}
-			if !equalOp {
-				var selectedVal, rejectedVal interface{}
-				var selectedPluginOp, rejectedPluginOp PluginOperation
-				if replaceVal {
-					selectedVal = val
-					rejectedVal = previousVal
-					selectedPluginOp = o
-					rejectedPluginOp = foundOp
-					ignoredPatches = append(ignoredPatches, foundOp)
-				} else {
-					selectedVal = previousVal
-					rejectedVal = val
-					selectedPluginOp = foundOp
-					rejectedPluginOp = o
-					ignoredPatches = append(ignoredPatches, o)
+			if c == ijsonpatch.NoConflict {
+				continue
+			}
+			if c == ijsonpatch.SamePath && ijsonpatch.EqualOperation(keptOp.Operation, o.Operation) {
+				duplicate = true
+				break
+			}
+			conflicts = append(conflicts, conflict{index: k, reason: conflictReason(c)})
+		}
+		if duplicate {
+			continue
+		}
+
+		// replace value if current plugin is higher (lower int) priority than all prior
+		replaceVal := true
+		for _, c := range conflicts {
+			if !r.hasPriorityOver(o.PluginName, pluginOps[c.index].PluginName) {
+				replaceVal = false
+				if err := r.logIgnoredOperation(pluginOps[c.index], o); err != nil {
+					return nil, nil, err
 				}
-				r.Log.Debugf("Operation on same path: %v with different kind or values selected kind, value: %v, %v (from plugin %v) kind, value that will be ignored: %v, %v (from plugin %v)",
-					key,
-					selectedPluginOp.Operation.Kind(),
-					selectedVal,
-					selectedPluginOp.PluginName,
-					rejectedPluginOp.Operation.Kind(),
-					rejectedVal,
-					rejectedPluginOp.PluginName,
-				)
+				ignoredOps = append(ignoredOps, IgnoredOperation{
+					Operation:    o.Operation,
+					Plugin:       o.PluginName,
+					Reason:       c.reason,
+					WinnerPlugin: pluginOps[c.index].PluginName,
+				})
+				break
 			}
+		}
+		if !replaceVal {
 			continue
 		}
-		patchMap[key] = o
+		for _, c := range conflicts {
+			if err := r.logIgnoredOperation(o, pluginOps[c.index]); err != nil {
+				return nil, nil, err
+			}
+			kept[c.index] = false
+			ignoredOps = append(ignoredOps, IgnoredOperation{
+				Operation:    pluginOps[c.index].Operation,
+				Plugin:       pluginOps[c.index].PluginName,
+				Reason:       c.reason,
+				WinnerPlugin: o.PluginName,
+			})
+		}
+		kept[i] = true
 	}
 
+	selected := []int{}
+	for i := range pluginOps {
+		if kept[i] {
+			selected = append(selected, i)
+		}
+	}
+	r.sortOperationIndexes(pluginOps, selected)
 	dedupedPatch := jsonpatch.Patch{}
+	for _, i := range selected {
+		dedupedPatch = append(dedupedPatch, pluginOps[i].Operation)
+	}
+	return dedupedPatch, ignoredOps, nil
+}
+
+func conflictReason(c ijsonpatch.Conflict) string {
+	switch c {
+	case ijsonpatch.ParentPath:
+		return IgnoredReasonParentPathConflict
+	case ijsonpatch.ArrayIndexShift:
+		return IgnoredReasonArrayIndexConflict
+	default:
+		return IgnoredReasonPathConflictPriority
+	}
+}
 
-	for _, p := range patchMap {
-		dedupedPatch = append(dedupedPatch, p.Operation)
+func (r *Runner) logIgnoredOperation(selected, rejected sourcedOperation) error {
+	selectedPath, err := selected.Operation.Path()
+	if err != nil {
+		return err
 	}
-	return dedupedPatch, ignoredPatches, nil
+	rejectedPath, err := rejected.Operation.Path()
+	if err != nil {
+		return err
+	}
+	selectedVal, err := operationValue(selected.Operation)
+	if err != nil {
+		return err
+	}
+	rejectedVal, err := operationValue(rejected.Operation)
+	if err != nil {
+		return err
+	}
+	r.Log.Debugf("Conflicting operations selected kind, path, value: %v, %v, %v (from plugin %v) kind, path, value that will be ignored: %v, %v, %v (from plugin %v)",
+		selected.Operation.Kind(),
+		selectedPath,
+		selectedVal,
+		selected.PluginName,
+		rejected.Operation.Kind(),
+		rejectedPath,
+		rejectedVal,
+		rejected.PluginName,
+	)
+	return nil
+}
+
+// operationValue returns the value of the operation, or nil for operations
+// like remove that do not carry one.
+func operationValue(operation jsonpatch.Operation) (interface{}, error) {
+	val, err := operation.ValueInterface()
+	isMissing := err != nil && (errors.Cause(err) == jsonpatch.ErrMissing || strings.Contains(err.Error(), "missing value"))
+	if err != nil && !isMissing {
+		return nil, err
+	}
+	return val, nil
+}
+
+// hasPriorityOver reports whether the current plugin outranks the previous
+// one. Only plugins listed in PluginPriorities can win; a lower value wins.
+func (r *Runner) hasPriorityOver(current, previous string) bool {
+	currentPrio, currentOk := r.PluginPriorities[current]
+	previousPrio, previousOk := r.PluginPriorities[previous]
+	return currentOk && (!previousOk || currentPrio < previousPrio)
+}
+
+// sortOperationIndexes sorts indexes into pluginOps so that plugins listed in
+// PluginPriorities come first, in priority order, followed by the remaining
+// plugins in the order they ran. Operations from the same plugin keep their
+// relative order.
+func (r *Runner) sortOperationIndexes(pluginOps []sourcedOperation, indexes []int) {
+	sort.SliceStable(indexes, func(a, b int) bool {
+		opA, opB := pluginOps[indexes[a]], pluginOps[indexes[b]]
+		if opA.source != opB.source {
+			if r.hasPriorityOver(opA.PluginName, opB.PluginName) {
+				return true
+			}
+			if r.hasPriorityOver(opB.PluginName, opA.PluginName) {
+				return false
+			}
+			return opA.source < opB.source
+		}
+		return indexes[a] < indexes[b]
+	})
 }
@@ -1,20 +1,33 @@
 package transform
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	jsonpatch "github.com/evanphx/json-patch"
+	transformerrors "github.com/konveyor/crane-lib/transform/errors"
 	internaljsonpatch "github.com/konveyor/crane-lib/transform/internal/jsonpatch"
 	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 type fakePlugin struct {
-	Func func(request PluginRequest) (PluginResponse, error)
-	name string
+	Func           func(request PluginRequest) (PluginResponse, error)
+	name           string
+	optionalFields []OptionalFields
+	capabilities   []Capability
+	// versions are the request versions of the plugin, SupportedVersions
+	// when nil.
+	versions []Version
 }
 
 func (fp fakePlugin) Run(request PluginRequest) (PluginResponse, error) {
@@ -22,7 +35,17 @@ func (fp fakePlugin) Run(request PluginRequest) (PluginResponse, error) {
 }
 
 func (fp fakePlugin) Metadata() PluginMetadata {
-	return PluginMetadata{Name: fp.name}
+	versions := fp.versions
+	if versions == nil {
+		versions = SupportedVersions
+	}
+	return PluginMetadata{
+		Name:            fp.name,
+		RequestVersion:  versions,
+		ResponseVersion: versions,
+		OptionalFields:  fp.optionalFields,
+		Capabilities:    fp.capabilities,
+	}
 }
 
 func TestRunnerRun(t *testing.T) {
@@ -284,26 +307,26 @@ func TestRunnerRun(t *testing.T) {
 			Plugins: []Plugin{
 				fakePlugin{
 					Func: func(request PluginRequest) (PluginResponse, error) {
-					p, err := jsonpatch.DecodePatch([]byte(`[{"op": "replace", "path": "/spec/testing", "value": "test"}]`))
-					if err != nil {
-						return PluginResponse{}, err
-					}
-					return PluginResponse{
-						Patches: p,
-					}, nil
-				},
+						p, err := jsonpatch.DecodePatch([]byte(`[{"op": "replace", "path": "/spec/testing", "value": "test"}]`))
+						if err != nil {
+							return PluginResponse{}, err
+						}
+						return PluginResponse{
+							Patches: p,
+						}, nil
+					},
 					name: "pluginreplace",
 				},
 				fakePlugin{
 					Func: func(request PluginRequest) (PluginResponse, error) {
-					p, err := jsonpatch.DecodePatch([]byte(`[{"op": "remove", "path": "/spec/testing"}]`))
-					if err != nil {
-						return PluginResponse{}, err
-					}
-					return PluginResponse{
-						Patches: p,
-					}, nil
-				},
+						p, err := jsonpatch.DecodePatch([]byte(`[{"op": "remove", "path": "/spec/testing"}]`))
+						if err != nil {
+							return PluginResponse{}, err
+						}
+						return PluginResponse{
+							Patches: p,
+						}, nil
+					},
 					name: "pluginremove",
 				},
 			},
@@ -318,14 +341,15 @@ func TestRunnerRun(t *testing.T) {
 					Func: func(request PluginRequest) (PluginResponse, error) {
 						extraVal := request.Extras["testFlag"]
 						p, err := jsonpatch.DecodePatch([]byte(`[{"op": "add", "path": "/spec/testing", "value": "` + extraVal + `"}]`))
-					if err != nil {
-						return PluginResponse{}, err
-					}
-					return PluginResponse{
-						Patches: p,
-					}, nil
-				},
-					name: "",
+						if err != nil {
+							return PluginResponse{}, err
+						}
+						return PluginResponse{
+							Patches: p,
+						}, nil
+					},
+					name:           "",
+					optionalFields: []OptionalFields{{FlagName: "testFlag"}},
 				},
 			},
 			OptionalFlags: map[string]string{
@@ -641,3 +665,1013 @@ func TestNewRunner(t *testing.T) {
 		}
 	})
 }
+
+type fakeContextPlugin struct {
+	fakePlugin
+	ContextFunc func(ctx context.Context, request PluginRequest) (PluginResponse, error)
+}
+
+func (fp fakeContextPlugin) RunWithContext(ctx context.Context, request PluginRequest) (PluginResponse, error) {
+	return fp.ContextFunc(ctx, request)
+}
+
+func namedObjects(count int) []unstructured.Unstructured {
+	objects := []unstructured.Unstructured{}
+	for i := 0; i < count; i++ {
+		u := unstructured.Unstructured{}
+		u.SetAPIVersion("v1")
+		u.SetKind("ConfigMap")
+		u.SetName(fmt.Sprintf("object-%d", i))
+		objects = append(objects, u)
+	}
+	return objects
+}
+
+func TestRunnerRunBatch(t *testing.T) {
+	t.Run("PreservesObjectOrder", func(t *testing.T) {
+		plugin := fakePlugin{
+			Func: func(request PluginRequest) (PluginResponse, error) {
+				// Finish later objects first to shake out ordering bugs.
+				var index int
+				fmt.Sscanf(request.GetName(), "object-%d", &index)
+				time.Sleep(time.Duration(50-index) * 100 * time.Microsecond)
+				p, err := jsonpatch.DecodePatch([]byte(`[{"op": "add", "path": "/metadata/labels/name", "value": "` + request.GetName() + `"}]`))
+				if err != nil {
+					return PluginResponse{}, err
+				}
+				return PluginResponse{Patches: p}, nil
+			},
+			name: "label",
+		}
+		runner := NewRunner(logrus.New(), nil, nil)
+		runner.Workers = 8
+		objects := namedObjects(50)
+		responses, err := runner.RunBatch(context.Background(), objects, []Plugin{plugin})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(responses) != len(objects) {
+			t.Fatalf("expected %d responses, got %d", len(objects), len(responses))
+		}
+		for i, response := range responses {
+			expected := `[{"op":"add","path":"/metadata/labels/name","value":"` + objects[i].GetName() + `"}]`
+			if string(response.TransformFile) != expected {
+				t.Errorf("response[%d]: expected %s, got %s", i, expected, string(response.TransformFile))
+			}
+		}
+	})
+
+	t.Run("BoundsConcurrency", func(t *testing.T) {
+		var running, maxRunning int32
+		plugin := fakePlugin{
+			Func: func(request PluginRequest) (PluginResponse, error) {
+				current := atomic.AddInt32(&running, 1)
+				defer atomic.AddInt32(&running, -1)
+				for {
+					seen := atomic.LoadInt32(&maxRunning)
+					if current <= seen || atomic.CompareAndSwapInt32(&maxRunning, seen, current) {
+						break
+					}
+				}
+				time.Sleep(time.Millisecond)
+				return PluginResponse{}, nil
+			},
+		}
+		runner := NewRunner(logrus.New(), nil, nil)
+		runner.Workers = 3
+		_, err := runner.RunBatch(context.Background(), namedObjects(30), []Plugin{plugin})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if maxRunning > 3 {
+			t.Errorf("expected at most 3 concurrent plugin runs, got %d", maxRunning)
+		}
+	})
+
+	t.Run("ReturnsFirstErrorInObjectOrder", func(t *testing.T) {
+		plugin := fakePlugin{
+			Func: func(request PluginRequest) (PluginResponse, error) {
+				switch request.GetName() {
+				case "object-3":
+					time.Sleep(5 * time.Millisecond)
+					return PluginResponse{}, fmt.Errorf("failed on object-3")
+				case "object-7":
+					return PluginResponse{}, fmt.Errorf("failed on object-7")
+				}
+				return PluginResponse{}, nil
+			},
+		}
+		runner := NewRunner(logrus.New(), nil, nil)
+		runner.Workers = 10
+		_, err := runner.RunBatch(context.Background(), namedObjects(10), []Plugin{plugin})
+		objErr := &transformerrors.ObjectError{}
+		if !errors.As(err, &objErr) || objErr.Name != "object-3" {
+			t.Errorf("expected error from object-3, got %v", err)
+		}
+	})
+
+	t.Run("StopsWhenContextIsCancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		var calls int32
+		plugin := fakeContextPlugin{
+			ContextFunc: func(ctx context.Context, request PluginRequest) (PluginResponse, error) {
+				if atomic.AddInt32(&calls, 1) == 2 {
+					cancel()
+				}
+				return PluginResponse{}, ctx.Err()
+			},
+		}
+		runner := NewRunner(logrus.New(), nil, nil)
+		runner.Workers = 1
+		responses, err := runner.RunBatch(ctx, namedObjects(20), []Plugin{plugin})
+		if err != context.Canceled {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+		if calls >= 20 {
+			t.Errorf("expected cancellation to skip remaining objects, got %d calls", calls)
+		}
+		for i, resp := range responses {
+			if string(resp.TransformFile) != "[]" || string(resp.IgnoredPatches) != "[]" {
+				t.Errorf("response %d of a skipped object = %q, %q, want empty patches", i, resp.TransformFile, resp.IgnoredPatches)
+			}
+		}
+	})
+
+	t.Run("EmptyBatch", func(t *testing.T) {
+		runner := NewRunner(logrus.New(), nil, nil)
+		responses, err := runner.RunBatch(context.Background(), nil, nil)
+		if err != nil || len(responses) != 0 {
+			t.Errorf("expected no responses and no error, got %v, %v", responses, err)
+		}
+	})
+}
+
+func TestRunnerErrorPolicy(t *testing.T) {
+	failing := fakePlugin{
+		Func: func(request PluginRequest) (PluginResponse, error) {
+			return PluginResponse{}, fmt.Errorf("failing plugin")
+		},
+		name: "failing",
+	}
+	patching := fakePlugin{
+		Func: func(request PluginRequest) (PluginResponse, error) {
+			p, err := jsonpatch.DecodePatch([]byte(`[{"op": "add", "path": "/spec/testing", "value": "test"}]`))
+			if err != nil {
+				return PluginResponse{}, err
+			}
+			return PluginResponse{Patches: p}, nil
+		},
+		name: "patching",
+	}
+	object := unstructured.Unstructured{}
+	object.SetAPIVersion("apps/v1")
+	object.SetKind("Deployment")
+	object.SetNamespace("foo")
+	object.SetName("bar")
+
+	cases := []struct {
+		Name             string
+		Policy           ErrorPolicy
+		IgnoreErrorsFrom []string
+		ExpectedErrors   int
+		PatchesString    string
+	}{
+		{
+			Name:           "FailFastByDefault",
+			ExpectedErrors: 1,
+			PatchesString:  `[]`,
+		},
+		{
+			Name:           "FailFast",
+			Policy:         ErrorPolicyFailFast,
+			ExpectedErrors: 1,
+			PatchesString:  `[]`,
+		},
+		{
+			Name:           "ContinueKeepsSuccessfulPatches",
+			Policy:         ErrorPolicyContinue,
+			ExpectedErrors: 2,
+			PatchesString:  `[{"op": "add", "path": "/spec/testing", "value": "test"}]`,
+		},
+		{
+			Name:             "IgnoredPluginErrors",
+			IgnoreErrorsFrom: []string{"failing"},
+			PatchesString:    `[{"op": "add", "path": "/spec/testing", "value": "test"}]`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			runner := NewRunner(logrus.New(), nil, nil)
+			runner.ErrorPolicy = c.Policy
+			runner.IgnoreErrorsFrom = c.IgnoreErrorsFrom
+			response, err := runner.Run(object, []Plugin{failing, patching, failing})
+
+			objErrs := transformerrors.ObjectErrors(err)
+			if len(objErrs) != c.ExpectedErrors {
+				t.Fatalf("expected %d errors, got %v", c.ExpectedErrors, err)
+			}
+			for _, objErr := range objErrs {
+				if objErr.Plugin != "failing" || objErr.GroupVersionKind.Kind != "Deployment" || objErr.Namespace != "foo" || objErr.Name != "bar" {
+					t.Errorf("error does not identify the plugin and object: %#v", objErr)
+				}
+			}
+			p, err := jsonpatch.DecodePatch([]byte(c.PatchesString))
+			if err != nil {
+				t.Fatal(err)
+			}
+			p2, err := jsonpatch.DecodePatch(response.TransformFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok, err := internaljsonpatch.Equal(p2, p); !ok || err != nil {
+				t.Errorf("incorrect patches, actual: %v expected: %v", string(response.TransformFile), c.PatchesString)
+			}
+		})
+	}
+
+	t.Run("FailFastSkipsRemainingPlugins", func(t *testing.T) {
+		called := false
+		after := fakePlugin{
+			Func: func(request PluginRequest) (PluginResponse, error) {
+				called = true
+				return PluginResponse{}, nil
+			},
+		}
+		runner := NewRunner(logrus.New(), nil, nil)
+		if _, err := runner.Run(object, []Plugin{failing, after}); err == nil {
+			t.Error("expected an error")
+		}
+		if called {
+			t.Error("plugin after the failing one should not run")
+		}
+	})
+
+	t.Run("BatchContinueAggregatesErrors", func(t *testing.T) {
+		runner := NewRunner(logrus.New(), nil, nil)
+		runner.ErrorPolicy = ErrorPolicyContinue
+		runner.Workers = 4
+		objects := namedObjects(5)
+		responses, err := runner.RunBatch(context.Background(), objects, []Plugin{failing, patching})
+		objErrs := transformerrors.ObjectErrors(err)
+		if len(objErrs) != len(objects) {
+			t.Fatalf("expected %d errors, got %v", len(objects), err)
+		}
+		for i, objErr := range objErrs {
+			if objErr.Name != objects[i].GetName() {
+				t.Errorf("error %d: expected object %s, got %s", i, objects[i].GetName(), objErr.Name)
+			}
+		}
+		for i, response := range responses {
+			if len(response.TransformFile) <= 2 {
+				t.Errorf("response %d: expected patches from the successful plugin", i)
+			}
+		}
+	})
+
+	t.Run("BatchContinueAggregatesAnalyzeErrors", func(t *testing.T) {
+		objects := namedObjects(3)
+		// The renamer fails to analyze the first object and renames the others.
+		renamer := fakePlugin{
+			name:         "renamer",
+			capabilities: []Capability{CapabilityRenames},
+			Func: func(request PluginRequest) (PluginResponse, error) {
+				if request.Context.Phase != PhaseAnalyze {
+					return PluginResponse{}, nil
+				}
+				if request.GetName() == objects[0].GetName() {
+					return PluginResponse{}, fmt.Errorf("failing analysis")
+				}
+				return PluginResponse{Renames: []Rename{{From: NewResourceReference(request.Unstructured), Name: request.GetName() + "-new"}}}, nil
+			},
+		}
+		runner := NewRunner(logrus.New(), nil, nil)
+		runner.ErrorPolicy = ErrorPolicyContinue
+
+		renames, err := runner.Analyze(context.Background(), objects, []Plugin{renamer})
+		if objErrs := transformerrors.ObjectErrors(err); len(objErrs) != 1 || objErrs[0].Name != objects[0].GetName() {
+			t.Fatalf("expected an analysis error for %s, got %v", objects[0].GetName(), err)
+		}
+		if len(renames) != 2 {
+			t.Errorf("expected the renames of the other objects, got %v", renames)
+		}
+
+		responses, err := runner.RunBatch(context.Background(), objects, []Plugin{renamer, failing})
+		objErrs := transformerrors.ObjectErrors(err)
+		wantErrs := []string{"renamer", "failing", "failing", "failing"}
+		if len(objErrs) != len(wantErrs) {
+			t.Fatalf("expected %d errors, got %v", len(wantErrs), err)
+		}
+		for i, objErr := range objErrs {
+			if objErr.Plugin != wantErrs[i] {
+				t.Errorf("error %d: expected plugin %s, got %s", i, wantErrs[i], objErr.Plugin)
+			}
+		}
+		for i, response := range responses {
+			want := `[]`
+			if i > 0 {
+				want = `[{"op":"replace","path":"/metadata/name","value":"` + objects[i].GetName() + `-new"}]`
+			}
+			if string(response.TransformFile) != want {
+				t.Errorf("response %d: incorrect patch, actual: %s expected: %s", i, response.TransformFile, want)
+			}
+		}
+	})
+}
+
+func patchPlugin(name, patch string) fakePlugin {
+	return fakePlugin{
+		Func: func(request PluginRequest) (PluginResponse, error) {
+			p, err := jsonpatch.DecodePatch([]byte(patch))
+			if err != nil {
+				return PluginResponse{}, err
+			}
+			return PluginResponse{Patches: p}, nil
+		},
+		name: name,
+	}
+}
+
+func TestRunnerPatchOrder(t *testing.T) {
+	cases := []struct {
+		Name             string
+		Plugins          []Plugin
+		PluginPriorities map[string]int
+		PatchesString    string
+	}{
+		{
+			Name: "KeepsPluginOrderWithoutPriorities",
+			Plugins: []Plugin{
+				patchPlugin("first", `[{"op": "add", "path": "/spec/b", "value": "b"}, {"op": "add", "path": "/spec/a", "value": "a"}]`),
+				patchPlugin("second", `[{"op": "remove", "path": "/spec/z"}, {"op": "add", "path": "/spec/y", "value": "y"}]`),
+			},
+			PatchesString: `[{"op":"add","path":"/spec/b","value":"b"},{"op":"add","path":"/spec/a","value":"a"},{"op":"remove","path":"/spec/z"},{"op":"add","path":"/spec/y","value":"y"}]`,
+		},
+		{
+			Name: "OrdersPluginsByPriority",
+			Plugins: []Plugin{
+				patchPlugin("unprioritized", `[{"op": "add", "path": "/spec/b", "value": "b"}, {"op": "add", "path": "/spec/a", "value": "a"}]`),
+				patchPlugin("low", `[{"op": "remove", "path": "/spec/z"}, {"op": "add", "path": "/spec/y", "value": "y"}]`),
+				patchPlugin("high", `[{"op": "add", "path": "/spec/c", "value": "c"}]`),
+			},
+			PluginPriorities: map[string]int{"high": 0, "low": 1},
+			PatchesString:    `[{"op":"add","path":"/spec/c","value":"c"},{"op":"remove","path":"/spec/z"},{"op":"add","path":"/spec/y","value":"y"},{"op":"add","path":"/spec/b","value":"b"},{"op":"add","path":"/spec/a","value":"a"}]`,
+		},
+		{
+			Name: "KeepsArrayAppendOrder",
+			Plugins: []Plugin{
+				patchPlugin("append", `[{"op": "remove", "path": "/spec/list/0"}, {"op": "add", "path": "/spec/list/-", "value": "one"}, {"op": "add", "path": "/spec/list/0", "value": "two"}]`),
+			},
+			PatchesString: `[{"op":"remove","path":"/spec/list/0"},{"op":"add","path":"/spec/list/-","value":"one"},{"op":"add","path":"/spec/list/0","value":"two"}]`,
+		},
+		{
+			Name: "WinningOperationMovesToWinningPlugin",
+			Plugins: []Plugin{
+				patchPlugin("low", `[{"op": "add", "path": "/spec/a", "value": "low"}, {"op": "add", "path": "/spec/b", "value": "b"}]`),
+				patchPlugin("high", `[{"op": "add", "path": "/spec/c", "value": "c"}, {"op": "add", "path": "/spec/a", "value": "high"}]`),
+			},
+			PluginPriorities: map[string]int{"high": 0},
+			PatchesString:    `[{"op":"add","path":"/spec/c","value":"c"},{"op":"add","path":"/spec/a","value":"high"},{"op":"add","path":"/spec/b","value":"b"}]`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			runner := NewRunner(logrus.New(), c.PluginPriorities, nil)
+			// Run several times to catch any dependency on map iteration order.
+			for i := 0; i < 20; i++ {
+				response, err := runner.Run(unstructured.Unstructured{}, c.Plugins)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(response.TransformFile) != c.PatchesString {
+					t.Fatalf("incorrect patch order, actual: %s expected: %s", string(response.TransformFile), c.PatchesString)
+				}
+			}
+		})
+	}
+}
+
+func TestRunnerPathConflicts(t *testing.T) {
+	cases := []struct {
+		Name              string
+		Plugins           []Plugin
+		PluginPriorities  map[string]int
+		PatchesString     string
+		IgnoredOperations []IgnoredOperation
+	}{
+		{
+			Name: "ParentRemovalWinsWithoutPriorities",
+			Plugins: []Plugin{
+				patchPlugin("templates", `[{"op": "remove", "path": "/spec/template"}]`),
+				patchPlugin("images", `[{"op": "replace", "path": "/spec/template/spec/containers/0/image", "value": "quay.io/foo"}]`),
+			},
+			PatchesString: `[{"op":"remove","path":"/spec/template"}]`,
+			IgnoredOperations: []IgnoredOperation{
+				{Plugin: "images", Reason: IgnoredReasonParentPathConflict, WinnerPlugin: "templates"},
+			},
+		},
+		{
+			Name: "ChildReplaceWinsWithPriority",
+			Plugins: []Plugin{
+				patchPlugin("templates", `[{"op": "remove", "path": "/spec/template"}]`),
+				patchPlugin("images", `[{"op": "replace", "path": "/spec/template/spec/containers/0/image", "value": "quay.io/foo"}]`),
+			},
+			PluginPriorities: map[string]int{"images": 0},
+			PatchesString:    `[{"op":"replace","path":"/spec/template/spec/containers/0/image","value":"quay.io/foo"}]`,
+			IgnoredOperations: []IgnoredOperation{
+				{Plugin: "templates", Reason: IgnoredReasonParentPathConflict, WinnerPlugin: "images"},
+			},
+		},
+		{
+			Name: "ArrayInsertShiftsIndex",
+			Plugins: []Plugin{
+				patchPlugin("sidecar", `[{"op": "add", "path": "/spec/containers/0", "value": {"name": "sidecar"}}]`),
+				patchPlugin("images", `[{"op": "replace", "path": "/spec/containers/0/image", "value": "quay.io/foo"}, {"op": "replace", "path": "/spec/initContainers/0/image", "value": "quay.io/bar"}]`),
+			},
+			PatchesString: `[{"op":"add","path":"/spec/containers/0","value":{"name":"sidecar"}},{"op":"replace","path":"/spec/initContainers/0/image","value":"quay.io/bar"}]`,
+			IgnoredOperations: []IgnoredOperation{
+				{Plugin: "images", Reason: IgnoredReasonArrayIndexConflict, WinnerPlugin: "sidecar"},
+			},
+		},
+		{
+			Name: "AppendsFromTwoPlugins",
+			Plugins: []Plugin{
+				patchPlugin("sidecar", `[{"op": "add", "path": "/spec/containers/-", "value": {"name": "sidecar"}}]`),
+				patchPlugin("proxy", `[{"op": "add", "path": "/spec/containers/-", "value": {"name": "proxy"}}]`),
+			},
+			PatchesString: `[{"op":"add","path":"/spec/containers/-","value":{"name":"sidecar"}},{"op":"add","path":"/spec/containers/-","value":{"name":"proxy"}}]`,
+		},
+		{
+			Name: "NumericObjectKeysHaveNoIndex",
+			Plugins: []Plugin{
+				patchPlugin("first", `[{"op": "add", "path": "/metadata/labels/0", "value": "b"}]`),
+				patchPlugin("second", `[{"op": "add", "path": "/metadata/labels/1", "value": "c"}]`),
+			},
+			PatchesString: `[{"op":"add","path":"/metadata/labels/0","value":"b"},{"op":"add","path":"/metadata/labels/1","value":"c"}]`,
+		},
+		{
+			Name: "WinnerReplacesEveryConflictingOperation",
+			Plugins: []Plugin{
+				patchPlugin("labels", `[{"op": "add", "path": "/spec/template/metadata/labels/app", "value": "foo"}]`),
+				patchPlugin("images", `[{"op": "replace", "path": "/spec/template/spec/containers/0/image", "value": "quay.io/foo"}]`),
+				patchPlugin("templates", `[{"op": "replace", "path": "/spec/template", "value": {}}]`),
+			},
+			PluginPriorities: map[string]int{"templates": 0},
+			PatchesString:    `[{"op":"replace","path":"/spec/template","value":{}}]`,
+			IgnoredOperations: []IgnoredOperation{
+				{Plugin: "labels", Reason: IgnoredReasonParentPathConflict, WinnerPlugin: "templates"},
+				{Plugin: "images", Reason: IgnoredReasonParentPathConflict, WinnerPlugin: "templates"},
+			},
+		},
+		{
+			Name: "SamePathRecordsPriorityReason",
+			Plugins: []Plugin{
+				patchPlugin("plugin1", `[{"op": "add", "path": "/spec/testing", "value": "test"}]`),
+				patchPlugin("plugin2", `[{"op": "add", "path": "/spec/testing", "value": "test1"}]`),
+			},
+			PatchesString: `[{"op":"add","path":"/spec/testing","value":"test"}]`,
+			IgnoredOperations: []IgnoredOperation{
+				{Plugin: "plugin2", Reason: IgnoredReasonPathConflictPriority, WinnerPlugin: "plugin1"},
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			runner := NewRunner(logrus.New(), c.PluginPriorities, nil)
+			object := unstructured.Unstructured{Object: map[string]interface{}{
+				"metadata": map[string]interface{}{"labels": map[string]interface{}{"0": "a"}},
+				"spec": map[string]interface{}{
+					"containers":     []interface{}{map[string]interface{}{"name": "app"}},
+					"initContainers": []interface{}{map[string]interface{}{"name": "init"}},
+				},
+			}}
+			response, err := runner.Run(object, c.Plugins)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(response.TransformFile) != c.PatchesString {
+				t.Errorf("incorrect patches, actual: %s expected: %s", string(response.TransformFile), c.PatchesString)
+			}
+			if len(response.IgnoredOperations) != len(c.IgnoredOperations) {
+				t.Fatalf("expected %d ignored operations, got %#v", len(c.IgnoredOperations), response.IgnoredOperations)
+			}
+			for i, expected := range c.IgnoredOperations {
+				actual := response.IgnoredOperations[i]
+				if actual.Plugin != expected.Plugin || actual.Reason != expected.Reason || actual.WinnerPlugin != expected.WinnerPlugin {
+					t.Errorf("ignored operation %d: expected %+v, got %+v", i, expected, actual)
+				}
+			}
+			ignoredPluginOperations := []PluginOperation{}
+			if err := json.Unmarshal(response.IgnoredPatches, &ignoredPluginOperations); err != nil {
+				t.Fatal(err)
+			}
+			if len(ignoredPluginOperations) != len(c.IgnoredOperations) {
+				t.Errorf("IgnoredPatches does not match IgnoredOperations: %s", string(response.IgnoredPatches))
+			}
+		})
+	}
+}
+
+func TestRunnerWhiteOutPolicy(t *testing.T) {
+	deployment := unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata": map[string]interface{}{
+				"name": "myapp",
+			},
+		},
+	}
+	convert := fakePlugin{
+		Func: func(request PluginRequest) (PluginResponse, error) {
+			return PluginResponse{
+				IsWhiteOut:   true,
+				NewResources: []unstructured.Unstructured{deployment},
+			}, nil
+		},
+		name: "dc-converter",
+	}
+	strip := patchPlugin("KubernetesPlugin", `[{"op": "remove", "path": "/status"}]`)
+
+	cases := []struct {
+		Name             string
+		Policy           WhiteOutPolicy
+		PluginPriorities map[string]int
+		IsWhiteOut       bool
+		PatchesString    string
+		IgnoredReasons   []string
+	}{
+		{
+			Name:           "AnyWhiteOutWinsByDefault",
+			IsWhiteOut:     true,
+			PatchesString:  `[]`,
+			IgnoredReasons: []string{IgnoredReasonWhiteOut},
+		},
+		{
+			Name:             "AnyWhiteOutIgnoresPriorities",
+			Policy:           WhiteOutPolicyAny,
+			PluginPriorities: map[string]int{"KubernetesPlugin": 0},
+			IsWhiteOut:       true,
+			PatchesString:    `[]`,
+			IgnoredReasons:   []string{IgnoredReasonWhiteOut},
+		},
+		{
+			Name:             "HigherPriorityPatchVetoesWhiteOut",
+			Policy:           WhiteOutPolicyPriority,
+			PluginPriorities: map[string]int{"KubernetesPlugin": 0, "dc-converter": 1},
+			PatchesString:    `[{"op":"remove","path":"/status"}]`,
+		},
+		{
+			Name:             "HigherPriorityWhiteOutStands",
+			Policy:           WhiteOutPolicyPriority,
+			PluginPriorities: map[string]int{"dc-converter": 0, "KubernetesPlugin": 1},
+			IsWhiteOut:       true,
+			PatchesString:    `[]`,
+			IgnoredReasons:   []string{IgnoredReasonWhiteOut},
+		},
+		{
+			Name:           "UnprioritizedPatchCannotVeto",
+			Policy:         WhiteOutPolicyPriority,
+			IsWhiteOut:     true,
+			PatchesString:  `[]`,
+			IgnoredReasons: []string{IgnoredReasonWhiteOut},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			runner := NewRunner(logrus.New(), c.PluginPriorities, nil)
+			runner.WhiteOutPolicy = c.Policy
+			response, err := runner.Run(unstructured.Unstructured{}, []Plugin{convert, strip})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if response.HaveWhiteOut != c.IsWhiteOut {
+				t.Errorf("incorrect white out determination, actual: %v expected: %v", response.HaveWhiteOut, c.IsWhiteOut)
+			}
+			if string(response.TransformFile) != c.PatchesString {
+				t.Errorf("incorrect patches, actual: %s expected: %s", string(response.TransformFile), c.PatchesString)
+			}
+			if len(response.NewResources) != 1 || response.NewResources[0].GetKind() != "Deployment" {
+				t.Errorf("expected the generated Deployment in both cases, got %v", response.NewResources)
+			}
+			if len(response.IgnoredOperations) != len(c.IgnoredReasons) {
+				t.Fatalf("expected %d ignored operations, got %#v", len(c.IgnoredReasons), response.IgnoredOperations)
+			}
+			for i, reason := range c.IgnoredReasons {
+				if response.IgnoredOperations[i].Reason != reason || response.IgnoredOperations[i].WinnerPlugin != "dc-converter" {
+					t.Errorf("ignored operation %d: expected reason %s from dc-converter, got %+v", i, reason, response.IgnoredOperations[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRunnerWarningsAndAnnotations(t *testing.T) {
+	plugin := func(name string, warnings []string, annotations map[string]string) fakePlugin {
+		return fakePlugin{
+			Func: func(request PluginRequest) (PluginResponse, error) {
+				return PluginResponse{IsWhiteOut: true, Warnings: warnings, Annotations: annotations}, nil
+			},
+			name: name,
+		}
+	}
+	plugins := []Plugin{
+		plugin("first", []string{"first warning"}, map[string]string{"shared": "first", "first": "only"}),
+		plugin("second", []string{"second warning"}, map[string]string{"shared": "second"}),
+	}
+
+	cases := []struct {
+		Name             string
+		PluginPriorities map[string]int
+		Annotations      map[string]string
+	}{
+		{
+			Name:        "FirstPluginWinsWithoutPriorities",
+			Annotations: map[string]string{"shared": "first", "first": "only"},
+		},
+		{
+			Name:             "HigherPriorityPluginWins",
+			PluginPriorities: map[string]int{"second": 0, "first": 1},
+			Annotations:      map[string]string{"shared": "second", "first": "only"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			response, err := NewRunner(logrus.New(), c.PluginPriorities, nil).Run(unstructured.Unstructured{}, plugins)
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantWarnings := []PluginWarning{
+				{PluginName: "first", Message: "first warning"},
+				{PluginName: "second", Message: "second warning"},
+			}
+			if !reflect.DeepEqual(response.Warnings, wantWarnings) {
+				t.Errorf("incorrect warnings, actual: %v expected: %v", response.Warnings, wantWarnings)
+			}
+			if !reflect.DeepEqual(response.Annotations, c.Annotations) {
+				t.Errorf("incorrect annotations, actual: %v expected: %v", response.Annotations, c.Annotations)
+			}
+		})
+	}
+}
+
+func TestRunnerRequestContext(t *testing.T) {
+	objects := namedObjects(3)
+	var mu sync.Mutex
+	contexts := map[string]*RequestContext{}
+	plugin := fakePlugin{
+		capabilities: []Capability{CapabilityResourceIndex},
+		Func: func(request PluginRequest) (PluginResponse, error) {
+			if request.Version != V2 {
+				t.Errorf("expected request version %v, got %v", V2, request.Version)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			contexts[request.GetName()] = request.Context
+			return PluginResponse{}, nil
+		},
+	}
+	// Plugins without CapabilityResourceIndex do not get the export.
+	withoutIndex := fakePlugin{
+		name: "withoutIndex",
+		Func: func(request PluginRequest) (PluginResponse, error) {
+			if request.Context.Resources != nil || request.Context.Index().Len() != 0 {
+				t.Errorf("%s: export sent to a plugin without %v", request.GetName(), CapabilityResourceIndex)
+			}
+			return PluginResponse{}, nil
+		},
+	}
+	runner := NewRunner(logrus.New(), nil, nil)
+	runner.SourceClusterVersion = "v1.21.0"
+	runner.TargetClusterVersion = "v1.27.0"
+	if _, err := runner.RunBatch(context.Background(), objects, []Plugin{plugin, withoutIndex}); err != nil {
+		t.Fatal(err)
+	}
+	want := &RequestContext{
+		SourceClusterVersion: "v1.21.0",
+		TargetClusterVersion: "v1.27.0",
+		Resources: []ResourceReference{
+			{APIVersion: "v1", Kind: "ConfigMap", Name: "object-0"},
+			{APIVersion: "v1", Kind: "ConfigMap", Name: "object-1"},
+			{APIVersion: "v1", Kind: "ConfigMap", Name: "object-2"},
+		},
+	}
+	for _, o := range objects {
+		got := contexts[o.GetName()]
+		if got.Index().Len() != len(objects) || !reflect.DeepEqual(got.Index().List(schema.GroupVersionKind{Kind: "ConfigMap"}, "", nil), objects) {
+			t.Errorf("%s: request context does not index the export", o.GetName())
+		}
+		// Plugins in the same process only see copies of the objects.
+		if got.Objects != nil {
+			t.Errorf("%s: request context shares the objects of the export", o.GetName())
+		}
+		forPlugin := PluginRequest{Context: got}.ForPlugin(V2, PluginMetadata{Capabilities: []Capability{CapabilityResourceIndex}})
+		if !reflect.DeepEqual(forPlugin.Context.Objects, objects) {
+			t.Errorf("%s: objects not sent to plugins in their own process: %v", o.GetName(), forPlugin.Context.Objects)
+		}
+		c := *got
+		c.index = nil
+		if !reflect.DeepEqual(&c, want) {
+			t.Errorf("%s: incorrect request context, actual: %+v expected: %+v", o.GetName(), &c, want)
+		}
+	}
+}
+
+func TestRunnerRequestVersion(t *testing.T) {
+	objects := namedObjects(1)
+	tests := []struct {
+		name        string
+		versions    []Version
+		want        Version
+		wantContext bool
+	}{
+		{name: "V2", versions: SupportedVersions, want: V2, wantContext: true},
+		{name: "V1", versions: []Version{V1}},
+		{name: "Unknown", versions: []Version{"v0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			analyzed := false
+			plugin := fakePlugin{
+				name:         "plugin",
+				versions:     tt.versions,
+				capabilities: []Capability{CapabilityRenames},
+				Func: func(request PluginRequest) (PluginResponse, error) {
+					if request.Version != tt.want {
+						t.Errorf("expected request version %q, got %q", tt.want, request.Version)
+					}
+					if (request.Context != nil) != tt.wantContext {
+						t.Errorf("request context sent: %v, want %v", request.Context != nil, tt.wantContext)
+					}
+					if request.Context != nil && request.Context.Phase == PhaseAnalyze {
+						analyzed = true
+					}
+					return PluginResponse{}, nil
+				},
+			}
+			runner := NewRunner(logrus.New(), nil, nil)
+			if _, err := runner.RunBatch(context.Background(), objects, []Plugin{plugin}); err != nil {
+				t.Fatal(err)
+			}
+			if analyzed != tt.wantContext {
+				t.Errorf("plugin analyzed: %v, want %v", analyzed, tt.wantContext)
+			}
+		})
+	}
+}
+
+func TestRunnerOptionalFields(t *testing.T) {
+	fields := []OptionalFields{
+		{FlagName: "enabled", Type: OptionalFieldBool, Default: "true"},
+		{FlagName: "mode", Type: OptionalFieldEnum, Enum: []string{"fast", "safe"}, Required: true},
+	}
+	tests := []struct {
+		name       string
+		flags      map[string]string
+		wantExtras map[string]string
+		wantErr    string
+	}{
+		{
+			name:       "DefaultApplied",
+			flags:      map[string]string{"mode": "fast", "other": "value"},
+			wantExtras: map[string]string{"enabled": "true", "mode": "fast"},
+		},
+		{
+			name:       "ValueKept",
+			flags:      map[string]string{"enabled": "false", "mode": "safe"},
+			wantExtras: map[string]string{"enabled": "false", "mode": "safe"},
+		},
+		{
+			name:    "Missing",
+			flags:   map[string]string{},
+			wantErr: "mode",
+		},
+		{
+			name:    "Invalid",
+			flags:   map[string]string{"enabled": "maybe", "mode": "fast"},
+			wantErr: "enabled",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotExtras map[string]string
+			calls := int32(0)
+			plugin := fakePlugin{
+				name:           "options",
+				optionalFields: fields,
+				Func: func(request PluginRequest) (PluginResponse, error) {
+					atomic.AddInt32(&calls, 1)
+					gotExtras = request.Extras
+					return PluginResponse{}, nil
+				},
+			}
+			runner := NewRunner(logrus.New(), nil, tt.flags)
+			responses, err := runner.RunBatch(context.Background(), namedObjects(2), []Plugin{plugin})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if !reflect.DeepEqual(gotExtras, tt.wantExtras) {
+					t.Errorf("incorrect extras, actual: %v expected: %v", gotExtras, tt.wantExtras)
+				}
+				return
+			}
+			optErr := &transformerrors.OptionError{}
+			if !errors.As(err, &optErr) || optErr.Plugin != "options" || optErr.FlagName != tt.wantErr {
+				t.Errorf("expected an option error for %q, got: %v", tt.wantErr, err)
+			}
+			if calls != 0 {
+				t.Errorf("expected no object to be processed, got %d plugin calls", calls)
+			}
+			if len(responses) != 2 || string(responses[0].TransformFile) != "[]" || string(responses[0].IgnoredPatches) != "[]" {
+				t.Errorf("expected empty responses, got %v", responses)
+			}
+		})
+	}
+}
+
+func TestRunnerScopedOptionalFlags(t *testing.T) {
+	extras := map[string]map[string]string{}
+	newPlugin := func(name string, flags ...string) Plugin {
+		fields := []OptionalFields{}
+		for _, flag := range flags {
+			fields = append(fields, OptionalFields{FlagName: flag})
+		}
+		return fakePlugin{
+			name:           name,
+			optionalFields: fields,
+			Func: func(request PluginRequest) (PluginResponse, error) {
+				extras[name] = request.Extras
+				return PluginResponse{}, nil
+			},
+		}
+	}
+	plugins := []Plugin{
+		newPlugin("first", "registry-replacement", "verbose"),
+		newPlugin("second", "registry-replacement"),
+		newPlugin("third.v2", "registry-replacement"),
+	}
+	logger, hook := test.NewNullLogger()
+	runner := NewRunner(logger, nil, map[string]string{
+		"registry-replacement":          "a=b",
+		"second.registry-replacement":   "c=d",
+		"third.v2.registry-replacement": "e=f",
+		"verbose":                       "true",
+		"second.verbose":                "true",
+		"unknown":                       "value",
+	})
+	for i := 0; i < 2; i++ {
+		if _, err := runner.Run(unstructured.Unstructured{}, plugins); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := map[string]map[string]string{
+		"first":    {"registry-replacement": "a=b", "verbose": "true"},
+		"second":   {"registry-replacement": "c=d"},
+		"third.v2": {"registry-replacement": "e=f"},
+	}
+	if !reflect.DeepEqual(extras, want) {
+		t.Errorf("incorrect extras, actual: %v expected: %v", extras, want)
+	}
+	warnings := []string{}
+	for _, entry := range hook.AllEntries() {
+		if entry.Level == logrus.WarnLevel {
+			warnings = append(warnings, entry.Message)
+		}
+	}
+	wantWarnings := []string{
+		`Ignoring flag "second.verbose": plugin "second" does not declare "verbose"`,
+		`Ignoring flag "unknown": no plugin declares it`,
+	}
+	if !reflect.DeepEqual(warnings, wantWarnings) {
+		t.Errorf("incorrect warnings, actual: %q expected: %q", warnings, wantWarnings)
+	}
+}
+
+func TestRunnerResourceIndex(t *testing.T) {
+	deployment := unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "app", "namespace": "ns"},
+	}}
+	service := unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Service",
+		"metadata":   map[string]interface{}{"name": "app", "namespace": "ns"},
+	}}
+	var mu sync.Mutex
+	found := map[string]bool{}
+	plugin := fakePlugin{
+		capabilities: []Capability{CapabilityResourceIndex},
+		Func: func(request PluginRequest) (PluginResponse, error) {
+			_, ok := request.Context.Index().Get(schema.GroupVersionKind{Group: "apps", Kind: "Deployment"}, "ns", "app")
+			mu.Lock()
+			defer mu.Unlock()
+			found[request.GetKind()] = ok
+			return PluginResponse{}, nil
+		},
+	}
+	runner := NewRunner(logrus.New(), nil, nil)
+	if _, err := runner.RunBatch(context.Background(), []unstructured.Unstructured{deployment, service}, []Plugin{plugin}); err != nil {
+		t.Fatal(err)
+	}
+	if !found["Deployment"] || !found["Service"] {
+		t.Errorf("expected every object to see the deployment in the index, got %v", found)
+	}
+	// Run has no export to index.
+	if _, err := runner.Run(service, []Plugin{plugin}); err != nil {
+		t.Fatal(err)
+	}
+	if found["Service"] {
+		t.Errorf("expected an empty index when running a single object")
+	}
+}
+
+func TestRunnerRunArtifacts(t *testing.T) {
+	deployment := unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "app", "namespace": "ns"},
+		"spec":       map[string]interface{}{},
+	}}
+	secret := unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   map[string]interface{}{"name": "token", "namespace": "ns"},
+	}}
+	patcher := fakePlugin{
+		name: "patcher",
+		Func: func(request PluginRequest) (PluginResponse, error) {
+			if request.GetKind() == "Secret" {
+				return PluginResponse{IsWhiteOut: true}, nil
+			}
+			p, err := jsonpatch.DecodePatch([]byte(`[{"op": "add", "path": "/spec/replicas", "value": 2}]`))
+			return PluginResponse{Patches: p, Warnings: []string{"scaled"}}, err
+		},
+	}
+	creator := fakePlugin{
+		name: "creator",
+		Func: func(request PluginRequest) (PluginResponse, error) {
+			if request.GetKind() != "Deployment" {
+				return PluginResponse{}, nil
+			}
+			return PluginResponse{NewResources: []unstructured.Unstructured{{Object: map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "Service",
+				"metadata": map[string]interface{}{
+					"name":      "app",
+					"namespace": "ns",
+					"labels":    map[string]interface{}{"app": "app"},
+				},
+			}}}}, nil
+		},
+	}
+
+	runner := NewRunner(logrus.New(), nil, nil)
+	artifacts, err := runner.RunArtifacts(context.Background(), []unstructured.Unstructured{deployment, secret}, []Plugin{patcher, creator})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(artifacts) != 2 {
+		t.Fatalf("expected 2 artifacts, got %d", len(artifacts))
+	}
+
+	a := artifacts[0]
+	if !reflect.DeepEqual(a.Artifact.Resource, deployment) {
+		t.Errorf("expected the original object as resource, got %v", a.Artifact.Resource)
+	}
+	wantTarget := PatchTarget{Group: "apps", Version: "v1", Kind: "Deployment", Name: "app", Namespace: "ns"}
+	if a.Artifact.Target != wantTarget {
+		t.Errorf("expected target %+v, got %+v", wantTarget, a.Artifact.Target)
+	}
+	if a.Artifact.HaveWhiteOut || a.Artifact.PluginName != "" {
+		t.Errorf("unexpected artifact %+v", a.Artifact)
+	}
+	wantPatch, _ := jsonpatch.DecodePatch([]byte(`[{"op": "add", "path": "/spec/replicas", "value": 2}]`))
+	if ok, _ := internaljsonpatch.Equal(a.Artifact.Patches, wantPatch); !ok {
+		t.Errorf("expected patches %v, got %v", wantPatch, a.Artifact.Patches)
+	}
+	if !reflect.DeepEqual(a.Warnings, []PluginWarning{{PluginName: "patcher", Message: "scaled"}}) {
+		t.Errorf("unexpected warnings %v", a.Warnings)
+	}
+	if len(a.NewResources) != 1 {
+		t.Fatalf("expected 1 new resource, got %d", len(a.NewResources))
+	}
+	n := a.NewResources[0]
+	if n.PluginName != "creator" {
+		t.Errorf("expected the new resource to come from creator, got %q", n.PluginName)
+	}
+	if _, ok := n.Resource.Object["metadata"].(map[string]interface{})["labels"]; ok {
+		t.Errorf("expected a skeleton, got %v", n.Resource.Object)
+	}
+	if n.Target.Kind != "Service" || n.Target.Name != "app" {
+		t.Errorf("unexpected target %+v", n.Target)
+	}
+	wantNewPatch, _ := jsonpatch.DecodePatch([]byte(`[{"op": "add", "path": "/metadata/labels", "value": {"app": "app"}}]`))
+	if ok, _ := internaljsonpatch.Equal(n.Patches, wantNewPatch); !ok {
+		t.Errorf("expected patches %v, got %v", wantNewPatch, n.Patches)
+	}
+
+	if !artifacts[1].Artifact.HaveWhiteOut || len(artifacts[1].NewResources) != 0 {
+		t.Errorf("expected the secret to be whited out, got %+v", artifacts[1])
+	}
+}
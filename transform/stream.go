@@ -0,0 +1,118 @@
+package transform
+
+import (
+	transformerrors "github.com/konveyor/crane-lib/transform/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// The streaming protocol lets a plugin process many objects. The runner
+// starts the plugin once and writes StreamRequest followed by newline
+// delimited StreamFrames on its stdin. The plugin answers every frame but
+// shutdown with a frame carrying the same ID on its stdout. Responses may be
+// sent in any order. The plugin exits after a shutdown frame or when its stdin
+// is closed.
+const (
+	// StreamVersionKey is the only key of StreamRequest.
+	StreamVersionKey = "streamVersion"
+	// StreamRequest is the first line sent to a plugin started in streaming
+	// mode.
+	StreamRequest = `{"` + StreamVersionKey + `":"v1"}`
+)
+
+type StreamFrameType string
+
+const (
+	// StreamFrameRequest carries a Request, answered by a StreamFrameResponse
+	// or a StreamFrameError.
+	StreamFrameRequest  StreamFrameType = "request"
+	StreamFrameResponse StreamFrameType = "response"
+	StreamFrameError    StreamFrameType = "error"
+	// StreamFrameHealth is echoed back by a healthy plugin.
+	StreamFrameHealth StreamFrameType = "health"
+	// StreamFrameShutdown asks the plugin to exit. It is not answered.
+	StreamFrameShutdown StreamFrameType = "shutdown"
+	// StreamFrameObjects carries the objects of the export for the request
+	// frames that follow it, which are sent without them, see
+	// StreamObjects. It is not answered.
+	StreamFrameObjects StreamFrameType = "objects"
+)
+
+// StreamFrame is a single message of the streaming protocol.
+type StreamFrame struct {
+	ID       uint64                       `json:"id"`
+	Type     StreamFrameType              `json:"type"`
+	Request  *PluginRequest               `json:"request,omitempty"`
+	Response *PluginResponse              `json:"response,omitempty"`
+	Error    *transformerrors.PluginError `json:"error,omitempty"`
+	Objects  []unstructured.Unstructured  `json:"objects,omitempty"`
+}
+
+// StreamObjects sends the objects of the export once per stream rather than
+// with every request, along with the Resources referencing them. The runner passes the frames it writes through Frames,
+// and the plugin hands the objects frames it reads to Receive and the
+// requests to Restore. The frames must go through it in the order they are
+// written, it is not safe for concurrent use. The zero value is ready to use.
+type StreamObjects struct {
+	objects   []unstructured.Unstructured
+	resources []ResourceReference
+	index     *ResourceIndex
+}
+
+// Frames returns the frames to write for frame: a StreamFrameObjects frame
+// when the objects of its request are not the ones sent last, followed by
+// frame with a request that carries neither them nor the Resources.
+func (s *StreamObjects) Frames(frame StreamFrame) []StreamFrame {
+	if frame.Type != StreamFrameRequest || frame.Request == nil || frame.Request.Context == nil {
+		return []StreamFrame{frame}
+	}
+	frames := []StreamFrame{}
+	c := *frame.Request.Context
+	if !sameObjects(c.Objects, s.objects) {
+		s.objects = c.Objects
+		frames = append(frames, StreamFrame{Type: StreamFrameObjects, Objects: c.Objects})
+	}
+	if len(c.Objects) > 0 {
+		// The plugin rebuilds the Resources from the objects.
+		c.Resources = nil
+	}
+	c.Objects = nil
+	request := *frame.Request
+	request.Context = &c
+	frame.Request = &request
+	return append(frames, frame)
+}
+
+// sameObjects tells whether a and b are the same slice, as the objects of
+// the export the Runner indexed are.
+func sameObjects(a, b []unstructured.Unstructured) bool {
+	return len(a) == len(b) && (len(a) == 0 || &a[0] == &b[0])
+}
+
+// Receive keeps the objects of a StreamFrameObjects frame, and indexes them
+// once for the requests that follow.
+func (s *StreamObjects) Receive(objects []unstructured.Unstructured) {
+	s.objects = objects
+	s.resources = nil
+	s.index = nil
+	if len(objects) > 0 {
+		s.index = NewResourceIndex(objects)
+		for _, o := range objects {
+			s.resources = append(s.resources, NewResourceReference(o))
+		}
+	}
+}
+
+// Restore adds the objects received last, and the Resources referencing
+// them, to the context of request.
+func (s *StreamObjects) Restore(request *PluginRequest) {
+	if request.Context == nil || len(request.Context.Objects) > 0 || s.index == nil {
+		return
+	}
+	c := *request.Context
+	c.Objects = s.objects
+	c.index = s.index
+	if c.Resources == nil {
+		c.Resources = s.resources
+	}
+	request.Context = &c
+}
@@ -0,0 +1,84 @@
+package transform
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestStreamObjects(t *testing.T) {
+	objects := namedObjects(3)
+	withIndex := PluginMetadata{Capabilities: []Capability{CapabilityResourceIndex}}
+	batch := func(objects []unstructured.Unstructured) *RequestContext {
+		return (&Runner{}).requestContext(objects)
+	}
+	first, second := batch(objects), batch(objects[:2])
+	sender := StreamObjects{}
+	receiver := StreamObjects{}
+	tests := []struct {
+		name        string
+		context     *RequestContext
+		wantObjects bool
+		wantLen     int
+	}{
+		{name: "FirstRequest", context: first, wantObjects: true, wantLen: 3},
+		{name: "SameExport", context: first, wantLen: 3},
+		{name: "NoContext", wantLen: 0},
+		{name: "OtherExport", context: second, wantObjects: true, wantLen: 2},
+		{name: "NoObjects", context: &RequestContext{}, wantObjects: true, wantLen: 0},
+		{name: "NoObjectsAgain", context: &RequestContext{}, wantLen: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := PluginRequest{Unstructured: objects[0], Context: tt.context}.ForPlugin(V2, withIndex)
+			frames := sender.Frames(StreamFrame{ID: 1, Type: StreamFrameRequest, Request: &request})
+			if len(frames) == 0 || (frames[0].Type == StreamFrameObjects) != tt.wantObjects {
+				t.Fatalf("Frames() = %+v, want an objects frame: %v", frames, tt.wantObjects)
+			}
+			if tt.wantLen > 0 && request.Context.Objects == nil {
+				t.Errorf("Frames() modified the request")
+			}
+
+			var rawRequest []byte
+			for _, frame := range frames {
+				// Frames go through the wire as the plugin reads them.
+				b, err := json.Marshal(frame)
+				if err != nil {
+					t.Fatal(err)
+				}
+				decoded := StreamFrame{}
+				if err := json.Unmarshal(b, &decoded); err != nil {
+					t.Fatal(err)
+				}
+				switch decoded.Type {
+				case StreamFrameObjects:
+					receiver.Receive(decoded.Objects)
+				case StreamFrameRequest:
+					if decoded.Request.Context != nil && (decoded.Request.Context.Objects != nil || decoded.Request.Context.Resources != nil) {
+						t.Errorf("request sent with its objects")
+					}
+					rawRequest, _ = json.Marshal(decoded.Request)
+				}
+			}
+			got := PluginRequest{}
+			if err := json.Unmarshal(rawRequest, &got); err != nil {
+				t.Fatal(err)
+			}
+			receiver.Restore(&got)
+			if got.Context == nil {
+				if tt.context != nil {
+					t.Errorf("restored request has no context")
+				}
+				return
+			}
+			if got.Context.Index().Len() != tt.wantLen || len(got.Context.Objects) != tt.wantLen {
+				t.Errorf("restored request has %d objects, want %d", got.Context.Index().Len(), tt.wantLen)
+			}
+			if !reflect.DeepEqual(got.Context.Resources, tt.context.Resources) {
+				t.Errorf("restored request has resources %v, want %v", got.Context.Resources, tt.context.Resources)
+			}
+		})
+	}
+}
@@ -23,7 +23,8 @@ type TransformArtifact struct {
 	// Target contains the Kustomize patch target metadata
 	Target PatchTarget
 
-	// PluginName is the name of the plugin that generated this artifact (for multi-stage)
+	// PluginName is the name of the plugin that generated this artifact (for multi-stage).
+	// Artifacts of a Pipeline carry the name of their stage.
 	PluginName string
 }
 
@@ -62,6 +63,25 @@ type IgnoredOperation struct {
 	WinnerPlugin string
 }
 
+// Reasons recorded in IgnoredOperation.Reason
+const (
+	// IgnoredReasonPathConflictPriority is used when a higher priority plugin
+	// changed the same path
+	IgnoredReasonPathConflictPriority = "path-conflict-priority"
+
+	// IgnoredReasonParentPathConflict is used when a higher priority plugin
+	// changed a parent or a child of the path
+	IgnoredReasonParentPathConflict = "path-conflict-parent"
+
+	// IgnoredReasonArrayIndexConflict is used when a higher priority plugin
+	// inserted or removed an array element that shifts the index in the path
+	IgnoredReasonArrayIndexConflict = "path-conflict-array-index"
+
+	// IgnoredReasonWhiteOut is used when the resource was whited out, so none
+	// of the patches apply
+	IgnoredReasonWhiteOut = "whiteout"
+)
+
 // ResourceGroup represents resources grouped by type (kind + group)
 // for multi-doc YAML file generation
 type ResourceGroup struct {
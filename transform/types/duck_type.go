@@ -5,6 +5,7 @@ import (
 
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 func IsPodSpecable(u unstructured.Unstructured) (*v1.PodTemplateSpec, bool) {
@@ -42,6 +43,36 @@ func IsPodSpecable(u unstructured.Unstructured) (*v1.PodTemplateSpec, bool) {
 	return &template, true
 }
 
+// podSpecPaths maps the kinds with a pod template to the path of their
+// PodSpec. Plugins take the paths of other kinds as options, such as the
+// pod-spec-paths option of the kubernetes plugin.
+var podSpecPaths = map[schema.GroupKind][]string{
+	{Group: "", Kind: "Pod"}:                               {"spec"},
+	{Group: "", Kind: "PodTemplate"}:                       {"template", "spec"},
+	{Group: "", Kind: "ReplicationController"}:             {"spec", "template", "spec"},
+	{Group: "apps", Kind: "DaemonSet"}:                     {"spec", "template", "spec"},
+	{Group: "apps", Kind: "Deployment"}:                    {"spec", "template", "spec"},
+	{Group: "apps", Kind: "ReplicaSet"}:                    {"spec", "template", "spec"},
+	{Group: "apps", Kind: "StatefulSet"}:                   {"spec", "template", "spec"},
+	{Group: "batch", Kind: "Job"}:                          {"spec", "template", "spec"},
+	{Group: "batch", Kind: "CronJob"}:                      {"spec", "jobTemplate", "spec", "template", "spec"},
+	{Group: "apps.openshift.io", Kind: "DeploymentConfig"}: {"spec", "template", "spec"},
+	{Group: "argoproj.io", Kind: "Rollout"}:                {"spec", "template", "spec"},
+}
+
+// PodSpecPath returns the path to the PodSpec of an object: the path known
+// for its kind, such as the spec of a Pod or the job template of a CronJob,
+// or the pod template of any other object with a spec.template.
+func PodSpecPath(u unstructured.Unstructured) ([]string, bool) {
+	if path, ok := podSpecPaths[u.GroupVersionKind().GroupKind()]; ok {
+		return append([]string{}, path...), true
+	}
+	if _, ok := IsPodSpecable(u); ok {
+		return []string{"spec", "template", "spec"}, true
+	}
+	return nil, false
+}
+
 func HasStatusObject(u unstructured.Unstructured) (bool, error) {
 	status, ok := u.UnstructuredContent()["status"]
 	if !ok {
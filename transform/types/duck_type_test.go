@@ -2,6 +2,7 @@ package types_test
 
 import (
 	"fmt"
+	"reflect"
 	"testing"
 
 	"github.com/konveyor/crane-lib/transform/types"
@@ -178,3 +179,54 @@ func TestHasStatusObject(t *testing.T) {
 	}
 
 }
+
+func TestPodSpecPath(t *testing.T) {
+	cases := []struct {
+		Name   string
+		Object unstructured.Unstructured
+		Path   []string
+	}{
+		{
+			Name:   "Pod",
+			Object: unstructured.Unstructured{Object: map[string]interface{}{"apiVersion": "v1", "kind": "Pod"}},
+			Path:   []string{"spec"},
+		},
+		{
+			Name:   "CronJob",
+			Object: unstructured.Unstructured{Object: map[string]interface{}{"apiVersion": "batch/v1", "kind": "CronJob"}},
+			Path:   []string{"spec", "jobTemplate", "spec", "template", "spec"},
+		},
+		{
+			Name:   "Deployment",
+			Object: deploymentToUnstructured(),
+			Path:   []string{"spec", "template", "spec"},
+		},
+		{
+			Name:   "DeploymentConfig",
+			Object: unstructured.Unstructured{Object: map[string]interface{}{"apiVersion": "apps.openshift.io/v1", "kind": "DeploymentConfig"}},
+			Path:   []string{"spec", "template", "spec"},
+		},
+		{
+			Name:   "Rollout",
+			Object: unstructured.Unstructured{Object: map[string]interface{}{"apiVersion": "argoproj.io/v1alpha1", "kind": "Rollout"}},
+			Path:   []string{"spec", "template", "spec"},
+		},
+		{
+			Name:   "PodTemplate",
+			Object: unstructured.Unstructured{Object: map[string]interface{}{"apiVersion": "v1", "kind": "PodTemplate"}},
+			Path:   []string{"template", "spec"},
+		},
+		{
+			Name:   "ConfigMap",
+			Object: unstructured.Unstructured{Object: map[string]interface{}{"apiVersion": "v1", "kind": "ConfigMap"}},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			path, ok := types.PodSpecPath(c.Object)
+			if ok != (c.Path != nil) || !reflect.DeepEqual(path, c.Path) {
+				t.Errorf("PodSpecPath() = %v, %v, want %v", path, ok, c.Path)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/distribution/reference"
+	"github.com/opencontainers/go-digest"
+)
+
+// dockerLibrary is the repository of the official Docker Hub images, such as
+// nginx.
+const dockerLibrary = "docker.io/library"
+
+// ImageRewriter rewrites container image references. References are parsed
+// and normalized first, so that nginx:1.25 is docker.io/library/nginx:1.25,
+// and rewritten references are fully qualified.
+type ImageRewriter struct {
+	registryMap map[string]string
+	digests     map[string]digest.Digest
+}
+
+// NewImageRewriter returns the ImageRewriter applying these rules:
+//
+//   - registryMap maps registries, optionally followed by the first
+//     components of the repository path, to their replacement, keeping the
+//     tag and the digest of the image. The longest match wins, and matches
+//     are made of whole components: quay.io/foo matches quay.io/foo/app but
+//     not quay.io/foobar/app.
+//   - libraryRepository, if set, replaces docker.io/library, the repository
+//     of the official Docker Hub images.
+//   - digests pins tagged images to a digest, replacing the tag. The keys are
+//     image references, with latest as tag if they have none, and the values
+//     digests such as sha256:<hex>. Images with a digest are left alone.
+func NewImageRewriter(registryMap map[string]string, libraryRepository string, digests map[string]string) (*ImageRewriter, error) {
+	r := &ImageRewriter{registryMap: map[string]string{}, digests: map[string]digest.Digest{}}
+	for source, target := range registryMap {
+		if err := validateRepositoryPrefix(target); err != nil {
+			return nil, fmt.Errorf("invalid replacement %q of %q: %w", target, source, err)
+		}
+		r.registryMap[source] = target
+	}
+	if libraryRepository != "" {
+		if err := validateRepositoryPrefix(libraryRepository); err != nil {
+			return nil, fmt.Errorf("invalid replacement %q of %q: %w", libraryRepository, dockerLibrary, err)
+		}
+		r.registryMap[dockerLibrary] = libraryRepository
+	}
+	for image, value := range digests {
+		named, err := reference.ParseNormalizedNamed(image)
+		if err != nil {
+			return nil, fmt.Errorf("invalid image %q: %w", image, err)
+		}
+		if _, ok := named.(reference.Digested); ok {
+			return nil, fmt.Errorf("invalid image %q: already has a digest", image)
+		}
+		d, err := digest.Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid digest %q of %q: %w", value, image, err)
+		}
+		r.digests[reference.TagNameOnly(named).String()] = d
+	}
+	return r, nil
+}
+
+// validateRepositoryPrefix checks that prefix, such as a registry host and
+// port, can start the name of a repository.
+func validateRepositoryPrefix(prefix string) error {
+	_, err := reference.WithName(prefix + "/image")
+	return err
+}
+
+// Rewrite returns the reference replacing image, and false if no rule
+// applies to it or it can not be parsed.
+func (r *ImageRewriter) Rewrite(image string) (string, bool) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", false
+	}
+	name, changed := r.mapName(named.Name())
+	var tag string
+	if tagged, ok := named.(reference.Tagged); ok {
+		tag = tagged.Tag()
+	}
+	var d digest.Digest
+	if digested, ok := named.(reference.Digested); ok {
+		d = digested.Digest()
+	} else if pinned, ok := r.digests[reference.TagNameOnly(named).String()]; ok {
+		d, tag, changed = pinned, "", true
+	}
+	if !changed {
+		return "", false
+	}
+
+	rewritten, err := reference.WithName(name)
+	if err != nil {
+		return "", false
+	}
+	if tag != "" {
+		if rewritten, err = reference.WithTag(rewritten, tag); err != nil {
+			return "", false
+		}
+	}
+	if d != "" {
+		if rewritten, err = reference.WithDigest(rewritten, d); err != nil {
+			return "", false
+		}
+	}
+	return rewritten.String(), true
+}
+
+// RewriteRepository returns the repository replacing repository, which has no
+// tag or digest, and false if no registry mapping applies to it.
+func (r *ImageRewriter) RewriteRepository(repository string) (string, bool) {
+	named, err := reference.ParseNormalizedNamed(repository)
+	if err != nil || !reference.IsNameOnly(named) {
+		return "", false
+	}
+	return r.mapName(named.Name())
+}
+
+// mapName applies the longest registry mapping matching the normalized name
+// of a repository.
+func (r *ImageRewriter) mapName(name string) (string, bool) {
+	components := strings.Split(name, "/")
+	for i := len(components); i > 0; i-- {
+		if replacement, ok := r.registryMap[strings.Join(components[:i], "/")]; ok {
+			return strings.Join(append([]string{replacement}, components[i:]...), "/"), true
+		}
+	}
+	return name, false
+}
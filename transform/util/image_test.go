@@ -0,0 +1,92 @@
+package util
+
+import (
+	"strings"
+	"testing"
+)
+
+const testDigest = "sha256:0d17b565c37bcbd895e9d92315a05c1c3c9a29f762b011a10c54a66cd53c9b31"
+
+func TestImageRewriterRewrite(t *testing.T) {
+	images, err := NewImageRewriter(
+		map[string]string{
+			"quay.io":                          "registry.example.com",
+			"quay.io/team":                     "registry.example.com/mirror/team",
+			"docker-registry.default.svc:5000": "image-registry.openshift-image-registry.svc:5000",
+		},
+		"registry.example.com/library",
+		map[string]string{
+			"quay.io/foo/app:v1": testDigest,
+			"busybox":            testDigest,
+			"docker.io/foo/bar":  testDigest,
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{image: "quay.io/foo/app:v2", want: "registry.example.com/foo/app:v2"},
+		{image: "quay.io/team/app", want: "registry.example.com/mirror/team/app"},
+		{image: "quay.io/teams/app", want: "registry.example.com/teams/app"},
+		{image: "quay.io/foo/app@" + testDigest, want: "registry.example.com/foo/app@" + testDigest},
+		{image: "quay.io/foo/app:v2@" + testDigest, want: "registry.example.com/foo/app:v2@" + testDigest},
+		{image: "docker-registry.default.svc:5000/shop/web:latest", want: "image-registry.openshift-image-registry.svc:5000/shop/web:latest"},
+		{image: "quay.io/foo/app:v1", want: "registry.example.com/foo/app@" + testDigest},
+		{image: "nginx:1.25", want: "registry.example.com/library/nginx:1.25"},
+		{image: "docker.io/library/nginx", want: "registry.example.com/library/nginx"},
+		{image: "busybox", want: "registry.example.com/library/busybox@" + testDigest},
+		{image: "busybox:latest", want: "registry.example.com/library/busybox@" + testDigest},
+		{image: "foo/bar:latest", want: "docker.io/foo/bar@" + testDigest},
+		{image: "foo/bar:v1"},
+		{image: "gcr.io/foo/app:v1"},
+		{image: "${IMAGE}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			got, ok := images.Rewrite(tt.image)
+			if ok != (tt.want != "") || got != tt.want {
+				t.Errorf("Rewrite() = %q, %v, want %q", got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestImageRewriterRewriteRepository(t *testing.T) {
+	images, err := NewImageRewriter(map[string]string{"quay.io": "registry.example.com"}, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := images.RewriteRepository("quay.io/foo/app"); !ok || got != "registry.example.com/foo/app" {
+		t.Errorf("RewriteRepository() = %q, %v", got, ok)
+	}
+	if got, ok := images.RewriteRepository("quay.io/foo/app:v1"); ok {
+		t.Errorf("RewriteRepository() of a tagged image = %q, %v", got, ok)
+	}
+}
+
+func TestNewImageRewriterErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		registryMap map[string]string
+		library     string
+		digests     map[string]string
+		wantErr     string
+	}{
+		{name: "InvalidReplacement", registryMap: map[string]string{"quay.io": "registry.example.com/Team"}, wantErr: `invalid replacement "registry.example.com/Team"`},
+		{name: "InvalidLibrary", library: "quay.io/a b", wantErr: `of "docker.io/library"`},
+		{name: "InvalidImage", digests: map[string]string{"Nginx": testDigest}, wantErr: `invalid image "Nginx"`},
+		{name: "DigestedImage", digests: map[string]string{"nginx@" + testDigest: testDigest}, wantErr: "already has a digest"},
+		{name: "InvalidDigest", digests: map[string]string{"nginx": "sha256:abc"}, wantErr: `invalid digest "sha256:abc"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewImageRewriter(tt.registryMap, tt.library, tt.digests)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("NewImageRewriter() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -13,6 +13,10 @@ const (
 ]`
 
 )
+
+// UpdateImageRegistry replaces the registry of a fully qualified image.
+//
+// Deprecated: use ImageRewriter, which parses image references.
 func UpdateImageRegistry(registryReplacements map[string]string, oldImageName string) (string, bool) {
 	// Break up oldImage to get the registry URL. Assume all manifests are using fully qualified image paths, if not ignore.
 	imageParts := strings.Split(oldImageName, "/")
@@ -0,0 +1,45 @@
+;; sample.wat is a plugin annotating every object and logging a line.
+;;
+;; Like every plugin, the module reads a request on stdin and writes its
+;; answer on stdout. It answers the metadata request, "{}", with its metadata.
+(module
+  (import "wasi_snapshot_preview1" "fd_read" (func $fd_read (param i32 i32 i32 i32) (result i32)))
+  (import "wasi_snapshot_preview1" "fd_write" (func $fd_write (param i32 i32 i32 i32) (result i32)))
+
+  ;; 0: iovec, 8: bytes read or written, 16: metadata, 1024: response,
+  ;; 2048: log line, 4096: request.
+  (memory (export "memory") 1)
+
+  ;; write writes len bytes at ptr to fd.
+  (func $write (param $fd i32) (param $ptr i32) (param $len i32)
+    (i32.store (i32.const 0) (local.get $ptr))
+    (i32.store (i32.const 4) (local.get $len))
+    (drop (call $fd_write (local.get $fd) (i32.const 0) (i32.const 1) (i32.const 8))))
+
+  ;; read reads stdin at 4096 and returns the number of bytes read.
+  (func $read (result i32)
+    (local $total i32)
+    (block $done
+      (loop $more
+        (i32.store (i32.const 0) (i32.add (i32.const 4096) (local.get $total)))
+        (i32.store (i32.const 4) (i32.sub (i32.const 61440) (local.get $total)))
+        (br_if $done (call $fd_read (i32.const 0) (i32.const 0) (i32.const 1) (i32.const 8)))
+        (br_if $done (i32.eqz (i32.load (i32.const 8))))
+        (local.set $total (i32.add (local.get $total) (i32.load (i32.const 8))))
+        (br $more)))
+    (local.get $total))
+
+  (func (export "_start")
+    (if (i32.le_u (call $read) (i32.const 2))
+      (then
+        (call $write (i32.const 1) (i32.const 16) (i32.const 95))
+        (return)))
+    (call $run))
+
+  (func $run
+    (call $write (i32.const 2) (i32.const 2048) (i32.const 47))
+    (call $write (i32.const 1) (i32.const 1024) (i32.const 154)))
+
+  (data (i32.const 16) "{\"name\":\"WasmSample\",\"version\":\"v1\",\"requestVersion\":[\"v1\",\"v2\"],\"responseVersion\":[\"v1\",\"v2\"]}")
+  (data (i32.const 1024) "{\"patches\":[{\"op\":\"add\",\"path\":\"/metadata/annotations\",\"value\":{\"wasm.crane.konveyor.io/sample\":\"true\"}}],\"warnings\":[\"transformed by the sample module\"]}")
+  (data (i32.const 2048) "{\"level\":\"info\",\"message\":\"sample module ran\"}\n"))
@@ -0,0 +1,301 @@
+package wasm_plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/konveyor/crane-lib/transform"
+	transformerrors "github.com/konveyor/crane-lib/transform/errors"
+	"github.com/konveyor/crane-lib/transform/internal/pluginlimit"
+	"github.com/konveyor/crane-lib/transform/internal/pluginlog"
+	"github.com/sirupsen/logrus"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/experimental"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+const (
+	MetadataRequest string = `{}`
+	// DefaultMaxMemoryBytes bounds the memory of a module when
+	// Options.MaxMemoryBytes is zero.
+	DefaultMaxMemoryBytes uint64 = 256 << 20
+	// DefaultMaxOutputBytes bounds the output of a module when
+	// Options.MaxOutputBytes is zero.
+	DefaultMaxOutputBytes int64 = 64 << 20
+
+	pageSize uint64 = 64 << 10
+	maxPages uint64 = 1 << 16
+)
+
+// WasmPlugin runs a WebAssembly module built for WASI preview 1, for instance
+// with GOOS=wasip1 GOARCH=wasm, in an embedded runtime. Every run gets a new
+// instance of the module, which reads the request on stdin and writes the
+// response on stdout, like a binary plugin. The module has no access to the
+// host filesystem, network or environment.
+type WasmPlugin struct {
+	runtime wazero.Runtime
+	module  wazero.CompiledModule
+	// arg0 is the program name given to the module, like the path of a
+	// binary plugin.
+	arg0           string
+	opts           Options
+	pluginMetadata transform.PluginMetadata
+	log            logrus.FieldLogger
+	// requestVersion and responseVersion are the highest versions supported
+	// by both the plugin and this library.
+	requestVersion  transform.Version
+	responseVersion transform.Version
+}
+
+// Options configures the limits a WASM plugin runs within.
+type Options struct {
+	// MaxMemoryBytes bounds the memory of the module, rounded up to whole
+	// pages of 64KiB. Zero uses DefaultMaxMemoryBytes.
+	MaxMemoryBytes uint64
+	// MaxOutputBytes bounds what a single run of the module may write on
+	// stdout and on stderr. A run writing more is stopped and fails with a
+	// PluginOutputLimitError. Zero uses DefaultMaxOutputBytes.
+	MaxOutputBytes int64
+	// Fuel bounds the number of function calls a single run of the module
+	// may make. A run out of fuel fails with a PluginFuelExhaustedError.
+	// Zero means no limit. Counting the calls slows the module down. Since a
+	// loop making no call burns no fuel, Fuel requires a Timeout.
+	Fuel int64
+	// Timeout bounds every run of the module, including the metadata
+	// request. Zero means no timeout.
+	Timeout time.Duration
+}
+
+// NewWasmPlugin compiles the module at path and asks it for its metadata.
+// The returned plugin is a *WasmPlugin, which must be closed with Close once
+// done.
+func NewWasmPlugin(path string, logger *logrus.Logger, opts Options) (transform.Plugin, error) {
+	log := logger.WithField(pluginlog.FieldPluginPath, path)
+	if opts.Fuel > 0 && opts.Timeout <= 0 {
+		return nil, fmt.Errorf("the fuel of the plugin requires a timeout")
+	}
+	wasm, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the plugin module: %w", err)
+	}
+
+	ctx := context.Background()
+	runtime := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(opts.memoryLimitPages()).
+		WithCloseOnContextDone(true))
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, runtime); err != nil {
+		runtime.Close(ctx)
+		return nil, fmt.Errorf("unable to set up the plugin runtime: %w", err)
+	}
+	compileCtx := ctx
+	if opts.Fuel > 0 {
+		compileCtx = experimental.WithFunctionListenerFactory(ctx, fuelMeter{})
+	}
+	module, err := runtime.CompileModule(compileCtx, wasm)
+	if err != nil {
+		runtime.Close(ctx)
+		return nil, fmt.Errorf("unable to compile the plugin module: %w", err)
+	}
+
+	w := &WasmPlugin{
+		runtime: runtime,
+		module:  module,
+		arg0:    filepath.Base(path),
+		opts:    opts,
+		log:     log,
+	}
+	out, logBytes, err := w.run(ctx, []byte(MetadataRequest))
+	w.logOutput(log, logBytes)
+	if err != nil {
+		runtime.Close(ctx)
+		log.Errorf("error running the plugin metadata request")
+		return nil, fmt.Errorf("error running the plugin metadata request: %w", err)
+	}
+
+	metadata := transform.PluginMetadata{}
+	err = json.Unmarshal(out, &metadata)
+	if err != nil {
+		runtime.Close(ctx)
+		log.Errorf("unable to decode json sent by the plugin")
+		return nil, fmt.Errorf("unable to decode metadata sent by the plugin: %s, err: %v", string(out), err)
+	}
+
+	requestVersion, requestOk := transform.NegotiateVersion(metadata.RequestVersion)
+	responseVersion, responseOk := transform.NegotiateVersion(metadata.ResponseVersion)
+	if !requestOk || !responseOk {
+		runtime.Close(ctx)
+		return nil, fmt.Errorf("invalid versions supported by plugin defined by caller responseVersions: %v, requestVersions: %v", metadata.ResponseVersion, metadata.RequestVersion)
+	}
+	log.Debugf("using request version %v and response version %v", requestVersion, responseVersion)
+
+	w.pluginMetadata = metadata
+	w.requestVersion = requestVersion
+	w.responseVersion = responseVersion
+	return w, nil
+}
+
+func (w *WasmPlugin) Run(request transform.PluginRequest) (transform.PluginResponse, error) {
+	return w.RunWithContext(context.Background(), request)
+}
+
+// RunWithContext runs the module on request, stopping it when ctx is done.
+func (w *WasmPlugin) RunWithContext(ctx context.Context, request transform.PluginRequest) (transform.PluginResponse, error) {
+	p := transform.PluginResponse{}
+
+	log := w.log.WithFields(pluginlog.ObjectFields(w.pluginMetadata.Name, request))
+	input, err := json.Marshal(request.ForPlugin(w.requestVersion, w.pluginMetadata))
+	if err != nil {
+		log.Errorf("unable to marshal unstructured Object")
+		return p, fmt.Errorf("unable to marshal unstructured Object: %s, err: %v", request.GetName(), err)
+	}
+	out, logBytes, err := w.run(ctx, input)
+	// The logs tell why the plugin failed, so they are kept in any case.
+	w.logOutput(log, logBytes)
+	if err != nil {
+		log.Errorf("error running the plugin module")
+		return p, fmt.Errorf("error running the plugin module: %w", err)
+	}
+
+	err = json.Unmarshal(out, &p)
+	if err != nil {
+		log.Errorf("unable to decode json sent by the plugin")
+		return p, fmt.Errorf("unable to decode object sent by the plugin: %s, err: %v", string(out), err)
+	}
+	if w.responseVersion == transform.V1 {
+		// V1 responses have no warnings, annotations or renames.
+		p.Warnings = nil
+		p.Annotations = nil
+		p.Renames = nil
+	}
+	return p, nil
+}
+
+func (w *WasmPlugin) Metadata() transform.PluginMetadata {
+	return w.pluginMetadata
+}
+
+// Close releases the runtime of the plugin.
+func (w *WasmPlugin) Close() error {
+	return w.runtime.Close(context.Background())
+}
+
+func (w *WasmPlugin) logOutput(log logrus.FieldLogger, logBytes []byte) {
+	if len(logBytes) == 0 {
+		return
+	}
+	for _, line := range strings.Split(string(logBytes), "\n") {
+		pluginlog.Output(log, line)
+	}
+}
+
+// run runs a new instance of the module with input on stdin, within the
+// limits of the options, and returns its stdout and stderr.
+func (w *WasmPlugin) run(ctx context.Context, input []byte) ([]byte, []byte, error) {
+	runCtx, cancel := pluginlimit.WithTimeout(ctx, w.opts.Timeout)
+	defer cancel()
+	fuel := w.opts.Fuel
+	runCtx = context.WithValue(runCtx, fuelKey{}, &fuel)
+
+	// Going over the output limit stops the run.
+	maxOutput := w.opts.maxOutputBytes()
+	stdout, stderr := pluginlimit.NewBuffer(maxOutput, cancel), pluginlimit.NewBuffer(maxOutput, cancel)
+	// Without any mount, socket or environment variable configured, the
+	// module only sees its standard streams.
+	config := wazero.NewModuleConfig().
+		WithName("").
+		WithArgs(w.arg0).
+		WithStdin(bytes.NewReader(input)).
+		WithStdout(stdout).
+		WithStderr(stderr)
+	instance, err := w.runtime.InstantiateModule(runCtx, w.module, config)
+	if instance != nil {
+		instance.Close(context.Background())
+	}
+	switch {
+	case stdout.Exceeded():
+		return nil, stderr.Bytes(), pluginlimit.OutputError(maxOutput, "stdout")
+	case stderr.Exceeded():
+		return nil, stderr.Bytes(), pluginlimit.OutputError(maxOutput, "stderr")
+	}
+	if err == nil {
+		return stdout.Bytes(), stderr.Bytes(), nil
+	}
+
+	if limitErr := pluginlimit.Error(ctx, runCtx, w.opts.Timeout); limitErr != nil {
+		return nil, stderr.Bytes(), limitErr
+	}
+	if errors.Is(err, errOutOfFuel) {
+		return nil, stderr.Bytes(), &transformerrors.PluginError{
+			Type:         transformerrors.PluginFuelExhaustedError,
+			Message:      "plugin ran out of fuel",
+			ErrorMessage: fmt.Sprintf("more than %d function calls", w.opts.Fuel),
+		}
+	}
+	exitErr := &sys.ExitError{}
+	if errors.As(err, &exitErr) {
+		if exitErr.ExitCode() == 0 {
+			return stdout.Bytes(), stderr.Bytes(), nil
+		}
+		return nil, stderr.Bytes(), fmt.Errorf("plugin module exited with code %d", exitErr.ExitCode())
+	}
+	return nil, stderr.Bytes(), err
+}
+
+// maxOutputBytes returns the output limit of the options.
+func (o Options) maxOutputBytes() int64 {
+	if o.MaxOutputBytes <= 0 {
+		return DefaultMaxOutputBytes
+	}
+	return o.MaxOutputBytes
+}
+
+// memoryLimitPages returns the memory limit of the options in pages.
+func (o Options) memoryLimitPages() uint32 {
+	max := o.MaxMemoryBytes
+	if max == 0 {
+		max = DefaultMaxMemoryBytes
+	}
+	pages := (max + pageSize - 1) / pageSize
+	if pages > maxPages {
+		pages = maxPages
+	}
+	return uint32(pages)
+}
+
+var errOutOfFuel = errors.New("out of fuel")
+
+// fuelKey holds the fuel left to a run of the module, as an *int64.
+type fuelKey struct{}
+
+// fuelMeter burns one unit of fuel per function call, and aborts the run
+// once there is none left.
+type fuelMeter struct{}
+
+func (fuelMeter) NewFunctionListener(api.FunctionDefinition) experimental.FunctionListener {
+	return fuelMeter{}
+}
+
+func (fuelMeter) Before(ctx context.Context, _ api.Module, _ api.FunctionDefinition, _ []uint64, _ experimental.StackIterator) {
+	fuel, ok := ctx.Value(fuelKey{}).(*int64)
+	if !ok {
+		return
+	}
+	*fuel--
+	if *fuel < 0 {
+		// The runtime recovers the panic and fails the run with it.
+		panic(errOutOfFuel)
+	}
+}
+
+func (fuelMeter) After(context.Context, api.Module, api.FunctionDefinition, []uint64) {}
+
+func (fuelMeter) Abort(context.Context, api.Module, api.FunctionDefinition, error) {}
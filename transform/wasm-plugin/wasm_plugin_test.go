@@ -0,0 +1,188 @@
+package wasm_plugin
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/konveyor/crane-lib/transform"
+	transformerrors "github.com/konveyor/crane-lib/transform/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// The modules in testdata are written in the .wat file of the same name.
+
+func newTestPlugin(t *testing.T, module string, logger *logrus.Logger, opts Options) *WasmPlugin {
+	t.Helper()
+	if logger == nil {
+		logger = logrus.New()
+	}
+	plugin, err := NewWasmPlugin("testdata/"+module+".wasm", logger, opts)
+	if err != nil {
+		t.Fatalf("NewWasmPlugin() error = %v", err)
+	}
+	w := plugin.(*WasmPlugin)
+	t.Cleanup(func() { w.Close() })
+	return w
+}
+
+func testRequest() transform.PluginRequest {
+	return transform.PluginRequest{Unstructured: unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata": map[string]interface{}{
+			"name":      "foo",
+			"namespace": "bar",
+		},
+	}}}
+}
+
+func TestNewWasmPlugin(t *testing.T) {
+	w := newTestPlugin(t, "sample", nil, Options{})
+	if w.Metadata().Name != "WasmSample" {
+		t.Errorf("Metadata().Name = %q, want WasmSample", w.Metadata().Name)
+	}
+	if w.requestVersion != transform.V2 || w.responseVersion != transform.V2 {
+		t.Errorf("negotiated %v and %v, want v2", w.requestVersion, w.responseVersion)
+	}
+
+	if _, err := NewWasmPlugin("testdata/missing.wasm", logrus.New(), Options{}); err == nil {
+		t.Errorf("NewWasmPlugin() expected an error for a missing module")
+	}
+	if _, err := NewWasmPlugin("testdata/sample.wat", logrus.New(), Options{}); err == nil {
+		t.Errorf("NewWasmPlugin() expected an error for an invalid module")
+	}
+}
+
+func TestWasmPluginRun(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	w := newTestPlugin(t, "sample", logger, Options{})
+
+	resp, err := w.Run(testRequest())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if len(resp.Patches) != 1 {
+		t.Fatalf("Run() returned %d patches, want 1", len(resp.Patches))
+	}
+	if path, _ := resp.Patches[0].Path(); path != "/metadata/annotations" {
+		t.Errorf("Run() patched %q, want /metadata/annotations", path)
+	}
+	if !reflect.DeepEqual(resp.Warnings, []string{"transformed by the sample module"}) {
+		t.Errorf("Run() warnings = %v", resp.Warnings)
+	}
+
+	entries := hook.AllEntries()
+	if len(entries) != 1 || entries[0].Message != "sample module ran" {
+		t.Fatalf("Run() did not log the plugin output: %v", entries)
+	}
+	want := logrus.Fields{
+		"pluginPath": "testdata/sample.wasm",
+		"plugin":     "WasmSample",
+		"kind":       "Pod",
+		"namespace":  "bar",
+		"name":       "foo",
+	}
+	if !reflect.DeepEqual(entries[0].Data, want) {
+		t.Errorf("Run() logged fields %v, want %v", entries[0].Data, want)
+	}
+}
+
+func TestWasmPluginRunV1(t *testing.T) {
+	w := newTestPlugin(t, "sample", nil, Options{})
+	w.responseVersion = transform.V1
+	resp, err := w.Run(testRequest())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if resp.Warnings != nil {
+		t.Errorf("Run() kept the warnings of a V1 response: %v", resp.Warnings)
+	}
+}
+
+func TestWasmPluginMemoryLimit(t *testing.T) {
+	// The module grows its memory by 16 pages and traps if it can not.
+	w := newTestPlugin(t, "grow", nil, Options{MaxMemoryBytes: 4 * pageSize})
+	if _, err := w.Run(testRequest()); err == nil {
+		t.Errorf("Run() expected an error past the memory limit")
+	}
+
+	w = newTestPlugin(t, "grow", nil, Options{})
+	if _, err := w.Run(testRequest()); err != nil {
+		t.Errorf("Run() error = %v within the default memory limit", err)
+	}
+}
+
+func TestWasmPluginFuel(t *testing.T) {
+	// The module calls a function in an endless loop.
+	w := newTestPlugin(t, "loop", nil, Options{Fuel: 1000, Timeout: time.Minute})
+	_, err := w.Run(testRequest())
+	if !transformerrors.IsFuelExhaustedError(err) {
+		t.Errorf("Run() error = %v, want a fuel exhausted error", err)
+	}
+
+	// The fuel is per run.
+	if _, err := w.Run(testRequest()); !transformerrors.IsFuelExhaustedError(err) {
+		t.Errorf("Run() error = %v, want a fuel exhausted error", err)
+	}
+
+	// The module spins in a loop without calls, which burns no fuel.
+	w = newTestPlugin(t, "spin", nil, Options{Fuel: 1000, Timeout: 100 * time.Millisecond})
+	if _, err := w.Run(testRequest()); !transformerrors.IsTimeoutError(err) {
+		t.Errorf("Run() error = %v, want a timeout error", err)
+	}
+	if _, err := NewWasmPlugin("testdata/spin.wasm", logrus.New(), Options{Fuel: 1000}); err == nil {
+		t.Errorf("NewWasmPlugin() expected an error for fuel without a timeout")
+	}
+}
+
+func TestWasmPluginTimeout(t *testing.T) {
+	w := newTestPlugin(t, "loop", nil, Options{Timeout: 100 * time.Millisecond})
+	_, err := w.Run(testRequest())
+	if !transformerrors.IsTimeoutError(err) {
+		t.Errorf("Run() error = %v, want a timeout error", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	w = newTestPlugin(t, "loop", nil, Options{})
+	if _, err := w.RunWithContext(ctx, testRequest()); err == nil || transformerrors.IsTimeoutError(err) {
+		t.Errorf("RunWithContext() error = %v, want the error of the context", err)
+	}
+}
+
+func TestWasmPluginOutputLimit(t *testing.T) {
+	// The module writes 60KiB chunks to stdout in an endless loop.
+	w := newTestPlugin(t, "flood", nil, Options{MaxOutputBytes: 1 << 20, Timeout: time.Minute})
+	_, err := w.Run(testRequest())
+	if !transformerrors.IsOutputLimitError(err) {
+		t.Errorf("Run() error = %v, want an output limit error", err)
+	}
+
+	w = newTestPlugin(t, "flood", nil, Options{Timeout: time.Minute})
+	if _, err := w.Run(testRequest()); !transformerrors.IsOutputLimitError(err) {
+		t.Errorf("Run() error = %v, want an output limit error within the default limit", err)
+	}
+}
+
+func TestOptionsMemoryLimitPages(t *testing.T) {
+	tests := []struct {
+		name string
+		max  uint64
+		want uint32
+	}{
+		{name: "Default", max: 0, want: uint32(DefaultMaxMemoryBytes / pageSize)},
+		{name: "RoundedUp", max: pageSize + 1, want: 2},
+		{name: "Capped", max: 1 << 40, want: uint32(maxPages)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (Options{MaxMemoryBytes: tt.max}).memoryLimitPages(); got != tt.want {
+				t.Errorf("memoryLimitPages() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}